@@ -154,7 +154,7 @@ async function main() {
 			const hashValue = fileName.split('.')[0];
 
 			console.log('\n--> Submit Transaction: store file tree');
-			await contract.submitTransaction('StoreFileTree', hashValue, jsonString);
+			await contract.submitTransaction('StoreFileTree', hashValue, jsonString, '');
 			console.log(`*** committed`);
 
 
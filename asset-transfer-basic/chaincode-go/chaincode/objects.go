@@ -0,0 +1,386 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/schema"
+)
+
+// Buckets and objects map the names of the S3 gateway of my-application to
+// stored files. A bucket lives under bucket~name and an object under
+// object~bucket~key, so the objects of a bucket are listed in key order.
+const bucketObjectType = "bucket"
+const objectObjectType = "object"
+
+// Events of the S3 gateway.
+const (
+	PutObjectEvent    = schema.PutObjectEvent
+	DeleteObjectEvent = schema.DeleteObjectEvent
+)
+
+// maxListKeys is the largest page of ListObjects, as in S3.
+const maxListKeys = 1000
+
+// validateBucketName applies the naming rules of S3: 3 to 63 lowercase
+// letters, digits, dots and hyphens, starting and ending with a letter or
+// digit.
+func validateBucketName(name string) error {
+	if len(name) < 3 || len(name) > 63 {
+		return fmt.Errorf("invalid bucket name %q: must be 3 to 63 characters long", name)
+	}
+	for i, c := range name {
+		alnum := (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9')
+		if !alnum && ((c != '.' && c != '-') || i == 0 || i == len(name)-1) {
+			return fmt.Errorf("invalid bucket name %q", name)
+		}
+	}
+	return nil
+}
+
+// validateKey checks that an object key is at most 1024 bytes of UTF-8 that
+// a composite key can hold.
+func validateKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("object key must not be empty")
+	}
+	if len(key) > 1024 {
+		return fmt.Errorf("object key is longer than 1024 bytes")
+	}
+	if !utf8.ValidString(key) || strings.ContainsAny(key, "\x00\U0010FFFF") {
+		return fmt.Errorf("invalid object key %q", key)
+	}
+	return nil
+}
+
+// CreateBucket creates an empty bucket owned by the MSP of the client.
+func (s *SmartContract) CreateBucket(ctx contractapi.TransactionContextInterface, name string) error {
+	err := validateBucketName(name)
+	if err != nil {
+		return err
+	}
+
+	existing, err := getBucket(ctx, name)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("bucket %s already exists", name)
+	}
+
+	owner, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client MSP ID: %v", err)
+	}
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+
+	bucket := Bucket{
+		Name:      name,
+		Owner:     owner,
+		CreatedAt: timestamp.AsTime().UTC().Format(time.RFC3339),
+	}
+	return putJSON(ctx, bucketObjectType, []string{name}, "bucket", bucket)
+}
+
+// DeleteBucket deletes an empty bucket.
+func (s *SmartContract) DeleteBucket(ctx contractapi.TransactionContextInterface, name string) error {
+	bucket, err := getOwnedBucket(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(objectObjectType, []string{bucket.Name})
+	if err != nil {
+		return fmt.Errorf("failed to read objects from state: %v", err)
+	}
+	defer resultsIterator.Close()
+	if resultsIterator.HasNext() {
+		return fmt.Errorf("bucket %s is not empty", name)
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(bucketObjectType, []string{name})
+	if err != nil {
+		return fmt.Errorf("failed to create bucket key: %v", err)
+	}
+	err = ctx.GetStub().DelState(key)
+	if err != nil {
+		return fmt.Errorf("failed to delete bucket from state: %v", err)
+	}
+	return nil
+}
+
+// GetBucket returns a bucket, or nothing when it does not exist.
+func (s *SmartContract) GetBucket(ctx contractapi.TransactionContextInterface, name string) (*Bucket, error) {
+	return getBucket(ctx, name)
+}
+
+// ListBuckets returns every bucket in the order of their names.
+func (s *SmartContract) ListBuckets(ctx contractapi.TransactionContextInterface) ([]*Bucket, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(bucketObjectType, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read buckets from state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	buckets := make([]*Bucket, 0)
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var bucket Bucket
+		err = json.Unmarshal(queryResponse.Value, &bucket)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal bucket: %v", err)
+		}
+		buckets = append(buckets, &bucket)
+	}
+	return buckets, nil
+}
+
+// PutObject maps a key of a bucket to a stored file, replacing the object
+// the key mapped to. objectJSON is an ObjectInput whose size must be the size
+// of the file. The file cannot be deleted while an object maps to it.
+func (s *SmartContract) PutObject(ctx contractapi.TransactionContextInterface, bucketName string, key string, objectJSON string) error {
+	bucket, err := getOwnedBucket(ctx, bucketName)
+	if err != nil {
+		return err
+	}
+	err = validateKey(key)
+	if err != nil {
+		return err
+	}
+
+	var input ObjectInput
+	err = decodeStrict(objectJSON, &input)
+	if err != nil {
+		return fmt.Errorf("invalid object: %v", err)
+	}
+	err = validateFileHash(input.FileHash)
+	if err != nil {
+		return err
+	}
+
+	header, err := getFileTreeHeader(ctx, input.FileHash)
+	if err != nil {
+		return err
+	}
+	if header == nil || !header.Complete {
+		return fmt.Errorf("file %s does not exist", input.FileHash)
+	}
+	if header.FileSize != input.Size {
+		return fmt.Errorf("object of %d bytes stored as file %s of %d bytes", input.Size, input.FileHash, header.FileSize)
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+
+	previous, err := getObject(ctx, bucket.Name, key)
+	if err != nil {
+		return err
+	}
+	if previous != nil {
+		err = removeReferrer(ctx, previous.FileHash, objectReferrer, bucket.Name, key)
+		if err != nil {
+			return err
+		}
+	}
+	err = addReferrer(ctx, input.FileHash, objectReferrer, bucket.Name, key)
+	if err != nil {
+		return err
+	}
+
+	object := Object{
+		Bucket:       bucket.Name,
+		Key:          key,
+		FileHash:     input.FileHash,
+		Size:         input.Size,
+		ETag:         input.ETag,
+		ContentType:  input.ContentType,
+		Metadata:     input.Metadata,
+		LastModified: timestamp.AsTime().UTC().Format(time.RFC3339),
+	}
+	err = putJSON(ctx, objectObjectType, []string{bucket.Name, key}, "object", object)
+	if err != nil {
+		return err
+	}
+
+	return setEvent(ctx, PutObjectEvent, ObjectEvent{Bucket: bucket.Name, Key: key, FileHash: input.FileHash})
+}
+
+// GetObject returns an object, or nothing when the key maps to none.
+func (s *SmartContract) GetObject(ctx contractapi.TransactionContextInterface, bucketName string, key string) (*Object, error) {
+	return getObject(ctx, bucketName, key)
+}
+
+// DeleteObject removes the mapping of a key. Like in S3, deleting a key that
+// maps to no object succeeds. The file stays stored, the gateway deletes it
+// once no object or ref points to it.
+func (s *SmartContract) DeleteObject(ctx contractapi.TransactionContextInterface, bucketName string, key string) error {
+	bucket, err := getOwnedBucket(ctx, bucketName)
+	if err != nil {
+		return err
+	}
+
+	object, err := getObject(ctx, bucket.Name, key)
+	if err != nil {
+		return err
+	}
+	if object == nil {
+		return nil
+	}
+
+	objectKey, err := ctx.GetStub().CreateCompositeKey(objectObjectType, []string{bucket.Name, key})
+	if err != nil {
+		return fmt.Errorf("failed to create object key: %v", err)
+	}
+	err = ctx.GetStub().DelState(objectKey)
+	if err != nil {
+		return fmt.Errorf("failed to delete object from state: %v", err)
+	}
+	err = removeReferrer(ctx, object.FileHash, objectReferrer, bucket.Name, key)
+	if err != nil {
+		return err
+	}
+
+	return setEvent(ctx, DeleteObjectEvent, ObjectEvent{Bucket: bucket.Name, Key: key, FileHash: object.FileHash})
+}
+
+// ListObjects returns up to maxKeys objects of a bucket whose keys start with
+// prefix and sort after startAfter, in key order. Grouping keys by a
+// delimiter is left to the gateway, which continues after a common prefix.
+func (s *SmartContract) ListObjects(ctx contractapi.TransactionContextInterface, bucketName string, prefix string, startAfter string, maxKeys int) (*ObjectPage, error) {
+	if maxKeys <= 0 || maxKeys > maxListKeys {
+		return nil, fmt.Errorf("maxKeys must be between 1 and %d", maxListKeys)
+	}
+	bucket, err := getBucket(ctx, bucketName)
+	if err != nil {
+		return nil, err
+	}
+	if bucket == nil {
+		return nil, fmt.Errorf("bucket %s does not exist", bucketName)
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(objectObjectType, []string{bucketName})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read objects from state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	// Composite keys sort like the object keys, which hold no 0x00 byte
+	page := &ObjectPage{Objects: make([]*Object, 0)}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split object key: %v", err)
+		}
+		key := attributes[1]
+		if key <= startAfter || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if len(page.Objects) == maxKeys {
+			page.IsTruncated = true
+			break
+		}
+
+		var object Object
+		err = json.Unmarshal(queryResponse.Value, &object)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal object: %v", err)
+		}
+		page.Objects = append(page.Objects, &object)
+	}
+	return page, nil
+}
+
+func getBucket(ctx contractapi.TransactionContextInterface, name string) (*Bucket, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(bucketObjectType, []string{name})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bucket key: %v", err)
+	}
+	bucketJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bucket from state: %v", err)
+	}
+	if bucketJSON == nil {
+		return nil, nil
+	}
+
+	var bucket Bucket
+	err = json.Unmarshal(bucketJSON, &bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal bucket: %v", err)
+	}
+	return &bucket, nil
+}
+
+// getOwnedBucket returns a bucket the client may change.
+func getOwnedBucket(ctx contractapi.TransactionContextInterface, name string) (*Bucket, error) {
+	bucket, err := getBucket(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if bucket == nil {
+		return nil, fmt.Errorf("bucket %s does not exist", name)
+	}
+
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client MSP ID: %v", err)
+	}
+	if mspID != bucket.Owner {
+		return nil, fmt.Errorf("bucket %s is owned by %s", name, bucket.Owner)
+	}
+	return bucket, nil
+}
+
+func getObject(ctx contractapi.TransactionContextInterface, bucketName string, key string) (*Object, error) {
+	objectKey, err := ctx.GetStub().CreateCompositeKey(objectObjectType, []string{bucketName, key})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create object key: %v", err)
+	}
+	objectJSON, err := ctx.GetStub().GetState(objectKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object from state: %v", err)
+	}
+	if objectJSON == nil {
+		return nil, nil
+	}
+
+	var object Object
+	err = json.Unmarshal(objectJSON, &object)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal object: %v", err)
+	}
+	return &object, nil
+}
+
+// putJSON stores v under the composite key of objectType and attributes.
+func putJSON(ctx contractapi.TransactionContextInterface, objectType string, attributes []string, kind string, v interface{}) error {
+	key, err := ctx.GetStub().CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return fmt.Errorf("failed to create %s key: %v", kind, err)
+	}
+	value, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %v", kind, err)
+	}
+	err = ctx.GetStub().PutState(key, value)
+	if err != nil {
+		return fmt.Errorf("failed to put %s in state: %v", kind, err)
+	}
+	return nil
+}
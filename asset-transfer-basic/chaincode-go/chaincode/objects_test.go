@@ -0,0 +1,210 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func objectJSON(t *testing.T, fileHash string, size int64) string {
+	return marshal(t, chaincode.ObjectInput{FileHash: fileHash, Size: size, ETag: `"etag"`, ContentType: "text/plain"})
+}
+
+func TestBuckets(t *testing.T) {
+	transactionContext, _, _ := newWorldState()
+	storage := chaincode.SmartContract{}
+
+	for _, name := range []string{"ab", "Photos", "-photos", "photos-", "pho_tos"} {
+		require.ErrorContains(t, storage.CreateBucket(transactionContext, name), "invalid bucket name", name)
+	}
+
+	require.NoError(t, storage.CreateBucket(transactionContext, "photos"))
+	require.NoError(t, storage.CreateBucket(transactionContext, "backups.2023"))
+	require.EqualError(t, storage.CreateBucket(transactionContext, "photos"), "bucket photos already exists")
+
+	bucket, err := storage.GetBucket(transactionContext, "photos")
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.Bucket{Name: "photos", Owner: "Org1MSP", CreatedAt: "2023-05-01T12:00:00Z"}, bucket)
+	bucket, err = storage.GetBucket(transactionContext, "missing")
+	require.NoError(t, err)
+	require.Nil(t, bucket)
+
+	buckets, err := storage.ListBuckets(transactionContext)
+	require.NoError(t, err)
+	require.Len(t, buckets, 2)
+	require.Equal(t, "backups.2023", buckets[0].Name)
+
+	fileHash := testHash("file")
+	_, err = storage.StoreFileTree(transactionContext, fileHash, marshal(t, testFileTree(fileHash, 1)), "")
+	require.NoError(t, err)
+	require.NoError(t, storage.PutObject(transactionContext, "photos", "cat.jpg", objectJSON(t, fileHash, 12288)))
+	require.EqualError(t, storage.DeleteBucket(transactionContext, "photos"), "bucket photos is not empty")
+
+	// Only the owner MSP deletes the bucket
+	transactionContext.GetClientIdentityReturns(clientIdentity{id: "x509::CN=User1@org2.example.com", mspID: "Org2MSP"})
+	require.EqualError(t, storage.DeleteBucket(transactionContext, "backups.2023"), "bucket backups.2023 is owned by Org1MSP")
+	transactionContext.GetClientIdentityReturns(user1)
+	require.NoError(t, storage.DeleteBucket(transactionContext, "backups.2023"))
+	require.EqualError(t, storage.DeleteBucket(transactionContext, "backups.2023"), "bucket backups.2023 does not exist")
+}
+
+func TestPutObject(t *testing.T) {
+	transactionContext, chaincodeStub, _ := newWorldState()
+	storage := chaincode.SmartContract{}
+	require.NoError(t, storage.CreateBucket(transactionContext, "photos"))
+
+	fileHash := testHash("file")
+	err := storage.PutObject(transactionContext, "photos", "cat.jpg", objectJSON(t, fileHash, 12288))
+	require.EqualError(t, err, "file "+fileHash+" does not exist")
+
+	_, err = storage.StoreFileTree(transactionContext, fileHash, marshal(t, testFileTree(fileHash, 1)), "")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		bucket string
+		key    string
+		object string
+		err    string
+	}{
+		{"missing bucket", "videos", "cat.jpg", objectJSON(t, fileHash, 12288), "bucket videos does not exist"},
+		{"empty key", "photos", "", objectJSON(t, fileHash, 12288), "object key must not be empty"},
+		{"key with a null byte", "photos", "cat\x00.jpg", objectJSON(t, fileHash, 12288), "invalid object key"},
+		{"other size", "photos", "cat.jpg", objectJSON(t, fileHash, 100), "object of 100 bytes stored as file " + fileHash + " of 12288 bytes"},
+		{"unknown field", "photos", "cat.jpg", `{"fileHash":"` + fileHash + `","owner":"me"}`, `unknown field "owner"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := storage.PutObject(transactionContext, test.bucket, test.key, test.object)
+			require.ErrorContains(t, err, test.err)
+		})
+	}
+
+	require.NoError(t, storage.PutObject(transactionContext, "photos", "cat.jpg", objectJSON(t, fileHash, 12288)))
+	eventName, payload := chaincodeStub.SetEventArgsForCall(chaincodeStub.SetEventCallCount() - 1)
+	require.Equal(t, chaincode.PutObjectEvent, eventName)
+	require.JSONEq(t, `{"bucket":"photos","key":"cat.jpg","fileHash":"`+fileHash+`"}`, string(payload))
+
+	object, err := storage.GetObject(transactionContext, "photos", "cat.jpg")
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.Object{
+		Bucket:       "photos",
+		Key:          "cat.jpg",
+		FileHash:     fileHash,
+		Size:         12288,
+		ETag:         `"etag"`,
+		ContentType:  "text/plain",
+		LastModified: "2023-05-01T12:00:00Z",
+	}, object)
+
+	transactionContext.GetClientIdentityReturns(clientIdentity{id: "x509::CN=User1@org2.example.com", mspID: "Org2MSP"})
+	err = storage.PutObject(transactionContext, "photos", "dog.jpg", objectJSON(t, fileHash, 12288))
+	require.EqualError(t, err, "bucket photos is owned by Org1MSP")
+	require.EqualError(t, storage.DeleteObject(transactionContext, "photos", "cat.jpg"), "bucket photos is owned by Org1MSP")
+	transactionContext.GetClientIdentityReturns(user1)
+
+	require.NoError(t, storage.DeleteObject(transactionContext, "photos", "cat.jpg"))
+	object, err = storage.GetObject(transactionContext, "photos", "cat.jpg")
+	require.NoError(t, err)
+	require.Nil(t, object)
+	// Deleting a missing key succeeds like in S3
+	require.NoError(t, storage.DeleteObject(transactionContext, "photos", "cat.jpg"))
+
+	// The file stays stored
+	_, err = storage.GetFileTreeHeader(transactionContext, fileHash)
+	require.NoError(t, err)
+}
+
+func TestListObjects(t *testing.T) {
+	transactionContext, _, _ := newWorldState()
+	storage := chaincode.SmartContract{}
+	require.NoError(t, storage.CreateBucket(transactionContext, "photos"))
+	require.NoError(t, storage.CreateBucket(transactionContext, "photos2"))
+
+	fileHash := testHash("file")
+	_, err := storage.StoreFileTree(transactionContext, fileHash, marshal(t, testFileTree(fileHash, 1)), "")
+	require.NoError(t, err)
+	for _, key := range []string{"b", "a/2", "a", "a/1", "c/x"} {
+		require.NoError(t, storage.PutObject(transactionContext, "photos", key, objectJSON(t, fileHash, 12288)))
+	}
+	require.NoError(t, storage.PutObject(transactionContext, "photos2", "a/0", objectJSON(t, fileHash, 12288)))
+
+	keys := func(page *chaincode.ObjectPage) []string {
+		keys := []string{}
+		for _, object := range page.Objects {
+			keys = append(keys, object.Key)
+		}
+		return keys
+	}
+
+	tests := []struct {
+		name       string
+		prefix     string
+		startAfter string
+		maxKeys    int
+		keys       []string
+		truncated  bool
+	}{
+		{"all", "", "", 1000, []string{"a", "a/1", "a/2", "b", "c/x"}, false},
+		{"first page", "", "", 2, []string{"a", "a/1"}, true},
+		{"next page", "", "a/1", 2, []string{"a/2", "b"}, true},
+		{"last page", "", "b", 2, []string{"c/x"}, false},
+		{"prefix", "a/", "", 1000, []string{"a/1", "a/2"}, false},
+		{"prefix after", "a/", "a/1", 1000, []string{"a/2"}, false},
+		{"no match", "d", "", 1000, []string{}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			page, err := storage.ListObjects(transactionContext, "photos", test.prefix, test.startAfter, test.maxKeys)
+			require.NoError(t, err)
+			require.Equal(t, test.keys, keys(page))
+			require.Equal(t, test.truncated, page.IsTruncated)
+		})
+	}
+
+	_, err = storage.ListObjects(transactionContext, "photos", "", "", 1001)
+	require.EqualError(t, err, "maxKeys must be between 1 and 1000")
+	_, err = storage.ListObjects(transactionContext, "videos", "", "", 10)
+	require.EqualError(t, err, "bucket videos does not exist")
+}
+
+func TestReferencedFiles(t *testing.T) {
+	transactionContext, chaincodeStub, _ := newWorldState()
+	storage := chaincode.SmartContract{}
+	require.NoError(t, storage.CreateBucket(transactionContext, "photos"))
+
+	fileHash, other := testHash("file"), testHash("other")
+	metadata := `{"tags":[],"contentType":"text/plain","expireAt":"2023-05-02T00:00:00Z"}`
+	for _, hash := range []string{fileHash, other} {
+		_, err := storage.StoreFileTree(transactionContext, hash, marshal(t, testFileTree(hash, 1)), metadata)
+		require.NoError(t, err)
+	}
+	require.NoError(t, storage.PutObject(transactionContext, "photos", "cat.jpg", objectJSON(t, fileHash, 12288)))
+	_, err := storage.SetRef(transactionContext, "cat", fileHash)
+	require.NoError(t, err)
+
+	// Neither an object nor a ref may be left pointing to a deleted file
+	_, err = storage.DeleteFileTree(transactionContext, fileHash)
+	require.EqualError(t, err, "file "+fileHash+" is referenced by object photos/cat.jpg")
+	setTxTime(chaincodeStub, 2)
+	expired, err := storage.ListExpiredFiles(transactionContext, 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{other}, expired)
+	_, err = storage.ExpireFile(transactionContext, fileHash)
+	require.ErrorContains(t, err, "is referenced by")
+
+	// Overwriting the key moves its reference to the new file
+	require.NoError(t, storage.PutObject(transactionContext, "photos", "cat.jpg", objectJSON(t, other, 12288)))
+	_, err = storage.DeleteFileTree(transactionContext, fileHash)
+	require.EqualError(t, err, "file "+fileHash+" is referenced by ref cat")
+	_, err = storage.SetRef(transactionContext, "cat", other)
+	require.NoError(t, err)
+	_, err = storage.DeleteFileTree(transactionContext, fileHash)
+	require.NoError(t, err)
+
+	require.NoError(t, storage.DeleteObject(transactionContext, "photos", "cat.jpg"))
+	require.NoError(t, storage.DeleteRef(transactionContext, "cat"))
+	_, err = storage.ExpireFile(transactionContext, other)
+	require.NoError(t, err)
+}
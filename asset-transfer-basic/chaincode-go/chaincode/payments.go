@@ -0,0 +1,726 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/schema"
+)
+
+// Storage may be paid for in the tokens of the ERC-20 chaincode of
+// token-erc-20/chaincode-go, installed on the same channel. Storing a file
+// moves the price of keeping it until its expiry from the client to the
+// treasury, the account of the admin that configured payments, and the
+// contract records the deposit as an escrow. SettlePayments, submitted by
+// the treasury, pays the part of every escrow earned so far to the storage
+// orgs, in proportion to the shards each was last verified to hold, and
+// refunds the rest of the escrows of files deleted before their expiry.
+//
+// The token chaincode is called with InvokeChaincode and sees the client
+// submitting the storage transaction as its caller, so tokens only ever move
+// out of the account of that client, with Transfer.
+//
+// The configuration lives under paymentConfig~, payout accounts under
+// payoutAccount~orgID, escrows under escrow~fileHash~txID, the last shard
+// report under shardReport~ and the escrow settled last by a partial
+// settlement under settlementCursor~.
+const paymentConfigObjectType = "paymentConfig"
+const payoutAccountObjectType = "payoutAccount"
+const escrowObjectType = "escrow"
+const shardReportObjectType = "shardReport"
+const settlementCursorObjectType = "settlementCursor"
+
+// Events of payments.
+const (
+	ConfigurePaymentsEvent = schema.ConfigurePaymentsEvent
+	SetPayoutAccountEvent  = schema.SetPayoutAccountEvent
+	ReportShardsEvent      = schema.ReportShardsEvent
+	SettlePaymentsEvent    = schema.SettlePaymentsEvent
+)
+
+// maxSettledEscrows is the most escrows one SettlePayments call settles.
+const maxSettledEscrows = 1000
+
+// codecDataShards is the number of data chunks of each codec of
+// codecShards, so a file stored with a codec takes codecShards/codecDataShards
+// times its size.
+var codecDataShards = map[string]int{
+	"":          3,
+	"rs-6-3":    3,
+	"lrc-4-2-2": 4,
+	"rep-3":     1,
+}
+
+// ConfigurePayments makes storage paid for in the tokens of tokenChaincode at
+// pricePerGiBDay tokens per GiB of chunks per day. The submitting client
+// becomes the treasury holding the escrows and settling them. An empty
+// tokenChaincode stops payments. Neither the treasury nor the token
+// chaincode changes while escrows are open. The client needs the
+// storage.admin attribute.
+func (s *SmartContract) ConfigurePayments(ctx contractapi.TransactionContextInterface, tokenChaincode string, pricePerGiBDay int64) error {
+	err := requireAdmin(ctx, "configure payments")
+	if err != nil {
+		return err
+	}
+	if pricePerGiBDay < 0 {
+		return fmt.Errorf("price must not be negative")
+	}
+	clientID, _, err := getClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	current, err := getPaymentConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if current != nil && (current.TokenChaincode != tokenChaincode || current.Treasury != clientID) {
+		open, err := hasEscrows(ctx)
+		if err != nil {
+			return err
+		}
+		if open {
+			return fmt.Errorf("the token chaincode and treasury cannot change while escrows are open")
+		}
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(paymentConfigObjectType, []string{})
+	if err != nil {
+		return fmt.Errorf("failed to create payment config key: %v", err)
+	}
+	config := &PaymentConfig{TokenChaincode: tokenChaincode, Treasury: clientID, PricePerGiBDay: pricePerGiBDay}
+	if tokenChaincode == "" {
+		err = ctx.GetStub().DelState(key)
+		if err != nil {
+			return fmt.Errorf("failed to delete payment config from state: %v", err)
+		}
+		config = &PaymentConfig{}
+	} else {
+		err = putJSON(ctx, paymentConfigObjectType, []string{}, "payment config", config)
+		if err != nil {
+			return err
+		}
+	}
+
+	return setEvent(ctx, ConfigurePaymentsEvent, config)
+}
+
+// GetPaymentConfig returns the payment configuration.
+func (s *SmartContract) GetPaymentConfig(ctx contractapi.TransactionContextInterface) (*PaymentConfig, error) {
+	config, err := getPaymentConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, fmt.Errorf("payments are not configured")
+	}
+	return config, nil
+}
+
+// SetPayoutAccount sets the token account the share of an org is paid to, an
+// empty account removes it. The client needs the storage.admin attribute.
+func (s *SmartContract) SetPayoutAccount(ctx contractapi.TransactionContextInterface, orgID string, account string) error {
+	err := requireAdmin(ctx, "set payout accounts")
+	if err != nil {
+		return err
+	}
+	if orgID == "" {
+		return fmt.Errorf("org ID must not be empty")
+	}
+	if account != "" {
+		err = putJSON(ctx, payoutAccountObjectType, []string{orgID}, "payout account", account)
+		if err != nil {
+			return err
+		}
+	} else {
+		key, err := ctx.GetStub().CreateCompositeKey(payoutAccountObjectType, []string{orgID})
+		if err != nil {
+			return fmt.Errorf("failed to create payout account key: %v", err)
+		}
+		err = ctx.GetStub().DelState(key)
+		if err != nil {
+			return fmt.Errorf("failed to delete payout account from state: %v", err)
+		}
+	}
+
+	return setEvent(ctx, SetPayoutAccountEvent, PayoutAccountEvent{OrgID: orgID, Account: account})
+}
+
+// GetEscrows returns the escrows of a file: the open one and those closed
+// but not settled yet.
+func (s *SmartContract) GetEscrows(ctx contractapi.TransactionContextInterface, fileHash string) ([]*Escrow, error) {
+	err := validateFileHash(fileHash)
+	if err != nil {
+		return nil, err
+	}
+	return getEscrows(ctx, fileHash)
+}
+
+// ReportShards records the shards each org was verified to hold, given as a
+// JSON object of org IDs to shard counts, which the following settlements
+// share the earned tokens by. The client needs the storage.admin attribute.
+func (s *SmartContract) ReportShards(ctx contractapi.TransactionContextInterface, shardsJSON string) error {
+	err := requireAdmin(ctx, "report verified shards")
+	if err != nil {
+		return err
+	}
+	var shards map[string]int
+	err = decodeStrict(shardsJSON, &shards)
+	if err != nil {
+		return fmt.Errorf("invalid shard report: %v", err)
+	}
+	for orgID, count := range shards {
+		if count < 0 {
+			return fmt.Errorf("invalid shard report: org %s holds %d shards", orgID, count)
+		}
+	}
+	if shards == nil {
+		shards = make(map[string]int)
+	}
+
+	clientID, _, err := getClient(ctx)
+	if err != nil {
+		return err
+	}
+	now, err := transactionTime(ctx)
+	if err != nil {
+		return err
+	}
+	report := &ShardReport{Shards: shards, ReportedBy: clientID, ReportedAt: formatTimestamp(now)}
+	err = putJSON(ctx, shardReportObjectType, []string{}, "shard report", report)
+	if err != nil {
+		return err
+	}
+
+	return setEvent(ctx, ReportShardsEvent, report)
+}
+
+// GetShardReport returns the last shard report.
+func (s *SmartContract) GetShardReport(ctx contractapi.TransactionContextInterface) (*ShardReport, error) {
+	report, err := getShardReport(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if report == nil {
+		return nil, fmt.Errorf("no shards have been reported")
+	}
+	return report, nil
+}
+
+// SettlePayments settles up to limit escrows as of the transaction
+// timestamp: the part of each deposit earned since its last settlement is
+// paid to the orgs in proportion to their reported shards, and the escrows
+// of deleted files refund the rest to their payers. Settlements continue
+// from the escrow the previous one stopped at. Only the treasury may call
+// it, the tokens leave its account.
+func (s *SmartContract) SettlePayments(ctx contractapi.TransactionContextInterface, limit int) (*Settlement, error) {
+	if limit < 1 || limit > maxSettledEscrows {
+		return nil, fmt.Errorf("limit must be between 1 and %d", maxSettledEscrows)
+	}
+	config, err := s.GetPaymentConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	clientID, _, err := getClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if clientID != config.Treasury {
+		return nil, fmt.Errorf("submitting client not authorized to settle payments, only the treasury is")
+	}
+	now, err := transactionTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cursorKey, err := ctx.GetStub().CreateCompositeKey(settlementCursorObjectType, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create settlement cursor key: %v", err)
+	}
+	cursor, err := ctx.GetStub().GetState(cursorKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read settlement cursor from state: %v", err)
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(escrowObjectType, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read escrows from state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	settlement := &Settlement{
+		SettledAt: formatTimestamp(now),
+		Payouts:   make(map[string]int64),
+		Refunds:   make(map[string]int64),
+	}
+	keys := make([]string, 0)
+	escrows := make([]*Escrow, 0)
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		if queryResponse.Key <= string(cursor) {
+			continue
+		}
+		if settlement.Escrows == limit {
+			settlement.More = true
+			break
+		}
+
+		var escrow Escrow
+		err = json.Unmarshal(queryResponse.Value, &escrow)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal escrow: %v", err)
+		}
+		earned, refund, err := settleEscrow(&escrow, now)
+		if err != nil {
+			return nil, err
+		}
+		settlement.Escrows++
+		settlement.Earned += earned
+		if refund > 0 {
+			settlement.Refunds[escrow.Payer] += refund
+		}
+		keys = append(keys, queryResponse.Key)
+		escrows = append(escrows, &escrow)
+	}
+
+	// Every org paid needs an account before anything is written
+	accounts := make(map[string]string)
+	if settlement.Earned > 0 {
+		report, err := s.GetShardReport(ctx)
+		if err != nil {
+			return nil, err
+		}
+		settlement.Payouts, err = shareTokens(settlement.Earned, report.Shards)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, orgID := range sortedKeys(settlement.Payouts) {
+		accounts[orgID], err = getPayoutAccount(ctx, orgID)
+		if err != nil {
+			return nil, err
+		}
+		if accounts[orgID] == "" {
+			return nil, fmt.Errorf("org %s has no payout account", orgID)
+		}
+	}
+
+	for i, escrow := range escrows {
+		if escrow.ClosedAt != "" {
+			err = ctx.GetStub().DelState(keys[i])
+			if err != nil {
+				return nil, fmt.Errorf("failed to delete escrow from state: %v", err)
+			}
+			continue
+		}
+		escrowJSON, err := json.Marshal(escrow)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal escrow: %v", err)
+		}
+		err = ctx.GetStub().PutState(keys[i], escrowJSON)
+		if err != nil {
+			return nil, fmt.Errorf("failed to put escrow in state: %v", err)
+		}
+	}
+	if settlement.More {
+		err = ctx.GetStub().PutState(cursorKey, []byte(keys[len(keys)-1]))
+	} else if cursor != nil {
+		err = ctx.GetStub().DelState(cursorKey)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update settlement cursor: %v", err)
+	}
+
+	// Map iteration is random, every endorser has to transfer in the same order
+	for _, orgID := range sortedKeys(settlement.Payouts) {
+		err = payFromClient(ctx, config, accounts[orgID], settlement.Payouts[orgID])
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, payer := range sortedKeys(settlement.Refunds) {
+		err = payFromClient(ctx, config, payer, settlement.Refunds[payer])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = setEvent(ctx, SettlePaymentsEvent, settlement)
+	if err != nil {
+		return nil, err
+	}
+	return settlement, nil
+}
+
+// openEscrow takes the price of storing a completed file until its expiry
+// from the submitting client, when payments are configured. A file stored
+// again keeps its open escrow.
+func openEscrow(ctx contractapi.TransactionContextInterface, header *FileTreeHeader) error {
+	config, err := getPaymentConfig(ctx)
+	if err != nil || config == nil {
+		return err
+	}
+	escrow, err := getOpenEscrow(ctx, header.FileHash)
+	if err != nil || escrow != nil {
+		return err
+	}
+	if header.ExpireAt == "" {
+		return fmt.Errorf("file %s needs an expiry to be paid for", header.FileHash)
+	}
+
+	payer, _, err := getClient(ctx)
+	if err != nil {
+		return err
+	}
+	now, err := transactionTime(ctx)
+	if err != nil {
+		return err
+	}
+	expire, err := parseTimestamp("expiry", header.ExpireAt)
+	if err != nil {
+		return err
+	}
+	storedBytes, err := storedSize(header.FileSize, header.Codec)
+	if err != nil {
+		return err
+	}
+	amount, err := storageCost(config, storedBytes, now, expire)
+	if err != nil {
+		return err
+	}
+	err = payFromClient(ctx, config, config.Treasury, amount)
+	if err != nil {
+		return err
+	}
+
+	txID := ctx.GetStub().GetTxID()
+	escrow = &Escrow{
+		FileHash:     header.FileHash,
+		TxID:         txID,
+		Payer:        payer,
+		StoredBytes:  storedBytes,
+		Amount:       amount,
+		SettledUntil: formatTimestamp(now),
+		PaidUntil:    header.ExpireAt,
+	}
+	return putJSON(ctx, escrowObjectType, []string{header.FileHash, txID}, "escrow", escrow)
+}
+
+// extendEscrow takes the price of the time a new expiry adds to the open
+// escrow of a file from the submitting client. A shorter expiry deletes the
+// file earlier, which refunds the rest.
+func extendEscrow(ctx contractapi.TransactionContextInterface, header *FileTreeHeader) error {
+	escrow, err := getOpenEscrow(ctx, header.FileHash)
+	if err != nil || escrow == nil {
+		return err
+	}
+	if header.ExpireAt == "" {
+		return fmt.Errorf("file %s needs an expiry to be paid for", header.FileHash)
+	}
+	paidUntil, err := parseTimestamp("paid until", escrow.PaidUntil)
+	if err != nil {
+		return err
+	}
+	expire, err := parseTimestamp("expiry", header.ExpireAt)
+	if err != nil {
+		return err
+	}
+	if !expire.After(paidUntil) {
+		return nil
+	}
+
+	config, err := getPaymentConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if config == nil {
+		return fmt.Errorf("payments are not configured")
+	}
+	amount, err := storageCost(config, escrow.StoredBytes, paidUntil, expire)
+	if err != nil {
+		return err
+	}
+	err = payFromClient(ctx, config, config.Treasury, amount)
+	if err != nil {
+		return err
+	}
+
+	escrow.Amount += amount
+	escrow.PaidUntil = header.ExpireAt
+	return putJSON(ctx, escrowObjectType, []string{escrow.FileHash, escrow.TxID}, "escrow", escrow)
+}
+
+// closeEscrow marks the open escrow of a deleted file, if any, for refund.
+func closeEscrow(ctx contractapi.TransactionContextInterface, fileHash string) error {
+	escrow, err := getOpenEscrow(ctx, fileHash)
+	if err != nil || escrow == nil {
+		return err
+	}
+	now, err := transactionTime(ctx)
+	if err != nil {
+		return err
+	}
+	escrow.ClosedAt = formatTimestamp(now)
+	return putJSON(ctx, escrowObjectType, []string{escrow.FileHash, escrow.TxID}, "escrow", escrow)
+}
+
+// settleEscrow moves an escrow to now and returns the tokens earned since its
+// last settlement and, when it is closed, the tokens refunded. The deposit
+// left is earned evenly until PaidUntil, so rounding only delays tokens.
+func settleEscrow(escrow *Escrow, now time.Time) (int64, int64, error) {
+	settledUntil, err := parseTimestamp("settled until", escrow.SettledUntil)
+	if err != nil {
+		return 0, 0, err
+	}
+	paidUntil, err := parseTimestamp("paid until", escrow.PaidUntil)
+	if err != nil {
+		return 0, 0, err
+	}
+	closedAt, err := parseTimestamp("closed at", escrow.ClosedAt)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	until := now
+	if until.After(paidUntil) {
+		until = paidUntil
+	}
+	if !closedAt.IsZero() && until.After(closedAt) {
+		until = closedAt
+	}
+
+	left := escrow.Amount - escrow.Settled - escrow.Refunded
+	var earned int64
+	if until.After(settledUntil) {
+		earned = left
+		if until.Before(paidUntil) {
+			share := new(big.Int).Mul(big.NewInt(left), big.NewInt(int64(until.Sub(settledUntil))))
+			share.Quo(share, big.NewInt(int64(paidUntil.Sub(settledUntil))))
+			earned = share.Int64()
+		}
+		escrow.Settled += earned
+		escrow.SettledUntil = formatTimestamp(until)
+	}
+
+	var refund int64
+	if escrow.ClosedAt != "" {
+		refund = left - earned
+		escrow.Refunded += refund
+	}
+	return earned, refund, nil
+}
+
+// shareTokens splits amount between the orgs in proportion to their shards,
+// handing the tokens left by rounding down to the largest remainders.
+func shareTokens(amount int64, shards map[string]int) (map[string]int64, error) {
+	var total int64
+	orgIDs := make([]string, 0, len(shards))
+	for orgID, count := range shards {
+		total += int64(count)
+		orgIDs = append(orgIDs, orgID)
+	}
+	sort.Strings(orgIDs)
+	if total == 0 {
+		return nil, fmt.Errorf("no verified shards have been reported")
+	}
+
+	type remainder struct {
+		orgID string
+		value int64
+	}
+	shares := make(map[string]int64)
+	remainders := make([]remainder, 0, len(shards))
+	var paid int64
+	for _, orgID := range orgIDs {
+		product := new(big.Int).Mul(big.NewInt(amount), big.NewInt(int64(shards[orgID])))
+		quotient, rest := new(big.Int).QuoRem(product, big.NewInt(total), new(big.Int))
+		if quotient.Int64() > 0 {
+			shares[orgID] = quotient.Int64()
+		}
+		paid += quotient.Int64()
+		remainders = append(remainders, remainder{orgID, rest.Int64()})
+	}
+	sort.SliceStable(remainders, func(i, j int) bool {
+		return remainders[i].value > remainders[j].value
+	})
+	for i := int64(0); i < amount-paid; i++ {
+		shares[remainders[i].orgID]++
+	}
+	return shares, nil
+}
+
+// storedSize returns the bytes of chunks a file of fileSize bytes takes with
+// codec.
+func storedSize(fileSize int64, codec string) (int64, error) {
+	chunks, err := validateCodec(codec)
+	if err != nil {
+		return 0, err
+	}
+	data := int64(codecDataShards[strings.TrimPrefix(codec, "zstd+")])
+	return (fileSize*int64(chunks) + data - 1) / data, nil
+}
+
+// storageCost returns the tokens storing storedBytes from from until to
+// costs, rounded up.
+func storageCost(config *PaymentConfig, storedBytes int64, from time.Time, to time.Time) (int64, error) {
+	if !to.After(from) {
+		return 0, nil
+	}
+	cost := new(big.Int).Mul(big.NewInt(storedBytes), big.NewInt(int64(to.Sub(from)/time.Second)))
+	cost.Mul(cost, big.NewInt(config.PricePerGiBDay))
+	divisor := big.NewInt(int64(1<<30) * 24 * 60 * 60)
+	cost.Add(cost, new(big.Int).Sub(divisor, big.NewInt(1)))
+	cost.Quo(cost, divisor)
+	if !cost.IsInt64() {
+		return 0, fmt.Errorf("storage cost of %d bytes overflows", storedBytes)
+	}
+	return cost.Int64(), nil
+}
+
+// payFromClient transfers amount tokens from the submitting client to
+// recipient through the token chaincode.
+func payFromClient(ctx contractapi.TransactionContextInterface, config *PaymentConfig, recipient string, amount int64) error {
+	clientID, _, err := getClient(ctx)
+	if err != nil {
+		return err
+	}
+	// The token chaincode refuses transfers to the sender
+	if amount == 0 || recipient == clientID {
+		return nil
+	}
+	args := [][]byte{[]byte("Transfer"), []byte(recipient), []byte(strconv.FormatInt(amount, 10))}
+	response := ctx.GetStub().InvokeChaincode(config.TokenChaincode, args, "")
+	if response.Status != shim.OK {
+		return fmt.Errorf("failed to transfer %d tokens to %s: %s", amount, recipient, response.Message)
+	}
+	return nil
+}
+
+func getPaymentConfig(ctx contractapi.TransactionContextInterface) (*PaymentConfig, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(paymentConfigObjectType, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create payment config key: %v", err)
+	}
+	configJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read payment config from state: %v", err)
+	}
+	if configJSON == nil {
+		return nil, nil
+	}
+
+	var config PaymentConfig
+	err = json.Unmarshal(configJSON, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal payment config: %v", err)
+	}
+	return &config, nil
+}
+
+func getPayoutAccount(ctx contractapi.TransactionContextInterface, orgID string) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(payoutAccountObjectType, []string{orgID})
+	if err != nil {
+		return "", fmt.Errorf("failed to create payout account key: %v", err)
+	}
+	accountJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to read payout account from state: %v", err)
+	}
+	if accountJSON == nil {
+		return "", nil
+	}
+
+	var account string
+	err = json.Unmarshal(accountJSON, &account)
+	if err != nil {
+		return "", fmt.Errorf("failed to unmarshal payout account: %v", err)
+	}
+	return account, nil
+}
+
+func getShardReport(ctx contractapi.TransactionContextInterface) (*ShardReport, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(shardReportObjectType, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create shard report key: %v", err)
+	}
+	reportJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read shard report from state: %v", err)
+	}
+	if reportJSON == nil {
+		return nil, nil
+	}
+
+	var report ShardReport
+	err = json.Unmarshal(reportJSON, &report)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal shard report: %v", err)
+	}
+	return &report, nil
+}
+
+func getEscrows(ctx contractapi.TransactionContextInterface, fileHash string) ([]*Escrow, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(escrowObjectType, []string{fileHash})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read escrows from state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	escrows := make([]*Escrow, 0)
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var escrow Escrow
+		err = json.Unmarshal(queryResponse.Value, &escrow)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal escrow: %v", err)
+		}
+		escrows = append(escrows, &escrow)
+	}
+	return escrows, nil
+}
+
+// getOpenEscrow returns the escrow of a stored file, nil when it was stored
+// without payment.
+func getOpenEscrow(ctx contractapi.TransactionContextInterface, fileHash string) (*Escrow, error) {
+	escrows, err := getEscrows(ctx, fileHash)
+	if err != nil {
+		return nil, err
+	}
+	for _, escrow := range escrows {
+		if escrow.ClosedAt == "" {
+			return escrow, nil
+		}
+	}
+	return nil, nil
+}
+
+func hasEscrows(ctx contractapi.TransactionContextInterface) (bool, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(escrowObjectType, []string{})
+	if err != nil {
+		return false, fmt.Errorf("failed to read escrows from state: %v", err)
+	}
+	defer resultsIterator.Close()
+	return resultsIterator.HasNext(), nil
+}
+
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,225 @@
+package chaincode_test
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+// withToken answers the Transfer calls of the contract to the token chaincode
+// as token-erc-20 does, from the account of the submitting client, and
+// returns the balances.
+func withToken(transactionContext *mocks.TransactionContext, chaincodeStub *mocks.ChaincodeStub, balances map[string]int) {
+	chaincodeStub.InvokeChaincodeStub = func(name string, args [][]byte, channel string) peer.Response {
+		if name != "token" || string(args[0]) != "Transfer" || channel != "" {
+			return shim.Error(fmt.Sprintf("unexpected call %s %s on channel %q", name, args[0], channel))
+		}
+		from, _ := transactionContext.GetClientIdentity().GetID()
+		to := string(args[1])
+		amount, err := strconv.Atoi(string(args[2]))
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if from == to {
+			return shim.Error("cannot transfer to and from same client account")
+		}
+		if balances[from] < amount {
+			return shim.Error(fmt.Sprintf("client account %s has insufficient funds", from))
+		}
+		balances[from] -= amount
+		balances[to] += amount
+		return shim.Success(nil)
+	}
+}
+
+// Storing 12288 bytes with rs-6-3 takes 24576 bytes, which costs 24 tokens a
+// day at 1 MiB tokens per GiB-day.
+const testPrice = 1 << 20
+
+func TestConfigurePayments(t *testing.T) {
+	transactionContext, _, _ := newWorldState()
+	storage := chaincode.SmartContract{}
+
+	_, err := storage.GetPaymentConfig(transactionContext)
+	require.EqualError(t, err, "payments are not configured")
+	require.EqualError(t, storage.ConfigurePayments(transactionContext, "token", testPrice), "submitting client not authorized to configure payments, does not have storage.admin attribute")
+
+	transactionContext.GetClientIdentityReturns(admin)
+	require.EqualError(t, storage.ConfigurePayments(transactionContext, "token", -1), "price must not be negative")
+	require.NoError(t, storage.ConfigurePayments(transactionContext, "token", testPrice))
+	config, err := storage.GetPaymentConfig(transactionContext)
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.PaymentConfig{TokenChaincode: "token", Treasury: admin.id, PricePerGiBDay: testPrice}, config)
+
+	require.NoError(t, storage.ConfigurePayments(transactionContext, "", 0))
+	_, err = storage.GetPaymentConfig(transactionContext)
+	require.EqualError(t, err, "payments are not configured")
+}
+
+func TestEscrow(t *testing.T) {
+	transactionContext, chaincodeStub, _ := newWorldState()
+	balances := map[string]int{user1.id: 1000}
+	withToken(transactionContext, chaincodeStub, balances)
+	storage := chaincode.SmartContract{}
+
+	// Files stored before payments are free
+	free := storeTestFile(t, transactionContext, "free")
+
+	transactionContext.GetClientIdentityReturns(admin)
+	require.NoError(t, storage.ConfigurePayments(transactionContext, "token", testPrice))
+	require.NoError(t, storage.SetPayoutAccount(transactionContext, "localhost:50052", "account2"))
+	require.NoError(t, storage.SetPayoutAccount(transactionContext, "localhost:50053", "account3"))
+	require.EqualError(t, storage.ReportShards(transactionContext, `{"localhost:50052":-1}`), "invalid shard report: org localhost:50052 holds -1 shards")
+	require.NoError(t, storage.ReportShards(transactionContext, `{"localhost:50052":2,"localhost:50053":1}`))
+	transactionContext.GetClientIdentityReturns(user1)
+
+	fileHash := testHash("paid")
+	store := func(metadata string) error {
+		_, err := storage.StoreFileTree(transactionContext, fileHash, marshal(t, testFileTree(fileHash, 1)), metadata)
+		return err
+	}
+	require.EqualError(t, store(""), "file "+fileHash+" needs an expiry to be paid for")
+	require.EqualError(t, store(`{"tags":[],"contentType":"","expireAt":"2023-07-01T12:00:00Z"}`), "failed to transfer 1464 tokens to "+admin.id+": client account "+user1.id+" has insufficient funds")
+	require.NoError(t, store(`{"tags":[],"contentType":"","expireAt":"2023-05-31T12:00:00Z"}`))
+	require.Equal(t, 280, balances[user1.id])
+	require.Equal(t, 720, balances[admin.id])
+
+	// A file stored again keeps its escrow
+	require.NoError(t, store(""))
+	escrows, err := storage.GetEscrows(transactionContext, fileHash)
+	require.NoError(t, err)
+	require.Equal(t, []*chaincode.Escrow{{
+		FileHash:     fileHash,
+		TxID:         escrows[0].TxID,
+		Payer:        user1.id,
+		StoredBytes:  24576,
+		Amount:       720,
+		SettledUntil: "2023-05-01T12:00:00Z",
+		PaidUntil:    "2023-05-31T12:00:00Z",
+	}}, escrows)
+
+	// Ten more days cost 240 tokens, an expiry is needed while paid
+	require.NoError(t, storage.SetRetention(transactionContext, fileHash, "", "2023-06-10T12:00:00Z"))
+	require.Equal(t, 40, balances[user1.id])
+	require.EqualError(t, storage.SetRetention(transactionContext, fileHash, "", ""), "file "+fileHash+" needs an expiry to be paid for")
+
+	setTxTime(chaincodeStub, 10)
+	_, err = storage.SettlePayments(transactionContext, 10)
+	require.EqualError(t, err, "submitting client not authorized to settle payments, only the treasury is")
+	transactionContext.GetClientIdentityReturns(admin)
+	_, err = storage.SettlePayments(transactionContext, 0)
+	require.EqualError(t, err, "limit must be between 1 and 1000")
+	settlement, err := storage.SettlePayments(transactionContext, 10)
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.Settlement{
+		SettledAt: "2023-05-11T12:00:00Z",
+		Escrows:   1,
+		Earned:    240,
+		Payouts:   map[string]int64{"localhost:50052": 160, "localhost:50053": 80},
+		Refunds:   map[string]int64{},
+	}, settlement)
+	require.Equal(t, 160, balances["account2"])
+	require.Equal(t, 80, balances["account3"])
+	eventName, _ := chaincodeStub.SetEventArgsForCall(chaincodeStub.SetEventCallCount() - 1)
+	require.Equal(t, chaincode.SettlePaymentsEvent, eventName)
+
+	// Payments cannot move to another treasury while escrows are open
+	other := clientIdentity{id: "x509::CN=Admin@org2.example.com", mspID: "Org2MSP", admin: true}
+	transactionContext.GetClientIdentityReturns(other)
+	require.EqualError(t, storage.ConfigurePayments(transactionContext, "token", testPrice), "the token chaincode and treasury cannot change while escrows are open")
+
+	// Deleting the file after 20 days refunds the 20 days left
+	transactionContext.GetClientIdentityReturns(user1)
+	setTxTime(chaincodeStub, 20)
+	_, err = storage.DeleteFileTree(transactionContext, fileHash)
+	require.NoError(t, err)
+	_, err = storage.DeleteFileTree(transactionContext, free)
+	require.NoError(t, err)
+	escrows, err = storage.GetEscrows(transactionContext, fileHash)
+	require.NoError(t, err)
+	require.Equal(t, "2023-05-21T12:00:00Z", escrows[0].ClosedAt)
+
+	setTxTime(chaincodeStub, 25)
+	transactionContext.GetClientIdentityReturns(admin)
+	settlement, err = storage.SettlePayments(transactionContext, 10)
+	require.NoError(t, err)
+	require.Equal(t, int64(240), settlement.Earned)
+	require.Equal(t, map[string]int64{user1.id: 480}, settlement.Refunds)
+	require.Equal(t, 520, balances[user1.id])
+	require.Equal(t, 320, balances["account2"])
+	require.Equal(t, 160, balances["account3"])
+	require.Equal(t, 0, balances[admin.id])
+
+	escrows, err = storage.GetEscrows(transactionContext, fileHash)
+	require.NoError(t, err)
+	require.Empty(t, escrows)
+}
+
+func TestSettlePayments(t *testing.T) {
+	transactionContext, chaincodeStub, _ := newWorldState()
+	balances := map[string]int{user1.id: 1000}
+	withToken(transactionContext, chaincodeStub, balances)
+	storage := chaincode.SmartContract{}
+
+	transactionContext.GetClientIdentityReturns(admin)
+	require.NoError(t, storage.ConfigurePayments(transactionContext, "token", testPrice))
+	transactionContext.GetClientIdentityReturns(user1)
+	for _, name := range []string{"a", "b", "c"} {
+		fileHash := testHash(name)
+		_, err := storage.StoreFileTree(transactionContext, fileHash, marshal(t, testFileTree(fileHash, 1)), `{"tags":[],"contentType":"","expireAt":"2023-05-04T12:00:00Z"}`)
+		require.NoError(t, err)
+	}
+	require.Equal(t, 1000-3*72, balances[user1.id])
+	require.Equal(t, 3*72, balances[admin.id])
+
+	// The deposits are out of reach of the payer, who spends the rest
+	response := chaincodeStub.InvokeChaincode("token", [][]byte{[]byte("Transfer"), []byte("elsewhere"), []byte(strconv.Itoa(balances[user1.id]))}, "")
+	require.Equal(t, int32(shim.OK), response.Status)
+	require.Equal(t, 0, balances[user1.id])
+
+	setTxTime(chaincodeStub, 1)
+	transactionContext.GetClientIdentityReturns(admin)
+	_, err := storage.SettlePayments(transactionContext, 10)
+	require.EqualError(t, err, "no shards have been reported")
+	require.NoError(t, storage.ReportShards(transactionContext, `{"localhost:50052":1,"localhost:50053":1,"localhost:50054":1}`))
+	_, err = storage.SettlePayments(transactionContext, 10)
+	require.EqualError(t, err, "org localhost:50052 has no payout account")
+	for _, orgID := range []string{"localhost:50052", "localhost:50053", "localhost:50054"} {
+		require.NoError(t, storage.SetPayoutAccount(transactionContext, orgID, "account "+orgID))
+	}
+
+	// Settlements go on from the escrow the previous one stopped at
+	settlement, err := storage.SettlePayments(transactionContext, 2)
+	require.NoError(t, err)
+	require.Equal(t, 2, settlement.Escrows)
+	require.True(t, settlement.More)
+	require.Equal(t, int64(48), settlement.Earned)
+	settlement, err = storage.SettlePayments(transactionContext, 2)
+	require.NoError(t, err)
+	require.Equal(t, 1, settlement.Escrows)
+	require.False(t, settlement.More)
+	require.Equal(t, int64(24), settlement.Earned)
+	require.Equal(t, map[string]int64{"localhost:50052": 8, "localhost:50053": 8, "localhost:50054": 8}, settlement.Payouts)
+
+	// Tokens left by rounding go to the largest remainders, and every escrow
+	// is paid out in full once its time is over
+	require.NoError(t, storage.ReportShards(transactionContext, `{"localhost:50052":2,"localhost:50053":2,"localhost:50054":3}`))
+	setTxTime(chaincodeStub, 5)
+	settlement, err = storage.SettlePayments(transactionContext, 10)
+	require.NoError(t, err)
+	require.Equal(t, int64(144), settlement.Earned)
+	require.Equal(t, map[string]int64{"localhost:50052": 41, "localhost:50053": 41, "localhost:50054": 62}, settlement.Payouts)
+	require.Equal(t, 0, balances[admin.id])
+	require.Equal(t, 3*72, balances["account localhost:50052"]+balances["account localhost:50053"]+balances["account localhost:50054"])
+
+	settlement, err = storage.SettlePayments(transactionContext, 10)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), settlement.Earned)
+	require.Empty(t, settlement.Payouts)
+}
@@ -0,0 +1,69 @@
+package chaincode
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Every object and ref pointing to a file is indexed under
+// referrer~fileHash~kind~name, so a file is not deleted while a name still
+// points to it. Objects are indexed by their bucket and key, refs by their
+// name.
+const referrerObjectType = "referrer"
+
+// Kinds of referrers.
+const (
+	objectReferrer = "object"
+	refReferrer    = "ref"
+)
+
+// addReferrer records that a name points to a file.
+func addReferrer(ctx contractapi.TransactionContextInterface, fileHash string, kind string, name ...string) error {
+	key, err := ctx.GetStub().CreateCompositeKey(referrerObjectType, append([]string{fileHash, kind}, name...))
+	if err != nil {
+		return fmt.Errorf("failed to create referrer key: %v", err)
+	}
+	err = ctx.GetStub().PutState(key, []byte{0x00})
+	if err != nil {
+		return fmt.Errorf("failed to put referrer in state: %v", err)
+	}
+	return nil
+}
+
+// removeReferrer records that a name no longer points to a file.
+func removeReferrer(ctx contractapi.TransactionContextInterface, fileHash string, kind string, name ...string) error {
+	key, err := ctx.GetStub().CreateCompositeKey(referrerObjectType, append([]string{fileHash, kind}, name...))
+	if err != nil {
+		return fmt.Errorf("failed to create referrer key: %v", err)
+	}
+	err = ctx.GetStub().DelState(key)
+	if err != nil {
+		return fmt.Errorf("failed to delete referrer from state: %v", err)
+	}
+	return nil
+}
+
+// getReferrer returns the first name pointing to a file, such as
+// "object photos/cat.jpg", or nothing when no name does.
+func getReferrer(ctx contractapi.TransactionContextInterface, fileHash string) (string, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(referrerObjectType, []string{fileHash})
+	if err != nil {
+		return "", fmt.Errorf("failed to read referrers from state: %v", err)
+	}
+	defer resultsIterator.Close()
+	if !resultsIterator.HasNext() {
+		return "", nil
+	}
+
+	queryResponse, err := resultsIterator.Next()
+	if err != nil {
+		return "", err
+	}
+	_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+	if err != nil {
+		return "", fmt.Errorf("failed to split referrer key: %v", err)
+	}
+	return attributes[1] + " " + strings.Join(attributes[2:], "/"), nil
+}
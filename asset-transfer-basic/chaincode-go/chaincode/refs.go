@@ -0,0 +1,351 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/schema"
+)
+
+// Refs are mutable names, such as bucket/path, pointing to stored files. A
+// ref lives under ref~name and every change to it is kept by the ledger
+// history of that key. The last version of a name lives under
+// refversion~name, so versions stay unique when a deleted name is set again.
+const refObjectType = "ref"
+const refVersionObjectType = "refversion"
+
+// Events of refs.
+const (
+	SetRefEvent    = schema.SetRefEvent
+	DeleteRefEvent = schema.DeleteRefEvent
+)
+
+// validateRefName checks that a ref name is at most 1024 bytes of UTF-8
+// that a composite key can hold.
+func validateRefName(name string) error {
+	if name == "" {
+		return fmt.Errorf("ref name must not be empty")
+	}
+	if len(name) > 1024 {
+		return fmt.Errorf("ref name is longer than 1024 bytes")
+	}
+	if !utf8.ValidString(name) || strings.ContainsAny(name, "\x00\U0010FFFF") {
+		return fmt.Errorf("invalid ref name %q", name)
+	}
+	return nil
+}
+
+// SetRef points a name to a stored file as a new version of the name. Only
+// clients of the MSP that created the ref may change it. The file cannot be
+// deleted while the current version of a ref points to it.
+func (s *SmartContract) SetRef(ctx contractapi.TransactionContextInterface, name string, fileHash string) (*Ref, error) {
+	err := validateRefName(name)
+	if err != nil {
+		return nil, err
+	}
+	err = validateFileHash(fileHash)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := getFileTreeHeader(ctx, fileHash)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil || !header.Complete {
+		return nil, fmt.Errorf("file %s does not exist", fileHash)
+	}
+
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client MSP ID: %v", err)
+	}
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client ID: %v", err)
+	}
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+
+	ref, err := getRef(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	owner := mspID
+	if ref != nil {
+		if ref.Owner != mspID {
+			return nil, fmt.Errorf("ref %s is owned by %s", name, ref.Owner)
+		}
+		owner = ref.Owner
+		err = removeReferrer(ctx, ref.FileHash, refReferrer, name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = addReferrer(ctx, fileHash, refReferrer, name)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := getRefVersion(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	ref = &Ref{
+		Name:      name,
+		FileHash:  fileHash,
+		Version:   version + 1,
+		Owner:     owner,
+		UpdatedBy: clientID,
+		UpdatedAt: timestamp.AsTime().UTC().Format(time.RFC3339Nano),
+	}
+	err = putJSON(ctx, refObjectType, []string{name}, "ref", ref)
+	if err != nil {
+		return nil, err
+	}
+	err = putJSON(ctx, refVersionObjectType, []string{name}, "ref version", ref.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	err = setEvent(ctx, SetRefEvent, RefEvent{Name: name, FileHash: fileHash, Version: ref.Version})
+	if err != nil {
+		return nil, err
+	}
+	return ref, nil
+}
+
+// GetRef returns the current version of a ref.
+func (s *SmartContract) GetRef(ctx contractapi.TransactionContextInterface, name string) (*Ref, error) {
+	ref, err := getRef(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if ref == nil {
+		return nil, fmt.Errorf("ref %s does not exist", name)
+	}
+	return ref, nil
+}
+
+// DeleteRef removes a name. Its versions stay in the history and the file
+// stays stored, other refs may point to it. Older versions may point to
+// files deleted since.
+func (s *SmartContract) DeleteRef(ctx contractapi.TransactionContextInterface, name string) error {
+	ref, err := s.GetRef(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client MSP ID: %v", err)
+	}
+	if mspID != ref.Owner {
+		return fmt.Errorf("ref %s is owned by %s", name, ref.Owner)
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(refObjectType, []string{name})
+	if err != nil {
+		return fmt.Errorf("failed to create ref key: %v", err)
+	}
+	err = ctx.GetStub().DelState(key)
+	if err != nil {
+		return fmt.Errorf("failed to delete ref from state: %v", err)
+	}
+	err = removeReferrer(ctx, ref.FileHash, refReferrer, name)
+	if err != nil {
+		return err
+	}
+
+	return setEvent(ctx, DeleteRefEvent, RefEvent{Name: name, FileHash: ref.FileHash, Version: ref.Version})
+}
+
+// ListRefs returns the current version of every ref whose name starts with
+// prefix, in the order of their names.
+func (s *SmartContract) ListRefs(ctx contractapi.TransactionContextInterface, prefix string) ([]*Ref, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(refObjectType, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read refs from state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	refs := make([]*Ref, 0)
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split ref key: %v", err)
+		}
+		if !strings.HasPrefix(attributes[0], prefix) {
+			continue
+		}
+
+		var ref Ref
+		err = json.Unmarshal(queryResponse.Value, &ref)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal ref: %v", err)
+		}
+		refs = append(refs, &ref)
+	}
+	return refs, nil
+}
+
+// GetRefHistory returns every change of a ref, including deletions, in the
+// order the ledger history gives them.
+func (s *SmartContract) GetRefHistory(ctx contractapi.TransactionContextInterface, name string) ([]*RefHistoryRecord, error) {
+	err := validateRefName(name)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(refObjectType, []string{name})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ref key: %v", err)
+	}
+
+	resultsIterator, err := ctx.GetStub().GetHistoryForKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ref history: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	records := make([]*RefHistoryRecord, 0)
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var ref *Ref
+		if len(response.Value) > 0 {
+			ref = new(Ref)
+			err = json.Unmarshal(response.Value, ref)
+			if err != nil {
+				return nil, fmt.Errorf("failed to unmarshal ref: %v", err)
+			}
+		}
+
+		records = append(records, &RefHistoryRecord{
+			Record:    ref,
+			TxId:      response.TxId,
+			Timestamp: response.Timestamp.AsTime().UTC().Format(time.RFC3339Nano),
+			IsDelete:  response.IsDelete,
+		})
+	}
+	return records, nil
+}
+
+// ResolveRef returns the version of a ref given, or the version current at
+// the RFC 3339 timestamp given, or the current version when given neither.
+func (s *SmartContract) ResolveRef(ctx contractapi.TransactionContextInterface, name string, version int, at string) (*Ref, error) {
+	if version < 0 {
+		return nil, fmt.Errorf("invalid version %d", version)
+	}
+	if version > 0 && at != "" {
+		return nil, fmt.Errorf("give a version or a timestamp, not both")
+	}
+	if version == 0 && at == "" {
+		return s.GetRef(ctx, name)
+	}
+
+	var atTime time.Time
+	if at != "" {
+		var err error
+		atTime, err = time.Parse(time.RFC3339Nano, at)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp %q: %v", at, err)
+		}
+	}
+
+	records, err := s.GetRefHistory(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// The history is not relied on to be in order, so the latest change is
+	// found by its timestamp.
+	var found *RefHistoryRecord
+	var foundTime time.Time
+	for _, record := range records {
+		if version > 0 {
+			if !record.IsDelete && record.Record.Version == version {
+				return record.Record, nil
+			}
+			continue
+		}
+
+		timestamp, err := time.Parse(time.RFC3339Nano, record.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("invalid history timestamp %q: %v", record.Timestamp, err)
+		}
+		if timestamp.After(atTime) {
+			continue
+		}
+		if found == nil || timestamp.After(foundTime) {
+			found, foundTime = record, timestamp
+		}
+	}
+
+	if version > 0 {
+		return nil, fmt.Errorf("ref %s has no version %d", name, version)
+	}
+	if found == nil || found.IsDelete {
+		return nil, fmt.Errorf("ref %s does not exist at %s", name, at)
+	}
+	return found.Record, nil
+}
+
+func getRef(ctx contractapi.TransactionContextInterface, name string) (*Ref, error) {
+	err := validateRefName(name)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(refObjectType, []string{name})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ref key: %v", err)
+	}
+	refJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ref from state: %v", err)
+	}
+	if refJSON == nil {
+		return nil, nil
+	}
+
+	var ref Ref
+	err = json.Unmarshal(refJSON, &ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal ref: %v", err)
+	}
+	return &ref, nil
+}
+
+// getRefVersion returns the last version of a name, 0 when it was never set.
+func getRefVersion(ctx contractapi.TransactionContextInterface, name string) (int, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(refVersionObjectType, []string{name})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create ref version key: %v", err)
+	}
+	versionJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read ref version from state: %v", err)
+	}
+	if versionJSON == nil {
+		return 0, nil
+	}
+
+	version, err := strconv.Atoi(string(versionJSON))
+	if err != nil {
+		return 0, fmt.Errorf("invalid ref version %q: %v", versionJSON, err)
+	}
+	return version, nil
+}
@@ -0,0 +1,201 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/mocks"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// withHistory records the writes of the world state as the ledger history
+// does, newest first, and answers GetHistoryForKey from it.
+func withHistory(chaincodeStub *mocks.ChaincodeStub) {
+	history := make(map[string][]*queryresult.KeyModification)
+	record := func(key string, value []byte, isDelete bool) {
+		timestamp, _ := chaincodeStub.GetTxTimestamp()
+		modification := &queryresult.KeyModification{TxId: chaincodeStub.GetTxID(), Value: value, Timestamp: timestamp, IsDelete: isDelete}
+		history[key] = append([]*queryresult.KeyModification{modification}, history[key]...)
+	}
+	putState, delState := chaincodeStub.PutStateStub, chaincodeStub.DelStateStub
+	chaincodeStub.PutStateStub = func(key string, value []byte) error {
+		record(key, value, false)
+		return putState(key, value)
+	}
+	chaincodeStub.DelStateStub = func(key string) error {
+		record(key, nil, true)
+		return delState(key)
+	}
+	chaincodeStub.GetHistoryForKeyStub = func(key string) (shim.HistoryQueryIteratorInterface, error) {
+		modifications := history[key]
+		iterator := &mocks.HistoryQueryIterator{}
+		iterator.HasNextStub = func() bool {
+			return len(modifications) > 0
+		}
+		iterator.NextStub = func() (*queryresult.KeyModification, error) {
+			modification := modifications[0]
+			modifications = modifications[1:]
+			return modification, nil
+		}
+		return iterator, nil
+	}
+}
+
+func storeTestFile(t *testing.T, transactionContext contractapi.TransactionContextInterface, name string) string {
+	fileHash := testHash(name)
+	storage := chaincode.SmartContract{}
+	_, err := storage.StoreFileTree(transactionContext, fileHash, marshal(t, testFileTree(fileHash, 1)), "")
+	require.NoError(t, err)
+	return fileHash
+}
+
+func TestSetRef(t *testing.T) {
+	transactionContext, chaincodeStub, _ := newWorldState()
+	storage := chaincode.SmartContract{}
+	first := storeTestFile(t, transactionContext, "first")
+	second := storeTestFile(t, transactionContext, "second")
+
+	_, err := storage.SetRef(transactionContext, "", first)
+	require.EqualError(t, err, "ref name must not be empty")
+	_, err = storage.SetRef(transactionContext, "docs/report.pdf", testHash("missing"))
+	require.EqualError(t, err, "file "+testHash("missing")+" does not exist")
+
+	ref, err := storage.SetRef(transactionContext, "docs/report.pdf", first)
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.Ref{
+		Name:      "docs/report.pdf",
+		FileHash:  first,
+		Version:   1,
+		Owner:     "Org1MSP",
+		UpdatedBy: user1.id,
+		UpdatedAt: "2023-05-01T12:00:00Z",
+	}, ref)
+	eventName, payload := chaincodeStub.SetEventArgsForCall(chaincodeStub.SetEventCallCount() - 1)
+	require.Equal(t, chaincode.SetRefEvent, eventName)
+	require.JSONEq(t, `{"name":"docs/report.pdf","fileHash":"`+first+`","version":1}`, string(payload))
+
+	ref, err = storage.SetRef(transactionContext, "docs/report.pdf", second)
+	require.NoError(t, err)
+	require.Equal(t, 2, ref.Version)
+	ref, err = storage.GetRef(transactionContext, "docs/report.pdf")
+	require.NoError(t, err)
+	require.Equal(t, second, ref.FileHash)
+
+	// Only the owner MSP changes the ref
+	transactionContext.GetClientIdentityReturns(clientIdentity{id: "x509::CN=User1@org2.example.com", mspID: "Org2MSP"})
+	_, err = storage.SetRef(transactionContext, "docs/report.pdf", first)
+	require.EqualError(t, err, "ref docs/report.pdf is owned by Org1MSP")
+	require.EqualError(t, storage.DeleteRef(transactionContext, "docs/report.pdf"), "ref docs/report.pdf is owned by Org1MSP")
+	transactionContext.GetClientIdentityReturns(user1)
+
+	// Versions go on after the ref is deleted and set again
+	require.NoError(t, storage.DeleteRef(transactionContext, "docs/report.pdf"))
+	_, err = storage.GetRef(transactionContext, "docs/report.pdf")
+	require.EqualError(t, err, "ref docs/report.pdf does not exist")
+	require.EqualError(t, storage.DeleteRef(transactionContext, "docs/report.pdf"), "ref docs/report.pdf does not exist")
+	ref, err = storage.SetRef(transactionContext, "docs/report.pdf", first)
+	require.NoError(t, err)
+	require.Equal(t, 3, ref.Version)
+}
+
+func TestListRefs(t *testing.T) {
+	transactionContext, _, _ := newWorldState()
+	storage := chaincode.SmartContract{}
+	fileHash := storeTestFile(t, transactionContext, "file")
+
+	for _, name := range []string{"photos/cat.jpg", "docs/b", "docs/a", "docsa"} {
+		_, err := storage.SetRef(transactionContext, name, fileHash)
+		require.NoError(t, err)
+	}
+
+	refs, err := storage.ListRefs(transactionContext, "docs/")
+	require.NoError(t, err)
+	require.Len(t, refs, 2)
+	require.Equal(t, "docs/a", refs[0].Name)
+	require.Equal(t, "docs/b", refs[1].Name)
+
+	refs, err = storage.ListRefs(transactionContext, "")
+	require.NoError(t, err)
+	require.Len(t, refs, 4)
+}
+
+func TestResolveRef(t *testing.T) {
+	transactionContext, chaincodeStub, _ := newWorldState()
+	withHistory(chaincodeStub)
+	storage := chaincode.SmartContract{}
+	first := storeTestFile(t, transactionContext, "first")
+	second := storeTestFile(t, transactionContext, "second")
+
+	at := func(hour int) {
+		chaincodeStub.GetTxTimestampReturns(timestamppb.New(txTime.Add(time.Duration(hour)*time.Hour)), nil)
+	}
+	at(1)
+	_, err := storage.SetRef(transactionContext, "report", first)
+	require.NoError(t, err)
+	at(2)
+	_, err = storage.SetRef(transactionContext, "report", second)
+	require.NoError(t, err)
+	at(3)
+	require.NoError(t, storage.DeleteRef(transactionContext, "report"))
+	at(4)
+	_, err = storage.SetRef(transactionContext, "report", first)
+	require.NoError(t, err)
+	chaincodeStub.GetTxTimestampReturns(timestamppb.New(txTime.Add(4*time.Hour+500*time.Millisecond)), nil)
+	_, err = storage.SetRef(transactionContext, "report", second)
+	require.NoError(t, err)
+
+	history, err := storage.GetRefHistory(transactionContext, "report")
+	require.NoError(t, err)
+	require.Len(t, history, 5)
+	require.Equal(t, 4, history[0].Record.Version)
+	require.Equal(t, "2023-05-01T16:00:00.5Z", history[0].Timestamp)
+	require.Equal(t, "2023-05-01T16:00:00.5Z", history[0].Record.UpdatedAt)
+	require.Equal(t, 3, history[1].Record.Version)
+	require.True(t, history[2].IsDelete)
+	require.Nil(t, history[2].Record)
+	require.Equal(t, "2023-05-01T15:00:00Z", history[2].Timestamp)
+	historyJSON, err := json.Marshal(history[2])
+	require.NoError(t, err)
+	require.JSONEq(t, `{"record":null,"txId":"`+history[2].TxId+`","timestamp":"2023-05-01T15:00:00Z","isDelete":true}`, string(historyJSON))
+
+	tests := []struct {
+		name     string
+		version  int
+		at       string
+		fileHash string
+		err      string
+	}{
+		{"current", 0, "", second, ""},
+		{"version 1", 1, "", first, ""},
+		{"version 2", 2, "", second, ""},
+		{"missing version", 5, "", "", "ref report has no version 5"},
+		{"negative version", -1, "", "", "invalid version -1"},
+		{"version and timestamp", 1, "2023-05-01T13:00:00Z", "", "give a version or a timestamp, not both"},
+		{"before the first version", 0, "2023-05-01T12:59:59Z", "", "ref report does not exist at 2023-05-01T12:59:59Z"},
+		{"at the first version", 0, "2023-05-01T13:00:00Z", first, ""},
+		{"between versions", 0, "2023-05-01T14:30:00+00:00", second, ""},
+		{"other time zone", 0, "2023-05-01T16:30:00+02:00", second, ""},
+		{"deleted", 0, "2023-05-01T15:30:00Z", "", "ref report does not exist at 2023-05-01T15:30:00Z"},
+		{"set again", 0, "2023-05-01T16:00:00Z", first, ""},
+		{"set again in the same second", 0, "2023-05-01T16:00:00.5Z", second, ""},
+		{"current version", 0, "2023-05-02T00:00:00Z", second, ""},
+		{"invalid timestamp", 0, "yesterday", "", `invalid timestamp "yesterday"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ref, err := storage.ResolveRef(transactionContext, "report", test.version, test.at)
+			if test.err != "" {
+				require.ErrorContains(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.fileHash, ref.FileHash)
+		})
+	}
+}
@@ -0,0 +1,468 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/schema"
+)
+
+// Files with an expiry are indexed under expiry~expireAt~fileHash, so the
+// sweeper reads the expired ones in the order they expired. Legal holds live
+// under legalHold~fileHash~holdID and are kept after they are released.
+const expiryObjectType = "expiry"
+const legalHoldObjectType = "legalHold"
+
+// Events of retention and legal holds.
+const (
+	SetRetentionEvent     = schema.SetRetentionEvent
+	SetLegalHoldEvent     = schema.SetLegalHoldEvent
+	ReleaseLegalHoldEvent = schema.ReleaseLegalHoldEvent
+)
+
+// maxExpiredFiles is the largest page of ListExpiredFiles.
+const maxExpiredFiles = 1000
+
+func parseTimestamp(name string, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s %q: %v", name, value, err)
+	}
+	return t.UTC(), nil
+}
+
+func formatTimestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// parseRetention parses the RFC 3339 timestamps of a retention, either may
+// be empty.
+func parseRetention(retainUntil string, expireAt string) (time.Time, time.Time, error) {
+	retain, err := parseTimestamp("retention", retainUntil)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	expire, err := parseTimestamp("expiry", expireAt)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return retain, expire, nil
+}
+
+// mergeRetention returns the retention of a file once retainUntil and
+// expireAt are applied, zero values keeping the current ones. Retention may
+// only be extended and a file cannot expire before its retention ends.
+func mergeRetention(header *FileTreeHeader, retainUntil time.Time, expireAt time.Time) (string, string, error) {
+	current, expire, err := parseRetention(header.RetainUntil, header.ExpireAt)
+	if err != nil {
+		return "", "", err
+	}
+
+	retain := current
+	if !retainUntil.IsZero() {
+		if retainUntil.Before(current) {
+			return "", "", fmt.Errorf("retention of file %s cannot be shortened from %s", header.FileHash, header.RetainUntil)
+		}
+		retain = retainUntil
+	}
+	if !expireAt.IsZero() {
+		expire = expireAt
+	}
+	if !expire.IsZero() && expire.Before(retain) {
+		return "", "", fmt.Errorf("file %s cannot expire at %s before its retention ends at %s", header.FileHash, formatTimestamp(expire), formatTimestamp(retain))
+	}
+	return formatTimestamp(retain), formatTimestamp(expire), nil
+}
+
+// applyRetention sets the retention of a header and moves its expiry index
+// entry. The header is left for the caller to put.
+func applyRetention(ctx contractapi.TransactionContextInterface, header *FileTreeHeader, retainUntil time.Time, expireAt time.Time) error {
+	retain, expire, err := mergeRetention(header, retainUntil, expireAt)
+	if err != nil {
+		return err
+	}
+
+	if expire != header.ExpireAt {
+		err = deleteExpiryIndex(ctx, header)
+		if err != nil {
+			return err
+		}
+		if expire != "" {
+			key, err := ctx.GetStub().CreateCompositeKey(expiryObjectType, []string{expire, header.FileHash})
+			if err != nil {
+				return fmt.Errorf("failed to create expiry key: %v", err)
+			}
+			// Only the key is needed, an empty value would delete it
+			err = ctx.GetStub().PutState(key, []byte{0x00})
+			if err != nil {
+				return fmt.Errorf("failed to put expiry in state: %v", err)
+			}
+		}
+	}
+
+	header.RetainUntil = retain
+	header.ExpireAt = expire
+	return nil
+}
+
+func deleteExpiryIndex(ctx contractapi.TransactionContextInterface, header *FileTreeHeader) error {
+	if header.ExpireAt == "" {
+		return nil
+	}
+	key, err := ctx.GetStub().CreateCompositeKey(expiryObjectType, []string{header.ExpireAt, header.FileHash})
+	if err != nil {
+		return fmt.Errorf("failed to create expiry key: %v", err)
+	}
+	err = ctx.GetStub().DelState(key)
+	if err != nil {
+		return fmt.Errorf("failed to delete expiry from state: %v", err)
+	}
+	return nil
+}
+
+func transactionTime(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+	return timestamp.AsTime().UTC(), nil
+}
+
+// checkDeletable fails while a file is retained, under legal hold, as of the
+// transaction timestamp, or while an object or ref points to it.
+func checkDeletable(ctx contractapi.TransactionContextInterface, header *FileTreeHeader) error {
+	now, err := transactionTime(ctx)
+	if err != nil {
+		return err
+	}
+	retain, err := parseTimestamp("retention", header.RetainUntil)
+	if err != nil {
+		return err
+	}
+	if now.Before(retain) {
+		return fmt.Errorf("file %s is retained until %s", header.FileHash, header.RetainUntil)
+	}
+
+	holds, err := getLegalHolds(ctx, header.FileHash)
+	if err != nil {
+		return err
+	}
+	for _, hold := range holds {
+		if hold.Active {
+			return fmt.Errorf("file %s is under legal hold %s", header.FileHash, hold.HoldID)
+		}
+	}
+
+	referrer, err := getReferrer(ctx, header.FileHash)
+	if err != nil {
+		return err
+	}
+	if referrer != "" {
+		return fmt.Errorf("file %s is referenced by %s", header.FileHash, referrer)
+	}
+	return nil
+}
+
+// getStoredFileTreeHeader returns the header of a file that was stored.
+func getStoredFileTreeHeader(ctx contractapi.TransactionContextInterface, fileHash string) (*FileTreeHeader, error) {
+	header, err := getFileTreeHeader(ctx, fileHash)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil || !header.Complete {
+		return nil, fmt.Errorf("file %s does not exist", fileHash)
+	}
+	return header, nil
+}
+
+// SetRetention keeps a file until retainUntil and lets the sweeper remove it
+// after expireAt, both RFC 3339 timestamps. An empty retainUntil keeps the
+// current retention, which can only be extended, and an empty expireAt
+// keeps the file until it is deleted. Clients of the owner MSP and admins
+// may set it. A later expiry of a paid file is paid for by the client.
+func (s *SmartContract) SetRetention(ctx contractapi.TransactionContextInterface, fileHash string, retainUntil string, expireAt string) error {
+	header, err := getStoredFileTreeHeader(ctx, fileHash)
+	if err != nil {
+		return err
+	}
+	err = requireOwnerOrAdmin(ctx, fileHash, "set the retention of files of other MSPs")
+	if err != nil {
+		return err
+	}
+
+	retain, expire, err := parseRetention(retainUntil, expireAt)
+	if err != nil {
+		return err
+	}
+	if expireAt == "" && header.ExpireAt != "" {
+		err = deleteExpiryIndex(ctx, header)
+		if err != nil {
+			return err
+		}
+		header.ExpireAt = ""
+	}
+	err = applyRetention(ctx, header, retain, expire)
+	if err != nil {
+		return err
+	}
+	err = extendEscrow(ctx, header)
+	if err != nil {
+		return err
+	}
+	err = putFileTreeHeader(ctx, header)
+	if err != nil {
+		return err
+	}
+
+	return setEvent(ctx, SetRetentionEvent, RetentionEvent{FileHash: fileHash, RetainUntil: header.RetainUntil, ExpireAt: header.ExpireAt})
+}
+
+// SetLegalHold keeps a file from being deleted, whatever its retention,
+// until the hold is released. A hold ID is used once. The client needs the
+// storage.admin attribute.
+func (s *SmartContract) SetLegalHold(ctx contractapi.TransactionContextInterface, fileHash string, holdID string, reason string) error {
+	err := requireAdmin(ctx, "set legal holds")
+	if err != nil {
+		return err
+	}
+	if holdID == "" {
+		return fmt.Errorf("hold ID must not be empty")
+	}
+	_, err = getStoredFileTreeHeader(ctx, fileHash)
+	if err != nil {
+		return err
+	}
+
+	existing, err := getLegalHold(ctx, fileHash, holdID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("legal hold %s of file %s already exists", holdID, fileHash)
+	}
+
+	clientID, mspID, err := getClient(ctx)
+	if err != nil {
+		return err
+	}
+	now, err := transactionTime(ctx)
+	if err != nil {
+		return err
+	}
+	hold := LegalHold{
+		FileHash: fileHash,
+		HoldID:   holdID,
+		Reason:   reason,
+		Active:   true,
+		SetBy:    clientID,
+		SetByMSP: mspID,
+		SetAt:    formatTimestamp(now),
+	}
+	err = putJSON(ctx, legalHoldObjectType, []string{fileHash, holdID}, "legal hold", hold)
+	if err != nil {
+		return err
+	}
+
+	return setEvent(ctx, SetLegalHoldEvent, hold)
+}
+
+// ReleaseLegalHold lifts a hold, recording who released it. The client
+// needs the storage.admin attribute.
+func (s *SmartContract) ReleaseLegalHold(ctx contractapi.TransactionContextInterface, fileHash string, holdID string) error {
+	err := requireAdmin(ctx, "release legal holds")
+	if err != nil {
+		return err
+	}
+	hold, err := getLegalHold(ctx, fileHash, holdID)
+	if err != nil {
+		return err
+	}
+	if hold == nil || !hold.Active {
+		return fmt.Errorf("file %s has no active legal hold %s", fileHash, holdID)
+	}
+
+	clientID, mspID, err := getClient(ctx)
+	if err != nil {
+		return err
+	}
+	now, err := transactionTime(ctx)
+	if err != nil {
+		return err
+	}
+	hold.Active = false
+	hold.ReleasedBy = clientID
+	hold.ReleasedByMSP = mspID
+	hold.ReleasedAt = formatTimestamp(now)
+	err = putJSON(ctx, legalHoldObjectType, []string{fileHash, holdID}, "legal hold", hold)
+	if err != nil {
+		return err
+	}
+
+	return setEvent(ctx, ReleaseLegalHoldEvent, hold)
+}
+
+// GetRetention returns the retention, expiry and legal holds of a file.
+func (s *SmartContract) GetRetention(ctx contractapi.TransactionContextInterface, fileHash string) (*Retention, error) {
+	header, err := getStoredFileTreeHeader(ctx, fileHash)
+	if err != nil {
+		return nil, err
+	}
+	holds, err := getLegalHolds(ctx, fileHash)
+	if err != nil {
+		return nil, err
+	}
+	return &Retention{
+		FileHash:    fileHash,
+		RetainUntil: header.RetainUntil,
+		ExpireAt:    header.ExpireAt,
+		Holds:       holds,
+	}, nil
+}
+
+// ListExpiredFiles returns up to limit files whose expiry has passed as of
+// the transaction timestamp, oldest expiry first. Held files are left out.
+func (s *SmartContract) ListExpiredFiles(ctx contractapi.TransactionContextInterface, limit int) ([]string, error) {
+	if limit <= 0 || limit > maxExpiredFiles {
+		return nil, fmt.Errorf("limit must be between 1 and %d", maxExpiredFiles)
+	}
+	now, err := transactionTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(expiryObjectType, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read expiries from state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	// RFC 3339 timestamps in UTC sort like the times they name
+	fileHashes := make([]string, 0)
+	for resultsIterator.HasNext() && len(fileHashes) < limit {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split expiry key: %v", err)
+		}
+		if attributes[0] > formatTimestamp(now) {
+			break
+		}
+
+		holds, err := getLegalHolds(ctx, attributes[1])
+		if err != nil {
+			return nil, err
+		}
+		held := false
+		for _, hold := range holds {
+			held = held || hold.Active
+		}
+		referrer, err := getReferrer(ctx, attributes[1])
+		if err != nil {
+			return nil, err
+		}
+		if !held && referrer == "" {
+			fileHashes = append(fileHashes, attributes[1])
+		}
+	}
+	return fileHashes, nil
+}
+
+// ExpireFile deletes a file whose expiry has passed, as DeleteFileTree does.
+// Any client may call it, so a sweeper can remove the files of every MSP.
+// Like DeleteFileTree, it returns the stripes no other file holds.
+func (s *SmartContract) ExpireFile(ctx contractapi.TransactionContextInterface, fileHash string) (*DeletedFile, error) {
+	header, err := getFileTreeHeader(ctx, fileHash)
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, fmt.Errorf("FileTree does not exist")
+	}
+
+	now, err := transactionTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	expire, err := parseTimestamp("expiry", header.ExpireAt)
+	if err != nil {
+		return nil, err
+	}
+	if expire.IsZero() || now.Before(expire) {
+		return nil, fmt.Errorf("file %s has not expired", fileHash)
+	}
+	err = checkDeletable(ctx, header)
+	if err != nil {
+		return nil, err
+	}
+
+	return deleteFileTree(ctx, header)
+}
+
+func getClient(ctx contractapi.TransactionContextInterface) (string, string, error) {
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get client ID: %v", err)
+	}
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get client MSP ID: %v", err)
+	}
+	return clientID, mspID, nil
+}
+
+func getLegalHold(ctx contractapi.TransactionContextInterface, fileHash string, holdID string) (*LegalHold, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(legalHoldObjectType, []string{fileHash, holdID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create legal hold key: %v", err)
+	}
+	holdJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read legal hold from state: %v", err)
+	}
+	if holdJSON == nil {
+		return nil, nil
+	}
+
+	var hold LegalHold
+	err = json.Unmarshal(holdJSON, &hold)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal legal hold: %v", err)
+	}
+	return &hold, nil
+}
+
+// getLegalHolds returns every hold of a file, active or released, in the
+// order of their IDs.
+func getLegalHolds(ctx contractapi.TransactionContextInterface, fileHash string) ([]*LegalHold, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(legalHoldObjectType, []string{fileHash})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read legal holds from state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	holds := make([]*LegalHold, 0)
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var hold LegalHold
+		err = json.Unmarshal(queryResponse.Value, &hold)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal legal hold: %v", err)
+		}
+		holds = append(holds, &hold)
+	}
+	return holds, nil
+}
@@ -0,0 +1,210 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/mocks"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var admin = clientIdentity{id: "x509::CN=Admin@org1.example.com", mspID: "Org1MSP", admin: true}
+
+// setTxTime moves the transaction timestamp of the world state by days.
+func setTxTime(chaincodeStub *mocks.ChaincodeStub, days int) {
+	chaincodeStub.GetTxTimestampReturns(timestamppb.New(txTime.AddDate(0, 0, days)), nil)
+}
+
+func TestRetention(t *testing.T) {
+	transactionContext, chaincodeStub, _ := newWorldState()
+	storage := chaincode.SmartContract{}
+
+	fileHash := testHash("file")
+	metadata := `{"tags":[],"contentType":"text/plain","retainUntil":"2023-06-01T00:00:00+02:00"}`
+	_, err := storage.StoreFileTree(transactionContext, fileHash, marshal(t, testFileTree(fileHash, 1)), metadata)
+	require.NoError(t, err)
+
+	retention, err := storage.GetRetention(transactionContext, fileHash)
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.Retention{FileHash: fileHash, RetainUntil: "2023-05-31T22:00:00Z", Holds: []*chaincode.LegalHold{}}, retention)
+	_, err = storage.DeleteFileTree(transactionContext, fileHash)
+	require.EqualError(t, err, "file "+fileHash+" is retained until 2023-05-31T22:00:00Z")
+
+	tests := []struct {
+		name        string
+		client      clientIdentity
+		retainUntil string
+		expireAt    string
+		err         string
+	}{
+		{"shortened", user1, "2023-05-15T00:00:00Z", "", "retention of file " + fileHash + " cannot be shortened from 2023-05-31T22:00:00Z"},
+		{"expiring first", user1, "", "2023-05-20T00:00:00Z", "file " + fileHash + " cannot expire at 2023-05-20T00:00:00Z before its retention ends at 2023-05-31T22:00:00Z"},
+		{"invalid", user1, "next month", "", `invalid retention "next month"`},
+		{"other MSP", clientIdentity{id: "x509::CN=User1@org2.example.com", mspID: "Org2MSP"}, "2023-07-01T00:00:00Z", "", "submitting client not authorized to set the retention of files of other MSPs"},
+		{"owner", user1, "2023-07-01T00:00:00Z", "2023-08-01T00:00:00Z", ""},
+		{"admin of another MSP", clientIdentity{id: "x509::CN=Admin@org2.example.com", mspID: "Org2MSP", admin: true}, "2023-07-01T00:00:00Z", "2023-08-01T00:00:00Z", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transactionContext.GetClientIdentityReturns(test.client)
+			err := storage.SetRetention(transactionContext, fileHash, test.retainUntil, test.expireAt)
+			if test.err != "" {
+				require.ErrorContains(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			eventName, payload := chaincodeStub.SetEventArgsForCall(chaincodeStub.SetEventCallCount() - 1)
+			require.Equal(t, chaincode.SetRetentionEvent, eventName)
+			require.JSONEq(t, `{"fileHash":"`+fileHash+`","retainUntil":"2023-07-01T00:00:00Z","expireAt":"2023-08-01T00:00:00Z"}`, string(payload))
+		})
+	}
+	transactionContext.GetClientIdentityReturns(user1)
+
+	// Storing the file again keeps its owner and retention, and only the
+	// owner MSP and admins may set a retention with it
+	other := clientIdentity{id: "x509::CN=User1@org2.example.com", mspID: "Org2MSP"}
+	transactionContext.GetClientIdentityReturns(other)
+	_, err = storage.StoreFileTree(transactionContext, fileHash, marshal(t, testFileTree(fileHash, 1)), "")
+	require.NoError(t, err)
+	_, err = storage.StoreFileTree(transactionContext, fileHash, marshal(t, testFileTree(fileHash, 1)), `{"expireAt":"2023-07-02T00:00:00Z"}`)
+	require.ErrorContains(t, err, "submitting client not authorized to set the retention of files of other MSPs")
+	stored, err := storage.GetFileMetadata(transactionContext, fileHash)
+	require.NoError(t, err)
+	require.Equal(t, "Org1MSP", stored.Owner)
+	require.Equal(t, user1.id, stored.Uploader)
+
+	transactionContext.GetClientIdentityReturns(user1)
+	_, err = storage.StoreFileTree(transactionContext, fileHash, marshal(t, testFileTree(fileHash, 1)), `{"tags":[],"contentType":"","retainUntil":"2023-06-01T00:00:00Z"}`)
+	require.ErrorContains(t, err, "cannot be shortened")
+	retention, err = storage.GetRetention(transactionContext, fileHash)
+	require.NoError(t, err)
+	require.Equal(t, "2023-07-01T00:00:00Z", retention.RetainUntil)
+	require.Equal(t, "2023-08-01T00:00:00Z", retention.ExpireAt)
+
+	// An empty expiry keeps the file until it is deleted
+	require.NoError(t, storage.SetRetention(transactionContext, fileHash, "", ""))
+	retention, err = storage.GetRetention(transactionContext, fileHash)
+	require.NoError(t, err)
+	require.Equal(t, "2023-07-01T00:00:00Z", retention.RetainUntil)
+	require.Empty(t, retention.ExpireAt)
+
+	setTxTime(chaincodeStub, 61)
+	_, err = storage.DeleteFileTree(transactionContext, fileHash)
+	require.NoError(t, err)
+}
+
+func TestLegalHold(t *testing.T) {
+	transactionContext, chaincodeStub, _ := newWorldState()
+	storage := chaincode.SmartContract{}
+	fileHash := storeTestFile(t, transactionContext, "file")
+
+	require.EqualError(t, storage.SetLegalHold(transactionContext, fileHash, "case-1", "litigation"), "submitting client not authorized to set legal holds, does not have storage.admin attribute")
+	transactionContext.GetClientIdentityReturns(admin)
+	require.EqualError(t, storage.SetLegalHold(transactionContext, testHash("missing"), "case-1", "litigation"), "file "+testHash("missing")+" does not exist")
+	require.NoError(t, storage.SetLegalHold(transactionContext, fileHash, "case-1", "litigation"))
+	require.EqualError(t, storage.SetLegalHold(transactionContext, fileHash, "case-1", "again"), "legal hold case-1 of file "+fileHash+" already exists")
+	eventName, payload := chaincodeStub.SetEventArgsForCall(chaincodeStub.SetEventCallCount() - 1)
+	require.Equal(t, chaincode.SetLegalHoldEvent, eventName)
+	var hold chaincode.LegalHold
+	require.NoError(t, json.Unmarshal(payload, &hold))
+	require.Equal(t, admin.id, hold.SetBy)
+
+	// The hold outlasts the retention
+	_, err := storage.DeleteFileTree(transactionContext, fileHash)
+	require.EqualError(t, err, "file "+fileHash+" is under legal hold case-1")
+
+	transactionContext.GetClientIdentityReturns(user1)
+	require.ErrorContains(t, storage.ReleaseLegalHold(transactionContext, fileHash, "case-1"), "not authorized to release legal holds")
+	releasedBy := clientIdentity{id: "x509::CN=Admin@org2.example.com", mspID: "Org2MSP", admin: true}
+	transactionContext.GetClientIdentityReturns(releasedBy)
+	require.EqualError(t, storage.ReleaseLegalHold(transactionContext, fileHash, "case-2"), "file "+fileHash+" has no active legal hold case-2")
+	setTxTime(chaincodeStub, 1)
+	require.NoError(t, storage.ReleaseLegalHold(transactionContext, fileHash, "case-1"))
+	require.EqualError(t, storage.ReleaseLegalHold(transactionContext, fileHash, "case-1"), "file "+fileHash+" has no active legal hold case-1")
+
+	retention, err := storage.GetRetention(transactionContext, fileHash)
+	require.NoError(t, err)
+	require.Equal(t, []*chaincode.LegalHold{{
+		FileHash:      fileHash,
+		HoldID:        "case-1",
+		Reason:        "litigation",
+		Active:        false,
+		SetBy:         admin.id,
+		SetByMSP:      "Org1MSP",
+		SetAt:         "2023-05-01T12:00:00Z",
+		ReleasedBy:    releasedBy.id,
+		ReleasedByMSP: "Org2MSP",
+		ReleasedAt:    "2023-05-02T12:00:00Z",
+	}}, retention.Holds)
+
+	// A released hold ID is not reused, its record stays
+	require.ErrorContains(t, storage.SetLegalHold(transactionContext, fileHash, "case-1", "again"), "already exists")
+	_, err = storage.DeleteFileTree(transactionContext, fileHash)
+	require.NoError(t, err)
+}
+
+func TestExpireFiles(t *testing.T) {
+	transactionContext, chaincodeStub, state := newWorldState()
+	storage := chaincode.SmartContract{}
+
+	store := func(name string, expireAt string) string {
+		fileHash := testHash(name)
+		metadata := `{"tags":[],"contentType":"","expireAt":"` + expireAt + `"}`
+		_, err := storage.StoreFileTree(transactionContext, fileHash, marshal(t, testFileTree(fileHash, 1)), metadata)
+		require.NoError(t, err)
+		return fileHash
+	}
+	late := store("late", "2023-05-10T00:00:00Z")
+	early := store("early", "2023-05-03T00:00:00Z")
+	held := store("held", "2023-05-02T00:00:00Z")
+	kept := storeTestFile(t, transactionContext, "kept")
+	transactionContext.GetClientIdentityReturns(admin)
+	require.NoError(t, storage.SetLegalHold(transactionContext, held, "audit", ""))
+	transactionContext.GetClientIdentityReturns(user1)
+
+	_, err := storage.ListExpiredFiles(transactionContext, 0)
+	require.EqualError(t, err, "limit must be between 1 and 1000")
+	expired, err := storage.ListExpiredFiles(transactionContext, 10)
+	require.NoError(t, err)
+	require.Empty(t, expired)
+	_, err = storage.ExpireFile(transactionContext, early)
+	require.EqualError(t, err, "file "+early+" has not expired")
+
+	setTxTime(chaincodeStub, 5)
+	expired, err = storage.ListExpiredFiles(transactionContext, 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{early}, expired)
+	_, err = storage.ExpireFile(transactionContext, held)
+	require.EqualError(t, err, "file "+held+" is under legal hold audit")
+	_, err = storage.ExpireFile(transactionContext, kept)
+	require.EqualError(t, err, "file "+kept+" has not expired")
+
+	// Any client may expire a file
+	transactionContext.GetClientIdentityReturns(clientIdentity{id: "x509::CN=Sweeper@org2.example.com", mspID: "Org2MSP"})
+	_, err = storage.ExpireFile(transactionContext, early)
+	require.NoError(t, err)
+	eventName, payload := chaincodeStub.SetEventArgsForCall(chaincodeStub.SetEventCallCount() - 1)
+	require.Equal(t, chaincode.DeleteFileTreeEvent, eventName)
+	require.JSONEq(t, `{"fileHash":"`+early+`"}`, string(payload))
+
+	setTxTime(chaincodeStub, 30)
+	expired, err = storage.ListExpiredFiles(transactionContext, 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{late}, expired)
+	_, err = storage.ExpireFile(transactionContext, late)
+	require.NoError(t, err)
+
+	// Only the expiry of the held file is left in the state
+	expiries := 0
+	for key := range state {
+		if strings.HasPrefix(key, "\x00expiry\x00") {
+			expiries++
+		}
+	}
+	require.Equal(t, 1, expiries)
+	_, err = storage.GetRetention(transactionContext, late)
+	require.EqualError(t, err, "file "+late+" does not exist")
+}
@@ -1,48 +1,233 @@
 package chaincode
 
 import (
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
-	"math/big"
 	"sort"
+	"strings"
+	"time"
 
+	"github.com/hyperledger/fabric-chaincode-go/shim"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/schema"
 )
 
 type SmartContract struct {
 	contractapi.Contract
 }
 
-type Slot struct {
-	StartSlot    int     `json:"startSlot"`
-	EndSlot      int     `json:"endSlot"`
+// The records of the contract are defined in the schema package, which the
+// clients of the contract share.
+type (
+	Slot                = schema.Slot
+	HashSlotTable       = schema.HashSlotTable
+	WeightTable         = schema.WeightTable
+	Chunk               = schema.Chunk
+	StripeTree          = schema.StripeTree
+	FileTree            = schema.FileTree
+	FileTreeHeader      = schema.FileTreeHeader
+	FileTreeSegment     = schema.FileTreeSegment
+	DeletedFile         = schema.DeletedFile
+	FileMetadata        = schema.FileMetadata
+	FileMetadataInput   = schema.FileMetadataInput
+	PaginatedFileResult = schema.PaginatedFileResult
+	FileEvent           = schema.FileEvent
+	OrgEvent            = schema.OrgEvent
+	QuotaEvent          = schema.QuotaEvent
+	Usage               = schema.Usage
+	LegalHold           = schema.LegalHold
+	Retention           = schema.Retention
+	RetentionEvent      = schema.RetentionEvent
+	Bucket              = schema.Bucket
+	ObjectInput         = schema.ObjectInput
+	Object              = schema.Object
+	ObjectPage          = schema.ObjectPage
+	ObjectEvent         = schema.ObjectEvent
+	Ref                 = schema.Ref
+	RefHistoryRecord    = schema.RefHistoryRecord
+	RefEvent            = schema.RefEvent
+	PaymentConfig       = schema.PaymentConfig
+	Escrow              = schema.Escrow
+	ShardReport         = schema.ShardReport
+	PayoutAccountEvent  = schema.PayoutAccountEvent
+	Settlement          = schema.Settlement
+)
+
+// Events emitted by the contract. Fabric keeps a single event per
+// transaction, so every function sets at most one.
+const (
+	StoreFileTreeEvent       = schema.StoreFileTreeEvent
+	DeleteFileTreeEvent      = schema.DeleteFileTreeEvent
+	UpdateOrgWeightEvent     = schema.UpdateOrgWeightEvent
+	RemoveOrgEvent           = schema.RemoveOrgEvent
+	CreateHashSlotTableEvent = schema.CreateHashSlotTableEvent
+	SetQuotaEvent            = schema.SetQuotaEvent
+)
+
+// StripeIndex is the value of a stripe index entry.
+type StripeIndex struct {
+	Index int `json:"index"`
+}
+
+// ShardLocation lists the holders of one chunk of a stripe: the node storing
+// the chunk, followed by its home node when the chunk was moved away from it.
+// The home node keeps a link to the node storing the chunk. When the hash
+// slot table changed since the file was stored, the nodes the table of its
+// upload placed the chunk on follow, for chunks not moved yet.
+type ShardLocation struct {
+	Index     int      `json:"index"`
+	ChunkHash string   `json:"chunkHash"`
+	Holders   []string `json:"holders"`
+}
+
+// StripeLocation is the result of LocateStripe, one shard per chunk in chunk
+// order.
+type StripeLocation struct {
+	StripeHash string          `json:"stripeHash"`
+	Shards     []ShardLocation `json:"shards"`
 }
 
-type HashSlotTable struct {
-	HST map[string]Slot `json:"hashSlotTable"`
+// Files live under composite keys, apart from the weight and hash slot tables:
+// the tree header under fileTree~fileHash, its segments under
+// fileTreeSegment~fileHash~index and the metadata under file~fileHash.
+const fileTreeObjectType = "fileTree"
+const fileTreeSegmentObjectType = "fileTreeSegment"
+const fileObjectType = "file"
+
+// Every stripe is also indexed under stripe~stripeHash~fileHash, holding its
+// position in the file, so that LocateStripe can find its chunks.
+const stripeObjectType = "stripe"
+
+// Every chunk is indexed under chunk~chunkHash~fileHash too. Chunks are
+// addressed by their content, so different stripes may share one, e.g. the
+// zero padding of the last stripe of files, and a deleted file keeps the
+// chunks another file holds.
+const chunkObjectType = "chunk"
+
+// Every hash slot table is also kept under hashSlotTable~epoch, so the chunks
+// of files stored with a replaced table can still be found.
+const hashSlotTableObjectType = "hashSlotTable"
+
+// stripesPerSegment keeps a segment around 300 KB, six 64-character chunk
+// hashes per stripe.
+const stripesPerSegment = 512
+
+var weightTableKey = "wt"
+var hashSlotKey = "slt"
+
+// codecShards is the number of chunks, data and parity, each codec of
+// my-application codes a stripe into. Trees naming no codec use rs-6-3.
+// Every codec may compress stripes first, which is named by a "zstd+"
+// prefix and leaves the number of chunks unchanged.
+var codecShards = map[string]int{
+	"":          6,
+	"rs-6-3":    6,
+	"lrc-4-2-2": 8,
+	"rep-3":     3,
 }
 
-type WeightTable struct {
-	WT map[string]int `json:"orgWeightTable"`
+// validateCodec returns the number of chunks per stripe of a codec.
+func validateCodec(codec string) (int, error) {
+	chunks, ok := codecShards[strings.TrimPrefix(codec, "zstd+")]
+	if !ok || codec == "zstd+" {
+		return 0, fmt.Errorf("unknown codec %q", codec)
+	}
+	return chunks, nil
 }
 
-// storing the file tree
-type Chunk struct {
-	ChunkHash string `json:"chunkHash"`
+// validateHash checks that hash is a hex encoded SHA-256 digest, as produced
+// by my-application.
+func validateHash(kind string, hash string) error {
+	if len(hash) != 2*sha256.Size {
+		return fmt.Errorf("invalid %s hash %q: expected %d hex characters", kind, hash, 2*sha256.Size)
+	}
+	for _, c := range hash {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return fmt.Errorf("invalid %s hash %q: expected lowercase hex characters", kind, hash)
+		}
+	}
+	return nil
 }
 
-type StripeTree struct {
-	StripeHash  string    `json:"stripeHash"`
-	ChunkHashes []Chunk  `json:"chunkHashes"`
+func validateFileHash(fileHash string) error {
+	if fileHash == "" {
+		return fmt.Errorf("file hash must not be empty")
+	}
+	if fileHash == weightTableKey || fileHash == hashSlotKey {
+		return fmt.Errorf("file hash %q is a reserved key", fileHash)
+	}
+	return validateHash("file", fileHash)
 }
 
-type FileTree struct {
-	StripeHashes []StripeTree  `json:"stripeHashes"`
+// validateStripes checks the hashes of stripes and that each has chunks
+// chunks, numbering the stripes from first in error messages.
+func validateStripes(stripes []StripeTree, first int, chunks int) error {
+	for i, stripe := range stripes {
+		if err := validateHash("stripe", stripe.StripeHash); err != nil {
+			return fmt.Errorf("stripe %d: %v", first+i, err)
+		}
+		if len(stripe.ChunkHashes) != chunks {
+			return fmt.Errorf("stripe %d: has %d chunks, expected %d", first+i, len(stripe.ChunkHashes), chunks)
+		}
+		for j, chunk := range stripe.ChunkHashes {
+			if err := validateHash("chunk", chunk.ChunkHash); err != nil {
+				return fmt.Errorf("stripe %d chunk %d: %v", first+i, j, err)
+			}
+		}
+	}
+	return nil
 }
 
-var weightTableKey = "wt"
-var hashSlotKey = "slt"
-var numOfSlots = 16384
+// decodeStrict unmarshals data into v, rejecting unknown fields and trailing
+// data.
+func decodeStrict(data string, v interface{}) error {
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return fmt.Errorf("unexpected data after JSON value")
+	}
+	return nil
+}
+
+// parseFileTree decodes and validates the tree of the file fileHash.
+func parseFileTree(fileHash string, fileTreeJSON string) (*FileTree, error) {
+	var fileTree FileTree
+	if err := decodeStrict(fileTreeJSON, &fileTree); err != nil {
+		return nil, fmt.Errorf("invalid FileTree: %v", err)
+	}
+	if fileTree.FileHash != "" && fileTree.FileHash != fileHash {
+		return nil, fmt.Errorf("invalid FileTree: tree of file %s stored as %s", fileTree.FileHash, fileHash)
+	}
+	if fileTree.FileSize < 0 {
+		return nil, fmt.Errorf("invalid FileTree: negative file size %d", fileTree.FileSize)
+	}
+	chunks, err := validateCodec(fileTree.Codec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid FileTree: %v", err)
+	}
+	if err := validateStripes(fileTree.StripeHashes, 0, chunks); err != nil {
+		return nil, fmt.Errorf("invalid FileTree: %v", err)
+	}
+	return &fileTree, nil
+}
+
+func setEvent(ctx contractapi.TransactionContextInterface, name string, payload interface{}) error {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s event: %v", name, err)
+	}
+
+	err = ctx.GetStub().SetEvent(name, payloadJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set %s event: %v", name, err)
+	}
+
+	return nil
+}
 
 func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface) error {
 	// Create an empty weight table to initialize the weight of each org
@@ -64,6 +249,10 @@ func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface)
 }
 
 func (s *SmartContract) UpdateOrgWeight(ctx contractapi.TransactionContextInterface, orgID string, weight int) error {
+	if weight < 0 {
+		return fmt.Errorf("weight of org %s must not be negative", orgID)
+	}
+
 	weightTableJSON, err := ctx.GetStub().GetState(weightTableKey)
 	if err != nil {
 		return fmt.Errorf("failed to read weight table from state: %v", err)
@@ -94,38 +283,181 @@ func (s *SmartContract) UpdateOrgWeight(ctx contractapi.TransactionContextInterf
 		return fmt.Errorf("failed to update weight table in state: %v", err)
 	}
 
-	return nil
+	return setEvent(ctx, UpdateOrgWeightEvent, OrgEvent{OrgID: orgID, Weight: weight})
 }
 
-func (s *SmartContract) GetOrgID(ctx contractapi.TransactionContextInterface, stripeHash string) (string, error) {
-	hashInt := new(big.Int)
-	hashInt.SetString(stripeHash, 16)
-	hashMod := hashInt.Mod(hashInt, big.NewInt(int64(numOfSlots)))
-	slotID := int(hashMod.Int64())
+func (s *SmartContract) RemoveOrg(ctx contractapi.TransactionContextInterface, orgID string) error {
+	weightTableJSON, err := ctx.GetStub().GetState(weightTableKey)
+	if err != nil {
+		return fmt.Errorf("failed to read weight table from state: %v", err)
+	}
 
-	hashSlotTableJSON, err := ctx.GetStub().GetState(hashSlotKey)
+	if weightTableJSON == nil {
+		return fmt.Errorf("empty weight table")
+	}
+
+	var weightTable WeightTable
+	err = json.Unmarshal(weightTableJSON, &weightTable)
 	if err != nil {
-		return "", fmt.Errorf("failed to read hash slot table from state: %v", err)
+		return fmt.Errorf("failed to unmarshal weight table: %v", err)
 	}
 
-	var hashSlotTable HashSlotTable
+	if _, ok := weightTable.WT[orgID]; !ok {
+		return fmt.Errorf("org %s does not exist", orgID)
+	}
+	delete(weightTable.WT, orgID)
 
-	if hashSlotTableJSON == nil {
-		return "", fmt.Errorf("hash slot table does not exist")
-	} else {
-		err = json.Unmarshal(hashSlotTableJSON, &hashSlotTable)
+	updatedWeightTableJSON, err := json.Marshal(weightTable)
+	if err != nil {
+		return fmt.Errorf("failed to marshal updated weight table: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(weightTableKey, updatedWeightTableJSON)
+	if err != nil {
+		return fmt.Errorf("failed to update weight table in state: %v", err)
+	}
+
+	return setEvent(ctx, RemoveOrgEvent, OrgEvent{OrgID: orgID})
+}
+
+// GetOrgID returns the org whose slot range holds the hash.
+func (s *SmartContract) GetOrgID(ctx contractapi.TransactionContextInterface, stripeHash string) (string, error) {
+	hashSlotTable, err := getHashSlotTable(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	orgID, ok := schema.NewSlotRing(*hashSlotTable).Lookup(schema.SlotID(stripeHash))
+	if !ok {
+		return "", fmt.Errorf("no orgID found for hash value")
+	}
+	return orgID, nil
+}
+
+// LocateStripe returns the holders of every chunk of a stored stripe. The
+// chunks are placed by schema.PlaceStripe, the rules my-application writes
+// them by.
+func (s *SmartContract) LocateStripe(ctx contractapi.TransactionContextInterface, stripeHash string) (*StripeLocation, error) {
+	if err := validateHash("stripe", stripeHash); err != nil {
+		return nil, err
+	}
+
+	stripe, header, err := getStripe(ctx, stripeHash)
+	if err != nil {
+		return nil, err
+	}
+
+	hashSlotTable, err := getHashSlotTable(ctx)
+	if err != nil {
+		return nil, err
+	}
+	chunkHashes := make([]string, len(stripe.ChunkHashes))
+	for i, chunk := range stripe.ChunkHashes {
+		chunkHashes[i] = chunk.ChunkHash
+	}
+	home, actual := schema.NewSlotRing(*hashSlotTable).PlaceStripe(chunkHashes)
+	var uploadHome, uploadActual []string
+	if header.SlotTableEpoch != 0 && header.SlotTableEpoch != hashSlotTable.Epoch {
+		uploadTable, err := getHashSlotTableByEpoch(ctx, header.SlotTableEpoch)
 		if err != nil {
-			return "", fmt.Errorf("failed to unmarshal hash slot table: %v", err)
+			return nil, err
+		}
+		uploadHome, uploadActual = schema.NewSlotRing(*uploadTable).PlaceStripe(chunkHashes)
+	}
+
+	location := &StripeLocation{
+		StripeHash: stripeHash,
+		Shards:     make([]ShardLocation, len(chunkHashes)),
+	}
+	for i, chunkHash := range chunkHashes {
+		if home[i] == "" {
+			return nil, fmt.Errorf("no orgID found for chunk %s", chunkHash)
+		}
+		holders := appendHolder(nil, actual[i])
+		holders = appendHolder(holders, home[i])
+		if uploadActual != nil {
+			holders = appendHolder(holders, uploadActual[i])
+			holders = appendHolder(holders, uploadHome[i])
 		}
+		location.Shards[i] = ShardLocation{Index: i, ChunkHash: chunkHash, Holders: holders}
 	}
+	return location, nil
+}
 
-	for orgID, slot := range hashSlotTable.HST {
-		if slotID >= slot.StartSlot && slotID <= slot.EndSlot {
-			return orgID, nil
+// appendHolder appends a holder to holders unless it is listed already.
+func appendHolder(holders []string, orgID string) []string {
+	for _, holder := range holders {
+		if holder == orgID {
+			return holders
 		}
 	}
+	return append(holders, orgID)
+}
+
+// getStripe looks a stripe up through the stripe index, together with the
+// header of the file it is read from. The hashes of a stripe follow from its
+// content, so any file holding it will do; the first by file hash is read.
+func getStripe(ctx contractapi.TransactionContextInterface, stripeHash string) (*StripeTree, *FileTreeHeader, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(stripeObjectType, []string{stripeHash})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read stripe index from state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	if !resultsIterator.HasNext() {
+		return nil, nil, fmt.Errorf("stripe %s does not exist", stripeHash)
+	}
+	queryResponse, err := resultsIterator.Next()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to split stripe index key: %v", err)
+	}
+	var stripeIndex StripeIndex
+	err = json.Unmarshal(queryResponse.Value, &stripeIndex)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal stripe index: %v", err)
+	}
+
+	fileHash := attributes[1]
+	header, err := getFileTreeHeader(ctx, fileHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	if header == nil {
+		return nil, nil, fmt.Errorf("FileTree %s of stripe %s does not exist", fileHash, stripeHash)
+	}
+	segment, err := getFileTreeSegment(ctx, fileHash, stripeIndex.Index/header.SegmentSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	i := stripeIndex.Index % header.SegmentSize
+	if i >= len(segment.StripeHashes) || segment.StripeHashes[i].StripeHash != stripeHash {
+		return nil, nil, fmt.Errorf("stripe index of %s is out of date", stripeHash)
+	}
+	return &segment.StripeHashes[i], header, nil
+}
+
+func getHashSlotTable(ctx contractapi.TransactionContextInterface) (*HashSlotTable, error) {
+	hashSlotTableJSON, err := ctx.GetStub().GetState(hashSlotKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hash slot table from state: %v", err)
+	}
+
+	if hashSlotTableJSON == nil {
+		return nil, fmt.Errorf("hash slot table does not exist")
+	}
 
-	return "", fmt.Errorf("no orgID found for hash value")
+	var hashSlotTable HashSlotTable
+	err = json.Unmarshal(hashSlotTableJSON, &hashSlotTable)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal hash slot table: %v", err)
+	}
+	return &hashSlotTable, nil
 }
 
 func (s *SmartContract) CreateHashSlotTable(ctx contractapi.TransactionContextInterface) error {
@@ -145,35 +477,25 @@ func (s *SmartContract) CreateHashSlotTable(ctx contractapi.TransactionContextIn
 		}
 	}
 
-	orgIDs := make([]string, 0)
-
-	totalWeight := 0
-	for orgID, weight := range weightTable.WT {
-		orgIDs = append(orgIDs, orgID)
-		totalWeight += weight
+	hashSlotTable, err := schema.AllocateSlots(weightTable.WT)
+	if err != nil {
+		return err
 	}
-	sort.Strings(orgIDs)
 
-	hashSlotTable := HashSlotTable{
-		HST: make(map[string]Slot),
+	// The table replaced stays under its epoch, which the new one follows
+	previousJSON, err := ctx.GetStub().GetState(hashSlotKey)
+	if err != nil {
+		return fmt.Errorf("failed to read hash slot table from state: %v", err)
 	}
-	startSlot := 0
-	var lastOrg string
-
-	for _, orgID := range orgIDs {
-		endSlot := startSlot + weightTable.WT[orgID]*numOfSlots/totalWeight
-		hashSlotTable.HST[orgID] = Slot{
-			StartSlot: startSlot,
-			EndSlot:   endSlot,
+	if previousJSON != nil {
+		var previous HashSlotTable
+		err = json.Unmarshal(previousJSON, &previous)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal hash slot table: %v", err)
 		}
-		startSlot = endSlot + 1
-		lastOrg = orgID
-	}
-
-	if entry, ok := hashSlotTable.HST[lastOrg]; ok {
-		entry.EndSlot = numOfSlots
-		hashSlotTable.HST[lastOrg] = entry
+		hashSlotTable.Epoch = previous.Epoch
 	}
+	hashSlotTable.Epoch++
 
 	hashSlotTableJSON, err := json.Marshal(hashSlotTable)
 	if err != nil {
@@ -184,6 +506,20 @@ func (s *SmartContract) CreateHashSlotTable(ctx contractapi.TransactionContextIn
 	if err != nil {
 		return fmt.Errorf("failed to update hash slot table in state: %v", err)
 	}
+	epochKey, err := hashSlotTableEpochKey(ctx, hashSlotTable.Epoch)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().PutState(epochKey, hashSlotTableJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put hash slot table of epoch %d in state: %v", hashSlotTable.Epoch, err)
+	}
+
+	// The event carries the whole table so listeners need not query it
+	err = ctx.GetStub().SetEvent(CreateHashSlotTableEvent, hashSlotTableJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set %s event: %v", CreateHashSlotTableEvent, err)
+	}
 	return nil
 }
 
@@ -200,26 +536,1359 @@ func (s *SmartContract) GetHashSlotTable(ctx contractapi.TransactionContextInter
 	return string(hashSlotTableJSON), nil
 }
 
-func (s *SmartContract) GetFileTree(ctx contractapi.TransactionContextInterface, fileHash string) (string, error) {
-	args, err := ctx.GetStub().GetState(fileHash)
+// GetHashSlotTableByEpoch returns the hash slot table of an epoch, current or
+// replaced, the one the chunks of files stored with it were placed by.
+func (s *SmartContract) GetHashSlotTableByEpoch(ctx contractapi.TransactionContextInterface, epoch int) (string, error) {
+	key, err := hashSlotTableEpochKey(ctx, epoch)
+	if err != nil {
+		return "", err
+	}
+	hashSlotTableJSON, err := ctx.GetStub().GetState(key)
 	if err != nil {
-		return "", fmt.Errorf("failed to read FileTree from state: %v", err)
+		return "", fmt.Errorf("failed to read hash slot table of epoch %d from state: %v", epoch, err)
 	}
+	if hashSlotTableJSON == nil {
+		return "", fmt.Errorf("hash slot table of epoch %d does not exist", epoch)
+	}
+	return string(hashSlotTableJSON), nil
+}
 
-	if args == nil {
-		return "", fmt.Errorf("FileTree does not exist")
+func getHashSlotTableByEpoch(ctx contractapi.TransactionContextInterface, epoch int) (*HashSlotTable, error) {
+	key, err := hashSlotTableEpochKey(ctx, epoch)
+	if err != nil {
+		return nil, err
+	}
+	hashSlotTableJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hash slot table of epoch %d from state: %v", epoch, err)
+	}
+	if hashSlotTableJSON == nil {
+		return nil, fmt.Errorf("hash slot table of epoch %d does not exist", epoch)
 	}
 
-	return string(args), nil
+	var hashSlotTable HashSlotTable
+	err = json.Unmarshal(hashSlotTableJSON, &hashSlotTable)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal hash slot table of epoch %d: %v", epoch, err)
+	}
+	return &hashSlotTable, nil
 }
 
-func (s *SmartContract) StoreFileTree(ctx contractapi.TransactionContextInterface, fileHash string, fileTreeJSON string) (string, error) {
-	args := []byte(fileTreeJSON)
+// hashSlotTableEpochKey pads the epoch so the tables sort in order.
+func hashSlotTableEpochKey(ctx contractapi.TransactionContextInterface, epoch int) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(hashSlotTableObjectType, []string{fmt.Sprintf("%08d", epoch)})
+	if err != nil {
+		return "", fmt.Errorf("failed to create hash slot table key: %v", err)
+	}
+	return key, nil
+}
 
-	err := ctx.GetStub().PutState(fileHash, args)
+// ValidateHashSlotTable checks that the stored hash slot table gives every
+// slot to exactly one org.
+func (s *SmartContract) ValidateHashSlotTable(ctx contractapi.TransactionContextInterface) error {
+	hashSlotTable, err := getHashSlotTable(ctx)
 	if err != nil {
-		return "failed to store FileTree: failed to update FileTree in state", err
+		return err
 	}
 
-	return "FileTree stored successfully", nil
+	return schema.ValidateHashSlotTable(hashSlotTable)
+}
+
+func fileTreeKey(ctx contractapi.TransactionContextInterface, fileHash string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(fileTreeObjectType, []string{fileHash})
+}
+
+// fileTreeSegmentKey pads the index so the segments of a file sort in order.
+func fileTreeSegmentKey(ctx contractapi.TransactionContextInterface, fileHash string, index int) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(fileTreeSegmentObjectType, []string{fileHash, fmt.Sprintf("%08d", index)})
+}
+
+func fileMetadataKey(ctx contractapi.TransactionContextInterface, fileHash string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(fileObjectType, []string{fileHash})
+}
+
+// getFileTreeHeader returns the header of a file tree, or nil when there is
+// none.
+func getFileTreeHeader(ctx contractapi.TransactionContextInterface, fileHash string) (*FileTreeHeader, error) {
+	key, err := fileTreeKey(ctx, fileHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create FileTree key: %v", err)
+	}
+
+	headerJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read FileTree from state: %v", err)
+	}
+
+	if headerJSON == nil {
+		return nil, nil
+	}
+
+	var header FileTreeHeader
+	err = json.Unmarshal(headerJSON, &header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal FileTree header: %v", err)
+	}
+
+	return &header, nil
+}
+
+func putFileTreeHeader(ctx contractapi.TransactionContextInterface, header *FileTreeHeader) error {
+	key, err := fileTreeKey(ctx, header.FileHash)
+	if err != nil {
+		return fmt.Errorf("failed to create FileTree key: %v", err)
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return fmt.Errorf("failed to marshal FileTree header: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, headerJSON)
+	if err != nil {
+		return fmt.Errorf("failed to update FileTree in state: %v", err)
+	}
+
+	return nil
+}
+
+// segmentStripes returns the number of stripes segment index of header holds.
+func segmentStripes(header *FileTreeHeader, index int) int {
+	if index == header.Segments-1 {
+		return header.Stripes - index*header.SegmentSize
+	}
+	return header.SegmentSize
+}
+
+func putFileTreeSegment(ctx contractapi.TransactionContextInterface, header *FileTreeHeader, segment *FileTreeSegment) error {
+	if segment.Index < 0 || segment.Index >= header.Segments {
+		return fmt.Errorf("segment %d out of range, FileTree has %d segments", segment.Index, header.Segments)
+	}
+	if want := segmentStripes(header, segment.Index); len(segment.StripeHashes) != want {
+		return fmt.Errorf("segment %d holds %d stripes, expected %d", segment.Index, len(segment.StripeHashes), want)
+	}
+	chunks, err := validateCodec(header.Codec)
+	if err != nil {
+		return err
+	}
+	if err := validateStripes(segment.StripeHashes, segment.Index*header.SegmentSize, chunks); err != nil {
+		return fmt.Errorf("invalid FileTree segment %d: %v", segment.Index, err)
+	}
+
+	key, err := fileTreeSegmentKey(ctx, header.FileHash, segment.Index)
+	if err != nil {
+		return fmt.Errorf("failed to create FileTree segment key: %v", err)
+	}
+
+	// A segment stored again replaces the index entries of the old one
+	oldSegmentJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return fmt.Errorf("failed to read FileTree segment from state: %v", err)
+	}
+	if oldSegmentJSON != nil {
+		if err := deleteStripeIndex(ctx, header.FileHash, oldSegmentJSON); err != nil {
+			return err
+		}
+	}
+
+	segmentJSON, err := json.Marshal(segment)
+	if err != nil {
+		return fmt.Errorf("failed to marshal FileTree segment: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, segmentJSON)
+	if err != nil {
+		return fmt.Errorf("failed to update FileTree segment in state: %v", err)
+	}
+
+	for i, stripe := range segment.StripeHashes {
+		indexKey, err := ctx.GetStub().CreateCompositeKey(stripeObjectType, []string{stripe.StripeHash, header.FileHash})
+		if err != nil {
+			return fmt.Errorf("failed to create stripe index key: %v", err)
+		}
+		indexJSON, err := json.Marshal(StripeIndex{Index: segment.Index*header.SegmentSize + i})
+		if err != nil {
+			return fmt.Errorf("failed to marshal stripe index: %v", err)
+		}
+		err = ctx.GetStub().PutState(indexKey, indexJSON)
+		if err != nil {
+			return fmt.Errorf("failed to update stripe index in state: %v", err)
+		}
+
+		for _, chunk := range stripe.ChunkHashes {
+			indexKey, err := ctx.GetStub().CreateCompositeKey(chunkObjectType, []string{chunk.ChunkHash, header.FileHash})
+			if err != nil {
+				return fmt.Errorf("failed to create chunk index key: %v", err)
+			}
+			err = ctx.GetStub().PutState(indexKey, []byte{0x00})
+			if err != nil {
+				return fmt.Errorf("failed to update chunk index in state: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// deleteStripeIndex deletes the index entries of the stripes and chunks of a
+// stored segment.
+func deleteStripeIndex(ctx contractapi.TransactionContextInterface, fileHash string, segmentJSON []byte) error {
+	var segment FileTreeSegment
+	err := json.Unmarshal(segmentJSON, &segment)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal FileTree segment: %v", err)
+	}
+
+	for _, stripe := range segment.StripeHashes {
+		indexKey, err := ctx.GetStub().CreateCompositeKey(stripeObjectType, []string{stripe.StripeHash, fileHash})
+		if err != nil {
+			return fmt.Errorf("failed to create stripe index key: %v", err)
+		}
+		err = ctx.GetStub().DelState(indexKey)
+		if err != nil {
+			return fmt.Errorf("failed to delete stripe index from state: %v", err)
+		}
+
+		for _, chunk := range stripe.ChunkHashes {
+			indexKey, err := ctx.GetStub().CreateCompositeKey(chunkObjectType, []string{chunk.ChunkHash, fileHash})
+			if err != nil {
+				return fmt.Errorf("failed to create chunk index key: %v", err)
+			}
+			err = ctx.GetStub().DelState(indexKey)
+			if err != nil {
+				return fmt.Errorf("failed to delete chunk index from state: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// deleteFileTreeSegments deletes every segment of a file tree and returns the
+// stripes they held.
+func deleteFileTreeSegments(ctx contractapi.TransactionContextInterface, fileHash string) ([]StripeTree, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(fileTreeSegmentObjectType, []string{fileHash})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read FileTree segments from state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	var stripes []StripeTree
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var segment FileTreeSegment
+		err = json.Unmarshal(queryResponse.Value, &segment)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal FileTree segment: %v", err)
+		}
+		stripes = append(stripes, segment.StripeHashes...)
+
+		err = deleteStripeIndex(ctx, fileHash, queryResponse.Value)
+		if err != nil {
+			return nil, err
+		}
+		err = ctx.GetStub().DelState(queryResponse.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete FileTree segment from state: %v", err)
+		}
+	}
+
+	return stripes, nil
+}
+
+// unreferencedStripes returns the stripes of a deleted file, each once, that
+// no other file holds according to the stripe index, and the chunks of them
+// that other files hold nevertheless. A transaction does not read its own
+// deletes, so the index entries of the deleted file are skipped.
+func unreferencedStripes(ctx contractapi.TransactionContextInterface, fileHash string, stripes []StripeTree) ([]StripeTree, []string, error) {
+	unreferenced := []StripeTree{}
+	sharedChunks := []string{}
+	seen := make(map[string]bool)
+	for _, stripe := range stripes {
+		if seen[stripe.StripeHash] {
+			continue
+		}
+		seen[stripe.StripeHash] = true
+
+		referenced, err := referencedElsewhere(ctx, stripeObjectType, stripe.StripeHash, fileHash)
+		if err != nil {
+			return nil, nil, err
+		}
+		if referenced {
+			continue
+		}
+		unreferenced = append(unreferenced, stripe)
+
+		for _, chunk := range stripe.ChunkHashes {
+			if seen[chunk.ChunkHash] {
+				continue
+			}
+			seen[chunk.ChunkHash] = true
+
+			referenced, err := referencedElsewhere(ctx, chunkObjectType, chunk.ChunkHash, fileHash)
+			if err != nil {
+				return nil, nil, err
+			}
+			if referenced {
+				sharedChunks = append(sharedChunks, chunk.ChunkHash)
+			}
+		}
+	}
+	return unreferenced, sharedChunks, nil
+}
+
+// referencedElsewhere reports whether the stripe or chunk index holds an
+// entry for the hash of a file other than fileHash.
+func referencedElsewhere(ctx contractapi.TransactionContextInterface, objectType string, hash string, fileHash string) (bool, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(objectType, []string{hash})
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s index from state: %v", objectType, err)
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return false, err
+		}
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return false, fmt.Errorf("failed to split %s index key: %v", objectType, err)
+		}
+		if attributes[1] != fileHash {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetFileTree assembles the whole tree of a file from its segments. The
+// result grows with the file; large trees are better read with
+// GetFileTreeHeader and GetFileTreeSegment.
+func (s *SmartContract) GetFileTree(ctx contractapi.TransactionContextInterface, fileHash string) (string, error) {
+	header, err := getFileTreeHeader(ctx, fileHash)
+	if err != nil {
+		return "", err
+	}
+
+	if header == nil || !header.Complete {
+		return "", fmt.Errorf("FileTree does not exist")
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(fileTreeSegmentObjectType, []string{fileHash})
+	if err != nil {
+		return "", fmt.Errorf("failed to read FileTree segments from state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	fileTree := FileTree{
+		FileHash:     fileHash,
+		FileSize:     header.FileSize,
+		Codec:        header.Codec,
+		StripeHashes: make([]StripeTree, 0, header.Stripes),
+	}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return "", err
+		}
+		var segment FileTreeSegment
+		err = json.Unmarshal(queryResponse.Value, &segment)
+		if err != nil {
+			return "", fmt.Errorf("failed to unmarshal FileTree segment: %v", err)
+		}
+		fileTree.StripeHashes = append(fileTree.StripeHashes, segment.StripeHashes...)
+	}
+
+	fileTreeJSON, err := json.Marshal(fileTree)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal FileTree: %v", err)
+	}
+
+	return string(fileTreeJSON), nil
+}
+
+// GetFileTreeHeader returns the header of a stored file tree, which tells how
+// many segments to read with GetFileTreeSegment.
+func (s *SmartContract) GetFileTreeHeader(ctx contractapi.TransactionContextInterface, fileHash string) (*FileTreeHeader, error) {
+	header, err := getFileTreeHeader(ctx, fileHash)
+	if err != nil {
+		return nil, err
+	}
+
+	if header == nil || !header.Complete {
+		return nil, fmt.Errorf("FileTree does not exist")
+	}
+
+	return header, nil
+}
+
+// GetFileTreeSegment returns the stripes of one segment of a stored file tree.
+func (s *SmartContract) GetFileTreeSegment(ctx contractapi.TransactionContextInterface, fileHash string, index int) (*FileTreeSegment, error) {
+	return getFileTreeSegment(ctx, fileHash, index)
+}
+
+func getFileTreeSegment(ctx contractapi.TransactionContextInterface, fileHash string, index int) (*FileTreeSegment, error) {
+	key, err := fileTreeSegmentKey(ctx, fileHash, index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create FileTree segment key: %v", err)
+	}
+
+	segmentJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read FileTree segment from state: %v", err)
+	}
+
+	if segmentJSON == nil {
+		return nil, fmt.Errorf("segment %d of FileTree %s does not exist", index, fileHash)
+	}
+
+	var segment FileTreeSegment
+	err = json.Unmarshal(segmentJSON, &segment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal FileTree segment: %v", err)
+	}
+
+	return &segment, nil
+}
+
+// StoreFileTree stores the tree of a file together with its metadata in one
+// transaction. metadataJSON holds the tags and content type of the file and
+// may be empty; the owner, size and creation time are taken from the
+// transaction. Trees too large for one transaction are stored with
+// BeginFileTree, StoreFileTreeSegment and CommitFileTree instead. A file
+// that is stored already is kept as it is, see BeginFileTree.
+func (s *SmartContract) StoreFileTree(ctx contractapi.TransactionContextInterface, fileHash string, fileTreeJSON string, metadataJSON string) (string, error) {
+	err := validateFileHash(fileHash)
+	if err != nil {
+		return "failed to store FileTree", err
+	}
+
+	fileTree, err := parseFileTree(fileHash, fileTreeJSON)
+	if err != nil {
+		return "failed to store FileTree", err
+	}
+
+	header, err := s.BeginFileTree(ctx, fileHash, fileTree.FileSize, len(fileTree.StripeHashes), fileTree.Codec, fileTree.SlotTableEpoch, metadataJSON)
+	if err != nil {
+		return "failed to store FileTree", err
+	}
+	if header.Complete {
+		return "FileTree already stored", nil
+	}
+
+	for index := 0; index < header.Segments; index++ {
+		start := index * header.SegmentSize
+		end := start + segmentStripes(header, index)
+		segment := FileTreeSegment{Index: index, StripeHashes: fileTree.StripeHashes[start:end]}
+		err = putFileTreeSegment(ctx, header, &segment)
+		if err != nil {
+			return "failed to store FileTree", err
+		}
+	}
+
+	err = completeFileTree(ctx, header)
+	if err != nil {
+		return "failed to store FileTree", err
+	}
+
+	return "FileTree stored successfully", nil
+}
+
+// BeginFileTree starts storing the tree of a file with the given number of
+// stripes, coded with codec, empty for the default one, and placed by the
+// hash slot table of slotTableEpoch, 0 when unknown. The returned header tells the segment size; every segment is then
+// stored with StoreFileTreeSegment, each in its own transaction if need be,
+// and CommitFileTree makes the file visible. Beginning a file again discards
+// the segments stored so far, unless it was committed: the content of a file
+// follows from its hash, so the header of the stored file is returned with
+// Complete set and there is nothing left to store. Its owner, uploader and
+// metadata are kept; a retention or expiry given with the metadata is set as
+// SetRetention does, by clients of the owner MSP and admins only.
+func (s *SmartContract) BeginFileTree(ctx contractapi.TransactionContextInterface, fileHash string, fileSize int64, stripes int, codec string, slotTableEpoch int, metadataJSON string) (*FileTreeHeader, error) {
+	err := validateFileHash(fileHash)
+	if err != nil {
+		return nil, err
+	}
+
+	if stripes < 0 || fileSize < 0 {
+		return nil, fmt.Errorf("invalid FileTree of %d bytes in %d stripes", fileSize, stripes)
+	}
+
+	_, err = validateCodec(codec)
+	if err != nil {
+		return nil, err
+	}
+
+	if slotTableEpoch < 0 {
+		return nil, fmt.Errorf("invalid hash slot table epoch %d", slotTableEpoch)
+	}
+	if slotTableEpoch > 0 {
+		_, err = getHashSlotTableByEpoch(ctx, slotTableEpoch)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var input FileMetadataInput
+	if metadataJSON != "" {
+		err = decodeStrict(metadataJSON, &input)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metadata: %v", err)
+		}
+	}
+
+	retainUntil, expireAt, err := parseRetention(input.RetainUntil, input.ExpireAt)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := getFileTreeHeader(ctx, fileHash)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.Complete {
+		if input.RetainUntil != "" || input.ExpireAt != "" {
+			err = restoreRetention(ctx, existing, retainUntil, expireAt)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return existing, nil
+	}
+
+	// Over-quota uploads are rejected before any segment is stored, the
+	// quotas are checked again when the tree is completed
+	metadata, err := newFileMetadata(ctx, fileHash, fileSize, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build metadata: %v", err)
+	}
+	err = checkQuotas(ctx, usageChanges(nil, metadata))
+	if err != nil {
+		return nil, err
+	}
+
+	// A tree begun again keeps its retention, which only ever grows
+	current := existing
+	if current == nil {
+		current = &FileTreeHeader{FileHash: fileHash}
+	}
+	_, _, err = mergeRetention(current, retainUntil, expireAt)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = deleteFileTreeSegments(ctx, fileHash)
+	if err != nil {
+		return nil, err
+	}
+
+	header := &FileTreeHeader{
+		FileHash:       fileHash,
+		FileSize:       fileSize,
+		Codec:          codec,
+		SlotTableEpoch: slotTableEpoch,
+		Stripes:        stripes,
+		SegmentSize:    stripesPerSegment,
+		Segments:       (stripes + stripesPerSegment - 1) / stripesPerSegment,
+		Metadata:       &input,
+	}
+	if existing != nil {
+		header.RetainUntil = existing.RetainUntil
+		header.ExpireAt = existing.ExpireAt
+	}
+	err = putFileTreeHeader(ctx, header)
+	if err != nil {
+		return nil, err
+	}
+
+	return header, nil
+}
+
+// restoreRetention sets the retention given when a stored file is stored
+// again, as SetRetention does.
+func restoreRetention(ctx contractapi.TransactionContextInterface, header *FileTreeHeader, retainUntil time.Time, expireAt time.Time) error {
+	err := requireOwnerOrAdmin(ctx, header.FileHash, "set the retention of files of other MSPs")
+	if err != nil {
+		return err
+	}
+	err = applyRetention(ctx, header, retainUntil, expireAt)
+	if err != nil {
+		return err
+	}
+	err = extendEscrow(ctx, header)
+	if err != nil {
+		return err
+	}
+	err = putFileTreeHeader(ctx, header)
+	if err != nil {
+		return err
+	}
+
+	return setEvent(ctx, SetRetentionEvent, RetentionEvent{FileHash: header.FileHash, RetainUntil: header.RetainUntil, ExpireAt: header.ExpireAt})
+}
+
+// StoreFileTreeSegment stores one segment of a file tree started with
+// BeginFileTree. segmentJSON is a FileTreeSegment.
+func (s *SmartContract) StoreFileTreeSegment(ctx contractapi.TransactionContextInterface, fileHash string, segmentJSON string) error {
+	header, err := getFileTreeHeader(ctx, fileHash)
+	if err != nil {
+		return err
+	}
+
+	if header == nil || header.Complete {
+		return fmt.Errorf("FileTree %s was not begun", fileHash)
+	}
+
+	var segment FileTreeSegment
+	err = decodeStrict(segmentJSON, &segment)
+	if err != nil {
+		return fmt.Errorf("invalid FileTree segment: %v", err)
+	}
+
+	return putFileTreeSegment(ctx, header, &segment)
+}
+
+// CommitFileTree completes a file tree once all of its segments are stored,
+// records its metadata and emits the StoreFileTree event.
+func (s *SmartContract) CommitFileTree(ctx contractapi.TransactionContextInterface, fileHash string) error {
+	header, err := getFileTreeHeader(ctx, fileHash)
+	if err != nil {
+		return err
+	}
+
+	if header == nil || header.Complete {
+		return fmt.Errorf("FileTree %s was not begun", fileHash)
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(fileTreeSegmentObjectType, []string{fileHash})
+	if err != nil {
+		return fmt.Errorf("failed to read FileTree segments from state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	stored := 0
+	for resultsIterator.HasNext() {
+		if _, err := resultsIterator.Next(); err != nil {
+			return err
+		}
+		stored++
+	}
+
+	if stored != header.Segments {
+		return fmt.Errorf("FileTree %s has %d of %d segments stored", fileHash, stored, header.Segments)
+	}
+
+	return completeFileTree(ctx, header)
+}
+
+func completeFileTree(ctx contractapi.TransactionContextInterface, header *FileTreeHeader) error {
+	var input FileMetadataInput
+	if header.Metadata != nil {
+		input = *header.Metadata
+	}
+
+	metadata, err := newFileMetadata(ctx, header.FileHash, header.FileSize, input)
+	if err != nil {
+		return fmt.Errorf("failed to build metadata: %v", err)
+	}
+
+	// Stored files are never completed again, so the file is new to the
+	// usage of its owner
+	err = chargeUsage(ctx, usageChanges(nil, metadata))
+	if err != nil {
+		return err
+	}
+
+	metadataKey, err := fileMetadataKey(ctx, header.FileHash)
+	if err != nil {
+		return fmt.Errorf("failed to create file metadata key: %v", err)
+	}
+	metadataBytes, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %v", err)
+	}
+	err = ctx.GetStub().PutState(metadataKey, metadataBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update metadata in state: %v", err)
+	}
+
+	retainUntil, expireAt, err := parseRetention(input.RetainUntil, input.ExpireAt)
+	if err != nil {
+		return err
+	}
+	err = applyRetention(ctx, header, retainUntil, expireAt)
+	if err != nil {
+		return err
+	}
+	err = openEscrow(ctx, header)
+	if err != nil {
+		return err
+	}
+
+	header.Complete = true
+	header.Metadata = nil
+	err = putFileTreeHeader(ctx, header)
+	if err != nil {
+		return err
+	}
+
+	return setEvent(ctx, StoreFileTreeEvent, FileEvent{FileHash: header.FileHash})
+}
+
+func newFileMetadata(ctx contractapi.TransactionContextInterface, fileHash string, fileSize int64, input FileMetadataInput) (*FileMetadata, error) {
+	owner, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client MSP ID: %v", err)
+	}
+
+	uploader, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client identity: %v", err)
+	}
+
+	// The transaction timestamp is the same on every endorser, unlike the
+	// local clock
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+
+	tags := input.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	return &FileMetadata{
+		DocType:     fileObjectType,
+		FileHash:    fileHash,
+		Owner:       owner,
+		Uploader:    uploader,
+		Size:        fileSize,
+		CreatedAt:   timestamp.AsTime().UTC().Format(time.RFC3339),
+		Tags:        tags,
+		ContentType: input.ContentType,
+	}, nil
+}
+
+// GetFileMetadata returns the metadata of a stored file.
+func (s *SmartContract) GetFileMetadata(ctx contractapi.TransactionContextInterface, fileHash string) (*FileMetadata, error) {
+	metadata, err := getFileMetadata(ctx, fileHash)
+	if err != nil {
+		return nil, err
+	}
+
+	if metadata == nil {
+		return nil, fmt.Errorf("file %s does not exist", fileHash)
+	}
+
+	return metadata, nil
+}
+
+// getFileMetadata returns the metadata of a file, or nil when there is none.
+func getFileMetadata(ctx contractapi.TransactionContextInterface, fileHash string) (*FileMetadata, error) {
+	key, err := fileMetadataKey(ctx, fileHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file metadata key: %v", err)
+	}
+
+	metadataBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file metadata from state: %v", err)
+	}
+
+	if metadataBytes == nil {
+		return nil, nil
+	}
+
+	var metadata FileMetadata
+	err = json.Unmarshal(metadataBytes, &metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal file metadata: %v", err)
+	}
+
+	return &metadata, nil
+}
+
+// DeleteFileTree deletes the header, the segments and the metadata of a file,
+// including a tree that was begun but never committed. Files under retention
+// or legal hold are kept. Clients of the owner MSP and admins may delete it.
+// It returns the stripes no other file holds, whose chunks the client deletes.
+func (s *SmartContract) DeleteFileTree(ctx contractapi.TransactionContextInterface, fileHash string) (*DeletedFile, error) {
+	header, err := getFileTreeHeader(ctx, fileHash)
+	if err != nil {
+		return nil, err
+	}
+
+	if header == nil {
+		return nil, fmt.Errorf("FileTree does not exist")
+	}
+
+	err = requireOwnerOrAdmin(ctx, fileHash, "delete files of other MSPs")
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkDeletable(ctx, header)
+	if err != nil {
+		return nil, err
+	}
+
+	return deleteFileTree(ctx, header)
+}
+
+func deleteFileTree(ctx contractapi.TransactionContextInterface, header *FileTreeHeader) (*DeletedFile, error) {
+	fileHash := header.FileHash
+	err := deleteExpiryIndex(ctx, header)
+	if err != nil {
+		return nil, err
+	}
+
+	treeKey, err := fileTreeKey(ctx, fileHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create FileTree key: %v", err)
+	}
+
+	err = ctx.GetStub().DelState(treeKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete FileTree from state: %v", err)
+	}
+
+	stripes, err := deleteFileTreeSegments(ctx, fileHash)
+	if err != nil {
+		return nil, err
+	}
+	stripes, sharedChunks, err := unreferencedStripes(ctx, fileHash, stripes)
+	if err != nil {
+		return nil, err
+	}
+
+	previous, err := getFileMetadata(ctx, fileHash)
+	if err != nil {
+		return nil, err
+	}
+	err = chargeUsage(ctx, usageChanges(previous, nil))
+	if err != nil {
+		return nil, err
+	}
+
+	metadataKey, err := fileMetadataKey(ctx, fileHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file metadata key: %v", err)
+	}
+
+	err = ctx.GetStub().DelState(metadataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete file metadata from state: %v", err)
+	}
+
+	// The unearned part of the escrow is refunded by the next settlement
+	err = closeEscrow(ctx, fileHash)
+	if err != nil {
+		return nil, err
+	}
+
+	err = setEvent(ctx, DeleteFileTreeEvent, FileEvent{FileHash: fileHash})
+	if err != nil {
+		return nil, err
+	}
+	return &DeletedFile{FileHash: fileHash, Stripes: stripes, SharedChunks: sharedChunks}, nil
+}
+
+// ListFiles returns one page of the metadata of the stored files, in the
+// order of their hashes. An empty bookmark starts from the first file.
+// Paginated queries are only valid for read only transactions.
+func (s *SmartContract) ListFiles(ctx contractapi.TransactionContextInterface, pageSize int, bookmark string) (*PaginatedFileResult, error) {
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(fileObjectType, []string{}, int32(pageSize), bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file metadata from state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	records, err := constructFileMetadataFromIterator(resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PaginatedFileResult{
+		Records:             records,
+		FetchedRecordsCount: responseMetadata.FetchedRecordsCount,
+		Bookmark:            responseMetadata.Bookmark,
+	}, nil
+}
+
+// QueryFilesByOwner returns one page of the files stored by the clients of an
+// MSP. Only available on state databases that support rich query (e.g.
+// CouchDB), see META-INF/statedb/couchdb/indexes/indexOwner.json.
+func (s *SmartContract) QueryFilesByOwner(ctx contractapi.TransactionContextInterface, owner string, pageSize int, bookmark string) (*PaginatedFileResult, error) {
+	selector := map[string]interface{}{
+		"selector": map[string]interface{}{"docType": fileObjectType, "owner": owner},
+	}
+	return queryFiles(ctx, selector, int32(pageSize), bookmark)
+}
+
+// QueryFilesByTag returns one page of the files carrying a tag. Only
+// available on state databases that support rich query (e.g. CouchDB). A
+// CouchDB index cannot serve $elemMatch on the elements of an array, so the
+// query scans the metadata of every file.
+func (s *SmartContract) QueryFilesByTag(ctx contractapi.TransactionContextInterface, tag string, pageSize int, bookmark string) (*PaginatedFileResult, error) {
+	selector := map[string]interface{}{
+		"selector": map[string]interface{}{
+			"docType": fileObjectType,
+			"tags":    map[string]interface{}{"$elemMatch": map[string]interface{}{"$eq": tag}},
+		},
+	}
+	return queryFiles(ctx, selector, int32(pageSize), bookmark)
+}
+
+// queryFiles runs a rich query built by the contract. The query is marshalled
+// rather than formatted so values cannot change its structure.
+func queryFiles(ctx contractapi.TransactionContextInterface, query map[string]interface{}, pageSize int32, bookmark string) (*PaginatedFileResult, error) {
+	queryString, err := json.Marshal(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal query: %v", err)
+	}
+
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetQueryResultWithPagination(string(queryString), pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query file metadata: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	records, err := constructFileMetadataFromIterator(resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PaginatedFileResult{
+		Records:             records,
+		FetchedRecordsCount: responseMetadata.FetchedRecordsCount,
+		Bookmark:            responseMetadata.Bookmark,
+	}, nil
+}
+
+func constructFileMetadataFromIterator(resultsIterator shim.StateQueryIteratorInterface) ([]*FileMetadata, error) {
+	records := make([]*FileMetadata, 0)
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var metadata FileMetadata
+		err = json.Unmarshal(queryResult.Value, &metadata)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal file metadata: %v", err)
+		}
+		records = append(records, &metadata)
+	}
+
+	return records, nil
+}
+
+// Usage is accounted per MSP and per client identity. Like the variables of
+// high-throughput, every change is written as a delta row of its own under
+// usageDelta~scope~subject~txID, so concurrent uploads never write the same
+// key, and the usage is the sum of the rows. Quotas are kept under
+// quota~scope~subject.
+const usageDeltaObjectType = "usageDelta"
+const quotaObjectType = "quota"
+
+// Usage scopes: a file is accounted to the MSP ID and to the client identity
+// ID of the client storing it.
+const (
+	MSPScope      = "msp"
+	IdentityScope = "identity"
+)
+
+// adminAttribute marks the client identities allowed to set quotas and prune
+// usage rows.
+const adminAttribute = "storage.admin"
+
+// UsageDelta is the value of a usage delta row.
+type UsageDelta struct {
+	Bytes int64 `json:"bytes"`
+	Files int64 `json:"files"`
+}
+
+// Quota limits the bytes stored by one subject.
+type Quota struct {
+	Bytes int64 `json:"bytes"`
+}
+
+type usageChange struct {
+	scope   string
+	subject string
+	delta   UsageDelta
+}
+
+func validateScope(scope string) error {
+	if scope != MSPScope && scope != IdentityScope {
+		return fmt.Errorf("unknown usage scope %q, expected %q or %q", scope, MSPScope, IdentityScope)
+	}
+	return nil
+}
+
+func requireAdmin(ctx contractapi.TransactionContextInterface, action string) error {
+	err := ctx.GetClientIdentity().AssertAttributeValue(adminAttribute, "true")
+	if err != nil {
+		return fmt.Errorf("submitting client not authorized to %s, does not have %s attribute", action, adminAttribute)
+	}
+	return nil
+}
+
+// requireOwnerOrAdmin allows clients of the MSP that owns a file, and admins.
+// Files without metadata, which were never committed, are left to admins.
+func requireOwnerOrAdmin(ctx contractapi.TransactionContextInterface, fileHash string, action string) error {
+	metadata, err := getFileMetadata(ctx, fileHash)
+	if err != nil {
+		return err
+	}
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client MSP ID: %v", err)
+	}
+	if metadata != nil && metadata.Owner == mspID {
+		return nil
+	}
+	return requireAdmin(ctx, action)
+}
+
+// usageChanges returns how the usage changes when the file described by
+// previous is replaced by the one described by current, either may be nil.
+func usageChanges(previous *FileMetadata, current *FileMetadata) []usageChange {
+	var changes []usageChange
+	add := func(scope string, subject string, bytes int64, files int64) {
+		// Files stored before identities were accounted have no uploader
+		if subject == "" {
+			return
+		}
+		for i := range changes {
+			if changes[i].scope == scope && changes[i].subject == subject {
+				changes[i].delta.Bytes += bytes
+				changes[i].delta.Files += files
+				return
+			}
+		}
+		changes = append(changes, usageChange{scope: scope, subject: subject, delta: UsageDelta{Bytes: bytes, Files: files}})
+	}
+
+	if previous != nil {
+		add(MSPScope, previous.Owner, -previous.Size, -1)
+		add(IdentityScope, previous.Uploader, -previous.Size, -1)
+	}
+	if current != nil {
+		add(MSPScope, current.Owner, current.Size, 1)
+		add(IdentityScope, current.Uploader, current.Size, 1)
+	}
+	return changes
+}
+
+// checkQuotas rejects changes taking a subject over its quota. Only the rows
+// of subjects with a quota are read, so uploads of subjects without one never
+// conflict.
+func checkQuotas(ctx contractapi.TransactionContextInterface, changes []usageChange) error {
+	for _, change := range changes {
+		if change.delta.Bytes <= 0 {
+			continue
+		}
+
+		quota, err := getQuota(ctx, change.scope, change.subject)
+		if err != nil {
+			return err
+		}
+		if quota == nil {
+			continue
+		}
+
+		usage, err := readUsage(ctx, change.scope, change.subject)
+		if err != nil {
+			return err
+		}
+		if usage.Bytes+change.delta.Bytes > quota.Bytes {
+			return fmt.Errorf("storing %d bytes exceeds the quota of %s %s: %d of %d bytes used", change.delta.Bytes, change.scope, change.subject, usage.Bytes, quota.Bytes)
+		}
+	}
+	return nil
+}
+
+// chargeUsage checks the quotas of changes and writes their delta rows.
+func chargeUsage(ctx contractapi.TransactionContextInterface, changes []usageChange) error {
+	err := checkQuotas(ctx, changes)
+	if err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		if change.delta == (UsageDelta{}) {
+			continue
+		}
+		err = putUsageDelta(ctx, change.scope, change.subject, change.delta)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func putUsageDelta(ctx contractapi.TransactionContextInterface, scope string, subject string, delta UsageDelta) error {
+	key, err := ctx.GetStub().CreateCompositeKey(usageDeltaObjectType, []string{scope, subject, ctx.GetStub().GetTxID()})
+	if err != nil {
+		return fmt.Errorf("failed to create usage delta key: %v", err)
+	}
+
+	deltaJSON, err := json.Marshal(delta)
+	if err != nil {
+		return fmt.Errorf("failed to marshal usage delta: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, deltaJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put usage delta in state: %v", err)
+	}
+	return nil
+}
+
+func quotaKey(ctx contractapi.TransactionContextInterface, scope string, subject string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(quotaObjectType, []string{scope, subject})
+}
+
+// getQuota returns the quota of a subject, or nil when it has none.
+func getQuota(ctx contractapi.TransactionContextInterface, scope string, subject string) (*Quota, error) {
+	key, err := quotaKey(ctx, scope, subject)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create quota key: %v", err)
+	}
+
+	quotaJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read quota from state: %v", err)
+	}
+
+	if quotaJSON == nil {
+		return nil, nil
+	}
+
+	var quota Quota
+	err = json.Unmarshal(quotaJSON, &quota)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal quota: %v", err)
+	}
+	return &quota, nil
+}
+
+// readUsage sums the delta rows of one subject.
+func readUsage(ctx contractapi.TransactionContextInterface, scope string, subject string) (*Usage, error) {
+	usages, err := sumUsage(ctx, []string{scope, subject})
+	if err != nil {
+		return nil, err
+	}
+
+	if usage, ok := usages[subject]; ok {
+		return usage, nil
+	}
+	return &Usage{Scope: scope, Subject: subject}, nil
+}
+
+// sumUsage sums the delta rows under the partial key attributes, the scope
+// optionally followed by a subject, per subject.
+func sumUsage(ctx contractapi.TransactionContextInterface, attributes []string) (map[string]*Usage, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(usageDeltaObjectType, attributes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read usage from state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	usages := make(map[string]*Usage)
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split usage delta key: %v", err)
+		}
+		var delta UsageDelta
+		err = json.Unmarshal(queryResponse.Value, &delta)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal usage delta: %v", err)
+		}
+
+		usage, ok := usages[keyParts[1]]
+		if !ok {
+			usage = &Usage{Scope: keyParts[0], Subject: keyParts[1]}
+			usages[keyParts[1]] = usage
+		}
+		usage.Bytes += delta.Bytes
+		usage.Files += delta.Files
+		usage.Rows++
+	}
+	return usages, nil
+}
+
+// GetUsage returns the storage used by a subject of a scope, "msp" or
+// "identity", together with its quota. With an empty subject it returns every
+// subject of the scope that stores files or has a quota, sorted by subject,
+// which is what a billing report needs.
+func (s *SmartContract) GetUsage(ctx contractapi.TransactionContextInterface, scope string, subject string) ([]*Usage, error) {
+	err := validateScope(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	attributes := []string{scope}
+	if subject != "" {
+		attributes = append(attributes, subject)
+	}
+	usages, err := sumUsage(ctx, attributes)
+	if err != nil {
+		return nil, err
+	}
+	if subject != "" && usages[subject] == nil {
+		usages[subject] = &Usage{Scope: scope, Subject: subject}
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(quotaObjectType, attributes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read quotas from state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split quota key: %v", err)
+		}
+		var quota Quota
+		err = json.Unmarshal(queryResponse.Value, &quota)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal quota: %v", err)
+		}
+
+		usage, ok := usages[keyParts[1]]
+		if !ok {
+			usage = &Usage{Scope: scope, Subject: keyParts[1]}
+			usages[keyParts[1]] = usage
+		}
+		usage.Quota = quota.Bytes
+	}
+
+	subjects := make([]string, 0, len(usages))
+	for subject := range usages {
+		subjects = append(subjects, subject)
+	}
+	sort.Strings(subjects)
+
+	results := make([]*Usage, 0, len(subjects))
+	for _, subject := range subjects {
+		results = append(results, usages[subject])
+	}
+	return results, nil
+}
+
+// SetQuota limits the bytes a subject of a scope may store, 0 removes the
+// limit. Usage above a lowered quota is kept, only further uploads are
+// rejected. Only clients with the storage.admin attribute may set quotas.
+func (s *SmartContract) SetQuota(ctx contractapi.TransactionContextInterface, scope string, subject string, bytes int64) error {
+	err := requireAdmin(ctx, "set quotas")
+	if err != nil {
+		return err
+	}
+
+	err = validateScope(scope)
+	if err != nil {
+		return err
+	}
+
+	if subject == "" {
+		return fmt.Errorf("subject must not be empty")
+	}
+
+	if bytes < 0 {
+		return fmt.Errorf("quota must not be negative")
+	}
+
+	key, err := quotaKey(ctx, scope, subject)
+	if err != nil {
+		return fmt.Errorf("failed to create quota key: %v", err)
+	}
+
+	if bytes == 0 {
+		err = ctx.GetStub().DelState(key)
+		if err != nil {
+			return fmt.Errorf("failed to delete quota from state: %v", err)
+		}
+	} else {
+		quotaJSON, err := json.Marshal(Quota{Bytes: bytes})
+		if err != nil {
+			return fmt.Errorf("failed to marshal quota: %v", err)
+		}
+		err = ctx.GetStub().PutState(key, quotaJSON)
+		if err != nil {
+			return fmt.Errorf("failed to put quota in state: %v", err)
+		}
+	}
+
+	return setEvent(ctx, SetQuotaEvent, QuotaEvent{Scope: scope, Subject: subject, Bytes: bytes})
+}
+
+// PruneUsage folds the delta rows of a subject into a single row. Like the
+// prune of high-throughput it conflicts with every concurrent change of the
+// subject and is best run when few files are stored. Only clients with the
+// storage.admin attribute may prune.
+func (s *SmartContract) PruneUsage(ctx contractapi.TransactionContextInterface, scope string, subject string) error {
+	err := requireAdmin(ctx, "prune usage")
+	if err != nil {
+		return err
+	}
+
+	err = validateScope(scope)
+	if err != nil {
+		return err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(usageDeltaObjectType, []string{scope, subject})
+	if err != nil {
+		return fmt.Errorf("failed to read usage from state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	var total UsageDelta
+	rows := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+
+		var delta UsageDelta
+		err = json.Unmarshal(queryResponse.Value, &delta)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal usage delta: %v", err)
+		}
+		total.Bytes += delta.Bytes
+		total.Files += delta.Files
+		rows++
+
+		err = ctx.GetStub().DelState(queryResponse.Key)
+		if err != nil {
+			return fmt.Errorf("failed to delete usage delta from state: %v", err)
+		}
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("no usage of %s %s", scope, subject)
+	}
+	if total == (UsageDelta{}) {
+		return nil
+	}
+	return putUsageDelta(ctx, scope, subject, total)
 }
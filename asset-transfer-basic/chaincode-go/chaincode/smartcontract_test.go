@@ -1,16 +1,25 @@
 package chaincode_test
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"math"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
 	"github.com/hyperledger/fabric-chaincode-go/shim"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go/peer"
 	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
 	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/mocks"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 //go:generate counterfeiter -o mocks/transaction.go -fake-name TransactionContext . transactionContext
@@ -28,157 +37,945 @@ type stateQueryIterator interface {
 	shim.StateQueryIteratorInterface
 }
 
-func TestInitLedger(t *testing.T) {
+//go:generate counterfeiter -o mocks/historyqueryiterator.go -fake-name HistoryQueryIterator . historyQueryIterator
+type historyQueryIterator interface {
+	shim.HistoryQueryIteratorInterface
+}
+
+// clientIdentity answers the calls the contract makes: the MSP ID, the ID
+// and the storage.admin attribute.
+type clientIdentity struct {
+	cid.ClientIdentity
+	id    string
+	mspID string
+	admin bool
+}
+
+func (c clientIdentity) GetID() (string, error) {
+	return c.id, nil
+}
+
+func (c clientIdentity) GetMSPID() (string, error) {
+	return c.mspID, nil
+}
+
+func (c clientIdentity) AssertAttributeValue(attrName, attrValue string) error {
+	if attrName != "storage.admin" || attrValue != "true" || !c.admin {
+		return fmt.Errorf("attribute %s not found", attrName)
+	}
+	return nil
+}
+
+var user1 = clientIdentity{id: "x509::CN=User1@org1.example.com", mspID: "Org1MSP"}
+
+var txTime = time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// newWorldState returns a transaction context whose stub keeps the world
+// state in the returned map.
+func newWorldState() (*mocks.TransactionContext, *mocks.ChaincodeStub, map[string][]byte) {
+	state := make(map[string][]byte)
 	chaincodeStub := &mocks.ChaincodeStub{}
+	chaincodeStub.GetStateStub = func(key string) ([]byte, error) {
+		return state[key], nil
+	}
+	chaincodeStub.PutStateStub = func(key string, value []byte) error {
+		state[key] = value
+		return nil
+	}
+	chaincodeStub.DelStateStub = func(key string) error {
+		delete(state, key)
+		return nil
+	}
+	chaincodeStub.CreateCompositeKeyStub = shim.CreateCompositeKey
+	chaincodeStub.SplitCompositeKeyStub = new(shim.ChaincodeStub).SplitCompositeKey
+	chaincodeStub.GetStateByPartialCompositeKeyStub = func(objectType string, attributes []string) (shim.StateQueryIteratorInterface, error) {
+		prefix, err := shim.CreateCompositeKey(objectType, attributes)
+		if err != nil {
+			return nil, err
+		}
+		keys := make([]string, 0)
+		for key := range state {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		iterator := &mocks.StateQueryIterator{}
+		iterator.HasNextStub = func() bool {
+			return len(keys) > 0
+		}
+		iterator.NextStub = func() (*queryresult.KV, error) {
+			key := keys[0]
+			keys = keys[1:]
+			return &queryresult.KV{Key: key, Value: state[key]}, nil
+		}
+		return iterator, nil
+	}
+	chaincodeStub.GetTxTimestampReturns(timestamppb.New(txTime), nil)
+	txs := 0
+	chaincodeStub.GetTxIDStub = func() string {
+		txs++
+		return fmt.Sprintf("tx%d", txs)
+	}
+
 	transactionContext := &mocks.TransactionContext{}
 	transactionContext.GetStubReturns(chaincodeStub)
+	transactionContext.GetClientIdentityReturns(user1)
+	return transactionContext, chaincodeStub, state
+}
 
-	assetTransfer := chaincode.SmartContract{}
-	err := assetTransfer.InitLedger(transactionContext)
-	require.NoError(t, err)
+func testHash(format string, args ...interface{}) string {
+	hash := sha256.Sum256([]byte(fmt.Sprintf(format, args...)))
+	return hex.EncodeToString(hash[:])
+}
 
-	chaincodeStub.PutStateReturns(fmt.Errorf("failed inserting key"))
-	err = assetTransfer.InitLedger(transactionContext)
-	require.EqualError(t, err, "failed to put to world state. failed inserting key")
+func testFileTree(fileHash string, stripes int) chaincode.FileTree {
+	fileTree := chaincode.FileTree{
+		FileHash:     fileHash,
+		FileSize:     int64(stripes) * 12288,
+		StripeHashes: make([]chaincode.StripeTree, 0, stripes),
+	}
+	for i := 0; i < stripes; i++ {
+		stripe := chaincode.StripeTree{StripeHash: testHash("%s stripe %d", fileHash, i)}
+		for j := 0; j < 6; j++ {
+			stripe.ChunkHashes = append(stripe.ChunkHashes, chaincode.Chunk{ChunkHash: testHash("%s chunk %d %d", fileHash, i, j)})
+		}
+		fileTree.StripeHashes = append(fileTree.StripeHashes, stripe)
+	}
+	return fileTree
+}
+
+func marshal(t *testing.T, v interface{}) string {
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	return string(data)
 }
 
-func TestCreateAsset(t *testing.T) {
+func TestInitLedger(t *testing.T) {
 	chaincodeStub := &mocks.ChaincodeStub{}
 	transactionContext := &mocks.TransactionContext{}
 	transactionContext.GetStubReturns(chaincodeStub)
 
-	assetTransfer := chaincode.SmartContract{}
-	err := assetTransfer.CreateAsset(transactionContext, "", "", 0, "", 0)
+	storage := chaincode.SmartContract{}
+	err := storage.InitLedger(transactionContext)
 	require.NoError(t, err)
 
-	chaincodeStub.GetStateReturns([]byte{}, nil)
-	err = assetTransfer.CreateAsset(transactionContext, "asset1", "", 0, "", 0)
-	require.EqualError(t, err, "the asset asset1 already exists")
+	key, value := chaincodeStub.PutStateArgsForCall(0)
+	require.Equal(t, "wt", key)
+	require.JSONEq(t, `{"orgWeightTable":{}}`, string(value))
 
-	chaincodeStub.GetStateReturns(nil, fmt.Errorf("unable to retrieve asset"))
-	err = assetTransfer.CreateAsset(transactionContext, "asset1", "", 0, "", 0)
-	require.EqualError(t, err, "failed to read from world state: unable to retrieve asset")
+	chaincodeStub.PutStateReturns(fmt.Errorf("failed inserting key"))
+	err = storage.InitLedger(transactionContext)
+	require.EqualError(t, err, "failed to store WeightTable in state: failed inserting key")
 }
 
-func TestReadAsset(t *testing.T) {
-	chaincodeStub := &mocks.ChaincodeStub{}
-	transactionContext := &mocks.TransactionContext{}
-	transactionContext.GetStubReturns(chaincodeStub)
+func TestUpdateOrgWeight(t *testing.T) {
+	transactionContext, chaincodeStub, state := newWorldState()
 
-	expectedAsset := &chaincode.Asset{ID: "asset1"}
-	bytes, err := json.Marshal(expectedAsset)
+	storage := chaincode.SmartContract{}
+	err := storage.UpdateOrgWeight(transactionContext, "localhost:50052", 100)
 	require.NoError(t, err)
+	require.JSONEq(t, `{"orgWeightTable":{"localhost:50052":100}}`, string(state["wt"]))
+
+	name, payload := chaincodeStub.SetEventArgsForCall(0)
+	require.Equal(t, chaincode.UpdateOrgWeightEvent, name)
+	require.JSONEq(t, `{"orgID":"localhost:50052","weight":100}`, string(payload))
+
+	err = storage.UpdateOrgWeight(transactionContext, "localhost:50052", -1)
+	require.EqualError(t, err, "weight of org localhost:50052 must not be negative")
+}
 
-	chaincodeStub.GetStateReturns(bytes, nil)
-	assetTransfer := chaincode.SmartContract{}
-	asset, err := assetTransfer.ReadAsset(transactionContext, "")
+func TestStoreFileTree(t *testing.T) {
+	transactionContext, chaincodeStub, state := newWorldState()
+	fileHash := testHash("file")
+	fileTree := testFileTree(fileHash, 3)
+
+	storage := chaincode.SmartContract{}
+	_, err := storage.StoreFileTree(transactionContext, fileHash, marshal(t, fileTree), `{"tags":["docs"],"contentType":"text/plain"}`)
 	require.NoError(t, err)
-	require.Equal(t, expectedAsset, asset)
+	// header, one segment, metadata, the index entries of three stripes and
+	// their 18 chunks and the usage of the MSP and the client
+	require.Len(t, state, 26)
+
+	name, payload := chaincodeStub.SetEventArgsForCall(0)
+	require.Equal(t, chaincode.StoreFileTreeEvent, name)
+	require.JSONEq(t, marshal(t, chaincode.FileEvent{FileHash: fileHash}), string(payload))
 
-	chaincodeStub.GetStateReturns(nil, fmt.Errorf("unable to retrieve asset"))
-	_, err = assetTransfer.ReadAsset(transactionContext, "")
-	require.EqualError(t, err, "failed to read from world state: unable to retrieve asset")
+	fileTreeJSON, err := storage.GetFileTree(transactionContext, fileHash)
+	require.NoError(t, err)
+	require.JSONEq(t, marshal(t, fileTree), fileTreeJSON)
 
-	chaincodeStub.GetStateReturns(nil, nil)
-	asset, err = assetTransfer.ReadAsset(transactionContext, "asset1")
-	require.EqualError(t, err, "the asset asset1 does not exist")
-	require.Nil(t, asset)
+	metadata, err := storage.GetFileMetadata(transactionContext, fileHash)
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.FileMetadata{
+		DocType:     "file",
+		FileHash:    fileHash,
+		Owner:       "Org1MSP",
+		Uploader:    user1.id,
+		Size:        fileTree.FileSize,
+		CreatedAt:   "2023-05-01T12:00:00Z",
+		Tags:        []string{"docs"},
+		ContentType: "text/plain",
+	}, metadata)
 }
 
-func TestUpdateAsset(t *testing.T) {
-	chaincodeStub := &mocks.ChaincodeStub{}
-	transactionContext := &mocks.TransactionContext{}
-	transactionContext.GetStubReturns(chaincodeStub)
+func TestStoreFileTreeSplitsLargeTrees(t *testing.T) {
+	transactionContext, _, _ := newWorldState()
+	fileHash := testHash("large file")
+	fileTree := testFileTree(fileHash, 1030)
 
-	expectedAsset := &chaincode.Asset{ID: "asset1"}
-	bytes, err := json.Marshal(expectedAsset)
+	storage := chaincode.SmartContract{}
+	_, err := storage.StoreFileTree(transactionContext, fileHash, marshal(t, fileTree), "")
 	require.NoError(t, err)
 
-	chaincodeStub.GetStateReturns(bytes, nil)
-	assetTransfer := chaincode.SmartContract{}
-	err = assetTransfer.UpdateAsset(transactionContext, "", "", 0, "", 0)
+	header, err := storage.GetFileTreeHeader(transactionContext, fileHash)
 	require.NoError(t, err)
+	require.Equal(t, 1030, header.Stripes)
+	require.Equal(t, 3, header.Segments)
 
-	chaincodeStub.GetStateReturns(nil, nil)
-	err = assetTransfer.UpdateAsset(transactionContext, "asset1", "", 0, "", 0)
-	require.EqualError(t, err, "the asset asset1 does not exist")
+	segment, err := storage.GetFileTreeSegment(transactionContext, fileHash, 2)
+	require.NoError(t, err)
+	require.Equal(t, fileTree.StripeHashes[1024:], segment.StripeHashes)
 
-	chaincodeStub.GetStateReturns(nil, fmt.Errorf("unable to retrieve asset"))
-	err = assetTransfer.UpdateAsset(transactionContext, "asset1", "", 0, "", 0)
-	require.EqualError(t, err, "failed to read from world state: unable to retrieve asset")
+	fileTreeJSON, err := storage.GetFileTree(transactionContext, fileHash)
+	require.NoError(t, err)
+	require.JSONEq(t, marshal(t, fileTree), fileTreeJSON)
 }
 
-func TestDeleteAsset(t *testing.T) {
-	chaincodeStub := &mocks.ChaincodeStub{}
-	transactionContext := &mocks.TransactionContext{}
-	transactionContext.GetStubReturns(chaincodeStub)
+func TestStoreFileTreeValidation(t *testing.T) {
+	fileHash := testHash("file")
+	valid := testFileTree(fileHash, 2)
+
+	withStripe := func(change func(stripe *chaincode.StripeTree)) string {
+		fileTree := testFileTree(fileHash, 2)
+		change(&fileTree.StripeHashes[1])
+		return marshal(t, fileTree)
+	}
+
+	tests := []struct {
+		name         string
+		fileHash     string
+		fileTreeJSON string
+		metadataJSON string
+		err          string
+	}{
+		{"empty file hash", "", marshal(t, valid), "", "file hash must not be empty"},
+		{"weight table key", "wt", marshal(t, valid), "", `file hash "wt" is a reserved key`},
+		{"hash slot table key", "slt", marshal(t, valid), "", `file hash "slt" is a reserved key`},
+		{"short file hash", "abc", marshal(t, valid), "", "invalid file hash"},
+		{"uppercase file hash", strings.ToUpper(fileHash), marshal(t, valid), "", "expected lowercase hex characters"},
+		{"not JSON", fileHash, "not json", "", "invalid FileTree"},
+		{"unknown field", fileHash, `{"stripeHashes":[],"owner":"me"}`, "", `unknown field "owner"`},
+		{"trailing data", fileHash, marshal(t, valid) + "{}", "", "unexpected data after JSON value"},
+		{"other file", testHash("other"), marshal(t, valid), "", "tree of file " + fileHash},
+		{"negative size", fileHash, `{"fileSize":-1,"stripeHashes":[]}`, "", "negative file size"},
+		{"bad stripe hash", fileHash, withStripe(func(stripe *chaincode.StripeTree) {
+			stripe.StripeHash = "xyz"
+		}), "", "stripe 1: invalid stripe hash"},
+		{"missing chunk", fileHash, withStripe(func(stripe *chaincode.StripeTree) {
+			stripe.ChunkHashes = stripe.ChunkHashes[:5]
+		}), "", "stripe 1: has 5 chunks, expected 6"},
+		{"unknown codec", fileHash, `{"codec":"rs-9-1","stripeHashes":[]}`, "", `invalid FileTree: unknown codec "rs-9-1"`},
+		{"compression alone", fileHash, `{"codec":"zstd+","stripeHashes":[]}`, "", `invalid FileTree: unknown codec "zstd+"`},
+		{"chunks of another codec", fileHash, `{"codec":"lrc-4-2-2",` + marshal(t, valid)[1:], "", "stripe 0: has 6 chunks, expected 8"},
+		{"bad chunk hash", fileHash, withStripe(func(stripe *chaincode.StripeTree) {
+			stripe.ChunkHashes[3].ChunkHash = strings.Repeat("g", 64)
+		}), "", "stripe 1 chunk 3: invalid chunk hash"},
+		{"unknown metadata field", fileHash, marshal(t, valid), `{"owner":"Org2MSP"}`, `invalid metadata: json: unknown field "owner"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transactionContext, chaincodeStub, _ := newWorldState()
+
+			storage := chaincode.SmartContract{}
+			_, err := storage.StoreFileTree(transactionContext, test.fileHash, test.fileTreeJSON, test.metadataJSON)
+			require.ErrorContains(t, err, test.err)
+			require.Zero(t, chaincodeStub.PutStateCallCount())
+			require.Zero(t, chaincodeStub.SetEventCallCount())
+		})
+	}
+}
 
-	asset := &chaincode.Asset{ID: "asset1"}
-	bytes, err := json.Marshal(asset)
+func TestStoreFileTreeWithCodec(t *testing.T) {
+	transactionContext, _, _ := newWorldState()
+	fileHash := testHash("file")
+	fileTree := testFileTree(fileHash, 2)
+	fileTree.Codec = "lrc-4-2-2"
+	for i := range fileTree.StripeHashes {
+		for j := 6; j < 8; j++ {
+			fileTree.StripeHashes[i].ChunkHashes = append(fileTree.StripeHashes[i].ChunkHashes, chaincode.Chunk{ChunkHash: testHash("%s chunk %d %d", fileHash, i, j)})
+		}
+	}
+
+	storage := chaincode.SmartContract{}
+	_, err := storage.StoreFileTree(transactionContext, fileHash, marshal(t, fileTree), "")
 	require.NoError(t, err)
 
-	chaincodeStub.GetStateReturns(bytes, nil)
-	chaincodeStub.DelStateReturns(nil)
-	assetTransfer := chaincode.SmartContract{}
-	err = assetTransfer.DeleteAsset(transactionContext, "")
+	header, err := storage.GetFileTreeHeader(transactionContext, fileHash)
 	require.NoError(t, err)
+	require.Equal(t, "lrc-4-2-2", header.Codec)
 
-	chaincodeStub.GetStateReturns(nil, nil)
-	err = assetTransfer.DeleteAsset(transactionContext, "asset1")
-	require.EqualError(t, err, "the asset asset1 does not exist")
-
-	chaincodeStub.GetStateReturns(nil, fmt.Errorf("unable to retrieve asset"))
-	err = assetTransfer.DeleteAsset(transactionContext, "")
-	require.EqualError(t, err, "failed to read from world state: unable to retrieve asset")
+	fileTreeJSON, err := storage.GetFileTree(transactionContext, fileHash)
+	require.NoError(t, err)
+	require.JSONEq(t, marshal(t, fileTree), fileTreeJSON)
+
+	_, err = storage.BeginFileTree(transactionContext, testHash("other"), 12288, 1, "rs-9-1", 0, "")
+	require.EqualError(t, err, `unknown codec "rs-9-1"`)
+
+	// A tiny file kept as three compressed copies
+	tiny := testHash("tiny")
+	fileTree = testFileTree(tiny, 1)
+	fileTree.FileSize = 100
+	fileTree.Codec = "zstd+rep-3"
+	fileTree.StripeHashes[0].ChunkHashes = fileTree.StripeHashes[0].ChunkHashes[:3]
+	_, err = storage.StoreFileTree(transactionContext, tiny, marshal(t, fileTree), "")
+	require.NoError(t, err)
 }
 
-func TestTransferAsset(t *testing.T) {
-	chaincodeStub := &mocks.ChaincodeStub{}
-	transactionContext := &mocks.TransactionContext{}
-	transactionContext.GetStubReturns(chaincodeStub)
+func TestStoreFileTreeInSegments(t *testing.T) {
+	transactionContext, chaincodeStub, _ := newWorldState()
+	fileHash := testHash("file")
+	fileTree := testFileTree(fileHash, 600)
 
-	asset := &chaincode.Asset{ID: "asset1"}
-	bytes, err := json.Marshal(asset)
+	storage := chaincode.SmartContract{}
+	err := storage.StoreFileTreeSegment(transactionContext, fileHash, "{}")
+	require.EqualError(t, err, fmt.Sprintf("FileTree %s was not begun", fileHash))
+
+	header, err := storage.BeginFileTree(transactionContext, fileHash, fileTree.FileSize, 600, "", 0, "")
 	require.NoError(t, err)
+	require.Equal(t, 2, header.Segments)
+
+	_, err = storage.GetFileTree(transactionContext, fileHash)
+	require.EqualError(t, err, "FileTree does not exist")
 
-	chaincodeStub.GetStateReturns(bytes, nil)
-	assetTransfer := chaincode.SmartContract{}
-	_, err = assetTransfer.TransferAsset(transactionContext, "", "")
+	first := chaincode.FileTreeSegment{Index: 0, StripeHashes: fileTree.StripeHashes[:512]}
+	second := chaincode.FileTreeSegment{Index: 1, StripeHashes: fileTree.StripeHashes[512:]}
+
+	err = storage.StoreFileTreeSegment(transactionContext, fileHash, marshal(t, chaincode.FileTreeSegment{Index: 2, StripeHashes: second.StripeHashes}))
+	require.EqualError(t, err, "segment 2 out of range, FileTree has 2 segments")
+	err = storage.StoreFileTreeSegment(transactionContext, fileHash, marshal(t, chaincode.FileTreeSegment{Index: 1, StripeHashes: first.StripeHashes}))
+	require.EqualError(t, err, "segment 1 holds 512 stripes, expected 88")
+
+	bad := chaincode.FileTreeSegment{Index: 1, StripeHashes: append([]chaincode.StripeTree(nil), second.StripeHashes...)}
+	bad.StripeHashes[0] = chaincode.StripeTree{StripeHash: bad.StripeHashes[0].StripeHash}
+	err = storage.StoreFileTreeSegment(transactionContext, fileHash, marshal(t, bad))
+	require.EqualError(t, err, "invalid FileTree segment 1: stripe 512: has 0 chunks, expected 6")
+
+	require.NoError(t, storage.StoreFileTreeSegment(transactionContext, fileHash, marshal(t, first)))
+	err = storage.CommitFileTree(transactionContext, fileHash)
+	require.EqualError(t, err, fmt.Sprintf("FileTree %s has 1 of 2 segments stored", fileHash))
+
+	require.NoError(t, storage.StoreFileTreeSegment(transactionContext, fileHash, marshal(t, second)))
+	require.NoError(t, storage.CommitFileTree(transactionContext, fileHash))
+	require.Equal(t, 1, chaincodeStub.SetEventCallCount())
+
+	fileTreeJSON, err := storage.GetFileTree(transactionContext, fileHash)
+	require.NoError(t, err)
+	require.JSONEq(t, marshal(t, fileTree), fileTreeJSON)
+
+	// Beginning a stored file again returns it as it is
+	header, err = storage.BeginFileTree(transactionContext, fileHash, fileTree.FileSize, 600, "", 0, `{"tags":["other"]}`)
+	require.NoError(t, err)
+	require.True(t, header.Complete)
+	require.Nil(t, header.Metadata)
+	message, err := storage.StoreFileTree(transactionContext, fileHash, marshal(t, fileTree), "")
 	require.NoError(t, err)
+	require.Equal(t, "FileTree already stored", message)
+	require.Equal(t, 1, chaincodeStub.SetEventCallCount())
 
-	chaincodeStub.GetStateReturns(nil, fmt.Errorf("unable to retrieve asset"))
-	_, err = assetTransfer.TransferAsset(transactionContext, "", "")
-	require.EqualError(t, err, "failed to read from world state: unable to retrieve asset")
+	fileTreeJSON, err = storage.GetFileTree(transactionContext, fileHash)
+	require.NoError(t, err)
+	require.JSONEq(t, marshal(t, fileTree), fileTreeJSON)
+	metadata, err := storage.GetFileMetadata(transactionContext, fileHash)
+	require.NoError(t, err)
+	require.Empty(t, metadata.Tags)
 }
 
-func TestGetAllAssets(t *testing.T) {
-	asset := &chaincode.Asset{ID: "asset1"}
-	bytes, err := json.Marshal(asset)
+func TestDeleteFileTree(t *testing.T) {
+	transactionContext, chaincodeStub, state := newWorldState()
+	fileHash := testHash("file")
+
+	storage := chaincode.SmartContract{}
+	_, err := storage.DeleteFileTree(transactionContext, fileHash)
+	require.EqualError(t, err, "FileTree does not exist")
+
+	_, err = storage.StoreFileTree(transactionContext, fileHash, marshal(t, testFileTree(fileHash, 520)), "")
 	require.NoError(t, err)
 
+	// Only the owner MSP and admins may delete a file
+	transactionContext.GetClientIdentityReturns(clientIdentity{id: "x509::CN=User1@org2.example.com", mspID: "Org2MSP"})
+	_, err = storage.DeleteFileTree(transactionContext, fileHash)
+	require.EqualError(t, err, "submitting client not authorized to delete files of other MSPs, does not have storage.admin attribute")
+	transactionContext.GetClientIdentityReturns(clientIdentity{id: "x509::CN=Admin@org2.example.com", mspID: "Org2MSP", admin: true})
+
+	deleted, err := storage.DeleteFileTree(transactionContext, fileHash)
+	require.NoError(t, err)
+	require.Equal(t, testFileTree(fileHash, 520).StripeHashes, deleted.Stripes)
+	require.Empty(t, deleted.SharedChunks)
+	for key := range state {
+		require.True(t, strings.HasPrefix(key, "\x00usageDelta\x00"), "key %q left", key)
+	}
+
+	name, payload := chaincodeStub.SetEventArgsForCall(1)
+	require.Equal(t, chaincode.DeleteFileTreeEvent, name)
+	require.JSONEq(t, marshal(t, chaincode.FileEvent{FileHash: fileHash}), string(payload))
+}
+
+func TestDeleteSharedStripes(t *testing.T) {
+	transactionContext, _, _ := newWorldState()
+	storage := chaincode.SmartContract{}
+	a, b := testHash("a"), testHash("b")
+
+	// b holds the second stripe of a twice, next to one of its own sharing
+	// the last chunk of the first stripe of a
+	treeA := testFileTree(a, 3)
+	treeB := testFileTree(b, 1)
+	treeB.StripeHashes[0].ChunkHashes[5] = treeA.StripeHashes[0].ChunkHashes[5]
+	treeB.StripeHashes = append(treeB.StripeHashes, treeA.StripeHashes[1], treeA.StripeHashes[1])
+	_, err := storage.StoreFileTree(transactionContext, a, marshal(t, treeA), "")
+	require.NoError(t, err)
+	_, err = storage.StoreFileTree(transactionContext, b, marshal(t, treeB), "")
+	require.NoError(t, err)
+
+	// The chunks b holds are kept
+	deleted, err := storage.DeleteFileTree(transactionContext, a)
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.DeletedFile{
+		FileHash:     a,
+		Stripes:      []chaincode.StripeTree{treeA.StripeHashes[0], treeA.StripeHashes[2]},
+		SharedChunks: []string{treeA.StripeHashes[0].ChunkHashes[5].ChunkHash},
+	}, deleted)
+
+	deleted, err = storage.DeleteFileTree(transactionContext, b)
+	require.NoError(t, err)
+	require.Equal(t, &chaincode.DeletedFile{FileHash: b, Stripes: treeB.StripeHashes[:2], SharedChunks: []string{}}, deleted)
+}
+
+// iterate returns an iterator over the given results.
+func iterate(results []*queryresult.KV) *mocks.StateQueryIterator {
 	iterator := &mocks.StateQueryIterator{}
-	iterator.HasNextReturnsOnCall(0, true)
-	iterator.HasNextReturnsOnCall(1, false)
-	iterator.NextReturns(&queryresult.KV{Value: bytes}, nil)
+	iterator.HasNextStub = func() bool {
+		return len(results) > 0
+	}
+	iterator.NextStub = func() (*queryresult.KV, error) {
+		result := results[0]
+		results = results[1:]
+		return result, nil
+	}
+	return iterator
+}
 
-	chaincodeStub := &mocks.ChaincodeStub{}
-	transactionContext := &mocks.TransactionContext{}
-	transactionContext.GetStubReturns(chaincodeStub)
+func TestListFiles(t *testing.T) {
+	transactionContext, chaincodeStub, state := newWorldState()
+	// Pages of the world state continue after the key named by the bookmark
+	chaincodeStub.GetStateByPartialCompositeKeyWithPaginationStub = func(objectType string, attributes []string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+		prefix, err := shim.CreateCompositeKey(objectType, attributes)
+		require.NoError(t, err)
+		var keys []string
+		for key := range state {
+			if strings.HasPrefix(key, prefix) && key > bookmark {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		next := ""
+		if len(keys) > int(pageSize) {
+			keys = keys[:pageSize]
+			next = keys[len(keys)-1]
+		}
+		var results []*queryresult.KV
+		for _, key := range keys {
+			results = append(results, &queryresult.KV{Key: key, Value: state[key]})
+		}
+		return iterate(results), &peer.QueryResponseMetadata{FetchedRecordsCount: int32(len(results)), Bookmark: next}, nil
+	}
+
+	var fileHashes []string
+	for _, name := range []string{"a", "b", "c"} {
+		fileHashes = append(fileHashes, storeTestFile(t, transactionContext, name))
+	}
+	sort.Strings(fileHashes)
+
+	storage := chaincode.SmartContract{}
+	var listed []string
+	bookmark := ""
+	for pages := 1; ; pages++ {
+		page, err := storage.ListFiles(transactionContext, 2, bookmark)
+		require.NoError(t, err)
+		require.Equal(t, int32(len(page.Records)), page.FetchedRecordsCount)
+		for _, record := range page.Records {
+			listed = append(listed, record.FileHash)
+		}
+		if page.Bookmark == "" {
+			require.Equal(t, 2, pages)
+			break
+		}
+		bookmark = page.Bookmark
+	}
+	require.Equal(t, fileHashes, listed)
+
+	_, _, _, bookmarkArg := chaincodeStub.GetStateByPartialCompositeKeyWithPaginationArgsForCall(1)
+	require.Equal(t, bookmark, bookmarkArg)
+}
 
-	chaincodeStub.GetStateByRangeReturns(iterator, nil)
-	assetTransfer := &chaincode.SmartContract{}
-	assets, err := assetTransfer.GetAllAssets(transactionContext)
+func TestQueryFiles(t *testing.T) {
+	transactionContext, chaincodeStub, _ := newWorldState()
+	metadata := &chaincode.FileMetadata{DocType: "file", FileHash: testHash("file"), Owner: "Org1MSP", Tags: []string{"docs"}}
+	chaincodeStub.GetQueryResultWithPaginationReturns(
+		iterate([]*queryresult.KV{{Key: "file", Value: []byte(marshal(t, metadata))}}),
+		&peer.QueryResponseMetadata{FetchedRecordsCount: 1, Bookmark: "next"},
+		nil,
+	)
+	storage := chaincode.SmartContract{}
+
+	page, err := storage.QueryFilesByOwner(transactionContext, "Org1MSP", 10, "start")
 	require.NoError(t, err)
-	require.Equal(t, []*chaincode.Asset{asset}, assets)
+	require.Equal(t, &chaincode.PaginatedFileResult{Records: []*chaincode.FileMetadata{metadata}, FetchedRecordsCount: 1, Bookmark: "next"}, page)
+	query, pageSize, bookmark := chaincodeStub.GetQueryResultWithPaginationArgsForCall(0)
+	require.JSONEq(t, `{"selector":{"docType":"file","owner":"Org1MSP"}}`, query)
+	require.Equal(t, int32(10), pageSize)
+	require.Equal(t, "start", bookmark)
+
+	// Quotes in a value stay inside the selector
+	_, err = storage.QueryFilesByTag(transactionContext, `docs"}`, 5, "")
+	require.NoError(t, err)
+	query, pageSize, bookmark = chaincodeStub.GetQueryResultWithPaginationArgsForCall(1)
+	require.JSONEq(t, `{"selector":{"docType":"file","tags":{"$elemMatch":{"$eq":"docs\"}"}}}}`, query)
+	require.Equal(t, int32(5), pageSize)
+	require.Empty(t, bookmark)
+
+	chaincodeStub.GetQueryResultWithPaginationReturns(nil, nil, fmt.Errorf("rich queries are not supported"))
+	_, err = storage.QueryFilesByTag(transactionContext, "docs", 5, "")
+	require.EqualError(t, err, "failed to query file metadata: rich queries are not supported")
+}
+
+func TestCreateHashSlotTable(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights map[string]int
+		slots   map[string]chaincode.Slot
+		err     string
+	}{
+		{
+			name:    "single org",
+			weights: map[string]int{"org1": 7},
+			slots:   map[string]chaincode.Slot{"org1": {StartSlot: 0, EndSlot: 16383}},
+		},
+		{
+			name:    "equal weights",
+			weights: map[string]int{"org3": 1, "org1": 1, "org2": 1},
+			slots: map[string]chaincode.Slot{
+				"org1": {StartSlot: 0, EndSlot: 5461},
+				"org2": {StartSlot: 5462, EndSlot: 10922},
+				"org3": {StartSlot: 10923, EndSlot: 16383},
+			},
+		},
+		{
+			name:    "largest remainder gets the leftover slot",
+			weights: map[string]int{"org1": 1, "org2": 2},
+			slots: map[string]chaincode.Slot{
+				"org1": {StartSlot: 0, EndSlot: 5460},
+				"org2": {StartSlot: 5461, EndSlot: 16383},
+			},
+		},
+		{
+			name:    "zero weight",
+			weights: map[string]int{"org1": 0, "org2": 5, "org3": 5},
+			slots: map[string]chaincode.Slot{
+				"org2": {StartSlot: 0, EndSlot: 8191},
+				"org3": {StartSlot: 8192, EndSlot: 16383},
+			},
+		},
+		{
+			name:    "too light for a slot",
+			weights: map[string]int{"org1": 1, "org2": 100000},
+			slots:   map[string]chaincode.Slot{"org2": {StartSlot: 0, EndSlot: 16383}},
+		},
+		{
+			name:    "large weights",
+			weights: map[string]int{"org1": math.MaxInt32, "org2": math.MaxInt32},
+			slots: map[string]chaincode.Slot{
+				"org1": {StartSlot: 0, EndSlot: 8191},
+				"org2": {StartSlot: 8192, EndSlot: 16383},
+			},
+		},
+		{
+			name:    "no weights",
+			weights: map[string]int{},
+			err:     "no org has a positive weight",
+		},
+		{
+			name:    "all zero",
+			weights: map[string]int{"org1": 0},
+			err:     "no org has a positive weight",
+		},
+		{
+			name:    "negative weight",
+			weights: map[string]int{"org1": 1, "org2": -1},
+			err:     "org org2 has negative weight -1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transactionContext, chaincodeStub, state := newWorldState()
+			state["wt"] = []byte(marshal(t, chaincode.WeightTable{WT: test.weights}))
+
+			storage := chaincode.SmartContract{}
+			err := storage.CreateHashSlotTable(transactionContext)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+				require.NotContains(t, state, "slt")
+				return
+			}
+			require.NoError(t, err)
+
+			var hashSlotTable chaincode.HashSlotTable
+			require.NoError(t, json.Unmarshal(state["slt"], &hashSlotTable))
+			require.Equal(t, test.slots, hashSlotTable.HST)
+			require.Equal(t, 1, hashSlotTable.Epoch)
+			require.NoError(t, storage.ValidateHashSlotTable(transactionContext))
+
+			name, payload := chaincodeStub.SetEventArgsForCall(0)
+			require.Equal(t, chaincode.CreateHashSlotTableEvent, name)
+			require.Equal(t, state["slt"], payload)
+		})
+	}
+}
 
-	iterator.HasNextReturns(true)
-	iterator.NextReturns(nil, fmt.Errorf("failed retrieving next item"))
-	assets, err = assetTransfer.GetAllAssets(transactionContext)
-	require.EqualError(t, err, "failed retrieving next item")
-	require.Nil(t, assets)
+func TestCreateHashSlotTableIsDeterministic(t *testing.T) {
+	weights := make(map[string]int)
+	for i := 0; i < 50; i++ {
+		weights[fmt.Sprintf("org%d", i)] = i*37%11 + 1
+	}
+
+	var first []byte
+	for i := 0; i < 20; i++ {
+		transactionContext, _, state := newWorldState()
+		state["wt"] = []byte(marshal(t, chaincode.WeightTable{WT: weights}))
+
+		storage := chaincode.SmartContract{}
+		require.NoError(t, storage.CreateHashSlotTable(transactionContext))
+		if first == nil {
+			first = state["slt"]
+		}
+		require.Equal(t, first, state["slt"])
+	}
+}
+
+func TestValidateHashSlotTable(t *testing.T) {
+	tests := []struct {
+		name  string
+		slots map[string]chaincode.Slot
+		err   string
+	}{
+		{
+			name: "valid",
+			slots: map[string]chaincode.Slot{
+				"org1": {StartSlot: 0, EndSlot: 99},
+				"org2": {StartSlot: 100, EndSlot: 16383},
+			},
+		},
+		{
+			name:  "empty",
+			slots: map[string]chaincode.Slot{},
+			err:   "hash slot table is empty",
+		},
+		{
+			name: "gap",
+			slots: map[string]chaincode.Slot{
+				"org1": {StartSlot: 0, EndSlot: 99},
+				"org2": {StartSlot: 101, EndSlot: 16383},
+			},
+			err: "slots 100-100 are not assigned",
+		},
+		{
+			name: "overlap",
+			slots: map[string]chaincode.Slot{
+				"org1": {StartSlot: 0, EndSlot: 100},
+				"org2": {StartSlot: 100, EndSlot: 16383},
+			},
+			err: "org org2 overlaps the slots before 101",
+		},
+		{
+			name:  "first slots missing",
+			slots: map[string]chaincode.Slot{"org1": {StartSlot: 1, EndSlot: 16383}},
+			err:   "slots 0-0 are not assigned",
+		},
+		{
+			name:  "last slots missing",
+			slots: map[string]chaincode.Slot{"org1": {StartSlot: 0, EndSlot: 16000}},
+			err:   "slots 16001-16383 are not assigned",
+		},
+		{
+			name:  "beyond the ring",
+			slots: map[string]chaincode.Slot{"org1": {StartSlot: 0, EndSlot: 16384}},
+			err:   "org org1 has invalid slot range 0-16384",
+		},
+		{
+			name: "inverted range",
+			slots: map[string]chaincode.Slot{
+				"org1": {StartSlot: 0, EndSlot: 16383},
+				"org2": {StartSlot: 10, EndSlot: 9},
+			},
+			err: "org org2 has invalid slot range 10-9",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transactionContext, _, state := newWorldState()
+			state["slt"] = []byte(marshal(t, chaincode.HashSlotTable{HST: test.slots}))
+
+			storage := chaincode.SmartContract{}
+			err := storage.ValidateHashSlotTable(transactionContext)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+
+	transactionContext, _, _ := newWorldState()
+	storage := chaincode.SmartContract{}
+	require.EqualError(t, storage.ValidateHashSlotTable(transactionContext), "hash slot table does not exist")
+}
+
+// slotHash returns a hash falling on slot.
+func slotHash(slot int) string {
+	return fmt.Sprintf("%064x", slot)
+}
+
+func storeHashSlotTable(t *testing.T, state map[string][]byte) {
+	state["slt"] = []byte(marshal(t, chaincode.HashSlotTable{HST: map[string]chaincode.Slot{
+		"org1": {StartSlot: 0, EndSlot: 5461},
+		"org2": {StartSlot: 5462, EndSlot: 10922},
+		"org3": {StartSlot: 10923, EndSlot: 16383},
+	}}))
+}
+
+func TestGetOrgID(t *testing.T) {
+	transactionContext, _, state := newWorldState()
+
+	storage := chaincode.SmartContract{}
+	_, err := storage.GetOrgID(transactionContext, slotHash(0))
+	require.EqualError(t, err, "hash slot table does not exist")
+
+	storeHashSlotTable(t, state)
+	for slot, want := range map[int]string{0: "org1", 5461: "org1", 5462: "org2", 10923: "org3", 16383: "org3", 16384: "org1"} {
+		orgID, err := storage.GetOrgID(transactionContext, slotHash(slot))
+		require.NoError(t, err)
+		require.Equal(t, want, orgID, "slot %d", slot)
+	}
+
+	state["slt"] = []byte(marshal(t, chaincode.HashSlotTable{HST: map[string]chaincode.Slot{
+		"org1": {StartSlot: 0, EndSlot: 99},
+		"org2": {StartSlot: 200, EndSlot: 16383},
+	}}))
+	_, err = storage.GetOrgID(transactionContext, slotHash(150))
+	require.EqualError(t, err, "no orgID found for hash value")
+}
+
+func TestLocateStripe(t *testing.T) {
+	fileHash := testHash("file")
+	stripe := func(slots ...int) chaincode.StripeTree {
+		stripe := chaincode.StripeTree{StripeHash: testHash("stripe %v", slots)}
+		for _, slot := range slots {
+			stripe.ChunkHashes = append(stripe.ChunkHashes, chaincode.Chunk{ChunkHash: slotHash(slot)})
+		}
+		return stripe
+	}
+	crowded := stripe(1, 2, 3, 4, 5, 6)
+	spread := stripe(10000, 1, 15000, 2, 10001, 15001)
+
+	tests := []struct {
+		name    string
+		stripe  chaincode.StripeTree
+		holders [][]string
+	}{
+		{
+			name:   "chunks moved off the home org",
+			stripe: crowded,
+			holders: [][]string{
+				{"org2", "org1"}, {"org2", "org1"}, {"org3", "org1"}, {"org3", "org1"}, {"org1"}, {"org1"},
+			},
+		},
+		{
+			name:    "chunks on their home orgs",
+			stripe:  spread,
+			holders: [][]string{{"org2"}, {"org1"}, {"org3"}, {"org1"}, {"org2"}, {"org3"}},
+		},
+	}
+
+	transactionContext, _, state := newWorldState()
+	storeHashSlotTable(t, state)
+	fileTree := chaincode.FileTree{FileHash: fileHash, StripeHashes: []chaincode.StripeTree{crowded, spread}}
+
+	storage := chaincode.SmartContract{}
+	_, err := storage.StoreFileTree(transactionContext, fileHash, marshal(t, fileTree), "")
+	require.NoError(t, err)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			location, err := storage.LocateStripe(transactionContext, test.stripe.StripeHash)
+			require.NoError(t, err)
+			require.Equal(t, test.stripe.StripeHash, location.StripeHash)
+			require.Len(t, location.Shards, len(test.holders))
+			for i, shard := range location.Shards {
+				require.Equal(t, i, shard.Index)
+				require.Equal(t, test.stripe.ChunkHashes[i].ChunkHash, shard.ChunkHash)
+				require.Equal(t, test.holders[i], shard.Holders, "shard %d", i)
+			}
+		})
+	}
+
+	_, err = storage.LocateStripe(transactionContext, "abc")
+	require.ErrorContains(t, err, "invalid stripe hash")
+
+	_, err = storage.DeleteFileTree(transactionContext, fileHash)
+	require.NoError(t, err)
+	_, err = storage.LocateStripe(transactionContext, crowded.StripeHash)
+	require.EqualError(t, err, fmt.Sprintf("stripe %s does not exist", crowded.StripeHash))
+}
+
+func TestLocateStripeAfterRebalance(t *testing.T) {
+	transactionContext, _, state := newWorldState()
+	storage := chaincode.SmartContract{}
+	state["wt"] = []byte(marshal(t, chaincode.WeightTable{WT: map[string]int{"org1": 1, "org2": 1, "org3": 1}}))
+	require.NoError(t, storage.CreateHashSlotTable(transactionContext))
+
+	fileHash := testHash("file")
+	stripe := chaincode.StripeTree{StripeHash: testHash("stripe")}
+	for _, slot := range []int{10000, 1, 15000, 2, 10001, 15001} {
+		stripe.ChunkHashes = append(stripe.ChunkHashes, chaincode.Chunk{ChunkHash: slotHash(slot)})
+	}
+	fileTree := chaincode.FileTree{FileHash: fileHash, SlotTableEpoch: 2, StripeHashes: []chaincode.StripeTree{stripe}}
+	_, err := storage.StoreFileTree(transactionContext, fileHash, marshal(t, fileTree), "")
+	require.EqualError(t, err, "hash slot table of epoch 2 does not exist")
+	fileTree.SlotTableEpoch = 1
+	_, err = storage.StoreFileTree(transactionContext, fileHash, marshal(t, fileTree), "")
+	require.NoError(t, err)
 
-	chaincodeStub.GetStateByRangeReturns(nil, fmt.Errorf("failed retrieving all assets"))
-	assets, err = assetTransfer.GetAllAssets(transactionContext)
-	require.EqualError(t, err, "failed retrieving all assets")
-	require.Nil(t, assets)
+	// A heavy new org takes most slots, the chunks stay where the table of
+	// the upload put them until they are moved
+	state["wt"] = []byte(marshal(t, chaincode.WeightTable{WT: map[string]int{"org1": 1, "org2": 1, "org3": 1, "org4": 9}}))
+	require.NoError(t, storage.CreateHashSlotTable(transactionContext))
+	location, err := storage.LocateStripe(transactionContext, stripe.StripeHash)
+	require.NoError(t, err)
+	holders := [][]string{{"org2", "org4"}, {"org1"}, {"org2", "org4", "org3"}, {"org1"}, {"org4", "org2"}, {"org4", "org3"}}
+	for i, shard := range location.Shards {
+		require.Equal(t, holders[i], shard.Holders, "shard %d", i)
+	}
+
+	first, err := storage.GetHashSlotTableByEpoch(transactionContext, 1)
+	require.NoError(t, err)
+	require.Contains(t, first, `"epoch":1`)
+	current, err := storage.GetHashSlotTable(transactionContext)
+	require.NoError(t, err)
+	require.Contains(t, current, `"epoch":2`)
+	_, err = storage.GetHashSlotTableByEpoch(transactionContext, 3)
+	require.EqualError(t, err, "hash slot table of epoch 3 does not exist")
+}
+
+func TestUsage(t *testing.T) {
+	transactionContext, _, _ := newWorldState()
+	user2 := clientIdentity{id: "x509::CN=User2@org1.example.com", mspID: "Org1MSP"}
+	user3 := clientIdentity{id: "x509::CN=User1@org2.example.com", mspID: "Org2MSP"}
+	admin := clientIdentity{id: "x509::CN=Admin@org1.example.com", mspID: "Org1MSP", admin: true}
+
+	storage := chaincode.SmartContract{}
+	store := func(identity clientIdentity, name string, stripes int) string {
+		transactionContext.GetClientIdentityReturns(identity)
+		fileHash := testHash(name)
+		_, err := storage.StoreFileTree(transactionContext, fileHash, marshal(t, testFileTree(fileHash, stripes)), "")
+		require.NoError(t, err)
+		return fileHash
+	}
+	a := store(user1, "a", 1)
+	store(user2, "b", 2)
+	store(user3, "c", 4)
+	// Storing a file again charges nothing more
+	store(user1, "a", 1)
+
+	usages, err := storage.GetUsage(transactionContext, "msp", "")
+	require.NoError(t, err)
+	require.Equal(t, []*chaincode.Usage{
+		{Scope: "msp", Subject: "Org1MSP", Bytes: 3 * 12288, Files: 2, Rows: 2},
+		{Scope: "msp", Subject: "Org2MSP", Bytes: 4 * 12288, Files: 1, Rows: 1},
+	}, usages)
+
+	usages, err = storage.GetUsage(transactionContext, "identity", user2.id)
+	require.NoError(t, err)
+	require.Equal(t, []*chaincode.Usage{{Scope: "identity", Subject: user2.id, Bytes: 2 * 12288, Files: 1, Rows: 1}}, usages)
+
+	usages, err = storage.GetUsage(transactionContext, "identity", "nobody")
+	require.NoError(t, err)
+	require.Equal(t, []*chaincode.Usage{{Scope: "identity", Subject: "nobody"}}, usages)
+
+	_, err = storage.GetUsage(transactionContext, "org", "")
+	require.EqualError(t, err, `unknown usage scope "org", expected "msp" or "identity"`)
+
+	_, err = storage.DeleteFileTree(transactionContext, a)
+	require.NoError(t, err)
+	usages, err = storage.GetUsage(transactionContext, "msp", "Org1MSP")
+	require.NoError(t, err)
+	require.Equal(t, []*chaincode.Usage{{Scope: "msp", Subject: "Org1MSP", Bytes: 2 * 12288, Files: 1, Rows: 3}}, usages)
+
+	transactionContext.GetClientIdentityReturns(user1)
+	err = storage.PruneUsage(transactionContext, "msp", "Org1MSP")
+	require.EqualError(t, err, "submitting client not authorized to prune usage, does not have storage.admin attribute")
+
+	transactionContext.GetClientIdentityReturns(admin)
+	require.NoError(t, storage.PruneUsage(transactionContext, "msp", "Org1MSP"))
+	usages, err = storage.GetUsage(transactionContext, "msp", "Org1MSP")
+	require.NoError(t, err)
+	require.Equal(t, []*chaincode.Usage{{Scope: "msp", Subject: "Org1MSP", Bytes: 2 * 12288, Files: 1, Rows: 1}}, usages)
+}
+
+func TestQuota(t *testing.T) {
+	transactionContext, chaincodeStub, _ := newWorldState()
+	admin := clientIdentity{id: "x509::CN=Admin@org1.example.com", mspID: "Org1MSP", admin: true}
+
+	storage := chaincode.SmartContract{}
+	err := storage.SetQuota(transactionContext, "msp", "Org1MSP", 2*12288)
+	require.EqualError(t, err, "submitting client not authorized to set quotas, does not have storage.admin attribute")
+
+	transactionContext.GetClientIdentityReturns(admin)
+	require.EqualError(t, storage.SetQuota(transactionContext, "msp", "Org1MSP", -1), "quota must not be negative")
+	require.EqualError(t, storage.SetQuota(transactionContext, "msp", "", 1), "subject must not be empty")
+	require.NoError(t, storage.SetQuota(transactionContext, "msp", "Org1MSP", 2*12288))
+	require.NoError(t, storage.SetQuota(transactionContext, "identity", user1.id, 12288))
+
+	name, payload := chaincodeStub.SetEventArgsForCall(1)
+	require.Equal(t, chaincode.SetQuotaEvent, name)
+	require.JSONEq(t, fmt.Sprintf(`{"scope":"identity","subject":%q,"bytes":12288}`, user1.id), string(payload))
+
+	transactionContext.GetClientIdentityReturns(user1)
+	small, large := testHash("small"), testHash("large")
+	_, err = storage.StoreFileTree(transactionContext, small, marshal(t, testFileTree(small, 1)), "")
+	require.NoError(t, err)
+
+	puts := chaincodeStub.PutStateCallCount()
+	_, err = storage.BeginFileTree(transactionContext, large, 2*12288, 2, "", 0, "")
+	require.EqualError(t, err, "storing 24576 bytes exceeds the quota of msp Org1MSP: 12288 of 24576 bytes used")
+	require.Equal(t, puts, chaincodeStub.PutStateCallCount())
+
+	transactionContext.GetClientIdentityReturns(admin)
+	require.NoError(t, storage.SetQuota(transactionContext, "msp", "Org1MSP", 0))
+	transactionContext.GetClientIdentityReturns(user1)
+	_, err = storage.BeginFileTree(transactionContext, large, 12288, 1, "", 0, "")
+	require.EqualError(t, err, fmt.Sprintf("storing 12288 bytes exceeds the quota of identity %s: 12288 of 12288 bytes used", user1.id))
+
+	usages, err := storage.GetUsage(transactionContext, "identity", "")
+	require.NoError(t, err)
+	require.Equal(t, []*chaincode.Usage{{Scope: "identity", Subject: user1.id, Bytes: 12288, Files: 1, Quota: 12288, Rows: 1}}, usages)
+
+	// Deleting frees quota
+	_, err = storage.DeleteFileTree(transactionContext, small)
+	require.NoError(t, err)
+	_, err = storage.StoreFileTree(transactionContext, large, marshal(t, testFileTree(large, 1)), "")
+	require.NoError(t, err)
 }
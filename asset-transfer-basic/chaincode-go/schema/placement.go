@@ -0,0 +1,195 @@
+package schema
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+// NumOfSlots is the number of hash slots on the ring.
+const NumOfSlots = 16384
+
+// NodesPerStripe is the number of nodes the chunks of a stripe are spread
+// over, at most a NodesPerStripe-th of them on each.
+const NodesPerStripe = 3
+
+// SlotID maps a hex encoded hash onto the hash slot ring.
+func SlotID(hash string) int {
+	hashInt := new(big.Int)
+	hashInt.SetString(hash, 16)
+	hashMod := hashInt.Mod(hashInt, big.NewInt(int64(NumOfSlots)))
+	return int(hashMod.Int64())
+}
+
+type slotRange struct {
+	orgID string
+	slot  Slot
+}
+
+// SlotRing holds the ranges of a hash slot table sorted by start slot, ties
+// broken by org ID, so that lookups never depend on map order.
+type SlotRing []slotRange
+
+// NewSlotRing sorts the ranges of a hash slot table.
+func NewSlotRing(hashSlotTable HashSlotTable) SlotRing {
+	ring := make(SlotRing, 0, len(hashSlotTable.HST))
+	for orgID, slot := range hashSlotTable.HST {
+		ring = append(ring, slotRange{orgID: orgID, slot: slot})
+	}
+	sort.Slice(ring, func(i, j int) bool {
+		if ring[i].slot.StartSlot != ring[j].slot.StartSlot {
+			return ring[i].slot.StartSlot < ring[j].slot.StartSlot
+		}
+		return ring[i].orgID < ring[j].orgID
+	})
+	return ring
+}
+
+// Lookup returns the org of the last range starting at or before slot, if
+// that range reaches slot.
+func (r SlotRing) Lookup(slot int) (string, bool) {
+	i := sort.Search(len(r), func(i int) bool {
+		return r[i].slot.StartSlot > slot
+	}) - 1
+	if i < 0 || r[i].slot.EndSlot < slot {
+		return "", false
+	}
+	return r[i].orgID, true
+}
+
+// PlaceStripe decides where the chunks of one stripe are written. home[i] is
+// the org owning the hash slot of chunk i, empty if no org owns it; actual[i]
+// is the org the chunk is stored on after moving chunks off orgs holding more
+// than a NodesPerStripe-th of the stripe to the first org, in slot order,
+// holding fewer. When the two differ the home org keeps a link to the actual
+// one.
+func (r SlotRing) PlaceStripe(chunkHashes []string) (home []string, actual []string) {
+	chunksPerNode := (len(chunkHashes) + NodesPerStripe - 1) / NodesPerStripe
+	nodeCounts := make(map[string]int)
+	for _, entry := range r {
+		nodeCounts[entry.orgID] = 0
+	}
+
+	home = make([]string, len(chunkHashes))
+	actual = make([]string, len(chunkHashes))
+	for i, chunkHash := range chunkHashes {
+		orgID, _ := r.Lookup(SlotID(chunkHash))
+		home[i] = orgID
+		actual[i] = orgID
+		nodeCounts[orgID]++
+	}
+
+	for _, entry := range r {
+		node := entry.orgID
+		for i, currentNode := range actual {
+			if currentNode == node && nodeCounts[node] > chunksPerNode {
+				nextNode := ""
+				for _, other := range r {
+					if other.orgID != node && nodeCounts[other.orgID] < chunksPerNode {
+						nextNode = other.orgID
+						break
+					}
+				}
+				if nextNode != "" {
+					actual[i] = nextNode
+					nodeCounts[node]--
+					nodeCounts[nextNode]++
+				}
+			}
+		}
+	}
+	return home, actual
+}
+
+// AllocateSlots divides the slots between the orgs in proportion to their
+// weights by the largest remainder method: every org first gets the whole
+// part of its quota, the slots left over go to the largest fractional parts,
+// ties broken by org ID. Orgs are then given consecutive ranges in org ID
+// order. Orgs of weight 0, or too light to get a single slot, are left out.
+func AllocateSlots(weights map[string]int) (*HashSlotTable, error) {
+	orgIDs := make([]string, 0, len(weights))
+	totalWeight := int64(0)
+	for orgID, weight := range weights {
+		if weight < 0 {
+			return nil, fmt.Errorf("org %s has negative weight %d", orgID, weight)
+		}
+		if weight > 0 {
+			orgIDs = append(orgIDs, orgID)
+			totalWeight += int64(weight)
+		}
+	}
+	if totalWeight == 0 {
+		return nil, fmt.Errorf("no org has a positive weight")
+	}
+	sort.Strings(orgIDs)
+
+	slots := make(map[string]int, len(orgIDs))
+	remainders := make(map[string]int64, len(orgIDs))
+	allocated := 0
+	for _, orgID := range orgIDs {
+		quota := int64(weights[orgID]) * int64(NumOfSlots)
+		slots[orgID] = int(quota / totalWeight)
+		remainders[orgID] = quota % totalWeight
+		allocated += slots[orgID]
+	}
+
+	byRemainder := append([]string(nil), orgIDs...)
+	sort.SliceStable(byRemainder, func(i, j int) bool {
+		return remainders[byRemainder[i]] > remainders[byRemainder[j]]
+	})
+	for _, orgID := range byRemainder[:NumOfSlots-allocated] {
+		slots[orgID]++
+	}
+
+	hashSlotTable := &HashSlotTable{
+		HST: make(map[string]Slot),
+	}
+	startSlot := 0
+	for _, orgID := range orgIDs {
+		if slots[orgID] == 0 {
+			continue
+		}
+		hashSlotTable.HST[orgID] = Slot{
+			StartSlot: startSlot,
+			EndSlot:   startSlot + slots[orgID] - 1,
+		}
+		startSlot += slots[orgID]
+	}
+
+	return hashSlotTable, ValidateHashSlotTable(hashSlotTable)
+}
+
+// ValidateHashSlotTable checks that the slot ranges, both ends included, lie
+// within the ring and cover each slot exactly once.
+func ValidateHashSlotTable(hashSlotTable *HashSlotTable) error {
+	if len(hashSlotTable.HST) == 0 {
+		return fmt.Errorf("hash slot table is empty")
+	}
+
+	orgIDs := make([]string, 0, len(hashSlotTable.HST))
+	for orgID, slot := range hashSlotTable.HST {
+		if slot.StartSlot < 0 || slot.EndSlot >= NumOfSlots || slot.StartSlot > slot.EndSlot {
+			return fmt.Errorf("org %s has invalid slot range %d-%d", orgID, slot.StartSlot, slot.EndSlot)
+		}
+		orgIDs = append(orgIDs, orgID)
+	}
+	sort.Slice(orgIDs, func(i, j int) bool {
+		return hashSlotTable.HST[orgIDs[i]].StartSlot < hashSlotTable.HST[orgIDs[j]].StartSlot
+	})
+
+	next := 0
+	for _, orgID := range orgIDs {
+		slot := hashSlotTable.HST[orgID]
+		if slot.StartSlot < next {
+			return fmt.Errorf("org %s overlaps the slots before %d", orgID, next)
+		}
+		if slot.StartSlot > next {
+			return fmt.Errorf("slots %d-%d are not assigned", next, slot.StartSlot-1)
+		}
+		next = slot.EndSlot + 1
+	}
+	if next != NumOfSlots {
+		return fmt.Errorf("slots %d-%d are not assigned", next, NumOfSlots-1)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlaceStripe(t *testing.T) {
+	hashSlotTable, err := AllocateSlots(map[string]int{"c": 1, "a": 1, "b": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunkHashes := []string{"0", "1", "2", "3", "4", "5"}
+
+	home, actual := NewSlotRing(*hashSlotTable).PlaceStripe(chunkHashes)
+	for i := range chunkHashes {
+		if home[i] != "a" {
+			t.Fatalf("chunk %d is homed on %s, want a", i, home[i])
+		}
+	}
+	want := []string{"b", "b", "c", "c", "a", "a"}
+	if !reflect.DeepEqual(actual, want) {
+		t.Fatalf("chunks are placed on %v, want %v", actual, want)
+	}
+
+	// Map order must not change the placement
+	for i := 0; i < 20; i++ {
+		_, again := NewSlotRing(*hashSlotTable).PlaceStripe(chunkHashes)
+		if !reflect.DeepEqual(again, actual) {
+			t.Fatalf("placement changed from %v to %v", actual, again)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	ring := NewSlotRing(HashSlotTable{HST: map[string]Slot{
+		"a": {StartSlot: 0, EndSlot: 99},
+		"b": {StartSlot: 200, EndSlot: NumOfSlots - 1},
+	}})
+	tests := []struct {
+		slot  int
+		orgID string
+		ok    bool
+	}{
+		{0, "a", true},
+		{99, "a", true},
+		{100, "", false},
+		{200, "b", true},
+		{NumOfSlots - 1, "b", true},
+	}
+	for _, test := range tests {
+		orgID, ok := ring.Lookup(test.slot)
+		if orgID != test.orgID || ok != test.ok {
+			t.Errorf("Lookup(%d) = %s, %v, want %s, %v", test.slot, orgID, ok, test.orgID, test.ok)
+		}
+	}
+}
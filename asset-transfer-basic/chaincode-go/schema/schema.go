@@ -0,0 +1,334 @@
+// Package schema defines the records the storage chaincode keeps on the
+// ledger, takes as arguments and sets as event payloads, and the rules
+// placing chunks on the hash slot ring. It has no dependencies, so the
+// clients of the chaincode share it with the contract.
+package schema
+
+// Slot is the range of hash slots, both ends included, owned by one org.
+type Slot struct {
+	StartSlot int `json:"startSlot"`
+	EndSlot   int `json:"endSlot"`
+}
+
+// HashSlotTable maps the org IDs, the addresses of their storage nodes, to
+// their slot ranges. Epoch counts the tables created, from 1; the chunks of
+// a file stay where the table of its SlotTableEpoch placed them until they
+// are moved.
+type HashSlotTable struct {
+	HST   map[string]Slot `json:"hashSlotTable"`
+	Epoch int             `json:"epoch,omitempty" metadata:",optional"`
+}
+
+// WeightTable maps the org IDs to the weights the hash slots are split by.
+type WeightTable struct {
+	WT map[string]int `json:"orgWeightTable"`
+}
+
+// Chunk is one shard of a stripe.
+type Chunk struct {
+	ChunkHash string `json:"chunkHash"`
+}
+
+// StripeTree lists the chunks of a stripe in shard order.
+type StripeTree struct {
+	StripeHash  string  `json:"stripeHash"`
+	ChunkHashes []Chunk `json:"chunkHashes"`
+}
+
+// FileTree is the whole tree of a file, as passed to StoreFileTree.
+type FileTree struct {
+	FileHash       string       `json:"fileHash,omitempty"`
+	FileSize       int64        `json:"fileSize,omitempty"`
+	Codec          string       `json:"codec,omitempty" metadata:",optional"`
+	SlotTableEpoch int          `json:"slotTableEpoch,omitempty" metadata:",optional"`
+	StripeHashes   []StripeTree `json:"stripeHashes"`
+}
+
+// FileTreeHeader is the ledger record of a file tree. The stripes are kept in
+// segments of SegmentSize stripes, each under its own key, so that neither a
+// key nor a transaction has to hold the whole tree of a large file.
+type FileTreeHeader struct {
+	FileHash string `json:"fileHash"`
+	FileSize int64  `json:"fileSize"`
+	// Codec names the erasure code of the stripes, empty for the default
+	// Reed-Solomon code of trees stored before it was recorded.
+	Codec string `json:"codec,omitempty" metadata:",optional"`
+	// SlotTableEpoch is the epoch of the hash slot table the chunks were
+	// placed by, zero for trees stored before it was recorded.
+	SlotTableEpoch int `json:"slotTableEpoch,omitempty" metadata:",optional"`
+	Stripes        int `json:"stripes"`
+	SegmentSize    int `json:"segmentSize"`
+	Segments       int `json:"segments"`
+	// Complete is set by CommitFileTree once every segment is stored, the
+	// file is not visible before.
+	Complete bool `json:"complete"`
+	// Metadata is kept between BeginFileTree and CommitFileTree.
+	Metadata *FileMetadataInput `json:"metadata,omitempty" metadata:",optional"`
+	// RetainUntil and ExpireAt are RFC 3339 timestamps, see SetRetention.
+	// The file cannot be deleted before RetainUntil and is removed by the
+	// sweeper after ExpireAt.
+	RetainUntil string `json:"retainUntil,omitempty" metadata:",optional"`
+	ExpireAt    string `json:"expireAt,omitempty" metadata:",optional"`
+}
+
+// FileTreeSegment holds the stripes Index*SegmentSize onwards of a file tree.
+type FileTreeSegment struct {
+	Index        int          `json:"index"`
+	StripeHashes []StripeTree `json:"stripeHashes"`
+}
+
+// DeletedFile is the result of DeleteFileTree and ExpireFile. Files sharing
+// content share stripes and chunks, so Stripes lists only the stripes of the
+// deleted file that no other file holds, and SharedChunks the chunks of them
+// that another file holds nevertheless. The other chunks of Stripes may be
+// deleted from the nodes.
+type DeletedFile struct {
+	FileHash     string       `json:"fileHash"`
+	Stripes      []StripeTree `json:"stripes"`
+	SharedChunks []string     `json:"sharedChunks"`
+}
+
+// FileMetadata describes a stored file. It is kept next to the file tree so
+// files can be listed and queried without reading their trees.
+type FileMetadata struct {
+	DocType     string   `json:"docType"` // always "file", distinguishes metadata in CouchDB queries
+	FileHash    string   `json:"fileHash"`
+	Owner       string   `json:"owner"`    // MSP ID of the client that stored the file
+	Uploader    string   `json:"uploader"` // ID of the client identity that stored the file
+	Size        int64    `json:"size"`
+	CreatedAt   string   `json:"createdAt"` // RFC 3339 timestamp of the storing transaction
+	Tags        []string `json:"tags"`
+	ContentType string   `json:"contentType"`
+}
+
+// FileMetadataInput is the part of the metadata chosen by the client storing
+// a file, passed to StoreFileTree as JSON.
+type FileMetadataInput struct {
+	Tags        []string `json:"tags"`
+	ContentType string   `json:"contentType"`
+	// RetainUntil and ExpireAt are applied with the tree as by SetRetention.
+	RetainUntil string `json:"retainUntil,omitempty" metadata:",optional"`
+	ExpireAt    string `json:"expireAt,omitempty" metadata:",optional"`
+}
+
+// PaginatedFileResult is one page of file metadata. Bookmark is passed back
+// to fetch the next page and is empty after the last one.
+type PaginatedFileResult struct {
+	Records             []*FileMetadata `json:"records"`
+	FetchedRecordsCount int32           `json:"fetchedRecordsCount"`
+	Bookmark            string          `json:"bookmark"`
+}
+
+// Events emitted by the contract. Fabric keeps a single event per
+// transaction, so every function sets at most one.
+const (
+	// StoreFileTreeEvent and DeleteFileTreeEvent carry a FileEvent.
+	StoreFileTreeEvent  = "StoreFileTree"
+	DeleteFileTreeEvent = "DeleteFileTree"
+	// UpdateOrgWeightEvent and RemoveOrgEvent carry an OrgEvent.
+	UpdateOrgWeightEvent = "UpdateOrgWeight"
+	RemoveOrgEvent       = "RemoveOrg"
+	// CreateHashSlotTableEvent carries the new HashSlotTable.
+	CreateHashSlotTableEvent = "CreateHashSlotTable"
+	// SetQuotaEvent carries a QuotaEvent.
+	SetQuotaEvent = "SetQuota"
+	// PutObjectEvent and DeleteObjectEvent carry an ObjectEvent.
+	PutObjectEvent    = "PutObject"
+	DeleteObjectEvent = "DeleteObject"
+	// SetRefEvent and DeleteRefEvent carry a RefEvent.
+	SetRefEvent    = "SetRef"
+	DeleteRefEvent = "DeleteRef"
+	// SetRetentionEvent carries a RetentionEvent, SetLegalHoldEvent and
+	// ReleaseLegalHoldEvent the LegalHold.
+	SetRetentionEvent     = "SetRetention"
+	SetLegalHoldEvent     = "SetLegalHold"
+	ReleaseLegalHoldEvent = "ReleaseLegalHold"
+	// ConfigurePaymentsEvent carries the PaymentConfig, SetPayoutAccountEvent a
+	// PayoutAccountEvent, ReportShardsEvent the ShardReport and
+	// SettlePaymentsEvent the Settlement.
+	ConfigurePaymentsEvent = "ConfigurePayments"
+	SetPayoutAccountEvent  = "SetPayoutAccount"
+	ReportShardsEvent      = "ReportShards"
+	SettlePaymentsEvent    = "SettlePayments"
+)
+
+// FileEvent is the payload of the StoreFileTree and DeleteFileTree events.
+type FileEvent struct {
+	FileHash string `json:"fileHash"`
+}
+
+// OrgEvent is the payload of the UpdateOrgWeight and RemoveOrg events.
+type OrgEvent struct {
+	OrgID  string `json:"orgID"`
+	Weight int    `json:"weight,omitempty"`
+}
+
+// QuotaEvent is the payload of the SetQuota event, Bytes is 0 when the quota
+// was removed.
+type QuotaEvent struct {
+	Scope   string `json:"scope"`
+	Subject string `json:"subject"`
+	Bytes   int64  `json:"bytes"`
+}
+
+// Usage is the storage used by one subject, as returned by GetUsage.
+type Usage struct {
+	Scope   string `json:"scope"`
+	Subject string `json:"subject"`
+	Bytes   int64  `json:"bytes"`
+	Files   int64  `json:"files"`
+	Quota   int64  `json:"quota"` // 0 without a quota
+	Rows    int    `json:"rows"`  // delta rows, PruneUsage folds them into one
+}
+
+// LegalHold keeps a file from being deleted until it is released. The
+// record stays with the clients that set and released it.
+type LegalHold struct {
+	FileHash      string `json:"fileHash"`
+	HoldID        string `json:"holdID"`
+	Reason        string `json:"reason"`
+	Active        bool   `json:"active"`
+	SetBy         string `json:"setBy"`    // ID of the client that set the hold
+	SetByMSP      string `json:"setByMSP"` // MSP ID of that client
+	SetAt         string `json:"setAt"`    // RFC 3339 timestamp of the setting transaction
+	ReleasedBy    string `json:"releasedBy,omitempty" metadata:",optional"`
+	ReleasedByMSP string `json:"releasedByMSP,omitempty" metadata:",optional"`
+	ReleasedAt    string `json:"releasedAt,omitempty" metadata:",optional"`
+}
+
+// Retention is the result of GetRetention, with every hold ever set on the
+// file.
+type Retention struct {
+	FileHash    string       `json:"fileHash"`
+	RetainUntil string       `json:"retainUntil,omitempty" metadata:",optional"`
+	ExpireAt    string       `json:"expireAt,omitempty" metadata:",optional"`
+	Holds       []*LegalHold `json:"holds"`
+}
+
+// RetentionEvent is the payload of the SetRetention event.
+type RetentionEvent struct {
+	FileHash    string `json:"fileHash"`
+	RetainUntil string `json:"retainUntil,omitempty"`
+	ExpireAt    string `json:"expireAt,omitempty"`
+}
+
+// Bucket is a namespace of objects. Only clients of the owner MSP may change
+// its objects.
+type Bucket struct {
+	Name      string `json:"name"`
+	Owner     string `json:"owner"`     // MSP ID of the client that created the bucket
+	CreatedAt string `json:"createdAt"` // RFC 3339 timestamp of the creating transaction
+}
+
+// ObjectInput is the part of an object chosen by the gateway, passed to
+// PutObject as JSON.
+type ObjectInput struct {
+	FileHash    string            `json:"fileHash"`
+	Size        int64             `json:"size"`
+	ETag        string            `json:"etag"`
+	ContentType string            `json:"contentType"`
+	Metadata    map[string]string `json:"metadata,omitempty" metadata:",optional"`
+}
+
+// Object maps a key of a bucket to a stored file.
+type Object struct {
+	Bucket       string            `json:"bucket"`
+	Key          string            `json:"key"`
+	FileHash     string            `json:"fileHash"`
+	Size         int64             `json:"size"`
+	ETag         string            `json:"etag"`
+	ContentType  string            `json:"contentType"`
+	Metadata     map[string]string `json:"metadata,omitempty" metadata:",optional"`
+	LastModified string            `json:"lastModified"` // RFC 3339 timestamp of the storing transaction
+}
+
+// ObjectPage is one page of ListObjects. IsTruncated tells whether objects
+// after the last one are left.
+type ObjectPage struct {
+	Objects     []*Object `json:"objects"`
+	IsTruncated bool      `json:"isTruncated"`
+}
+
+// ObjectEvent is the payload of the PutObject and DeleteObject events.
+type ObjectEvent struct {
+	Bucket   string `json:"bucket"`
+	Key      string `json:"key"`
+	FileHash string `json:"fileHash"`
+}
+
+// Ref points a name to a stored file. Version counts the updates of the
+// name from 1.
+type Ref struct {
+	Name      string `json:"name"`
+	FileHash  string `json:"fileHash"`
+	Version   int    `json:"version"`
+	Owner     string `json:"owner"`     // MSP ID of the client that created the ref
+	UpdatedBy string `json:"updatedBy"` // ID of the client that set this version
+	UpdatedAt string `json:"updatedAt"` // RFC 3339 timestamp of the setting transaction, in nanoseconds
+}
+
+// RefHistoryRecord is one change of a ref in the ledger history, like the
+// records of GetAssetHistory in asset-transfer-ledger-queries. Record is
+// nil when the change deleted the ref.
+type RefHistoryRecord struct {
+	Record    *Ref   `json:"record" metadata:",optional"`
+	TxId      string `json:"txId"`
+	Timestamp string `json:"timestamp"` // RFC 3339 timestamp of the transaction, in nanoseconds
+	IsDelete  bool   `json:"isDelete"`
+}
+
+// RefEvent is the payload of the SetRef and DeleteRef events.
+type RefEvent struct {
+	Name     string `json:"name"`
+	FileHash string `json:"fileHash"`
+	Version  int    `json:"version"`
+}
+
+// PaymentConfig names the token chaincode and the price of storage.
+type PaymentConfig struct {
+	TokenChaincode string `json:"tokenChaincode"`
+	Treasury       string `json:"treasury"`       // token account holding the escrows, the ID of the client that configured payments
+	PricePerGiBDay int64  `json:"pricePerGiBDay"` // tokens per GiB of stored chunks per day
+}
+
+// Escrow is the deposit paid for storing a file until PaidUntil. Settled
+// counts the tokens paid to storage orgs for the time up to SettledUntil.
+// ClosedAt is set when the file is deleted, the rest of the deposit is
+// refunded to the payer by the next settlement, which removes the escrow.
+type Escrow struct {
+	FileHash     string `json:"fileHash"`
+	TxID         string `json:"txID"`        // the transaction that stored the file
+	Payer        string `json:"payer"`       // ID of the client that stored the file, refunds go to it
+	StoredBytes  int64  `json:"storedBytes"` // the file size times the redundancy of its codec
+	Amount       int64  `json:"amount"`      // tokens deposited, including expiry extensions
+	Settled      int64  `json:"settled"`
+	Refunded     int64  `json:"refunded"`
+	SettledUntil string `json:"settledUntil"` // RFC 3339 timestamps
+	PaidUntil    string `json:"paidUntil"`
+	ClosedAt     string `json:"closedAt,omitempty" metadata:",optional"`
+}
+
+// ShardReport is the number of shards each org was verified to hold intact,
+// as reported by an audit of the stored files.
+type ShardReport struct {
+	Shards     map[string]int `json:"shards"`
+	ReportedBy string         `json:"reportedBy"`
+	ReportedAt string         `json:"reportedAt"`
+}
+
+// PayoutAccountEvent is the payload of the SetPayoutAccount event.
+type PayoutAccountEvent struct {
+	OrgID   string `json:"orgID"`
+	Account string `json:"account"`
+}
+
+// Settlement is the result and the event of SettlePayments. More is set when
+// escrows were left for another call.
+type Settlement struct {
+	SettledAt string           `json:"settledAt"`
+	Escrows   int              `json:"escrows"`
+	Earned    int64            `json:"earned"`
+	Payouts   map[string]int64 `json:"payouts"` // tokens per org
+	Refunds   map[string]int64 `json:"refunds"` // tokens per payer
+	More      bool             `json:"more"`
+}
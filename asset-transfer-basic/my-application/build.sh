@@ -1,5 +1,4 @@
-go build boost.go
-go build chunk_storage_service.go
-go build file_partition_service.go storage_object.go
-go build store_file.go
-go build request_file.go storage_object.go
+go build ./cmd/dsctl
+go build ./cmd/chunk_storage_service
+go build ./cmd/file_partition_service
+go build ./cmd/s3_gateway
@@ -0,0 +1,132 @@
+// Package chaos injects faults into the requests of a ChunkStorage server, so
+// that files can be seen to survive slow, failing, corrupting and forgetful
+// nodes.
+package chaos
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+
+	metrics "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/metrics"
+	pb "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/protos"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// adminMethods are never faulted, so the faults can always be changed.
+var adminMethods = map[string]bool{
+	"/messages.ChunkStorage/SetFaults":  true,
+	"/messages.ChunkStorage/LoseChunks": true,
+}
+
+// Injector injects the faults of a FaultConfig, which can be replaced while
+// the server runs.
+type Injector struct {
+	mu     sync.Mutex
+	config *pb.FaultConfig
+}
+
+// NewInjector returns an Injector injecting the faults of config, none if it
+// is nil.
+func NewInjector(config *pb.FaultConfig) (*Injector, error) {
+	i := &Injector{config: &pb.FaultConfig{}}
+	if config != nil {
+		if err := i.Set(config); err != nil {
+			return nil, err
+		}
+	}
+	return i, nil
+}
+
+// Validate checks that the latency of config is not negative and its rates
+// are between 0 and 1.
+func Validate(config *pb.FaultConfig) error {
+	if config.GetLatencyMs() < 0 {
+		return fmt.Errorf("latency must not be negative")
+	}
+	rates := map[string]float64{
+		"drop":    config.GetDropRate(),
+		"corrupt": config.GetCorruptRate(),
+		"loss":    config.GetLossRate(),
+	}
+	for name, rate := range rates {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("%s rate %v is not between 0 and 1", name, rate)
+		}
+	}
+	return nil
+}
+
+// Set replaces the injected faults.
+func (i *Injector) Set(config *pb.FaultConfig) error {
+	if err := Validate(config); err != nil {
+		return err
+	}
+	i.mu.Lock()
+	i.config = proto.Clone(config).(*pb.FaultConfig)
+	i.mu.Unlock()
+	slog.Warn("fault injection changed", "latency_ms", config.GetLatencyMs(), "drop_rate", config.GetDropRate(), "corrupt_rate", config.GetCorruptRate(), "loss_rate", config.GetLossRate())
+	return nil
+}
+
+// Config returns a copy of the injected faults.
+func (i *Injector) Config() *pb.FaultConfig {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return proto.Clone(i.config).(*pb.FaultConfig)
+}
+
+// inject reports whether a fault of the given rate happens to a request, and
+// counts it.
+func inject(kind string, rate float64) bool {
+	if rate <= 0 || rand.Float64() >= rate {
+		return false
+	}
+	metrics.FaultsInjected.WithLabelValues(kind).Inc()
+	return true
+}
+
+// UnaryServerInterceptor delays, drops, corrupts and loses the requests of a
+// ChunkStorage server as configured. A dropped request is not served, a lost
+// chunk is acknowledged without being stored and a corrupted chunk is read
+// with one bit flipped.
+func (i *Injector) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if adminMethods[info.FullMethod] {
+			return handler(ctx, req)
+		}
+		config := i.Config()
+
+		if latency := time.Duration(config.GetLatencyMs()) * time.Millisecond; latency > 0 {
+			metrics.FaultsInjected.WithLabelValues("latency").Inc()
+			timer := time.NewTimer(latency)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, status.FromContextError(ctx.Err()).Err()
+			case <-timer.C:
+			}
+		}
+		if inject("drop", config.GetDropRate()) {
+			return nil, status.Error(codes.Unavailable, "request dropped by fault injection")
+		}
+		if _, ok := req.(*pb.ChunkStorageRequest); ok && inject("loss", config.GetLossRate()) {
+			return &pb.ChunkStorageResponse{Status: "SUCCESS"}, nil
+		}
+
+		resp, err := handler(ctx, req)
+		if res, ok := resp.(*pb.ChunkResponse); ok && err == nil && len(res.GetData()) > 0 && inject("corrupt", config.GetCorruptRate()) {
+			data := append([]byte(nil), res.GetData()...)
+			bit := rand.Intn(len(data) * 8)
+			data[bit/8] ^= 1 << (bit % 8)
+			resp = &pb.ChunkResponse{Data: data}
+		}
+		return resp, err
+	}
+}
@@ -0,0 +1,110 @@
+package chaos
+
+import (
+	"bytes"
+	"context"
+	"math/bits"
+	"testing"
+	"time"
+
+	pb "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/protos"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var chunk = bytes.Repeat([]byte{0x5a}, 64)
+
+// call runs a request through the interceptor of the injector and reports
+// whether the handler served it.
+func call(t *testing.T, i *Injector, method string, req interface{}) (interface{}, bool, error) {
+	t.Helper()
+	served := false
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		served = true
+		switch req.(type) {
+		case *pb.ChunkRequest:
+			return &pb.ChunkResponse{Data: chunk}, nil
+		case *pb.ChunkStorageRequest:
+			return &pb.ChunkStorageResponse{Status: "SUCCESS"}, nil
+		}
+		return &pb.FaultConfig{}, nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/messages.ChunkStorage/" + method}
+	resp, err := i.UnaryServerInterceptor()(context.Background(), req, info, handler)
+	return resp, served, err
+}
+
+func TestNoFaults(t *testing.T) {
+	i, err := NewInjector(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := 0; n < 100; n++ {
+		resp, served, err := call(t, i, "GetChunk", &pb.ChunkRequest{})
+		if err != nil || !served || !bytes.Equal(resp.(*pb.ChunkResponse).Data, chunk) {
+			t.Fatalf("GetChunk returned %v, %v and was served %v", resp, err, served)
+		}
+	}
+}
+
+func TestFaults(t *testing.T) {
+	i, err := NewInjector(&pb.FaultConfig{DropRate: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, served, err := call(t, i, "GetChunk", &pb.ChunkRequest{})
+	if status.Code(err) != codes.Unavailable || served {
+		t.Fatalf("dropped GetChunk returned %v and was served %v", err, served)
+	}
+	// The faults can still be changed
+	if _, served, err := call(t, i, "SetFaults", &pb.FaultConfig{}); err != nil || !served {
+		t.Fatalf("SetFaults returned %v and was served %v", err, served)
+	}
+
+	if err := i.Set(&pb.FaultConfig{LossRate: 1, CorruptRate: 1}); err != nil {
+		t.Fatal(err)
+	}
+	resp, served, err := call(t, i, "StoreChunk", &pb.ChunkStorageRequest{Data: chunk})
+	if err != nil || served || resp.(*pb.ChunkStorageResponse).Status != "SUCCESS" {
+		t.Fatalf("lost StoreChunk returned %v, %v and was served %v", resp, err, served)
+	}
+	resp, _, err = call(t, i, "GetChunk", &pb.ChunkRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	flipped := 0
+	for n, b := range resp.(*pb.ChunkResponse).Data {
+		flipped += bits.OnesCount8(b ^ chunk[n])
+	}
+	if flipped != 1 || chunk[0] != 0x5a {
+		t.Fatalf("corrupted GetChunk flipped %d bits, want 1 of a copy", flipped)
+	}
+
+	if err := i.Set(&pb.FaultConfig{LatencyMs: 20}); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, _, err := call(t, i, "GetChunk", &pb.ChunkRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Fatalf("GetChunk took %s, want at least the latency", elapsed)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, config := range []*pb.FaultConfig{
+		{LatencyMs: -1},
+		{DropRate: 1.5},
+		{CorruptRate: -0.1},
+		{LossRate: 2},
+	} {
+		if err := Validate(config); err == nil {
+			t.Errorf("Validate(%v) accepted it", config)
+		}
+	}
+	if _, err := NewInjector(&pb.FaultConfig{DropRate: 2}); err == nil {
+		t.Error("NewInjector accepted a drop rate of 2")
+	}
+}
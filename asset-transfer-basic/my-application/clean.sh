@@ -1,3 +1,5 @@
-rm *.json
+# file trees are named after the 64-character file hash, dsctl*.json is kept
+find . -maxdepth 1 -regex './[0-9a-f]\{64\}\.json' -delete
 rm -rf memory1
 rm -rf memory2
+rm -rf node1 node2 node3
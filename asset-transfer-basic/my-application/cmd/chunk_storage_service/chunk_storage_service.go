@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"flag"
+	"math/big"
+	"math/rand"
+	"log/slog"
+	"path/filepath"
+	"sync"
+
+	chaos "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/chaos"
+	metrics "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/metrics"
+	pb "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/protos"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var port = flag.String("port", ":50052", "listening port")
+var dir = flag.String("dir", ".", "directory holding the chunk folders memory1 and memory2, one per node running on a host")
+var metricsAddr = flag.String("metrics", "", "address serving Prometheus metrics on /metrics, disabled if empty")
+var chaosMode = flag.Bool("chaos", false, "enable fault injection through the flags below and the SetFaults and LoseChunks RPCs, for chaos testing only")
+var faultLatency = flag.Duration("fault-latency", 0, "latency added to every request in chaos mode")
+var faultDrop = flag.Float64("fault-drop", 0, "fraction of the requests dropped in chaos mode")
+var faultCorrupt = flag.Float64("fault-corrupt", 0, "fraction of the chunks read returned with a bit flipped in chaos mode")
+var faultLoss = flag.Float64("fault-loss", 0, "fraction of the chunks acknowledged without being stored in chaos mode")
+// injector is nil unless the server runs in chaos mode
+var injector *chaos.Injector
+var linkMap = make(map[string]string)
+var linkMu sync.RWMutex
+
+type server struct{
+	pb.UnimplementedChunkStorageServer
+}
+
+func (s *server) StoreChunk(ctx context.Context, in *pb.ChunkStorageRequest) (*pb.ChunkStorageResponse, error) {
+	// Ensure the memory directory exists
+	if _, err := os.Stat(filepath.Join(*dir, "memory1")); os.IsNotExist(err) {
+		os.MkdirAll(filepath.Join(*dir, "memory1"), 0755)
+	}
+
+	if _, err := os.Stat(filepath.Join(*dir, "memory2")); os.IsNotExist(err) {
+		os.MkdirAll(filepath.Join(*dir, "memory2"), 0755)
+	}
+	
+	// Store the chunk in memory folder
+	hash := sha256.Sum256(in.GetData())
+	hashString := hex.EncodeToString(hash[:])
+	hashInt := new(big.Int)
+	hashInt.SetString(hashString, 16)
+	hashMod := hashInt.Mod(hashInt, big.NewInt(int64(16384)))
+	slotID := int(hashMod.Int64())
+
+	targetDirectory := filepath.Join(*dir, "memory2")
+	if slotID < 8193 {
+		targetDirectory = filepath.Join(*dir, "memory1")
+	}
+
+	err := ioutil.WriteFile(fmt.Sprintf("%s/%s", targetDirectory, hashString), in.GetData(), 0644)
+	if err != nil {
+		slog.Error("failed to store chunk", "chunk", hashString, "err", err)
+		return nil, err
+	}
+	metrics.BytesStored.Add(float64(len(in.GetData())))
+
+	// Return success response
+	return &pb.ChunkStorageResponse{Status: "SUCCESS"}, nil
+}
+
+func (s *server) GetChunk(ctx context.Context, in *pb.ChunkRequest) (*pb.ChunkResponse, error) {
+	hashString := in.GetHash()
+
+	linkMu.RLock()
+	target, ok := linkMap[hashString]
+	linkMu.RUnlock()
+
+	if ok {
+		slog.Debug("forwarding chunk request", "chunk", hashString, "peer", target)
+		metrics.ForwardingHops.Inc()
+		nConn, err := grpc.Dial(target, grpc.WithInsecure())
+		if err != nil {
+			log.Fatalf("Failed to connect: %v", err)
+		}
+		defer nConn.Close()
+
+		nStub := pb.NewChunkStorageClient(nConn)
+
+		nRq := &pb.ChunkRequest{
+			Hash:  hashString,
+		}
+	
+		chunkData, err := nStub.GetChunk(context.Background(), nRq)
+		if err != nil {
+			slog.Error("failed to get forwarded chunk", "chunk", hashString, "peer", target, "err", err)
+			return nil, err
+		}
+		metrics.BytesServed.Add(float64(len(chunkData.Data)))
+		return &pb.ChunkResponse{Data: chunkData.Data}, nil
+	}
+
+	
+	hashInt := new(big.Int)
+	hashInt.SetString(hashString, 16)
+	hashMod := hashInt.Mod(hashInt, big.NewInt(int64(16384)))
+	slotID := int(hashMod.Int64())
+
+	targetDirectory := filepath.Join(*dir, "memory2")
+	if slotID < 8193 {
+		targetDirectory = filepath.Join(*dir, "memory1")
+	}
+
+	// Search local folder "memory". If there is a file named as hashString, return it.
+	data, err := ioutil.ReadFile(fmt.Sprintf("%s/%s", targetDirectory, hashString))
+	if err != nil {
+		return nil, err
+	}
+	metrics.BytesServed.Add(float64(len(data)))
+
+	return &pb.ChunkResponse{Data: data}, nil
+}
+
+func (s *server) StoreLink(ctx context.Context, in *pb.LinkStorageRequest) (*pb.LinkStorageResponse, error) {
+	hashString := in.GetHash()
+	id := in.GetId()
+	
+	linkMu.Lock()
+	linkMap[hashString] = id
+	linkMu.Unlock()
+	slog.Debug("stored link", "chunk", hashString, "peer", id)
+	return &pb.LinkStorageResponse{Status: "SUCCESS"}, nil
+} 
+
+func (s *server) DeleteChunk(ctx context.Context, in *pb.ChunkDeletionRequest) (*pb.ChunkDeletionResponse, error) {
+	hashString := in.GetHash()
+
+	// This node may only hold a link to the node storing the chunk
+	linkMu.Lock()
+	_, ok := linkMap[hashString]
+	delete(linkMap, hashString)
+	linkMu.Unlock()
+
+	if ok {
+		slog.Debug("deleted link", "chunk", hashString)
+		return &pb.ChunkDeletionResponse{Status: "SUCCESS"}, nil
+	}
+
+	hashInt := new(big.Int)
+	hashInt.SetString(hashString, 16)
+	hashMod := hashInt.Mod(hashInt, big.NewInt(int64(16384)))
+	slotID := int(hashMod.Int64())
+
+	targetDirectory := filepath.Join(*dir, "memory2")
+	if slotID < 8193 {
+		targetDirectory = filepath.Join(*dir, "memory1")
+	}
+
+	err := os.Remove(fmt.Sprintf("%s/%s", targetDirectory, hashString))
+	if err != nil && !os.IsNotExist(err) {
+		slog.Error("failed to delete chunk", "chunk", hashString, "err", err)
+		return nil, err
+	}
+	slog.Debug("deleted chunk", "chunk", hashString)
+	return &pb.ChunkDeletionResponse{Status: "SUCCESS"}, nil
+}
+
+func (s *server) SetFaults(ctx context.Context, in *pb.FaultConfig) (*pb.FaultConfig, error) {
+	if injector == nil {
+		return nil, status.Error(codes.FailedPrecondition, "fault injection is disabled, start the server with -chaos")
+	}
+	if err := injector.Set(in); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return injector.Config(), nil
+}
+
+// LoseChunks deletes a fraction of the stored chunks chosen at random, as a
+// failing disk would. Links are kept.
+func (s *server) LoseChunks(ctx context.Context, in *pb.LoseChunksRequest) (*pb.LoseChunksResponse, error) {
+	if injector == nil {
+		return nil, status.Error(codes.FailedPrecondition, "fault injection is disabled, start the server with -chaos")
+	}
+	if in.GetFraction() < 0 || in.GetFraction() > 1 {
+		return nil, status.Errorf(codes.InvalidArgument, "fraction %v is not between 0 and 1", in.GetFraction())
+	}
+
+	var paths []string
+	for _, directory := range []string{filepath.Join(*dir, "memory1"), filepath.Join(*dir, "memory2")} {
+		entries, err := os.ReadDir(directory)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		for _, entry := range entries {
+			paths = append(paths, filepath.Join(directory, entry.Name()))
+		}
+	}
+	rand.Shuffle(len(paths), func(i, j int) { paths[i], paths[j] = paths[j], paths[i] })
+
+	lost := int(in.GetFraction()*float64(len(paths)) + 0.5)
+	for _, path := range paths[:lost] {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	metrics.FaultsInjected.WithLabelValues("lose_chunks").Add(float64(lost))
+	slog.Warn("chunks lost by fault injection", "lost", lost, "stored", len(paths))
+	return &pb.LoseChunksResponse{Lost: int64(lost)}, nil
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Println("Usage: ./chunk_storage_service [-h] [-port string] [-metrics string] [-chaos [-fault-latency duration] [-fault-drop float] [-fault-corrupt float] [-fault-loss float]]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, nil)).With("service", "chunk_storage", "port", *port))
+	metrics.Serve(*metricsAddr)
+
+	faults := &pb.FaultConfig{
+		LatencyMs:   faultLatency.Milliseconds(),
+		DropRate:    *faultDrop,
+		CorruptRate: *faultCorrupt,
+		LossRate:    *faultLoss,
+	}
+	if !*chaosMode && (faults.LatencyMs != 0 || faults.DropRate != 0 || faults.CorruptRate != 0 || faults.LossRate != 0) {
+		log.Fatal("The fault flags need -chaos")
+	}
+	interceptors := []grpc.UnaryServerInterceptor{metrics.UnaryServerInterceptor()}
+	if *chaosMode {
+		var err error
+		injector, err = chaos.NewInjector(faults)
+		if err != nil {
+			log.Fatalf("Invalid faults: %v", err)
+		}
+		// Injected faults run inside the metrics interceptor, so they are
+		// counted and logged like real ones
+		interceptors = append(interceptors, injector.UnaryServerInterceptor())
+	}
+
+	// Create a listener on the TCP port
+	lis, err := net.Listen("tcp", *port)
+	if err != nil {
+		log.Fatalf("Failed to listen: %v", err)
+	}
+
+	// Create a new gRPC server
+	s := grpc.NewServer(grpc.ChainUnaryInterceptor(interceptors...))
+
+	// Register the chunk storage server
+	pb.RegisterChunkStorageServer(s, &server{})
+
+	// Start the server
+	slog.Info("starting chunk storage server")
+	if err := s.Serve(lis); err != nil {
+		log.Fatalf("Failed to serve: %v", err)
+	}
+}
+
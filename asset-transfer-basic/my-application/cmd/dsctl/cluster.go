@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	ledger "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/ledger"
+)
+
+// clusterInit initializes the ledger, registers every node of the
+// configuration with its weight and creates the hash slot table.
+func clusterInit(c *client, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: ./dsctl cluster init")
+	}
+
+	chain, err := c.chaincode()
+	if err != nil {
+		return err
+	}
+	if _, err := chain.InitLedger(); err != nil {
+		return err
+	}
+	for _, node := range c.cfg.Nodes {
+		if _, err := chain.UpdateOrgWeight(node.Addr, node.Weight); err != nil {
+			return err
+		}
+	}
+	return rebuildHashSlotTable(chain)
+}
+
+func nodeAdd(c *client, args []string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return fmt.Errorf("usage: ./dsctl node add <addr> [weight]")
+	}
+	weight := "100"
+	if len(args) == 2 {
+		weight = args[1]
+	}
+	return setWeight(c, args[0], weight)
+}
+
+func nodeWeight(c *client, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: ./dsctl node weight <addr> <weight>")
+	}
+	return setWeight(c, args[0], args[1])
+}
+
+func nodeRemove(c *client, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: ./dsctl node remove <addr>")
+	}
+	chain, err := c.chaincode()
+	if err != nil {
+		return err
+	}
+	if _, err := chain.RemoveOrg(args[0]); err != nil {
+		return err
+	}
+	return rebuildHashSlotTable(chain)
+}
+
+func setWeight(c *client, addr string, weight string) error {
+	n, err := strconv.Atoi(weight)
+	if err != nil {
+		return fmt.Errorf("invalid weight %q", weight)
+	}
+	chain, err := c.chaincode()
+	if err != nil {
+		return err
+	}
+	if _, err := chain.UpdateOrgWeight(addr, n); err != nil {
+		return err
+	}
+	return rebuildHashSlotTable(chain)
+}
+
+// rebuildHashSlotTable recreates the hash slot table from the weights and
+// prints it.
+func rebuildHashSlotTable(chain *ledger.Fabric) error {
+	if _, err := chain.CreateHashSlotTable(); err != nil {
+		return err
+	}
+	hashSlotTable, err := chain.GetHashSlotTable()
+	if err != nil {
+		return fmt.Errorf("failed to get hash slot table: %v", err)
+	}
+
+	orgs := make([]string, 0, len(hashSlotTable.HST))
+	for org := range hashSlotTable.HST {
+		orgs = append(orgs, org)
+	}
+	sort.Strings(orgs)
+	for _, org := range orgs {
+		slot := hashSlotTable.HST[org]
+		fmt.Printf("%s\t%d-%d\n", org, slot.StartSlot, slot.EndSlot)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+
+	fabric "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/fabric"
+	utils "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/utils"
+)
+
+// Config is the content of the dsctl configuration file. Fields left out of
+// the file keep the defaults, which match test-network run from this
+// directory. The Fabric settings sit at the top level of the file.
+type Config struct {
+	fabric.Config
+
+	// FilePartition is the address of file_partition_service.
+	FilePartition string       `json:"filePartition"`
+	Nodes         []NodeConfig `json:"nodes"`
+}
+
+type NodeConfig struct {
+	Addr   string `json:"addr"`
+	Weight int    `json:"weight"`
+}
+
+func defaultConfig() *Config {
+	cfg := &Config{
+		Config:        fabric.DefaultConfig(),
+		FilePartition: "localhost:50051",
+	}
+	for i, addr := range utils.MasterNodes {
+		weight, _ := strconv.Atoi(utils.Weights[i])
+		cfg.Nodes = append(cfg.Nodes, NodeConfig{Addr: addr, Weight: weight})
+	}
+	return cfg
+}
+
+// loadConfig reads the configuration file at path on top of the defaults, then
+// applies the FABRIC_* environment variables. A missing file is only an error
+// when it was asked for explicitly.
+func loadConfig(path string, explicit bool) (*Config, error) {
+	cfg := defaultConfig()
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && !explicit:
+	case err != nil:
+		return nil, fmt.Errorf("failed to read config %s: %v", path, err)
+	default:
+		if err := json.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse config %s: %v", path, err)
+		}
+	}
+
+	if err := cfg.LoadEnv(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (cfg *Config) nodeAddrs() []string {
+	addrs := make([]string, len(cfg.Nodes))
+	for i, node := range cfg.Nodes {
+		addrs[i] = node.Addr
+	}
+	return addrs
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	pb "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/protos"
+	storage "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/storage"
+	utils "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/utils"
+	"google.golang.org/grpc"
+)
+
+// stringList is a flag that can be repeated.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// putFile sends a file to file_partition_service, which encodes it, stores
+// the chunks and records the file tree on the ledger.
+func putFile(c *client, args []string) error {
+	flags := flag.NewFlagSet("put", flag.ContinueOnError)
+	var tags stringList
+	flags.Var(&tags, "tag", "a tag of the file, may be repeated")
+	contentType := flags.String("type", "", "the content type of the file (default detected from the content)")
+	codec := flags.String("codec", "", "the codec of the stripes, one of "+strings.Join(utils.CodecNames(), ", ")+" (default chosen by file_partition_service)")
+	name := flags.String("name", "", "a ref to point to the file once it is stored")
+	wait := flags.Duration("wait", time.Minute, "how long to wait for the file to be stored before pointing -name to it")
+	retainUntil := flags.String("retain-until", "", "keep the file from deletion until this RFC 3339 time")
+	expireAt := flags.String("expire-at", "", "let the sweeper remove the file after this RFC 3339 time")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: ./dsctl put [-tag string]... [-type string] [-codec string] [-retain-until time] [-expire-at time] [-name string [-wait duration]] <file>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected one file")
+	}
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to read file: %v", err)
+	}
+
+	conn, err := grpc.Dial(c.cfg.FilePartition, grpc.WithInsecure(), grpc.WithDefaultCallOptions(grpc.MaxCallSendMsgSize(1024*1024*1024)))
+	if err != nil {
+		return fmt.Errorf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	response, err := pb.NewFilePartitionClient(conn).PartitionFile(context.Background(), &pb.FilePartitionRequest{
+		Data:        data,
+		Tags:        tags,
+		ContentType: *contentType,
+		Codec:       *codec,
+		RetainUntil: *retainUntil,
+		ExpireAt:    *expireAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store file: %v", err)
+	}
+
+	fmt.Println(response.Status)
+	if *name == "" {
+		return nil
+	}
+	// file_partition_service stores the file in the background
+	if err := waitForFile(c, response.Status, *wait); err != nil {
+		return err
+	}
+	return pointRef(c, *name, response.Status)
+}
+
+func getFile(c *client, args []string) error {
+	flags := flag.NewFlagSet("get", flag.ContinueOnError)
+	out := flags.String("o", "out", "the name of the output file")
+	offset := flags.Int64("offset", 0, "the first byte of the file to read")
+	length := flags.Int64("length", -1, "the number of bytes to read, -1 reads to the end of the file")
+	stripes := flags.Int("stripes", 4, "the number of stripes fetched concurrently")
+	hedge := flags.Duration("hedge", 200*time.Millisecond, "how long to wait for data shards before requesting parity shards")
+	version := flags.Int("version", 0, "the version of the ref to fetch (default the current one)")
+	at := flags.String("at", "", "fetch the version of the ref current at this RFC 3339 time, e.g. 2023-05-01T12:00:00Z")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: ./dsctl get [-o string] [-offset int] [-length int] [-stripes int] [-hedge duration] [-version int | -at time] <hash | name>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected one file hash or ref name")
+	}
+
+	// Anything but a hash names a ref, and so does a hash with a version
+	fileHash := flags.Arg(0)
+	if !isFileHash(fileHash) || *version != 0 || *at != "" {
+		ref, err := resolveRef(c, fileHash, *version, *at)
+		if err != nil {
+			return err
+		}
+		fileHash = ref.FileHash
+	}
+
+	file, err := c.fileTree(fileHash)
+	if err != nil {
+		return err
+	}
+	hashSlotTable, err := c.hashSlotTable()
+	if err != nil {
+		return err
+	}
+
+	reader := storage.NewReader(hashSlotTable, c.cfg.nodeAddrs())
+	reader.SlotTables, err = c.chaincode()
+	if err != nil {
+		return err
+	}
+	reader.StripesInFlight = *stripes
+	reader.HedgeDelay = *hedge
+
+	if *length < 0 {
+		*length = file.Size() - *offset
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %v", err)
+	}
+	defer f.Close()
+
+	return reader.ReadRange(context.Background(), file, *offset, *length, f)
+}
+
+// listFiles prints the metadata of the stored files a page at a time. The
+// bookmark of the next page is printed last unless -all is given.
+func listFiles(c *client, args []string) error {
+	flags := flag.NewFlagSet("ls", flag.ContinueOnError)
+	pageSize := flags.Int("n", 100, "the number of files per page")
+	bookmark := flags.String("bookmark", "", "the bookmark of the page to list")
+	owner := flags.String("owner", "", "only list the files stored by this MSP ID (needs CouchDB)")
+	tag := flags.String("tag", "", "only list the files carrying this tag (needs CouchDB)")
+	all := flags.Bool("all", false, "follow the bookmarks to list every file")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: ./dsctl ls [-n int] [-bookmark string] [-owner string | -tag string] [-all]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 || (*owner != "" && *tag != "") {
+		flags.Usage()
+		return fmt.Errorf("expected no arguments and at most one of -owner and -tag")
+	}
+
+	chain, err := c.chaincode()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "HASH\tSIZE\tCREATED\tOWNER\tTYPE\tTAGS")
+	for {
+		var page *storage.FilePage
+		switch {
+		case *owner != "":
+			page, err = chain.QueryFilesByOwner(*owner, *pageSize, *bookmark)
+		case *tag != "":
+			page, err = chain.QueryFilesByTag(*tag, *pageSize, *bookmark)
+		default:
+			page, err = chain.ListFiles(*pageSize, *bookmark)
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, file := range page.Records {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\n", file.FileHash, file.Size, file.CreatedAt, file.Owner, file.ContentType, strings.Join(file.Tags, ","))
+		}
+		*bookmark = page.Bookmark
+		if !*all || page.Bookmark == "" || len(page.Records) == 0 {
+			break
+		}
+	}
+	w.Flush()
+
+	if !*all && *bookmark != "" {
+		fmt.Printf("next page: ./dsctl ls -bookmark=%s\n", *bookmark)
+	}
+	return nil
+}
+
+// removeFile deletes the file tree from the ledger first, so the file is gone
+// for readers even if some storage nodes cannot be reached. Only the chunks no
+// other file holds are deleted.
+func removeFile(c *client, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: ./dsctl rm <hash>")
+	}
+	hashSlotTable, err := c.hashSlotTable()
+	if err != nil {
+		return err
+	}
+	chain, err := c.chaincode()
+	if err != nil {
+		return err
+	}
+
+	deleted, err := chain.DeleteFileTree(args[0])
+	if err != nil {
+		return err
+	}
+	return storage.DeleteChunks(context.Background(), deleted, hashSlotTable, c.cfg.nodeAddrs())
+}
+
+func statFile(c *client, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: ./dsctl stat <hash>")
+	}
+	file, err := c.fileTree(args[0])
+	if err != nil {
+		return err
+	}
+	hashSlotTable, err := c.hashSlotTable()
+	if err != nil {
+		return err
+	}
+
+	chunksPerNode := make(map[string]int)
+	chunks := 0
+	for _, stripe := range file.StripeHashes {
+		chunkHashes := make([]string, len(stripe.ChunkHashes))
+		for i, chunk := range stripe.ChunkHashes {
+			chunkHashes[i] = chunk.ChunkHash
+		}
+		_, actual := storage.PlaceStripe(chunkHashes, hashSlotTable)
+		for _, addr := range actual {
+			chunksPerNode[addr]++
+		}
+		chunks += len(chunkHashes)
+	}
+
+	chain, err := c.chaincode()
+	if err != nil {
+		return err
+	}
+	metadata, err := chain.GetFileMetadata(file.FileHash)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("File:    %s\n", file.FileHash)
+	fmt.Printf("Size:    %d\n", file.Size())
+	codecName := file.Codec
+	if codecName == "" {
+		codecName = utils.DefaultCodec.Name()
+	}
+	fmt.Printf("Codec:   %s\n", codecName)
+	fmt.Printf("Owner:   %s\n", metadata.Owner)
+	fmt.Printf("Created: %s\n", metadata.CreatedAt)
+	fmt.Printf("Type:    %s\n", metadata.ContentType)
+	fmt.Printf("Tags:    %s\n", strings.Join(metadata.Tags, ","))
+	fmt.Printf("Stripes: %d\n", len(file.StripeHashes))
+	fmt.Printf("Chunks:  %d\n", chunks)
+	addrs := make([]string, 0, len(chunksPerNode))
+	for addr := range chunksPerNode {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	for _, addr := range addrs {
+		fmt.Printf("  %s\t%d chunks\n", addr, chunksPerNode[addr])
+	}
+	return nil
+}
+
+func verifyFile(c *client, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: ./dsctl verify <hash>")
+	}
+	file, err := c.fileTree(args[0])
+	if err != nil {
+		return err
+	}
+	hashSlotTable, err := c.hashSlotTable()
+	if err != nil {
+		return err
+	}
+
+	repairer := storage.NewRepairer(hashSlotTable, c.cfg.nodeAddrs())
+	repairer.SlotTables, err = c.chaincode()
+	if err != nil {
+		return err
+	}
+	reports, err := repairer.Verify(context.Background(), file)
+	if err != nil {
+		return err
+	}
+
+	damaged, misplaced, lost := 0, 0, 0
+	for _, report := range reports {
+		if report.Healthy() {
+			continue
+		}
+		// Every shard is intact, some only where the table of the upload
+		// placed them
+		if report.Available() == len(report.Shards) {
+			misplaced++
+		} else {
+			damaged++
+		}
+		if !report.Recoverable() {
+			lost++
+		}
+		for i, state := range report.Shards {
+			if state != storage.ShardOK {
+				fmt.Printf("stripe %d shard %d on %s: %s\n", report.Index, i, report.Nodes[i], state)
+			}
+		}
+	}
+	fmt.Printf("%d stripes, %d damaged, %d unrecoverable\n", len(reports), damaged, lost)
+	if damaged > 0 {
+		return fmt.Errorf("file %s is damaged, run ./dsctl repair %s", file.FileHash, file.FileHash)
+	}
+	if misplaced > 0 {
+		fmt.Printf("%d stripes not moved since the hash slot table changed, run ./dsctl repair %s\n", misplaced, file.FileHash)
+	}
+	return nil
+}
+
+// repairFile rebuilds the damaged chunks of a file. With -node it rebuilds
+// the chunks a node should hold without checking the others, reading only
+// the repair sets of the codec, e.g. after the disk of the node was replaced.
+func repairFile(c *client, args []string) error {
+	flags := flag.NewFlagSet("repair", flag.ContinueOnError)
+	node := flags.String("node", "", "only rebuild the chunks stored on this node")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: ./dsctl repair [-node string] <hash>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected one file hash")
+	}
+	file, err := c.fileTree(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	hashSlotTable, err := c.hashSlotTable()
+	if err != nil {
+		return err
+	}
+
+	repairer := storage.NewRepairer(hashSlotTable, c.cfg.nodeAddrs())
+	repairer.SlotTables, err = c.chaincode()
+	if err != nil {
+		return err
+	}
+	var repaired int
+	if *node != "" {
+		repaired, err = repairer.RepairNode(context.Background(), file, *node)
+	} else {
+		repaired, err = repairer.Repair(context.Background(), file)
+	}
+	fmt.Printf("%d chunks repaired\n", repaired)
+	return err
+}
@@ -0,0 +1,185 @@
+// dsctl administers the decentralized storage system and moves files in and
+// out of it.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	fabricclient "github.com/hyperledger/fabric-gateway/pkg/client"
+	fabric "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/fabric"
+	ledger "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/ledger"
+	storage "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/storage"
+)
+
+const usage = `Usage: ./dsctl [-h] [-config string] <command> [arguments]
+
+Commands:
+  cluster init                 register the configured nodes and create the hash slot table
+  node add <addr> [weight]     add a storage node (default weight 100)
+  node remove <addr>           remove a storage node
+  node weight <addr> <weight>  change the weight of a storage node
+  put [flags] <file>           store a file and print its hash, see ./dsctl put -h
+  get [flags] <hash | name>    fetch a file by hash or ref, see ./dsctl get -h
+  ls [flags]                   list the stored files a page at a time, see ./dsctl ls -h
+  rm <hash>                    delete a file and its chunks
+  ref set <name> <hash>        point a ref to a file as its next version
+  ref rm <name>                delete a ref, keeping its history
+  ref ls [prefix]              list the refs whose names start with prefix
+  ref log <name>               show every version of a ref
+  retention [flags] <hash>     show or change the retention of a file, see ./dsctl retention -h
+  hold set <hash> <id> [why]   put a legal hold on a file
+  hold release <hash> <id>     release a legal hold of a file
+  sweep [flags]                remove the expired files and their chunks, see ./dsctl sweep -h
+  pay config [<cc> <price>]    show or set the token chaincode and tokens per GiB-day stored
+  pay account <addr> [acct]    set the token account a storage node is paid to, or remove it
+  pay audit [flags]            verify every chunk and report the shards each node holds, see ./dsctl pay audit -h
+  pay settle [flags]           pay the nodes and refund deleted files as the treasury, see ./dsctl pay settle -h
+  pay escrow <hash>            show the escrows of a file
+  stat <hash>                  show the stripes of a file and where its chunks live
+  verify <hash>                check that every chunk of a file is intact
+  repair [flags] <hash>        rebuild the missing or corrupted chunks of a file, see ./dsctl repair -h
+  soak [flags]                 read random files back under injected faults, see ./dsctl soak -h
+  usage [flags] [subject]      show the bytes stored per MSP or identity, see ./dsctl usage -h
+  quota <scope> <subject> <n>  limit the bytes an MSP or identity may store, 0 removes the limit
+
+Flags:
+`
+
+type command func(c *client, args []string) error
+
+var commands = map[string]command{
+	"cluster init": clusterInit,
+	"node add":     nodeAdd,
+	"node remove":  nodeRemove,
+	"node weight":  nodeWeight,
+	"put":          putFile,
+	"get":          getFile,
+	"ls":           listFiles,
+	"rm":           removeFile,
+	"ref set":      setRef,
+	"ref rm":       removeRef,
+	"ref ls":       listRefs,
+	"ref log":      refLog,
+	"retention":    retention,
+	"hold set":     setHold,
+	"hold release": releaseHold,
+	"sweep":        sweep,
+	"pay config":   payConfig,
+	"pay account":  payAccount,
+	"pay audit":    payAudit,
+	"pay settle":   paySettle,
+	"pay escrow":   payEscrow,
+	"stat":         statFile,
+	"verify":       verifyFile,
+	"repair":       repairFile,
+	"soak":         soak,
+	"usage":        showUsage,
+	"quota":        setQuota,
+}
+
+// client carries the configuration and the Fabric connection, which is only
+// opened by commands that need the ledger.
+type client struct {
+	cfg  *Config
+	conn *fabric.Connection
+}
+
+func (c *client) contract() (*fabricclient.Contract, error) {
+	if c.conn == nil {
+		conn, err := fabric.Connect(c.cfg.Config)
+		if err != nil {
+			return nil, err
+		}
+		c.conn = conn
+	}
+	return c.conn.Contract, nil
+}
+
+func (c *client) close() {
+	if c.conn != nil {
+		c.conn.Close()
+	}
+}
+
+// chaincode returns the typed client of the chaincode.
+func (c *client) chaincode() (*ledger.Fabric, error) {
+	contract, err := c.contract()
+	if err != nil {
+		return nil, err
+	}
+	return ledger.NewFabric(contract), nil
+}
+
+func (c *client) fileTree(fileHash string) (*storage.File, error) {
+	chain, err := c.chaincode()
+	if err != nil {
+		return nil, err
+	}
+	tree, err := chain.GetFileTree(fileHash)
+	if err != nil {
+		return nil, err
+	}
+	return (*storage.File)(tree), nil
+}
+
+func (c *client) hashSlotTable() (storage.HashSlotTable, error) {
+	chain, err := c.chaincode()
+	if err != nil {
+		return storage.HashSlotTable{}, err
+	}
+	hashSlotTable, err := chain.GetHashSlotTable()
+	if err != nil {
+		return storage.HashSlotTable{}, fmt.Errorf("failed to get hash slot table: %v", err)
+	}
+	return *hashSlotTable, nil
+}
+
+func main() {
+	configPath := flag.String("config", "dsctl.json", "the configuration file")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	name, args, ok := lookup(flag.Args())
+	if !ok {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	explicit := false
+	flag.Visit(func(f *flag.Flag) {
+		explicit = explicit || f.Name == "config"
+	})
+	cfg, err := loadConfig(*configPath, explicit)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	c := &client{cfg: cfg}
+	err = commands[name](c, args)
+	c.close()
+	if err != nil {
+		log.Fatalf("%s: %v", name, err)
+	}
+}
+
+// lookup finds the command named by the first one or two arguments.
+func lookup(args []string) (string, []string, bool) {
+	if len(args) >= 2 {
+		name := args[0] + " " + args[1]
+		if _, ok := commands[name]; ok {
+			return name, args[2:], true
+		}
+	}
+	if len(args) >= 1 {
+		if _, ok := commands[args[0]]; ok {
+			return args[0], args[1:], true
+		}
+	}
+	return "", nil, false
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	storage "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/storage"
+)
+
+// payConfig shows the payment configuration, or sets it with the client as
+// the treasury. The chaincode name "none" stops payments.
+func payConfig(c *client, args []string) error {
+	if len(args) != 0 && len(args) != 2 {
+		return fmt.Errorf("usage: ./dsctl pay config [<token chaincode | none> <price>]")
+	}
+	chain, err := c.chaincode()
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		config, err := chain.GetPaymentConfig()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Token chaincode: %s\n", config.TokenChaincode)
+		fmt.Printf("Treasury:        %s\n", config.Treasury)
+		fmt.Printf("Price:           %d tokens per GiB-day\n", config.PricePerGiBDay)
+		return nil
+	}
+
+	chaincode := args[0]
+	if chaincode == "none" {
+		chaincode = ""
+	}
+	price, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid price %q", args[1])
+	}
+	_, err = chain.ConfigurePayments(chaincode, price)
+	return err
+}
+
+func payAccount(c *client, args []string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return fmt.Errorf("usage: ./dsctl pay account <addr> [account]")
+	}
+	account := ""
+	if len(args) == 2 {
+		account = args[1]
+	}
+	chain, err := c.chaincode()
+	if err != nil {
+		return err
+	}
+	_, err = chain.SetPayoutAccount(args[0], account)
+	return err
+}
+
+// payAudit verifies every chunk of every file and reports the intact shards
+// of each node, which settlements share the earned tokens by.
+func payAudit(c *client, args []string) error {
+	flags := flag.NewFlagSet("pay audit", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "print the counts without reporting them")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: ./dsctl pay audit [-dry-run]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	chain, err := c.chaincode()
+	if err != nil {
+		return err
+	}
+	hashSlotTable, err := c.hashSlotTable()
+	if err != nil {
+		return err
+	}
+
+	shards, err := storage.CountShards(context.Background(), chain, hashSlotTable, c.cfg.nodeAddrs())
+	if err != nil {
+		return fmt.Errorf("audit incomplete, nothing reported: %v", err)
+	}
+	nodes := make([]string, 0, len(shards))
+	for node := range shards {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tSHARDS")
+	for _, node := range nodes {
+		fmt.Fprintf(w, "%s\t%d\n", node, shards[node])
+	}
+	if err := w.Flush(); err != nil || *dryRun {
+		return err
+	}
+
+	_, err = chain.ReportShards(shards)
+	return err
+}
+
+// paySettle pays the storage orgs and refunds deleted files, as the
+// treasury.
+func paySettle(c *client, args []string) error {
+	flags := flag.NewFlagSet("pay settle", flag.ContinueOnError)
+	limit := flags.Int("n", 100, "the most escrows settled per transaction, at most 1000")
+	all := flags.Bool("all", false, "settle again until every escrow is settled")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: ./dsctl pay settle [-n int] [-all]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	chain, err := c.chaincode()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SETTLED\tESCROWS\tTO\tTOKENS")
+	for {
+		settlement, err := chain.SettlePayments(*limit)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "%s\t%d\t-\t%d earned\n", settlement.SettledAt, settlement.Escrows, settlement.Earned)
+		for _, payouts := range []map[string]int64{settlement.Payouts, settlement.Refunds} {
+			accounts := make([]string, 0, len(payouts))
+			for account := range payouts {
+				accounts = append(accounts, account)
+			}
+			sort.Strings(accounts)
+			for _, account := range accounts {
+				fmt.Fprintf(w, "\t\t%s\t%d\n", account, payouts[account])
+			}
+		}
+		if !*all || !settlement.More {
+			break
+		}
+	}
+	return w.Flush()
+}
+
+func payEscrow(c *client, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: ./dsctl pay escrow <hash>")
+	}
+	chain, err := c.chaincode()
+	if err != nil {
+		return err
+	}
+	escrows, err := chain.GetEscrows(args[0])
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PAID UNTIL\tAMOUNT\tSETTLED\tREFUNDED\tSETTLED UNTIL\tCLOSED\tPAYER")
+	for _, escrow := range escrows {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\t%s\t%s\n", escrow.PaidUntil, escrow.Amount, escrow.Settled, escrow.Refunded,
+			escrow.SettledUntil, orNone(escrow.ClosedAt), escrow.Payer)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	storage "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/storage"
+)
+
+// isFileHash tells whether an argument is a file hash rather than a ref name.
+func isFileHash(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil && len(s) == 64 && strings.ToLower(s) == s
+}
+
+// resolveRef returns the file hash a ref pointed to at the version or the
+// RFC 3339 timestamp given, or now when given neither.
+func resolveRef(c *client, name string, version int, at string) (*storage.Ref, error) {
+	chain, err := c.chaincode()
+	if err != nil {
+		return nil, err
+	}
+	return chain.ResolveRef(name, version, at)
+}
+
+// setRef points a name to a file as a new version of the name.
+func setRef(c *client, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: ./dsctl ref set <name> <hash>")
+	}
+	return pointRef(c, args[0], args[1])
+}
+
+func pointRef(c *client, name string, fileHash string) error {
+	chain, err := c.chaincode()
+	if err != nil {
+		return err
+	}
+	ref, err := chain.SetRef(name, fileHash)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s version %d -> %s\n", ref.Name, ref.Version, ref.FileHash)
+	return nil
+}
+
+func removeRef(c *client, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: ./dsctl ref rm <name>")
+	}
+	chain, err := c.chaincode()
+	if err != nil {
+		return err
+	}
+	_, err = chain.DeleteRef(args[0])
+	return err
+}
+
+func listRefs(c *client, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: ./dsctl ref ls [prefix]")
+	}
+	prefix := ""
+	if len(args) == 1 {
+		prefix = args[0]
+	}
+	chain, err := c.chaincode()
+	if err != nil {
+		return err
+	}
+	refs, err := chain.ListRefs(prefix)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tVERSION\tHASH\tUPDATED\tOWNER")
+	for _, ref := range refs {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", ref.Name, ref.Version, ref.FileHash, ref.UpdatedAt, ref.Owner)
+	}
+	return w.Flush()
+}
+
+// refLog prints every change of a ref, newest first.
+func refLog(c *client, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: ./dsctl ref log <name>")
+	}
+	chain, err := c.chaincode()
+	if err != nil {
+		return err
+	}
+	records, err := chain.GetRefHistory(args[0])
+	if err != nil {
+		return err
+	}
+
+	// Timestamps in nanoseconds do not sort as strings
+	times := make([]time.Time, len(records))
+	for i, record := range records {
+		t, err := time.Parse(time.RFC3339Nano, record.Timestamp)
+		if err != nil {
+			return fmt.Errorf("invalid history timestamp %q: %v", record.Timestamp, err)
+		}
+		times[i] = t
+	}
+	sort.Sort(byTime{records, times})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tVERSION\tHASH\tTX")
+	for _, record := range records {
+		if record.IsDelete || record.Record == nil {
+			fmt.Fprintf(w, "%s\tdeleted\t-\t%s\n", record.Timestamp, record.TxId)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", record.Timestamp, record.Record.Version, record.Record.FileHash, record.TxId)
+	}
+	return w.Flush()
+}
+
+// byTime sorts ref history records newest first.
+type byTime struct {
+	records []*storage.RefHistoryRecord
+	times   []time.Time
+}
+
+func (b byTime) Len() int           { return len(b.records) }
+func (b byTime) Less(i, j int) bool { return b.times[i].After(b.times[j]) }
+func (b byTime) Swap(i, j int) {
+	b.records[i], b.records[j] = b.records[j], b.records[i]
+	b.times[i], b.times[j] = b.times[j], b.times[i]
+}
+
+// waitForFile waits until the file tree of a file put by file_partition_service
+// is committed.
+func waitForFile(c *client, fileHash string, timeout time.Duration) error {
+	chain, err := c.chaincode()
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		_, err := chain.GetFileMetadata(fileHash)
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("file %s was not stored after %s: %v", fileHash, timeout, err)
+		}
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	storage "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/storage"
+)
+
+// retention shows the retention and legal holds of a file, or changes its
+// retention when given -retain-until or -expire-at.
+func retention(c *client, args []string) error {
+	flags := flag.NewFlagSet("retention", flag.ContinueOnError)
+	retainUntil := flags.String("retain-until", "", "extend the retention of the file to this RFC 3339 time")
+	expireAt := flags.String("expire-at", "", "let the sweeper remove the file after this RFC 3339 time, \"none\" keeps it until deleted")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: ./dsctl retention [-retain-until time] [-expire-at time | none] <hash>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected one file hash")
+	}
+	fileHash := flags.Arg(0)
+
+	current, err := getRetention(c, fileHash)
+	if err != nil {
+		return err
+	}
+	if *retainUntil != "" || *expireAt != "" {
+		// SetRetention clears an empty expiry, so an unchanged one is passed on
+		expiry := current.ExpireAt
+		switch *expireAt {
+		case "":
+		case "none":
+			expiry = ""
+		default:
+			expiry = *expireAt
+		}
+		chain, err := c.chaincode()
+		if err != nil {
+			return err
+		}
+		if _, err := chain.SetRetention(fileHash, *retainUntil, expiry); err != nil {
+			return err
+		}
+		if current, err = getRetention(c, fileHash); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Retain until: %s\n", orNone(current.RetainUntil))
+	fmt.Printf("Expire at:    %s\n", orNone(current.ExpireAt))
+	if len(current.Holds) == 0 {
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "HOLD\tACTIVE\tSET\tSET BY\tRELEASED\tRELEASED BY\tREASON")
+	for _, hold := range current.Holds {
+		fmt.Fprintf(w, "%s\t%t\t%s\t%s\t%s\t%s\t%s\n", hold.HoldID, hold.Active, hold.SetAt, hold.SetBy,
+			orNone(hold.ReleasedAt), orNone(hold.ReleasedBy), hold.Reason)
+	}
+	return w.Flush()
+}
+
+func getRetention(c *client, fileHash string) (*storage.Retention, error) {
+	chain, err := c.chaincode()
+	if err != nil {
+		return nil, err
+	}
+	return chain.GetRetention(fileHash)
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func setHold(c *client, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: ./dsctl hold set <hash> <id> [reason]")
+	}
+	chain, err := c.chaincode()
+	if err != nil {
+		return err
+	}
+	_, err = chain.SetLegalHold(args[0], args[1], strings.Join(args[2:], " "))
+	return err
+}
+
+func releaseHold(c *client, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: ./dsctl hold release <hash> <id>")
+	}
+	chain, err := c.chaincode()
+	if err != nil {
+		return err
+	}
+	_, err = chain.ReleaseLegalHold(args[0], args[1])
+	return err
+}
+
+// sweep removes the files whose expiry has passed, as file_partition_service
+// does with -sweep.
+func sweep(c *client, args []string) error {
+	flags := flag.NewFlagSet("sweep", flag.ContinueOnError)
+	limit := flags.Int("n", 100, "the most files removed, at most 1000")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: ./dsctl sweep [-n int]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	chain, err := c.chaincode()
+	if err != nil {
+		return err
+	}
+	hashSlotTable, err := c.hashSlotTable()
+	if err != nil {
+		return err
+	}
+
+	swept, err := storage.SweepExpired(context.Background(), chain, hashSlotTable, c.cfg.nodeAddrs(), *limit)
+	for _, fileHash := range swept {
+		fmt.Println(fileHash)
+	}
+	return err
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	chaos "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/chaos"
+	pb "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/protos"
+	storage "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/storage"
+	utils "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/utils"
+	"google.golang.org/grpc"
+)
+
+// soak uploads random files, then injects faults into random storage nodes
+// round after round and checks that every file still reads back to its hash
+// as ./dsctl get reads it. The nodes must run with -chaos. The chunks lost in
+// a round are repaired once its faults are cleared, unless -repair=false, so
+// the damage does not pile up beyond what the codec tolerates.
+func soak(c *client, args []string) error {
+	flags := flag.NewFlagSet("soak", flag.ContinueOnError)
+	files := flags.Int("files", 10, "the number of random files uploaded")
+	size := flags.Int("size", 4*1024*1024, "the largest file in bytes, the sizes are random up to it")
+	codec := flags.String("codec", "", "the codec of the stripes, one of "+strings.Join(utils.CodecNames(), ", ")+" (default chosen by file_partition_service)")
+	duration := flags.Duration("duration", 10*time.Minute, "how long to keep injecting faults and reading the files")
+	interval := flags.Duration("interval", 10*time.Second, "the pause between rounds")
+	faulty := flags.Int("faulty", 1, "the number of nodes faulted in each round")
+	latency := flags.Duration("latency", 50*time.Millisecond, "the latency added to the requests of a faulty node")
+	drop := flags.Float64("drop", 0.05, "the fraction of the requests a faulty node drops")
+	corrupt := flags.Float64("corrupt", 0.05, "the fraction of the chunks a faulty node returns with a bit flipped")
+	lose := flags.Float64("lose", 0.1, "the fraction of its stored chunks a faulty node loses in each round")
+	repair := flags.Bool("repair", true, "repair the files after each round")
+	keep := flags.Bool("keep", false, "keep the uploaded files instead of deleting them at the end")
+	seed := flags.Int64("seed", time.Now().UnixNano(), "the seed of the file contents and the choice of the faulty nodes")
+	wait := flags.Duration("wait", time.Minute, "how long to wait for each file to be stored")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: ./dsctl soak [-files int] [-size int] [-codec string] [-duration duration] [-interval duration] [-faulty int] [-latency duration] [-drop float] [-corrupt float] [-lose float] [-repair bool] [-keep] [-seed int] [-wait duration]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	nodes := c.cfg.nodeAddrs()
+	if *faulty < 0 || *faulty > len(nodes) {
+		return fmt.Errorf("-faulty must be between 0 and the %d nodes", len(nodes))
+	}
+	if *files <= 0 || *size <= 0 {
+		return fmt.Errorf("-files and -size must be positive")
+	}
+	faults := &pb.FaultConfig{LatencyMs: latency.Milliseconds(), DropRate: *drop, CorruptRate: *corrupt}
+	if err := chaos.Validate(faults); err != nil {
+		return err
+	}
+	if *lose < 0 || *lose > 1 {
+		return fmt.Errorf("-lose must be between 0 and 1")
+	}
+	rng := rand.New(rand.NewSource(*seed))
+	ctx := context.Background()
+
+	admins := make(map[string]pb.ChunkStorageClient)
+	for _, addr := range nodes {
+		conn, err := grpc.Dial(addr, grpc.WithInsecure())
+		if err != nil {
+			return fmt.Errorf("failed to connect to %s: %v", addr, err)
+		}
+		defer conn.Close()
+		admins[addr] = pb.NewChunkStorageClient(conn)
+	}
+	// Fail before uploading if a node does not run in chaos mode, and leave
+	// no faults behind however the test ends
+	if err := clearFaults(ctx, admins); err != nil {
+		return err
+	}
+	defer clearFaults(ctx, admins)
+
+	fmt.Printf("seed %d\n", *seed)
+	fileHashes, err := uploadRandomFiles(c, rng, *files, *size, *codec, *wait)
+	if !*keep {
+		defer func() {
+			for _, fileHash := range fileHashes {
+				if err := removeFile(c, []string{fileHash}); err != nil {
+					fmt.Printf("failed to delete %s: %v\n", fileHash, err)
+				}
+			}
+		}()
+	}
+	if err != nil {
+		return err
+	}
+
+	trees := make([]*storage.File, len(fileHashes))
+	for i, fileHash := range fileHashes {
+		if trees[i], err = c.fileTree(fileHash); err != nil {
+			return err
+		}
+	}
+	hashSlotTable, err := c.hashSlotTable()
+	if err != nil {
+		return err
+	}
+	chain, err := c.chaincode()
+	if err != nil {
+		return err
+	}
+	reader := storage.NewReader(hashSlotTable, nodes)
+	reader.SlotTables = chain
+	repairer := storage.NewRepairer(hashSlotTable, nodes)
+	repairer.SlotTables = chain
+
+	deadline := time.Now().Add(*duration)
+	reads, failures := 0, 0
+	for round := 1; ; round++ {
+		faultyNodes := make([]string, *faulty)
+		for i, index := range rng.Perm(len(nodes))[:*faulty] {
+			faultyNodes[i] = nodes[index]
+		}
+		lost := int64(0)
+		for _, addr := range faultyNodes {
+			if _, err := admins[addr].SetFaults(ctx, faults); err != nil {
+				return fmt.Errorf("failed to inject faults into %s: %v", addr, err)
+			}
+			if *lose > 0 {
+				res, err := admins[addr].LoseChunks(ctx, &pb.LoseChunksRequest{Fraction: *lose})
+				if err != nil {
+					return fmt.Errorf("failed to lose chunks of %s: %v", addr, err)
+				}
+				lost += res.GetLost()
+			}
+		}
+
+		failed := 0
+		for _, file := range trees {
+			if err := readBack(ctx, reader, file); err != nil {
+				failed++
+				fmt.Printf("round %d: %s: %v\n", round, file.FileHash, err)
+			}
+		}
+		reads += len(trees)
+		failures += failed
+
+		if err := clearFaults(ctx, admins); err != nil {
+			return err
+		}
+		repaired := 0
+		if *repair {
+			for _, file := range trees {
+				n, err := repairer.Repair(ctx, file)
+				repaired += n
+				if err != nil {
+					fmt.Printf("round %d: failed to repair %s: %v\n", round, file.FileHash, err)
+				}
+			}
+		}
+		fmt.Printf("round %d: faulty %s, %d chunks lost, %d of %d files intact, %d chunks repaired\n", round, strings.Join(faultyNodes, ","), lost, len(trees)-failed, len(trees), repaired)
+
+		if time.Now().Add(*interval).After(deadline) {
+			break
+		}
+		time.Sleep(*interval)
+	}
+
+	fmt.Printf("%d reads, %d failed\n", reads, failures)
+	if failures > 0 {
+		return fmt.Errorf("%d of %d reads did not reproduce the file", failures, reads)
+	}
+	return nil
+}
+
+// uploadRandomFiles stores files of random content and sizes up to size and
+// waits for their trees. It returns the hashes of the files stored so far
+// even when it fails.
+func uploadRandomFiles(c *client, rng *rand.Rand, files int, size int, codec string, wait time.Duration) ([]string, error) {
+	conn, err := grpc.Dial(c.cfg.FilePartition, grpc.WithInsecure(), grpc.WithDefaultCallOptions(grpc.MaxCallSendMsgSize(1024*1024*1024)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+	partition := pb.NewFilePartitionClient(conn)
+
+	var fileHashes []string
+	for i := 0; i < files; i++ {
+		data := make([]byte, 1+rng.Intn(size))
+		rng.Read(data)
+		response, err := partition.PartitionFile(context.Background(), &pb.FilePartitionRequest{Data: data, Codec: codec})
+		if err != nil {
+			return fileHashes, fmt.Errorf("failed to store file: %v", err)
+		}
+		if want := utils.GetHash(data); response.Status != want {
+			return fileHashes, fmt.Errorf("file stored as %s, want %s", response.Status, want)
+		}
+		fileHashes = append(fileHashes, response.Status)
+		if err := waitForFile(c, response.Status, wait); err != nil {
+			return fileHashes, err
+		}
+		fmt.Printf("uploaded %s, %d bytes\n", response.Status, len(data))
+	}
+	return fileHashes, nil
+}
+
+// readBack reads a whole file and checks that it hashes to its file hash.
+func readBack(ctx context.Context, reader *storage.Reader, file *storage.File) error {
+	hash := sha256.New()
+	if err := reader.ReadFile(ctx, file, hash); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(hash.Sum(nil)); got != file.FileHash {
+		return fmt.Errorf("read back a file hashing to %s", got)
+	}
+	return nil
+}
+
+// clearFaults stops the fault injection of every node.
+func clearFaults(ctx context.Context, admins map[string]pb.ChunkStorageClient) error {
+	for addr, admin := range admins {
+		if _, err := admin.SetFaults(ctx, &pb.FaultConfig{}); err != nil {
+			return fmt.Errorf("failed to clear the faults of %s: %v", addr, err)
+		}
+	}
+	return nil
+}
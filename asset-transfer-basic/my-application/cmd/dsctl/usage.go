@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// The chaincode accounts usage to the client identity ID, the base64 encoding
+// of "x509::<subject DN>::<issuer DN>". dsctl shows and accepts the decoded
+// form.
+const identityPrefix = "x509::"
+
+func encodeSubject(scope string, subject string) string {
+	if scope == "identity" && strings.HasPrefix(subject, identityPrefix) {
+		return base64.StdEncoding.EncodeToString([]byte(subject))
+	}
+	return subject
+}
+
+func decodeSubject(scope string, subject string) string {
+	if scope != "identity" {
+		return subject
+	}
+	decoded, err := base64.StdEncoding.DecodeString(subject)
+	if err != nil || !strings.HasPrefix(string(decoded), identityPrefix) {
+		return subject
+	}
+	return string(decoded)
+}
+
+// showUsage prints the bytes and files stored per MSP or client identity
+// next to their quotas, e.g. for a billing report.
+func showUsage(c *client, args []string) error {
+	flags := flag.NewFlagSet("usage", flag.ContinueOnError)
+	scope := flags.String("scope", "msp", "account per msp or per identity")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: ./dsctl usage [-scope msp|identity] [subject]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return fmt.Errorf("expected at most one subject")
+	}
+
+	chain, err := c.chaincode()
+	if err != nil {
+		return err
+	}
+	usages, err := chain.GetUsage(*scope, encodeSubject(*scope, flags.Arg(0)))
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SUBJECT\tFILES\tBYTES\tQUOTA")
+	for _, usage := range usages {
+		quota := "-"
+		if usage.Quota > 0 {
+			quota = strconv.FormatInt(usage.Quota, 10)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", decodeSubject(*scope, usage.Subject), usage.Files, usage.Bytes, quota)
+	}
+	return w.Flush()
+}
+
+// setQuota limits the bytes an MSP or client identity may store, 0 removes
+// the limit. The client needs the storage.admin attribute.
+func setQuota(c *client, args []string) error {
+	if len(args) != 3 {
+		return fmt.Errorf("usage: ./dsctl quota <msp|identity> <subject> <bytes>")
+	}
+	bytes, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid quota %q", args[2])
+	}
+	chain, err := c.chaincode()
+	if err != nil {
+		return err
+	}
+	_, err = chain.SetQuota(args[0], encodeSubject(args[0], args[1]), bytes)
+	return err
+}
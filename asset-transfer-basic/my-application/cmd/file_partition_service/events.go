@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	fabric "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/fabric"
+	storage "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/storage"
+)
+
+// slotTableCache keeps the hash slot table between chaincode events that
+// change it. It is only enabled while chaincode events are listened to;
+// otherwise every lookup queries the ledger.
+type slotTableCache struct {
+	mu      sync.Mutex
+	enabled bool
+	table   *storage.HashSlotTable
+}
+
+func (c *slotTableCache) get() (storage.HashSlotTable, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.table != nil {
+		return *c.table, nil
+	}
+
+	hashSlotTable, err := chain.GetHashSlotTable()
+	if err != nil {
+		return storage.HashSlotTable{}, fmt.Errorf("failed to get hash slot table: %v", err)
+	}
+	if c.enabled {
+		c.table = hashSlotTable
+	}
+	return *hashSlotTable, nil
+}
+
+// set replaces the cached table, a nil table is fetched again on next use.
+func (c *slotTableCache) set(table *storage.HashSlotTable) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.enabled {
+		c.table = table
+	}
+}
+
+var (
+	slotTables slotTableCache
+	// storedFiles holds the hashes of the files stored by this service, which
+	// need no check when their StoreFileTree event arrives.
+	storedFiles sync.Map
+	repairQueue = make(chan string, 1024)
+)
+
+// listenEvents keeps the slot table cache current and queues the files
+// stored by other services for a check of their chunks.
+func listenEvents(ctx context.Context, conn *fabric.Connection, checkpointPath string) {
+	slotTables.mu.Lock()
+	slotTables.enabled = true
+	slotTables.mu.Unlock()
+
+	go repairFiles(ctx)
+	err := conn.ListenEvents(ctx, checkpointPath, handleEvent)
+	slog.Info("stopped listening for chaincode events", "err", err)
+}
+
+func handleEvent(event *client.ChaincodeEvent) {
+	logger := slog.With("event", event.EventName, "tx", event.TransactionID, "block", event.BlockNumber)
+	switch event.EventName {
+	case fabric.CreateHashSlotTableEvent:
+		var hashSlotTable storage.HashSlotTable
+		if err := json.Unmarshal(event.Payload, &hashSlotTable); err != nil {
+			logger.Warn("failed to unmarshal hash slot table", "err", err)
+			slotTables.set(nil)
+			return
+		}
+		slotTables.set(&hashSlotTable)
+		logger.Info("hash slot table updated", "orgs", len(hashSlotTable.HST))
+
+	case fabric.UpdateOrgWeightEvent, fabric.RemoveOrgEvent:
+		// The table is stale until it is created again, fetch it on next use
+		var org fabric.OrgEvent
+		_ = json.Unmarshal(event.Payload, &org)
+		slotTables.set(nil)
+		logger.Info("org weights changed", "org", org.OrgID, "weight", org.Weight)
+
+	case fabric.StoreFileTreeEvent:
+		var file fabric.FileEvent
+		if err := json.Unmarshal(event.Payload, &file); err != nil {
+			logger.Warn("failed to unmarshal file event", "err", err)
+			return
+		}
+		if _, ok := storedFiles.LoadAndDelete(file.FileHash); ok {
+			return
+		}
+		select {
+		case repairQueue <- file.FileHash:
+			logger.Info("file queued for repair check", "file", file.FileHash)
+		default:
+			logger.Warn("repair queue full, file not checked", "file", file.FileHash)
+		}
+
+	case fabric.DeleteFileTreeEvent:
+		var file fabric.FileEvent
+		_ = json.Unmarshal(event.Payload, &file)
+		logger.Info("file deleted", "file", file.FileHash)
+	}
+}
+
+// repairFiles checks the files of the repair queue one at a time and
+// rebuilds their missing or corrupted chunks.
+func repairFiles(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case fileHash := <-repairQueue:
+			logger := slog.With("file", fileHash)
+			fileObj, err := getFileTree(fileHash)
+			if err != nil {
+				logger.Warn("repair check skipped", "err", err)
+				continue
+			}
+			hashSlotTable, err := slotTables.get()
+			if err != nil {
+				logger.Warn("repair check skipped", "err", err)
+				continue
+			}
+			repairer := storage.NewRepairer(hashSlotTable, storageNodes)
+			repairer.SlotTables = chain
+			repairer.DialOptions = dialOptions
+			repaired, err := repairer.Repair(ctx, fileObj)
+			if err != nil {
+				logger.Error("failed to repair file", "repaired", repaired, "err", err)
+			} else if repaired > 0 {
+				logger.Info("file repaired", "repaired", repaired)
+			}
+		}
+	}
+}
@@ -0,0 +1,310 @@
+// the data of the file->this service->1. divide the file into chunks (communicate with chunk_storage_service) 2. record the hash of those chunks (on chaincode)
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"encoding/json"
+	"os"
+	"flag"
+	"io/ioutil"
+	"errors"
+	"runtime"
+	"strings"
+	"time"
+	"log/slog"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/schema"
+	fabric "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/fabric"
+	ledger "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/ledger"
+	utils "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/utils"
+	metrics "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/metrics"
+	pb "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/protos"
+	storage "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/storage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	port = flag.String("port", ":50051", "listening port")
+	workers = flag.Int("workers", runtime.NumCPU(), "number of stripe encoding workers")
+	inFlight = flag.Int("inflight", 4, "maximum concurrent chunk writes per storage node")
+	cacheSize = flag.Int64("cache", 256, "size of the local chunk cache in MiB")
+	metricsAddr = flag.String("metrics", ":9100", "address serving Prometheus metrics on /metrics, disabled if empty")
+	events = flag.Bool("events", true, "listen for chaincode events to cache the hash slot table and check files stored by other services")
+	checkpoint = flag.String("checkpoint", "", "file recording the last handled chaincode event, so a restart resumes from it")
+	codecFlag = flag.String("codec", utils.DefaultCodec.Name(), "codec of the stripes of files whose request names none, one of "+strings.Join(utils.CodecNames(), ", "))
+	replicateBelow = flag.Int64("replicate-below", 4096, "store files smaller than this many bytes whose request names no codec as "+utils.DefaultReplication.Name()+" copies, 0 disables")
+	sweepInterval = flag.Duration("sweep", 0, "interval between sweeps removing expired files and their chunks, 0 disables")
+	fabricConfig = fabric.DefaultConfig()
+	chain ledger.Client
+	// storageNodes are the ChunkStorage servers, reached with dialOptions
+	storageNodes = utils.MasterNodes[:]
+	dialOptions []grpc.DialOption
+	// maxFileTreeTransaction is the largest file tree submitted in a single
+	// StoreFileTree transaction
+	maxFileTreeTransaction = 1024 * 1024
+	chunkCache *storage.ChunkCache
+)
+
+type server struct{
+	pb.UnimplementedFilePartitionServer
+}
+
+func getFileTree(fileHash string) (*storage.File, error) {
+	tree, err := chain.GetFileTree(fileHash)
+	if err != nil {
+		return nil, err
+	}
+	return (*storage.File)(tree), nil
+}
+
+func storeFile(fileHash string, fileContent []byte, codec utils.Codec, metadata storage.FileMetadataInput) {
+	logger := slog.With("file", fileHash)
+	hashSlotTable, err := slotTables.get()
+	if err != nil {
+		logger.Error("failed to get hash slot table", "err", err)
+		return
+	}
+
+	uploader := storage.NewUploader(hashSlotTable, storageNodes)
+	uploader.DialOptions = dialOptions
+	uploader.Workers = *workers
+	uploader.InFlight = *inFlight
+	uploader.Codec = codec
+	// Keep the freshly written chunks around for reads of the same file
+	uploader.OnChunk = chunkCache.Put
+
+	fileObj, err := uploader.Upload(context.Background(), fileContent)
+	if err != nil {
+		logger.Error("failed to store file", "err", err)
+		return
+	}
+	logger.Info("stored chunks", "stripes", len(fileObj.StripeHashes), "bytes", fileObj.FileSize)
+
+	// Marshal fileObj to json and print it to a file
+	jsonFile, err := json.MarshalIndent(fileObj, "", "  ")
+	if err != nil {
+		logger.Error("failed to marshal file tree", "err", err)
+		return
+	}
+	fileName := fileObj.FileHash + ".json"
+	err = ioutil.WriteFile(fileName, jsonFile, 0644)
+	if err != nil {
+		logger.Error("failed to write file tree", "path", fileName, "err", err)
+		return
+	}
+
+	// The chunks were just written, the event of this file needs no check
+	storedFiles.Store(fileObj.FileHash, struct{}{})
+	block, err := submitFileTree(logger, fileObj, &metadata)
+	if err != nil {
+		storedFiles.Delete(fileObj.FileHash)
+		logger.Error("file tree not committed", "err", err)
+		return
+	}
+
+	logger.Info("file partition end", "block", block)
+}
+
+// submitFileTree records the tree of a stored file on the ledger and returns
+// the block it was committed in, 0 if the file was stored already.
+func submitFileTree(logger *slog.Logger, fileObj *storage.File, metadata *storage.FileMetadataInput) (uint64, error) {
+	logger.Info("submitting file tree", "stripes", len(fileObj.StripeHashes))
+	return ledger.SaveFileTree(chain, (*schema.FileTree)(fileObj), metadata, maxFileTreeTransaction)
+}
+
+func (s *server) PartitionFile(ctx context.Context, request *pb.FilePartitionRequest) (*pb.FilePartitionResponse, error) {
+	// Accept file from remote nodes
+	fileContent := make([]byte, len(request.Data))
+	copy(fileContent, request.Data)
+	fileHash := utils.GetHash(fileContent)
+	metrics.BytesStored.Add(float64(len(fileContent)))
+
+	codecName := request.Codec
+	if codecName == "" {
+		codecName = *codecFlag
+		// Erasure coding would pad tiny files to a whole stripe
+		if int64(len(fileContent)) < *replicateBelow {
+			codecName = utils.DefaultReplication.Name()
+		}
+	}
+	codec, err := utils.GetCodec(codecName)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := storage.FileMetadataInput{
+		Tags:        request.Tags,
+		ContentType: request.ContentType,
+		RetainUntil: request.RetainUntil,
+		ExpireAt:    request.ExpireAt,
+	}
+	if metadata.ContentType == "" {
+		metadata.ContentType = http.DetectContentType(fileContent)
+	}
+	slog.Info("file partition start", "file", fileHash, "bytes", len(fileContent), "contentType", metadata.ContentType, "tags", metadata.Tags, "codec", codec.Name())
+
+	// Encoding and distribution run in the background, the file tree is
+	// submitted once every chunk has been stored.
+	go storeFile(fileHash, fileContent, codec, metadata)
+
+	return &pb.FilePartitionResponse{Status: fileHash}, nil
+}
+
+func (s *server) ReadFile(ctx context.Context, request *pb.FileRequest) (*pb.FileResponse, error) {
+	logger := slog.With("file", request.Hash)
+	fileObj, err := getFileTree(request.Hash)
+	if err != nil {
+		return nil, err
+	}
+	hashSlotTable, err := slotTables.get()
+	if err != nil {
+		return nil, err
+	}
+
+	// A zero length reads up to the end of the file
+	length := request.Length
+	if length == 0 {
+		length = fileObj.Size() - request.Offset
+	}
+
+	reader := storage.NewReader(hashSlotTable, storageNodes)
+	reader.SlotTables = chain
+	reader.DialOptions = dialOptions
+	reader.Cache = chunkCache
+	var buf bytes.Buffer
+	err = reader.ReadRange(ctx, fileObj, request.Offset, length, &buf)
+	if err != nil {
+		logger.Error("failed to read file", "err", err)
+		return nil, err
+	}
+	metrics.BytesServed.Add(float64(buf.Len()))
+
+	stats := chunkCache.Stats()
+	logger.Info("file read end", "offset", request.Offset, "bytes", buf.Len(),
+		"cacheHits", stats.Hits, "cacheMisses", stats.Misses, "cacheEvictions", stats.Evictions,
+		"cacheChunks", stats.Entries, "cacheBytes", stats.Bytes)
+	return &pb.FileResponse{Data: buf.Bytes()}, nil
+}
+
+// DeleteFile removes the tree of a file from the ledger, then the chunks no
+// other file holds from the storage nodes.
+func (s *server) DeleteFile(ctx context.Context, request *pb.FileDeletionRequest) (*pb.FileDeletionResponse, error) {
+	logger := slog.With("file", request.Hash)
+	fileObj, err := getFileTree(request.Hash)
+	if errors.Is(err, ledger.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	hashSlotTable, err := slotTables.get()
+	if err != nil {
+		return nil, err
+	}
+
+	deleted, err := chain.DeleteFileTree(fileObj.FileHash)
+	if errors.Is(err, ledger.ErrRetained) || errors.Is(err, ledger.ErrHeld) {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := storage.DeleteChunks(ctx, deleted, hashSlotTable, storageNodes, dialOptions...); err != nil {
+		logger.Error("failed to delete chunks", "err", err)
+		return nil, err
+	}
+	logger.Info("file deleted", "stripes", len(fileObj.StripeHashes), "deletedStripes", len(deleted.Stripes))
+	return &pb.FileDeletionResponse{Status: "SUCCESS"}, nil
+}
+
+// sweepFiles removes the expired files and their chunks every interval.
+func sweepFiles(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		hashSlotTable, err := slotTables.get()
+		if err != nil {
+			slog.Warn("sweep skipped", "err", err)
+			continue
+		}
+		swept, err := storage.SweepExpired(ctx, chain, hashSlotTable, storageNodes, 100, dialOptions...)
+		if err != nil {
+			slog.Error("failed to sweep expired files", "swept", len(swept), "err", err)
+			continue
+		}
+		if len(swept) > 0 {
+			slog.Info("expired files swept", "files", swept)
+		}
+	}
+}
+
+func main() {
+	if err := fabricConfig.LoadEnv(); err != nil {
+		log.Fatal(err)
+	}
+	fabricConfig.RegisterFlags(flag.CommandLine)
+	flag.Usage = func() {
+		fmt.Println("Usage: ./file_partition_service [-h] [-port string] [-workers int] [-inflight int] [-cache int] [-metrics string] [-events bool] [-checkpoint string] [-codec string] [-replicate-below int] [-sweep duration] [-org int] [-user string] [fabric flags]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if _, err := utils.GetCodec(*codecFlag); err != nil {
+		log.Fatal(err)
+	}
+
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, nil)).With("service", "file_partition", "port", *port))
+	metrics.Serve(*metricsAddr)
+	chunkCache = storage.NewChunkCache(*cacheSize * 1024 * 1024)
+
+	slog.Info("connecting to Fabric", "org", fabricConfig.Org, "user", fabricConfig.User)
+	conn, err := fabric.Connect(fabricConfig)
+	if err != nil {
+		log.Fatalf("Failed to connect to Fabric: %v", err)
+	}
+	// The gateway stays open while the server runs
+	defer conn.Close()
+	chain = ledger.NewFabric(conn.Contract)
+	if *events {
+		go listenEvents(context.Background(), conn, *checkpoint)
+	}
+	if *sweepInterval > 0 {
+		go sweepFiles(context.Background(), *sweepInterval)
+	}
+
+	// Create a listener on the TCP port
+	lis, err := net.Listen("tcp", *port)
+	if err != nil {
+		log.Fatalf("Failed to listen: %v", err)
+	}
+
+	opts := []grpc.ServerOption{
+		grpc.MaxRecvMsgSize(1024 * 1024 * 1024), // Set the maximum receive message size (in this case, 10MB)
+		grpc.UnaryInterceptor(metrics.UnaryServerInterceptor()),
+	}
+
+	// Create a new gRPC server
+	s := grpc.NewServer(opts...)
+
+	// Register the chunk storage server
+	pb.RegisterFilePartitionServer(s, &server{})
+
+	// Start the server
+	slog.Info("starting file partition server")
+	if err := s.Serve(lis); err != nil {
+		log.Fatalf("Failed to serve: %v", err)
+	}
+}
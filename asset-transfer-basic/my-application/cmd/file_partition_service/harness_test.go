@@ -0,0 +1,433 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	storagetest "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/internal/storagetest"
+	ledger "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/ledger"
+	pb "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/protos"
+	storage "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/storage"
+	utils "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/utils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// countingLedger counts the trees stored in segments.
+type countingLedger struct {
+	*ledger.Memory
+	commits atomic.Int32
+}
+
+func (l *countingLedger) CommitFileTree(fileHash string) (uint64, error) {
+	l.commits.Add(1)
+	return l.Memory.CommitFileTree(fileHash)
+}
+
+// harness runs a FilePartition server with its ChunkStorage servers and
+// ledger in process, all connections go over bufconn.
+type harness struct {
+	t      *testing.T
+	ledger *countingLedger
+	client pb.FilePartitionClient
+
+	cluster *storagetest.Cluster
+}
+
+// newHarness starts numNodes storage nodes of equal weight and a
+// FilePartition server using them, and points the globals of the service at
+// them for the duration of the test.
+func newHarness(t *testing.T, numNodes int) *harness {
+	// The service writes the tree of every stored file to the working
+	// directory
+	t.Chdir(t.TempDir())
+
+	h := &harness{
+		t:       t,
+		ledger:  &countingLedger{Memory: ledger.NewMemory()},
+		cluster: storagetest.NewCluster(t),
+	}
+	// Small segments so that trees of a few stripes are stored in segments,
+	// the events are handled as the event listener of the service does
+	h.ledger.SegmentSize = 8
+	h.ledger.OnEvent = func(name string, payload []byte) {
+		handleEvent(&client.ChaincodeEvent{EventName: name, Payload: payload})
+	}
+
+	savedNodes, savedMaxTransaction := storageNodes, maxFileTreeTransaction
+	chain = h.ledger
+	storageNodes = nil
+	dialOptions = []grpc.DialOption{h.cluster.Dialer()}
+	chunkCache = nil
+	slotTables.mu.Lock()
+	slotTables.enabled = true
+	slotTables.table = nil
+	slotTables.mu.Unlock()
+	ctx, cancel := context.WithCancel(context.Background())
+	go repairFiles(ctx)
+	t.Cleanup(func() {
+		cancel()
+		chain = nil
+		storageNodes, maxFileTreeTransaction = savedNodes, savedMaxTransaction
+		dialOptions = nil
+		slotTables.mu.Lock()
+		slotTables.enabled = false
+		slotTables.table = nil
+		slotTables.mu.Unlock()
+	})
+
+	for i := 0; i < numNodes; i++ {
+		h.addNode(fmt.Sprintf("node%d", i), 100)
+	}
+
+	lis := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer(grpc.MaxRecvMsgSize(1024 * 1024 * 1024))
+	pb.RegisterFilePartitionServer(s, &server{})
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	conn, err := grpc.Dial("file_partition", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}))
+	if err != nil {
+		t.Fatalf("failed to connect to file partition server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	h.client = pb.NewFilePartitionClient(conn)
+	return h
+}
+
+// startNode serves an empty store at addr.
+func (h *harness) startNode(addr string) *storagetest.ChunkStorage {
+	return h.cluster.Start(addr)
+}
+
+// stopNode takes the node at addr offline, its chunks are lost.
+func (h *harness) stopNode(addr string) {
+	h.cluster.Stop(addr)
+}
+
+// addNode starts a node and gives it weight in a new hash slot table, as
+// ./dsctl node add does.
+func (h *harness) addNode(addr string, weight int) {
+	h.t.Helper()
+	h.startNode(addr)
+	storageNodes = append(storageNodes, addr)
+	if _, err := h.ledger.UpdateOrgWeight(addr, weight); err != nil {
+		h.t.Fatalf("UpdateOrgWeight failed: %v", err)
+	}
+	if _, err := h.ledger.CreateHashSlotTable(); err != nil {
+		h.t.Fatalf("CreateHashSlotTable failed: %v", err)
+	}
+}
+
+func (h *harness) store(addr string) *storagetest.ChunkStorage {
+	return h.cluster.Store(addr)
+}
+
+// put partitions the content and waits until its tree is on the ledger.
+func (h *harness) put(content []byte, codec string) *storage.File {
+	h.t.Helper()
+	return h.partition(&pb.FilePartitionRequest{Data: content, Codec: codec})
+}
+
+func (h *harness) partition(request *pb.FilePartitionRequest) *storage.File {
+	h.t.Helper()
+	res, err := h.client.PartitionFile(context.Background(), request)
+	if err != nil {
+		h.t.Fatalf("PartitionFile failed: %v", err)
+	}
+	var file *storage.File
+	h.waitFor("file tree of "+res.Status, func() bool {
+		tree, err := h.ledger.GetFileTree(res.Status)
+		file = (*storage.File)(tree)
+		return err == nil
+	})
+	return file
+}
+
+// get reads a range of the file through the service.
+func (h *harness) get(fileHash string, offset, length int64) ([]byte, error) {
+	res, err := h.client.ReadFile(context.Background(), &pb.FileRequest{Hash: fileHash, Offset: offset, Length: length})
+	if err != nil {
+		return nil, err
+	}
+	return res.Data, nil
+}
+
+func (h *harness) mustGet(fileHash string, want []byte) {
+	h.t.Helper()
+	data, err := h.get(fileHash, 0, 0)
+	if err != nil {
+		h.t.Fatalf("ReadFile failed: %v", err)
+	}
+	if string(data) != string(want) {
+		h.t.Fatalf("ReadFile returned %d bytes that differ from the %d stored", len(data), len(want))
+	}
+}
+
+func (h *harness) waitFor(what string, done func() bool) {
+	h.t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			h.t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// location is where a chunk is placed: on its actual node, with a link on
+// its home node if they differ.
+type location struct {
+	home   string
+	actual string
+}
+
+// placement returns the location of every chunk of the file under the
+// current hash slot table.
+func (h *harness) placement(file *storage.File) map[string]location {
+	hashSlotTable, err := h.ledger.GetHashSlotTable()
+	if err != nil {
+		h.t.Fatalf("GetHashSlotTable failed: %v", err)
+	}
+
+	locations := make(map[string]location)
+	for _, stripe := range file.StripeHashes {
+		var chunkHashes []string
+		for _, chunk := range stripe.ChunkHashes {
+			chunkHashes = append(chunkHashes, chunk.ChunkHash)
+		}
+		home, actual := storage.PlaceStripe(chunkHashes, *hashSlotTable)
+		for i, chunkHash := range chunkHashes {
+			locations[chunkHash] = location{home: home[i], actual: actual[i]}
+		}
+	}
+	return locations
+}
+
+// healthy reports whether every chunk of the file is intact where readers
+// look for it, on its actual or its home node.
+func (h *harness) healthy(file *storage.File) bool {
+	for chunkHash, loc := range h.placement(file) {
+		if !h.store(loc.actual).Intact(chunkHash) && !h.store(loc.home).Intact(chunkHash) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkFile queues the file for a check of its chunks, as the
+// StoreFileTree event of a file stored by another service does.
+func (h *harness) checkFile(file *storage.File) {
+	repairQueue <- file.FileHash
+}
+
+func content(seed int64, size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+func TestUploadAndDownload(t *testing.T) {
+	h := newHarness(t, 3)
+	// Trees of more than about 30 stripes are stored a segment per
+	// transaction
+	maxFileTreeTransaction = 16 * 1024
+
+	tests := []struct {
+		name  string
+		size  int
+		codec string
+		want  string
+	}{
+		{"tiny file replicated", 1000, "", utils.DefaultReplication.Name()},
+		{"default codec", 100000, "", utils.DefaultCodec.Name()},
+		{"lrc", 50000, "lrc-4-2-2", "lrc-4-2-2"},
+		{"segmented tree", 40 * utils.StripeSize, "", utils.DefaultCodec.Name()},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := content(int64(i), tt.size)
+			file := h.put(data, tt.codec)
+			if file.Codec != tt.want || file.FileSize != int64(tt.size) {
+				t.Fatalf("stored codec %q and size %d, want %q and %d", file.Codec, file.FileSize, tt.want, tt.size)
+			}
+			if !h.healthy(file) {
+				t.Fatal("not every chunk is stored on its node")
+			}
+			h.mustGet(file.FileHash, data)
+
+			part, err := h.get(file.FileHash, 500, 300)
+			if err != nil {
+				t.Fatalf("ReadFile of a range failed: %v", err)
+			}
+			if string(part) != string(data[500:800]) {
+				t.Fatal("ReadFile returned the wrong range")
+			}
+		})
+	}
+	if n := h.ledger.commits.Load(); n != 1 {
+		t.Fatalf("%d trees stored in segments, want 1", n)
+	}
+	for _, addr := range storageNodes {
+		if len(h.store(addr).Chunks()) == 0 {
+			t.Fatalf("node %s stores no chunks", addr)
+		}
+	}
+}
+
+func TestDeleteFile(t *testing.T) {
+	h := newHarness(t, 3)
+	retainUntil := time.Now().Add(time.Hour)
+	file := h.partition(&pb.FilePartitionRequest{Data: content(1, 50000), RetainUntil: retainUntil.Format(time.RFC3339)})
+
+	_, err := h.client.DeleteFile(context.Background(), &pb.FileDeletionRequest{Hash: file.FileHash})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("DeleteFile of a retained file returned %v, want FailedPrecondition", err)
+	}
+	h.ledger.Now = func() time.Time { return retainUntil.Add(time.Second) }
+
+	if _, err := h.client.DeleteFile(context.Background(), &pb.FileDeletionRequest{Hash: file.FileHash}); err != nil {
+		t.Fatalf("DeleteFile failed: %v", err)
+	}
+	for _, addr := range storageNodes {
+		if n := len(h.store(addr).Chunks()); n != 0 {
+			t.Fatalf("node %s still stores %d chunks", addr, n)
+		}
+	}
+	_, err = h.client.DeleteFile(context.Background(), &pb.FileDeletionRequest{Hash: file.FileHash})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("DeleteFile of a deleted file returned %v, want NotFound", err)
+	}
+}
+
+func TestDeleteSharedStripes(t *testing.T) {
+	h := newHarness(t, 3)
+	shared := content(3, utils.StripeSize)
+	a := append(append([]byte{}, shared...), content(4, 1000)...)
+	b := append(append([]byte{}, shared...), content(5, 1000)...)
+	fileA, fileB := h.put(a, ""), h.put(b, "")
+	if fileA.StripeHashes[0].StripeHash != fileB.StripeHashes[0].StripeHash {
+		t.Fatal("files with the same first stripe do not share it")
+	}
+
+	// Deleting a keeps the chunks b still holds, the shared stripe and the
+	// zero padding of the last stripes
+	if _, err := h.client.DeleteFile(context.Background(), &pb.FileDeletionRequest{Hash: fileA.FileHash}); err != nil {
+		t.Fatalf("DeleteFile failed: %v", err)
+	}
+	h.mustGet(fileB.FileHash, b)
+	if !h.healthy(fileB) {
+		t.Fatal("chunks of the shared stripe were deleted")
+	}
+}
+
+func TestNodeLoss(t *testing.T) {
+	h := newHarness(t, 3)
+	data := content(2, 30*utils.StripeSize)
+	file := h.put(data, "")
+
+	// Every node holds two chunks of each stripe, which the parities cover
+	h.stopNode("node1")
+	h.mustGet(file.FileHash, data)
+
+	// The node comes back with an empty disk and the check rebuilds it
+	h.startNode("node1")
+	h.mustGet(file.FileHash, data)
+	h.checkFile(file)
+	h.waitFor("repair of node1", func() bool { return h.healthy(file) })
+
+	h.stopNode("node0")
+	h.stopNode("node2")
+	if _, err := h.get(file.FileHash, 0, 0); err == nil {
+		t.Fatal("ReadFile succeeded with two of three nodes lost")
+	}
+}
+
+func TestCorruptedShards(t *testing.T) {
+	h := newHarness(t, 3)
+	data := content(3, 30*utils.StripeSize)
+	file := h.put(data, "")
+	placement := h.placement(file)
+
+	// Three corrupted chunks of a stripe are within the parities
+	for _, stripe := range file.StripeHashes {
+		for _, chunk := range stripe.ChunkHashes[:3] {
+			h.store(placement[chunk.ChunkHash].actual).Corrupt(chunk.ChunkHash)
+		}
+	}
+	h.mustGet(file.FileHash, data)
+	h.checkFile(file)
+	h.waitFor("repair of corrupted chunks", func() bool { return h.healthy(file) })
+	h.mustGet(file.FileHash, data)
+
+	// A fourth one in a stripe is not
+	for _, chunk := range file.StripeHashes[0].ChunkHashes[:4] {
+		h.store(placement[chunk.ChunkHash].actual).Corrupt(chunk.ChunkHash)
+	}
+	if _, err := h.get(file.FileHash, 0, 0); err == nil {
+		t.Fatal("ReadFile succeeded with four corrupted chunks in a stripe")
+	}
+}
+
+func TestRebalance(t *testing.T) {
+	h := newHarness(t, 3)
+	data := content(4, 30*utils.StripeSize)
+	file := h.put(data, "")
+	before := h.placement(file)
+
+	// A new node takes most slots from the others, the service picks up
+	// the new table from the CreateHashSlotTable event. Stripes with more
+	// chunks moved than the codec can lose cannot be rebuilt from the rest.
+	h.addNode("node3", 1000)
+	after := h.placement(file)
+	parity := utils.DefaultCodec.Shards() - utils.DefaultCodec.DataShards()
+	mostMoved := 0
+	for _, stripe := range file.StripeHashes {
+		moved := 0
+		for _, chunk := range stripe.ChunkHashes {
+			if before[chunk.ChunkHash].actual != after[chunk.ChunkHash].actual {
+				moved++
+			}
+		}
+		if moved > mostMoved {
+			mostMoved = moved
+		}
+	}
+	if mostMoved <= parity {
+		t.Fatalf("at most %d chunks of a stripe moved, want more than %d", mostMoved, parity)
+	}
+
+	// Reads find the moved chunks where the table of the upload placed them
+	h.mustGet(file.FileHash, data)
+	h.checkFile(file)
+	h.waitFor("chunks to move to their new nodes", func() bool { return h.healthy(file) })
+
+	// Once the old copies are gone, the file is read from the new placement
+	for chunkHash, loc := range before {
+		if loc.actual != after[chunkHash].actual && loc.actual != after[chunkHash].home {
+			h.store(loc.actual).DeleteChunk(context.Background(), &pb.ChunkDeletionRequest{Hash: chunkHash})
+		}
+	}
+	h.mustGet(file.FileHash, data)
+
+	// New files use the new node as well
+	other := h.put(content(5, 30*utils.StripeSize), "")
+	onNewNode := 0
+	for _, loc := range h.placement(other) {
+		if loc.actual == "node3" {
+			onNewNode++
+		}
+	}
+	if onNewNode == 0 || !h.healthy(other) {
+		t.Fatalf("%d chunks of a new file on the new node, healthy %v", onNewNode, h.healthy(other))
+	}
+}
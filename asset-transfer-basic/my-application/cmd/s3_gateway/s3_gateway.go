@@ -0,0 +1,98 @@
+// s3_gateway serves the core of the S3 API on the storage system, mapping
+// buckets and keys to stored files through the storage chaincode.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	fabric "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/fabric"
+	ledger "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/ledger"
+	metrics "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/metrics"
+	s3gateway "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/s3gateway"
+	storage "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/storage"
+	utils "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/utils"
+)
+
+var (
+	addr           = flag.String("addr", ":9000", "address serving the S3 API")
+	metricsAddr    = flag.String("metrics", ":9101", "address serving Prometheus metrics on /metrics, disabled if empty")
+	cacheSize      = flag.Int64("cache", 256, "size of the local chunk cache in MiB")
+	codecFlag      = flag.String("codec", utils.DefaultCodec.Name(), "codec of the stripes of objects, one of "+strings.Join(utils.CodecNames(), ", "))
+	replicateBelow = flag.Int64("replicate-below", 4096, "store objects smaller than this many bytes as "+utils.DefaultReplication.Name()+" copies, 0 disables")
+	maxObjectSize  = flag.Int64("max-object-size", 1024, "largest object or part in MiB, held in memory while it is stored")
+	partsDir       = flag.String("parts", "s3parts", "directory keeping the parts of multipart uploads")
+	credentials    = flag.String("credentials", os.Getenv("S3_CREDENTIALS"), "comma separated accessKey:secretKey pairs allowed to sign requests, anonymous access if empty (env S3_CREDENTIALS)")
+	region         = flag.String("region", "us-east-1", "region requests are signed for")
+	fabricConfig   = fabric.DefaultConfig()
+)
+
+func parseCredentials(value string) (map[string]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	credentials := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		accessKey, secretKey, ok := strings.Cut(pair, ":")
+		if !ok || accessKey == "" || secretKey == "" {
+			return nil, fmt.Errorf("invalid credentials %q, expected accessKey:secretKey", pair)
+		}
+		credentials[accessKey] = secretKey
+	}
+	return credentials, nil
+}
+
+func main() {
+	if err := fabricConfig.LoadEnv(); err != nil {
+		log.Fatal(err)
+	}
+	fabricConfig.RegisterFlags(flag.CommandLine)
+	flag.Usage = func() {
+		fmt.Println("Usage: ./s3_gateway [-h] [-addr string] [-metrics string] [-cache int] [-codec string] [-replicate-below int] [-max-object-size int] [-parts string] [-credentials string] [-region string] [fabric flags]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	codec, err := utils.GetCodec(*codecFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	keys, err := parseCredentials(*credentials)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, nil)).With("service", "s3_gateway", "addr", *addr))
+	metrics.Serve(*metricsAddr)
+
+	slog.Info("connecting to Fabric", "org", fabricConfig.Org, "user", fabricConfig.User)
+	conn, err := fabric.Connect(fabricConfig)
+	if err != nil {
+		log.Fatalf("Failed to connect to Fabric: %v", err)
+	}
+	// The gateway stays open while the server runs
+	defer conn.Close()
+
+	gateway := s3gateway.NewGateway(ledger.NewFabric(conn.Contract), utils.MasterNodes[:], *partsDir)
+	gateway.Cache = storage.NewChunkCache(*cacheSize * 1024 * 1024)
+	gateway.Codec = codec
+	gateway.ReplicateBelow = *replicateBelow
+	gateway.MaxObjectSize = *maxObjectSize * 1024 * 1024
+	gateway.Credentials = keys
+	gateway.Region = *region
+	if keys == nil {
+		slog.Warn("no credentials given, accepting anonymous requests")
+	}
+
+	// The gateway is not wrapped in a ServeMux, which would clean the keys
+	// out of the paths
+	slog.Info("starting S3 gateway")
+	if err := http.ListenAndServe(*addr, gateway); err != nil {
+		log.Fatalf("Failed to serve: %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+// Package fabric connects the storage services and dsctl to the Fabric
+// network. A Config names the organization, the user and the endpoints; it
+// can be filled from defaults, the environment and flags, in that order of
+// precedence. Its JSON tags let dsctl read it from its configuration file
+// between the defaults and the environment.
+package fabric
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Config describes the identity used to transact and where to find the
+// network. Paths left empty are derived from TestNetwork, Org and User, so
+// switching to another test-network organization or user only takes
+// changing Org or User.
+type Config struct {
+	// TestNetwork is the test-network directory the default paths are
+	// derived from.
+	TestNetwork string `json:"testNetwork"`
+	// Org is the number of the test-network organization, 1 for Org1.
+	Org int `json:"org"`
+	// User is the name of the user within the organization, e.g. User1 or
+	// Admin.
+	User string `json:"user"`
+
+	// MSPID, CertPath and KeyPath describe the identity used to transact.
+	// KeyPath is either the private key or a directory holding only the key.
+	MSPID    string `json:"mspId"`
+	CertPath string `json:"certPath"`
+	KeyPath  string `json:"keyPath"`
+
+	// PeerEndpoint, GatewayPeer and TLSCertPath locate the peer serving the
+	// Gateway service.
+	PeerEndpoint string `json:"peerEndpoint"`
+	GatewayPeer  string `json:"gatewayPeer"`
+	TLSCertPath  string `json:"tlsCertPath"`
+
+	Channel   string `json:"channel"`
+	Chaincode string `json:"chaincode"`
+}
+
+// DefaultConfig returns the configuration of User1 of Org1 in test-network,
+// run from the my-application directory.
+func DefaultConfig() Config {
+	return Config{
+		TestNetwork: filepath.Join("..", "..", "test-network"),
+		Org:         1,
+		User:        "User1",
+		Channel:     "mychannel",
+		Chaincode:   "basic",
+	}
+}
+
+// env maps the environment variables read by LoadEnv to the fields they set.
+func (cfg *Config) env() map[string]*string {
+	return map[string]*string{
+		"FABRIC_USER":          &cfg.User,
+		"FABRIC_MSP_ID":        &cfg.MSPID,
+		"FABRIC_CERT_PATH":     &cfg.CertPath,
+		"FABRIC_KEY_PATH":      &cfg.KeyPath,
+		"FABRIC_PEER_ENDPOINT": &cfg.PeerEndpoint,
+		"FABRIC_GATEWAY_PEER":  &cfg.GatewayPeer,
+		"FABRIC_TLS_CERT_PATH": &cfg.TLSCertPath,
+		"CHANNEL_NAME":         &cfg.Channel,
+		"CHAINCODE_NAME":       &cfg.Chaincode,
+	}
+}
+
+// LoadEnv overrides the configuration with the environment variables that
+// are set.
+func (cfg *Config) LoadEnv() error {
+	for name, field := range cfg.env() {
+		if value := os.Getenv(name); value != "" {
+			*field = value
+		}
+	}
+	if value := os.Getenv("FABRIC_ORG"); value != "" {
+		org, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid FABRIC_ORG %q: %v", value, err)
+		}
+		cfg.Org = org
+	}
+	return nil
+}
+
+// RegisterFlags defines flags setting the configuration on fs. The flags
+// default to the current values, so LoadEnv should be called first to let
+// flags override the environment.
+func (cfg *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.IntVar(&cfg.Org, "org", cfg.Org, "number of the test-network organization to transact as")
+	fs.StringVar(&cfg.User, "user", cfg.User, "user of the organization to transact as")
+	fs.StringVar(&cfg.MSPID, "msp-id", cfg.MSPID, "MSP ID of the identity (default derived from -org)")
+	fs.StringVar(&cfg.CertPath, "cert", cfg.CertPath, "certificate of the identity (default derived from -org and -user)")
+	fs.StringVar(&cfg.KeyPath, "key", cfg.KeyPath, "private key, or directory holding it, of the identity (default derived from -org and -user)")
+	fs.StringVar(&cfg.PeerEndpoint, "peer-endpoint", cfg.PeerEndpoint, "address of the gateway peer (default derived from -org)")
+	fs.StringVar(&cfg.GatewayPeer, "gateway-peer", cfg.GatewayPeer, "TLS server name of the gateway peer (default derived from -org)")
+	fs.StringVar(&cfg.TLSCertPath, "tls-cert", cfg.TLSCertPath, "TLS CA certificate of the gateway peer (default derived from -org)")
+	fs.StringVar(&cfg.Channel, "channel", cfg.Channel, "channel name")
+	fs.StringVar(&cfg.Chaincode, "chaincode", cfg.Chaincode, "chaincode name")
+}
+
+// Resolved returns a copy of the configuration with the empty paths and
+// names derived from TestNetwork, Org and User.
+func (cfg Config) Resolved() Config {
+	domain := fmt.Sprintf("org%d.example.com", cfg.Org)
+	orgPath := filepath.Join(cfg.TestNetwork, "organizations", "peerOrganizations", domain)
+	credPath := filepath.Join(orgPath, "users", cfg.User+"@"+domain, "msp")
+	peer := "peer0." + domain
+
+	setDefault := func(field *string, value string) {
+		if *field == "" {
+			*field = value
+		}
+	}
+	setDefault(&cfg.MSPID, fmt.Sprintf("Org%dMSP", cfg.Org))
+	setDefault(&cfg.CertPath, filepath.Join(credPath, "signcerts", "cert.pem"))
+	setDefault(&cfg.KeyPath, filepath.Join(credPath, "keystore"))
+	// test-network exposes the peer of Org1 on 7051, Org2 on 9051 and
+	// every further organization 2000 ports higher.
+	setDefault(&cfg.PeerEndpoint, fmt.Sprintf("localhost:%d", 5051+2000*cfg.Org))
+	setDefault(&cfg.GatewayPeer, peer)
+	setDefault(&cfg.TLSCertPath, filepath.Join(orgPath, "peers", peer, "tls", "ca.crt"))
+	return cfg
+}
@@ -0,0 +1,96 @@
+package fabric
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolvedDerivesPathsFromOrgAndUser(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.TestNetwork = "tn"
+	cfg.Org = 2
+	cfg.User = "Admin"
+	cfg = cfg.Resolved()
+
+	org := filepath.Join("tn", "organizations", "peerOrganizations", "org2.example.com")
+	msp := filepath.Join(org, "users", "Admin@org2.example.com", "msp")
+	want := map[string][2]string{
+		"MSPID":        {cfg.MSPID, "Org2MSP"},
+		"CertPath":     {cfg.CertPath, filepath.Join(msp, "signcerts", "cert.pem")},
+		"KeyPath":      {cfg.KeyPath, filepath.Join(msp, "keystore")},
+		"PeerEndpoint": {cfg.PeerEndpoint, "localhost:9051"},
+		"GatewayPeer":  {cfg.GatewayPeer, "peer0.org2.example.com"},
+		"TLSCertPath":  {cfg.TLSCertPath, filepath.Join(org, "peers", "peer0.org2.example.com", "tls", "ca.crt")},
+	}
+	for field, values := range want {
+		if values[0] != values[1] {
+			t.Errorf("%s = %q, want %q", field, values[0], values[1])
+		}
+	}
+}
+
+func TestResolvedKeepsExplicitValues(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MSPID = "OtherMSP"
+	cfg.PeerEndpoint = "peer.example.com:443"
+	cfg = cfg.Resolved()
+
+	if cfg.MSPID != "OtherMSP" || cfg.PeerEndpoint != "peer.example.com:443" {
+		t.Errorf("explicit values were replaced: %q, %q", cfg.MSPID, cfg.PeerEndpoint)
+	}
+	if cfg.GatewayPeer != "peer0.org1.example.com" {
+		t.Errorf("GatewayPeer = %q, want the default of Org1", cfg.GatewayPeer)
+	}
+}
+
+func TestFlagsOverrideEnv(t *testing.T) {
+	t.Setenv("FABRIC_ORG", "2")
+	t.Setenv("FABRIC_USER", "Admin")
+	t.Setenv("CHANNEL_NAME", "envchannel")
+
+	cfg := DefaultConfig()
+	if err := cfg.LoadEnv(); err != nil {
+		t.Fatal(err)
+	}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg.RegisterFlags(fs)
+	if err := fs.Parse([]string{"-user=User2", "-peer-endpoint=peer:7051"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Org != 2 || cfg.User != "User2" || cfg.Channel != "envchannel" || cfg.PeerEndpoint != "peer:7051" {
+		t.Errorf("got org %d, user %q, channel %q, peer %q", cfg.Org, cfg.User, cfg.Channel, cfg.PeerEndpoint)
+	}
+}
+
+func TestLoadEnvRejectsInvalidOrg(t *testing.T) {
+	t.Setenv("FABRIC_ORG", "org1")
+	cfg := DefaultConfig()
+	if err := cfg.LoadEnv(); err == nil {
+		t.Error("expected an error for a non-numeric FABRIC_ORG")
+	}
+}
+
+func TestReadPrivateKey(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "priv_sk")
+	if err := os.WriteFile(keyPath, []byte("key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{dir, keyPath} {
+		key, err := readPrivateKey(path)
+		if err != nil || string(key) != "key" {
+			t.Errorf("readPrivateKey(%s) = %q, %v", path, key, err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "other_sk"), []byte("key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readPrivateKey(dir); err == nil {
+		t.Error("expected an error for a keystore holding two files")
+	}
+}
@@ -0,0 +1,179 @@
+package fabric
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Connection is an open connection to the Gateway service of a peer. It
+// stays usable until Close is called, which is usually when the process
+// exits.
+type Connection struct {
+	Gateway  *client.Gateway
+	Network  *client.Network
+	Contract *client.Contract
+
+	conn *grpc.ClientConn
+}
+
+// Close releases the gateway and its gRPC connection.
+func (c *Connection) Close() error {
+	c.Gateway.Close()
+	return c.conn.Close()
+}
+
+// Connect opens a connection to the chaincode of the configuration.
+func Connect(cfg Config) (*Connection, error) {
+	cfg = cfg.Resolved()
+
+	tlsCert, err := loadCertificate(cfg.TLSCertPath)
+	if err != nil {
+		return nil, err
+	}
+	certPool := x509.NewCertPool()
+	certPool.AddCert(tlsCert)
+	transportCredentials := credentials.NewClientTLSFromCert(certPool, cfg.GatewayPeer)
+
+	id, err := newIdentity(cfg)
+	if err != nil {
+		return nil, err
+	}
+	sign, err := newSign(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := grpc.Dial(cfg.PeerEndpoint, grpc.WithTransportCredentials(transportCredentials))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gRPC connection: %w", err)
+	}
+
+	gw, err := client.Connect(
+		id,
+		client.WithSign(sign),
+		client.WithClientConnection(conn),
+		client.WithEvaluateTimeout(5*time.Second),
+		client.WithEndorseTimeout(15*time.Second),
+		client.WithSubmitTimeout(5*time.Second),
+		client.WithCommitStatusTimeout(1*time.Minute),
+	)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to connect to gateway: %w", err)
+	}
+
+	network := gw.GetNetwork(cfg.Channel)
+	return &Connection{
+		Gateway:  gw,
+		Network:  network,
+		Contract: network.GetContract(cfg.Chaincode),
+		conn:     conn,
+	}, nil
+}
+
+// SubmitAsync endorses and submits a transaction without waiting for it to
+// be committed. The returned Commit reports the commit status.
+func SubmitAsync(contract *client.Contract, name string, args ...string) ([]byte, *client.Commit, error) {
+	result, commit, err := contract.SubmitAsync(name, client.WithArguments(args...))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to submit %s: %w", name, describe(err))
+	}
+	return result, commit, nil
+}
+
+// WaitForCommit waits for the transaction of commit to be committed and
+// fails unless it was committed as valid.
+func WaitForCommit(commit *client.Commit) (*client.Status, error) {
+	status, err := commit.Status()
+	if err != nil {
+		return nil, describe(err)
+	}
+	if !status.Successful {
+		return status, fmt.Errorf("transaction %s failed to commit with status %d", status.TransactionID, int32(status.Code))
+	}
+	return status, nil
+}
+
+// describe names the stage of the transaction flow an error comes from.
+func describe(err error) error {
+	var endorseErr *client.EndorseError
+	var submitErr *client.SubmitError
+	var commitStatusErr *client.CommitStatusError
+	var commitErr *client.CommitError
+	switch {
+	case errors.As(err, &endorseErr):
+		return fmt.Errorf("endorsement of transaction %s failed: %w", endorseErr.TransactionID, err)
+	case errors.As(err, &submitErr):
+		return fmt.Errorf("submission of transaction %s to the orderer failed: %w", submitErr.TransactionID, err)
+	case errors.As(err, &commitStatusErr):
+		return fmt.Errorf("commit status of transaction %s is unknown: %w", commitStatusErr.TransactionID, err)
+	case errors.As(err, &commitErr):
+		return fmt.Errorf("transaction %s failed to commit with status %d: %w", commitErr.TransactionID, int32(commitErr.Code), err)
+	}
+	return err
+}
+
+// newIdentity creates the X.509 identity of the configuration.
+func newIdentity(cfg Config) (*identity.X509Identity, error) {
+	certificate, err := loadCertificate(cfg.CertPath)
+	if err != nil {
+		return nil, err
+	}
+	return identity.NewX509Identity(cfg.MSPID, certificate)
+}
+
+// newSign creates a function signing message digests with the private key of
+// the configuration.
+func newSign(cfg Config) (identity.Sign, error) {
+	privateKeyPEM, err := readPrivateKey(cfg.KeyPath)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := identity.PrivateKeyFromPEM(privateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	return identity.NewPrivateKeySign(privateKey)
+}
+
+// readPrivateKey reads the private key at keyPath, or the only file of the
+// keyPath directory.
+func readPrivateKey(keyPath string) ([]byte, error) {
+	keyPath = filepath.Clean(keyPath)
+	info, err := os.Stat(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+	if info.IsDir() {
+		files, err := os.ReadDir(keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read private key directory: %w", err)
+		}
+		if len(files) != 1 {
+			return nil, fmt.Errorf("keystore folder %s should contain one file", keyPath)
+		}
+		keyPath = filepath.Join(keyPath, files[0].Name())
+	}
+	key, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key file: %w", err)
+	}
+	return key, nil
+}
+
+func loadCertificate(filename string) (*x509.Certificate, error) {
+	certificatePEM, err := os.ReadFile(filepath.Clean(filename))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate file: %w", err)
+	}
+	return identity.CertificateFromPEM(certificatePEM)
+}
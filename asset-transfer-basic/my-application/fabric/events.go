@@ -0,0 +1,107 @@
+package fabric
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/schema"
+)
+
+// Events emitted by the storage chaincode, one per transaction, and their
+// payloads, as defined by the schema package of the chaincode.
+const (
+	StoreFileTreeEvent       = schema.StoreFileTreeEvent
+	DeleteFileTreeEvent      = schema.DeleteFileTreeEvent
+	UpdateOrgWeightEvent     = schema.UpdateOrgWeightEvent
+	RemoveOrgEvent           = schema.RemoveOrgEvent
+	CreateHashSlotTableEvent = schema.CreateHashSlotTableEvent
+	SetQuotaEvent            = schema.SetQuotaEvent
+	SetRefEvent              = schema.SetRefEvent
+	DeleteRefEvent           = schema.DeleteRefEvent
+	SetRetentionEvent        = schema.SetRetentionEvent
+	SetLegalHoldEvent        = schema.SetLegalHoldEvent
+	ReleaseLegalHoldEvent    = schema.ReleaseLegalHoldEvent
+	ConfigurePaymentsEvent   = schema.ConfigurePaymentsEvent
+	SetPayoutAccountEvent    = schema.SetPayoutAccountEvent
+	ReportShardsEvent        = schema.ReportShardsEvent
+	SettlePaymentsEvent      = schema.SettlePaymentsEvent
+)
+
+type (
+	FileEvent          = schema.FileEvent
+	OrgEvent           = schema.OrgEvent
+	QuotaEvent         = schema.QuotaEvent
+	RefEvent           = schema.RefEvent
+	RetentionEvent     = schema.RetentionEvent
+	LegalHold          = schema.LegalHold
+	PaymentConfig      = schema.PaymentConfig
+	PayoutAccountEvent = schema.PayoutAccountEvent
+	ShardReport        = schema.ShardReport
+	Settlement         = schema.Settlement
+)
+
+// EventHandler handles one chaincode event. Events are handled one at a
+// time, in the order they were committed.
+type EventHandler func(event *client.ChaincodeEvent)
+
+// ListenEvents delivers the events of the chaincode to handle until ctx is
+// done. The event stream is reopened after the last handled event when it
+// breaks. With a non-empty checkpointPath, the last handled event is also
+// kept in that file so a restarted process resumes where it stopped instead
+// of missing the events committed in between.
+func (c *Connection) ListenEvents(ctx context.Context, checkpointPath string, handle EventHandler) error {
+	var checkpointer interface {
+		client.Checkpoint
+		CheckpointChaincodeEvent(event *client.ChaincodeEvent) error
+	}
+	if checkpointPath != "" {
+		fileCheckpointer, err := client.NewFileCheckpointer(checkpointPath)
+		if err != nil {
+			return fmt.Errorf("failed to open checkpoint %s: %w", checkpointPath, err)
+		}
+		defer fileCheckpointer.Close()
+		checkpointer = fileCheckpointer
+	} else {
+		checkpointer = &memoryCheckpointer{new(client.InMemoryCheckpointer)}
+	}
+
+	chaincodeName := c.Contract.ChaincodeName()
+	logger := slog.With("chaincode", chaincodeName)
+	retryDelay := time.Second
+	for {
+		events, err := c.Network.ChaincodeEvents(ctx, chaincodeName, client.WithCheckpoint(checkpointer))
+		if err != nil {
+			logger.Warn("failed to start chaincode event listening", "err", err)
+		} else {
+			logger.Info("listening for chaincode events", "block", checkpointer.BlockNumber())
+			for event := range events {
+				handle(event)
+				if err := checkpointer.CheckpointChaincodeEvent(event); err != nil {
+					logger.Warn("failed to checkpoint chaincode event", "tx", event.TransactionID, "err", err)
+				}
+				retryDelay = time.Second
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryDelay):
+		}
+		retryDelay = min(2*retryDelay, time.Minute)
+	}
+}
+
+// memoryCheckpointer gives the in-memory checkpointer the signature of the
+// file checkpointer.
+type memoryCheckpointer struct {
+	*client.InMemoryCheckpointer
+}
+
+func (c *memoryCheckpointer) CheckpointChaincodeEvent(event *client.ChaincodeEvent) error {
+	c.InMemoryCheckpointer.CheckpointChaincodeEvent(event)
+	return nil
+}
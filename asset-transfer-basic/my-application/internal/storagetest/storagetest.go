@@ -0,0 +1,227 @@
+// Package storagetest runs storage nodes in process for the tests of the
+// packages reading and writing chunks.
+package storagetest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/protos"
+	utils "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/utils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// ChunkStorage is a ChunkStorage server keeping its chunks and links in
+// memory.
+type ChunkStorage struct {
+	pb.UnimplementedChunkStorageServer
+	mu     sync.Mutex
+	chunks map[string][]byte
+	links  map[string]string
+	// delay is added to every GetChunk call.
+	delay time.Duration
+	// gets counts GetChunk calls.
+	gets int
+}
+
+func NewChunkStorage() *ChunkStorage {
+	return &ChunkStorage{chunks: make(map[string][]byte), links: make(map[string]string)}
+}
+
+func (s *ChunkStorage) StoreChunk(ctx context.Context, in *pb.ChunkStorageRequest) (*pb.ChunkStorageResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chunks[utils.GetHash(in.GetData())] = append([]byte{}, in.GetData()...)
+	return &pb.ChunkStorageResponse{Status: "SUCCESS"}, nil
+}
+
+func (s *ChunkStorage) GetChunk(ctx context.Context, in *pb.ChunkRequest) (*pb.ChunkResponse, error) {
+	s.mu.Lock()
+	s.gets++
+	delay := s.delay
+	s.mu.Unlock()
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.chunks[in.GetHash()]
+	if !ok {
+		return nil, fmt.Errorf("chunk %s not found", in.GetHash())
+	}
+	return &pb.ChunkResponse{Data: data}, nil
+}
+
+func (s *ChunkStorage) StoreLink(ctx context.Context, in *pb.LinkStorageRequest) (*pb.LinkStorageResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.links[in.GetHash()] = in.GetId()
+	return &pb.LinkStorageResponse{Status: "SUCCESS"}, nil
+}
+
+func (s *ChunkStorage) DeleteChunk(ctx context.Context, in *pb.ChunkDeletionRequest) (*pb.ChunkDeletionResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.chunks, in.GetHash())
+	delete(s.links, in.GetHash())
+	return &pb.ChunkDeletionResponse{Status: "SUCCESS"}, nil
+}
+
+// Chunks returns a copy of the stored chunks by hash.
+func (s *ChunkStorage) Chunks() map[string][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chunks := make(map[string][]byte, len(s.chunks))
+	for chunkHash, data := range s.chunks {
+		chunks[chunkHash] = append([]byte{}, data...)
+	}
+	return chunks
+}
+
+// Chunk returns a copy of a stored chunk.
+func (s *ChunkStorage) Chunk(chunkHash string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.chunks[chunkHash]
+	return append([]byte{}, data...), ok
+}
+
+// Link returns the node a link of the chunk points to, empty without one.
+func (s *ChunkStorage) Link(chunkHash string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.links[chunkHash]
+}
+
+// Lose deletes a chunk, as a failing disk would.
+func (s *ChunkStorage) Lose(chunkHash string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.chunks, chunkHash)
+}
+
+// Wipe deletes every chunk and returns their number.
+func (s *ChunkStorage) Wipe() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	wiped := len(s.chunks)
+	s.chunks = make(map[string][]byte)
+	return wiped
+}
+
+// Corrupt flips a bit of a stored chunk, if the node holds it.
+func (s *ChunkStorage) Corrupt(chunkHash string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if data, ok := s.chunks[chunkHash]; ok {
+		data[0] ^= 1
+	}
+}
+
+// Intact reports whether the node holds an uncorrupted copy of the chunk.
+func (s *ChunkStorage) Intact(chunkHash string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.chunks[chunkHash]
+	return ok && utils.GetHash(data) == chunkHash
+}
+
+// SetDelay delays every later GetChunk call.
+func (s *ChunkStorage) SetDelay(delay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delay = delay
+}
+
+// Gets returns the number of GetChunk calls.
+func (s *ChunkStorage) Gets() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.gets
+}
+
+type node struct {
+	store  *ChunkStorage
+	server *grpc.Server
+	lis    *bufconn.Listener
+}
+
+// Cluster serves ChunkStorage servers over bufconn, each under the address
+// it was started at. The servers are stopped at the end of the test.
+type Cluster struct {
+	t     testing.TB
+	mu    sync.Mutex
+	nodes map[string]*node
+}
+
+// NewCluster starts a server at each address.
+func NewCluster(t testing.TB, addrs ...string) *Cluster {
+	c := &Cluster{t: t, nodes: make(map[string]*node)}
+	for _, addr := range addrs {
+		c.Start(addr)
+	}
+	return c
+}
+
+// Start serves an empty store at addr.
+func (c *Cluster) Start(addr string) *ChunkStorage {
+	n := &node{store: NewChunkStorage(), server: grpc.NewServer(), lis: bufconn.Listen(1024 * 1024)}
+	pb.RegisterChunkStorageServer(n.server, n.store)
+	go n.server.Serve(n.lis)
+	c.t.Cleanup(n.server.Stop)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nodes[addr] = n
+	return n.store
+}
+
+// Stop takes the server at addr offline.
+func (c *Cluster) Stop(addr string) {
+	c.mu.Lock()
+	n := c.nodes[addr]
+	c.mu.Unlock()
+	n.server.Stop()
+}
+
+// Store returns the store served at addr.
+func (c *Cluster) Store(addr string) *ChunkStorage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.nodes[addr].store
+}
+
+// Stores returns the stores by address.
+func (c *Cluster) Stores() map[string]*ChunkStorage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stores := make(map[string]*ChunkStorage, len(c.nodes))
+	for addr, n := range c.nodes {
+		stores[addr] = n.store
+	}
+	return stores
+}
+
+// Dial connects to the server at addr.
+func (c *Cluster) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	c.mu.Lock()
+	n, ok := c.nodes[addr]
+	c.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown node %s", addr)
+	}
+	return n.lis.DialContext(ctx)
+}
+
+// Dialer is the dial option connecting to the servers.
+func (c *Cluster) Dialer() grpc.DialOption {
+	return grpc.WithContextDialer(c.Dial)
+}
@@ -0,0 +1,64 @@
+// Package ledger is a typed client of the storage chaincode. Its arguments
+// and results are the records of the schema package of the chaincode, so the
+// on-chain schema is defined once for the contract and its clients. Fabric
+// calls the deployed chaincode through a gateway, Memory keeps the ledger in
+// memory for tests.
+package ledger
+
+import (
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/schema"
+)
+
+// Client calls the functions of the storage chaincode. Every submitting
+// method returns once its transaction is committed as valid, with the number
+// of the block it was committed in or the result of the function.
+type Client interface {
+	// UpdateOrgWeight and RemoveOrg change the weight table, which
+	// CreateHashSlotTable splits the slots by.
+	UpdateOrgWeight(orgID string, weight int) (uint64, error)
+	RemoveOrg(orgID string) (uint64, error)
+	CreateHashSlotTable() (uint64, error)
+	GetHashSlotTable() (*schema.HashSlotTable, error)
+	// GetHashSlotTableByEpoch returns the table of an epoch, which the
+	// chunks of the files stored with it were placed by.
+	GetHashSlotTableByEpoch(epoch int) (*schema.HashSlotTable, error)
+	// GetFileTree reads the tree of a stored file a segment at a time.
+	GetFileTree(fileHash string) (*schema.FileTree, error)
+	GetFileMetadata(fileHash string) (*schema.FileMetadata, error)
+	// ListExpiredFiles returns up to limit files whose expiry has passed,
+	// leaving out held and referenced files.
+	ListExpiredFiles(limit int) ([]string, error)
+
+	// StoreFileTree stores a whole tree in one transaction.
+	StoreFileTree(tree *schema.FileTree, metadata *schema.FileMetadataInput) (uint64, error)
+	// BeginFileTree starts storing a tree a segment per transaction, the
+	// returned header tells the segment size.
+	BeginFileTree(fileHash string, fileSize int64, stripes int, codec string, slotTableEpoch int, metadata *schema.FileMetadataInput) (*schema.FileTreeHeader, error)
+	StoreFileTreeSegment(fileHash string, segment *schema.FileTreeSegment) (uint64, error)
+	// CommitFileTree makes a tree stored in segments visible.
+	CommitFileTree(fileHash string) (uint64, error)
+	// DeleteFileTree deletes a file unless it is retained, held or an
+	// object or ref points to it. The chunks of the returned stripes, which no other file holds, are left
+	// to the caller to delete.
+	DeleteFileTree(fileHash string) (*schema.DeletedFile, error)
+	// ExpireFile deletes a file whose expiry has passed, as DeleteFileTree.
+	ExpireFile(fileHash string) (*schema.DeletedFile, error)
+}
+
+// Objects is a Client that also maps the buckets and keys of the S3 gateway
+// to stored files. GetBucket and GetObject return nil for a bucket or key
+// that does not exist.
+type Objects interface {
+	Client
+	CreateBucket(name string) (uint64, error)
+	DeleteBucket(name string) (uint64, error)
+	GetBucket(name string) (*schema.Bucket, error)
+	ListBuckets() ([]*schema.Bucket, error)
+	// PutObject maps a key to a stored file of the size of the object.
+	PutObject(bucket string, key string, object *schema.ObjectInput) (uint64, error)
+	GetObject(bucket string, key string) (*schema.Object, error)
+	DeleteObject(bucket string, key string) (uint64, error)
+	// ListObjects returns up to maxKeys objects whose keys start with
+	// prefix and sort after startAfter, in key order.
+	ListObjects(bucket string, prefix string, startAfter string, maxKeys int) (*schema.ObjectPage, error)
+}
@@ -0,0 +1,77 @@
+package ledger
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"google.golang.org/grpc/status"
+)
+
+// Errors of the chaincode a client acts upon, matched with errors.Is. The
+// gateway passes chaincode errors on as messages, in the details of its gRPC
+// status, so they are told apart by the messages of the chaincode.
+var (
+	// ErrNotFound is returned for a file, tree or table that does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrRetained is returned for deleting a file before its retention ends.
+	ErrRetained = errors.New("file is retained")
+	// ErrHeld is returned for deleting a file under legal hold.
+	ErrHeld = errors.New("file is under legal hold")
+	// ErrReferenced is returned for deleting a file an object or ref points
+	// to.
+	ErrReferenced = errors.New("file is referenced")
+	// ErrNotOwner is returned for changing a bucket of another org.
+	ErrNotOwner = errors.New("not the owner")
+	// ErrInvalidBucketName is returned for creating a bucket whose name
+	// breaks the naming rules of S3.
+	ErrInvalidBucketName = errors.New("invalid bucket name")
+)
+
+// kinds maps the messages of the chaincode errors onto their sentinels.
+var kinds = []struct {
+	message string
+	kind    error
+}{
+	{"does not exist", ErrNotFound},
+	{" is retained until ", ErrRetained},
+	{" is under legal hold ", ErrHeld},
+	{" is referenced by ", ErrReferenced},
+	{" is owned by ", ErrNotOwner},
+	{"invalid bucket name", ErrInvalidBucketName},
+}
+
+// chaincodeError is an error of the chaincode matching one of the sentinels.
+// Its message is the one of the chaincode.
+type chaincodeError struct {
+	kind    error
+	message string
+	err     error
+}
+
+func (e *chaincodeError) Error() string        { return e.message }
+func (e *chaincodeError) Unwrap() error        { return e.err }
+func (e *chaincodeError) Is(target error) bool { return target == e.kind }
+
+// classify makes an error of the chaincode match its sentinel, if any. The
+// errors of the gateway only say that endorsement failed, the messages of
+// the peers are in the details of their gRPC status.
+func classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	messages := []string{err.Error()}
+	for _, detail := range status.Convert(err).Details() {
+		if detail, ok := detail.(*gateway.ErrorDetail); ok {
+			messages = append(messages, detail.Message)
+		}
+	}
+	for _, message := range messages {
+		for _, k := range kinds {
+			if strings.Contains(message, k.message) {
+				return &chaincodeError{kind: k.kind, message: message, err: err}
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,38 @@
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestClassifyMatchesStatusDetails(t *testing.T) {
+	// The gateway reports a failed endorsement with a generic message and
+	// the error of the chaincode in the details, which SubmitAsync wraps
+	message := "chaincode response 500, file abc is retained until 2023-06-01T00:00:00Z"
+	st, err := status.New(codes.Aborted, "failed to endorse transaction, see attached details for more info").
+		WithDetails(&gateway.ErrorDetail{Address: "peer0.org1.example.com:7051", MspId: "Org1MSP", Message: message})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = classify(fmt.Errorf("failed to submit DeleteFileTree: %w", st.Err()))
+	if !errors.Is(err, ErrRetained) {
+		t.Fatalf("expected ErrRetained, got %v", err)
+	}
+	if err.Error() != message {
+		t.Fatalf("expected the message of the chaincode, got %q", err.Error())
+	}
+	if status.Code(err) != codes.Aborted {
+		t.Fatalf("expected the status error to be wrapped")
+	}
+
+	st = status.New(codes.Aborted, "failed to endorse transaction, see attached details for more info")
+	if err := classify(st.Err()); errors.Is(err, ErrRetained) || errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected no sentinel without details, got %v", err)
+	}
+}
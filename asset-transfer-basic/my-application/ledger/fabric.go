@@ -0,0 +1,429 @@
+package ledger
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/schema"
+	fabric "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/fabric"
+	metrics "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/metrics"
+)
+
+// Fabric is a Client of the chaincode behind a Fabric gateway contract.
+type Fabric struct {
+	contract *client.Contract
+}
+
+func NewFabric(contract *client.Contract) *Fabric {
+	return &Fabric{contract: contract}
+}
+
+func (f *Fabric) evaluate(name string, args ...string) ([]byte, error) {
+	defer metrics.ObserveChaincode(name, time.Now())
+	result, err := f.contract.EvaluateTransaction(name, args...)
+	return result, classify(err)
+}
+
+// submit endorses and submits a transaction and waits for its commit.
+func (f *Fabric) submit(name string, args ...string) ([]byte, uint64, error) {
+	defer metrics.ObserveChaincode(name, time.Now())
+	result, commit, err := fabric.SubmitAsync(f.contract, name, args...)
+	if err != nil {
+		return nil, 0, classify(err)
+	}
+	status, err := fabric.WaitForCommit(commit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", name, err)
+	}
+	return result, status.BlockNumber, nil
+}
+
+// evaluateJSON evaluates a function and unmarshals its result into v.
+func (f *Fabric) evaluateJSON(v interface{}, name string, args ...string) error {
+	result, err := f.evaluate(name, args...)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(result, v); err != nil {
+		return fmt.Errorf("failed to unmarshal result of %s: %v", name, err)
+	}
+	return nil
+}
+
+// evaluateOptional evaluates a function returning nothing for a missing
+// record into v, and reports whether it returned one.
+func (f *Fabric) evaluateOptional(v interface{}, name string, args ...string) (bool, error) {
+	result, err := f.evaluate(name, args...)
+	if err != nil || len(result) == 0 {
+		return false, err
+	}
+	if err := json.Unmarshal(result, v); err != nil {
+		return false, fmt.Errorf("failed to unmarshal result of %s: %v", name, err)
+	}
+	return true, nil
+}
+
+// submitJSON submits a transaction and unmarshals its result into v.
+func (f *Fabric) submitJSON(v interface{}, name string, args ...string) error {
+	result, _, err := f.submit(name, args...)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(result, v); err != nil {
+		return fmt.Errorf("failed to unmarshal result of %s: %v", name, err)
+	}
+	return nil
+}
+
+func (f *Fabric) InitLedger() (uint64, error) {
+	_, block, err := f.submit("InitLedger")
+	return block, err
+}
+
+func (f *Fabric) UpdateOrgWeight(orgID string, weight int) (uint64, error) {
+	_, block, err := f.submit("UpdateOrgWeight", orgID, strconv.Itoa(weight))
+	return block, err
+}
+
+func (f *Fabric) RemoveOrg(orgID string) (uint64, error) {
+	_, block, err := f.submit("RemoveOrg", orgID)
+	return block, err
+}
+
+func (f *Fabric) CreateHashSlotTable() (uint64, error) {
+	_, block, err := f.submit("CreateHashSlotTable")
+	return block, err
+}
+
+func (f *Fabric) GetHashSlotTable() (*schema.HashSlotTable, error) {
+	var hashSlotTable schema.HashSlotTable
+	if err := f.evaluateJSON(&hashSlotTable, "GetHashSlotTable"); err != nil {
+		return nil, err
+	}
+	return &hashSlotTable, nil
+}
+
+func (f *Fabric) GetHashSlotTableByEpoch(epoch int) (*schema.HashSlotTable, error) {
+	var hashSlotTable schema.HashSlotTable
+	if err := f.evaluateJSON(&hashSlotTable, "GetHashSlotTableByEpoch", strconv.Itoa(epoch)); err != nil {
+		return nil, err
+	}
+	return &hashSlotTable, nil
+}
+
+// GetFileTree reads the header and then every segment of the tree, so no
+// single response holds the whole tree.
+func (f *Fabric) GetFileTree(fileHash string) (*schema.FileTree, error) {
+	var header schema.FileTreeHeader
+	if err := f.evaluateJSON(&header, "GetFileTreeHeader", fileHash); err != nil {
+		return nil, err
+	}
+
+	tree := &schema.FileTree{
+		FileHash:       header.FileHash,
+		FileSize:       header.FileSize,
+		Codec:          header.Codec,
+		SlotTableEpoch: header.SlotTableEpoch,
+		StripeHashes:   make([]schema.StripeTree, 0, header.Stripes),
+	}
+	for index := 0; index < header.Segments; index++ {
+		var segment schema.FileTreeSegment
+		if err := f.evaluateJSON(&segment, "GetFileTreeSegment", fileHash, strconv.Itoa(index)); err != nil {
+			return nil, err
+		}
+		tree.StripeHashes = append(tree.StripeHashes, segment.StripeHashes...)
+	}
+
+	if len(tree.StripeHashes) != header.Stripes {
+		return nil, fmt.Errorf("file tree %s has %d stripes, expected %d", fileHash, len(tree.StripeHashes), header.Stripes)
+	}
+	return tree, nil
+}
+
+func (f *Fabric) GetFileMetadata(fileHash string) (*schema.FileMetadata, error) {
+	var metadata schema.FileMetadata
+	if err := f.evaluateJSON(&metadata, "GetFileMetadata", fileHash); err != nil {
+		return nil, err
+	}
+	return &metadata, nil
+}
+
+func (f *Fabric) ListExpiredFiles(limit int) ([]string, error) {
+	var fileHashes []string
+	if err := f.evaluateJSON(&fileHashes, "ListExpiredFiles", strconv.Itoa(limit)); err != nil {
+		return nil, err
+	}
+	return fileHashes, nil
+}
+
+func (f *Fabric) StoreFileTree(tree *schema.FileTree, metadata *schema.FileMetadataInput) (uint64, error) {
+	treeJSON, err := json.Marshal(tree)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal file tree: %v", err)
+	}
+	metadataJSON, err := marshalMetadata(metadata)
+	if err != nil {
+		return 0, err
+	}
+	_, block, err := f.submit("StoreFileTree", tree.FileHash, string(treeJSON), metadataJSON)
+	return block, err
+}
+
+func (f *Fabric) BeginFileTree(fileHash string, fileSize int64, stripes int, codec string, slotTableEpoch int, metadata *schema.FileMetadataInput) (*schema.FileTreeHeader, error) {
+	metadataJSON, err := marshalMetadata(metadata)
+	if err != nil {
+		return nil, err
+	}
+	result, _, err := f.submit("BeginFileTree", fileHash, strconv.FormatInt(fileSize, 10), strconv.Itoa(stripes), codec, strconv.Itoa(slotTableEpoch), metadataJSON)
+	if err != nil {
+		return nil, err
+	}
+	var header schema.FileTreeHeader
+	if err := json.Unmarshal(result, &header); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal file tree header: %v", err)
+	}
+	return &header, nil
+}
+
+func (f *Fabric) StoreFileTreeSegment(fileHash string, segment *schema.FileTreeSegment) (uint64, error) {
+	segmentJSON, err := json.Marshal(segment)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal file tree segment: %v", err)
+	}
+	_, block, err := f.submit("StoreFileTreeSegment", fileHash, string(segmentJSON))
+	return block, err
+}
+
+func (f *Fabric) CommitFileTree(fileHash string) (uint64, error) {
+	_, block, err := f.submit("CommitFileTree", fileHash)
+	return block, err
+}
+
+func (f *Fabric) DeleteFileTree(fileHash string) (*schema.DeletedFile, error) {
+	return f.submitDelete("DeleteFileTree", fileHash)
+}
+
+func (f *Fabric) ExpireFile(fileHash string) (*schema.DeletedFile, error) {
+	return f.submitDelete("ExpireFile", fileHash)
+}
+
+func (f *Fabric) submitDelete(name string, fileHash string) (*schema.DeletedFile, error) {
+	var deleted schema.DeletedFile
+	if err := f.submitJSON(&deleted, name, fileHash); err != nil {
+		return nil, err
+	}
+	return &deleted, nil
+}
+
+func (f *Fabric) ListFiles(pageSize int, bookmark string) (*schema.PaginatedFileResult, error) {
+	var page schema.PaginatedFileResult
+	if err := f.evaluateJSON(&page, "ListFiles", strconv.Itoa(pageSize), bookmark); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+func (f *Fabric) QueryFilesByOwner(owner string, pageSize int, bookmark string) (*schema.PaginatedFileResult, error) {
+	var page schema.PaginatedFileResult
+	if err := f.evaluateJSON(&page, "QueryFilesByOwner", owner, strconv.Itoa(pageSize), bookmark); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+func (f *Fabric) QueryFilesByTag(tag string, pageSize int, bookmark string) (*schema.PaginatedFileResult, error) {
+	var page schema.PaginatedFileResult
+	if err := f.evaluateJSON(&page, "QueryFilesByTag", tag, strconv.Itoa(pageSize), bookmark); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+func (f *Fabric) GetUsage(scope string, subject string) ([]*schema.Usage, error) {
+	var usage []*schema.Usage
+	if err := f.evaluateJSON(&usage, "GetUsage", scope, subject); err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+func (f *Fabric) SetQuota(scope string, subject string, bytes int64) (uint64, error) {
+	_, block, err := f.submit("SetQuota", scope, subject, strconv.FormatInt(bytes, 10))
+	return block, err
+}
+
+func (f *Fabric) SetRetention(fileHash string, retainUntil string, expireAt string) (uint64, error) {
+	_, block, err := f.submit("SetRetention", fileHash, retainUntil, expireAt)
+	return block, err
+}
+
+func (f *Fabric) GetRetention(fileHash string) (*schema.Retention, error) {
+	var retention schema.Retention
+	if err := f.evaluateJSON(&retention, "GetRetention", fileHash); err != nil {
+		return nil, err
+	}
+	return &retention, nil
+}
+
+func (f *Fabric) SetLegalHold(fileHash string, holdID string, reason string) (uint64, error) {
+	_, block, err := f.submit("SetLegalHold", fileHash, holdID, reason)
+	return block, err
+}
+
+func (f *Fabric) ReleaseLegalHold(fileHash string, holdID string) (uint64, error) {
+	_, block, err := f.submit("ReleaseLegalHold", fileHash, holdID)
+	return block, err
+}
+
+func (f *Fabric) SetRef(name string, fileHash string) (*schema.Ref, error) {
+	var ref schema.Ref
+	if err := f.submitJSON(&ref, "SetRef", name, fileHash); err != nil {
+		return nil, err
+	}
+	return &ref, nil
+}
+
+func (f *Fabric) DeleteRef(name string) (uint64, error) {
+	_, block, err := f.submit("DeleteRef", name)
+	return block, err
+}
+
+func (f *Fabric) ResolveRef(name string, version int, at string) (*schema.Ref, error) {
+	var ref schema.Ref
+	if err := f.evaluateJSON(&ref, "ResolveRef", name, strconv.Itoa(version), at); err != nil {
+		return nil, err
+	}
+	return &ref, nil
+}
+
+func (f *Fabric) ListRefs(prefix string) ([]*schema.Ref, error) {
+	var refs []*schema.Ref
+	if err := f.evaluateJSON(&refs, "ListRefs", prefix); err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+func (f *Fabric) GetRefHistory(name string) ([]*schema.RefHistoryRecord, error) {
+	var records []*schema.RefHistoryRecord
+	if err := f.evaluateJSON(&records, "GetRefHistory", name); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (f *Fabric) CreateBucket(name string) (uint64, error) {
+	_, block, err := f.submit("CreateBucket", name)
+	return block, err
+}
+
+func (f *Fabric) DeleteBucket(name string) (uint64, error) {
+	_, block, err := f.submit("DeleteBucket", name)
+	return block, err
+}
+
+func (f *Fabric) GetBucket(name string) (*schema.Bucket, error) {
+	var bucket schema.Bucket
+	found, err := f.evaluateOptional(&bucket, "GetBucket", name)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &bucket, nil
+}
+
+func (f *Fabric) ListBuckets() ([]*schema.Bucket, error) {
+	var buckets []*schema.Bucket
+	if err := f.evaluateJSON(&buckets, "ListBuckets"); err != nil {
+		return nil, err
+	}
+	return buckets, nil
+}
+
+func (f *Fabric) PutObject(bucket string, key string, object *schema.ObjectInput) (uint64, error) {
+	objectJSON, err := json.Marshal(object)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal object: %v", err)
+	}
+	_, block, err := f.submit("PutObject", bucket, key, string(objectJSON))
+	return block, err
+}
+
+func (f *Fabric) GetObject(bucket string, key string) (*schema.Object, error) {
+	var object schema.Object
+	found, err := f.evaluateOptional(&object, "GetObject", bucket, key)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &object, nil
+}
+
+func (f *Fabric) DeleteObject(bucket string, key string) (uint64, error) {
+	_, block, err := f.submit("DeleteObject", bucket, key)
+	return block, err
+}
+
+func (f *Fabric) ListObjects(bucket string, prefix string, startAfter string, maxKeys int) (*schema.ObjectPage, error) {
+	var page schema.ObjectPage
+	if err := f.evaluateJSON(&page, "ListObjects", bucket, prefix, startAfter, strconv.Itoa(maxKeys)); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+func (f *Fabric) ConfigurePayments(tokenChaincode string, pricePerGiBDay int64) (uint64, error) {
+	_, block, err := f.submit("ConfigurePayments", tokenChaincode, strconv.FormatInt(pricePerGiBDay, 10))
+	return block, err
+}
+
+func (f *Fabric) GetPaymentConfig() (*schema.PaymentConfig, error) {
+	var config schema.PaymentConfig
+	if err := f.evaluateJSON(&config, "GetPaymentConfig"); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func (f *Fabric) SetPayoutAccount(orgID string, account string) (uint64, error) {
+	_, block, err := f.submit("SetPayoutAccount", orgID, account)
+	return block, err
+}
+
+func (f *Fabric) GetEscrows(fileHash string) ([]*schema.Escrow, error) {
+	var escrows []*schema.Escrow
+	if err := f.evaluateJSON(&escrows, "GetEscrows", fileHash); err != nil {
+		return nil, err
+	}
+	return escrows, nil
+}
+
+func (f *Fabric) ReportShards(shards map[string]int) (uint64, error) {
+	shardsJSON, err := json.Marshal(shards)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal shards: %v", err)
+	}
+	_, block, err := f.submit("ReportShards", string(shardsJSON))
+	return block, err
+}
+
+func (f *Fabric) SettlePayments(limit int) (*schema.Settlement, error) {
+	var settlement schema.Settlement
+	if err := f.submitJSON(&settlement, "SettlePayments", strconv.Itoa(limit)); err != nil {
+		return nil, err
+	}
+	return &settlement, nil
+}
+
+// marshalMetadata returns the metadata argument, empty without metadata.
+func marshalMetadata(metadata *schema.FileMetadataInput) (string, error) {
+	if metadata == nil {
+		return "", nil
+	}
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal file metadata: %v", err)
+	}
+	return string(metadataJSON), nil
+}
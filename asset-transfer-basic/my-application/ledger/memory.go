@@ -0,0 +1,650 @@
+package ledger
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/schema"
+)
+
+// Memory is an Objects client keeping the ledger in memory, for tests. It
+// follows the chaincode for the weight and hash slot tables, file trees,
+// their metadata and retention, buckets and objects and the events it sets;
+// it has no quotas, legal holds or payments, and its only identity is MSPID.
+type Memory struct {
+	// SegmentSize is the number of stripes per segment of begun trees.
+	SegmentSize int
+	// Now returns the time of a transaction, time.Now if nil.
+	Now func() time.Time
+	// OnEvent receives the event of every committed transaction setting
+	// one, in commit order.
+	OnEvent func(name string, payload []byte)
+	// MSPID is the MSP of the client, which owns the buckets it creates.
+	MSPID string
+
+	mu            sync.Mutex
+	weights       map[string]int
+	hashSlotTable *schema.HashSlotTable
+	slotTables    map[int]*schema.HashSlotTable // every table by epoch
+	headers       map[string]*schema.FileTreeHeader
+	stripes       map[string][]schema.StripeTree
+	metadata      map[string]*schema.FileMetadata
+	buckets       map[string]*schema.Bucket
+	objects       map[string]map[string]*schema.Object
+	block         uint64
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		SegmentSize: 512,
+		weights:     make(map[string]int),
+		slotTables:  make(map[int]*schema.HashSlotTable),
+		headers:     make(map[string]*schema.FileTreeHeader),
+		stripes:     make(map[string][]schema.StripeTree),
+		metadata:    make(map[string]*schema.FileMetadata),
+		MSPID:       "Org1MSP",
+		buckets:     make(map[string]*schema.Bucket),
+		objects:     make(map[string]map[string]*schema.Object),
+	}
+}
+
+func (m *Memory) now() time.Time {
+	if m.Now != nil {
+		return m.Now().UTC()
+	}
+	return time.Now().UTC()
+}
+
+// commit ends a transaction that modified the ledger, which must be locked,
+// and returns its block. The event is delivered once the ledger is unlocked.
+func (m *Memory) commit(name string, payload any) (uint64, func()) {
+	m.block++
+	if payload == nil || m.OnEvent == nil {
+		return m.block, func() {}
+	}
+	payloadJSON, _ := json.Marshal(payload)
+	onEvent := m.OnEvent
+	return m.block, func() { onEvent(name, payloadJSON) }
+}
+
+func (m *Memory) UpdateOrgWeight(orgID string, weight int) (uint64, error) {
+	if weight < 0 {
+		return 0, fmt.Errorf("weight of org %s must not be negative", orgID)
+	}
+	m.mu.Lock()
+	m.weights[orgID] = weight
+	block, notify := m.commit(schema.UpdateOrgWeightEvent, schema.OrgEvent{OrgID: orgID, Weight: weight})
+	m.mu.Unlock()
+	notify()
+	return block, nil
+}
+
+func (m *Memory) RemoveOrg(orgID string) (uint64, error) {
+	m.mu.Lock()
+	if _, ok := m.weights[orgID]; !ok {
+		m.mu.Unlock()
+		return 0, classify(fmt.Errorf("org %s does not exist", orgID))
+	}
+	delete(m.weights, orgID)
+	block, notify := m.commit(schema.RemoveOrgEvent, schema.OrgEvent{OrgID: orgID})
+	m.mu.Unlock()
+	notify()
+	return block, nil
+}
+
+// CreateHashSlotTable splits the slots by the weights with the allocator of
+// the chaincode, in the next epoch.
+func (m *Memory) CreateHashSlotTable() (uint64, error) {
+	m.mu.Lock()
+	hashSlotTable, err := schema.AllocateSlots(m.weights)
+	if err != nil {
+		m.mu.Unlock()
+		return 0, err
+	}
+	hashSlotTable.Epoch = len(m.slotTables) + 1
+	m.hashSlotTable = hashSlotTable
+	m.slotTables[hashSlotTable.Epoch] = hashSlotTable
+	block, notify := m.commit(schema.CreateHashSlotTableEvent, hashSlotTable)
+	m.mu.Unlock()
+	notify()
+	return block, nil
+}
+
+func (m *Memory) GetHashSlotTable() (*schema.HashSlotTable, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.hashSlotTable == nil {
+		return nil, classify(fmt.Errorf("hash slot table does not exist"))
+	}
+	hashSlotTable := *m.hashSlotTable
+	return &hashSlotTable, nil
+}
+
+func (m *Memory) GetHashSlotTableByEpoch(epoch int) (*schema.HashSlotTable, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hashSlotTable, ok := m.slotTables[epoch]
+	if !ok {
+		return nil, classify(fmt.Errorf("hash slot table of epoch %d does not exist", epoch))
+	}
+	copied := *hashSlotTable
+	return &copied, nil
+}
+
+func (m *Memory) GetFileTree(fileHash string) (*schema.FileTree, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	header, ok := m.headers[fileHash]
+	if !ok || !header.Complete {
+		return nil, classify(fmt.Errorf("FileTree does not exist"))
+	}
+	return &schema.FileTree{
+		FileHash:       header.FileHash,
+		FileSize:       header.FileSize,
+		Codec:          header.Codec,
+		SlotTableEpoch: header.SlotTableEpoch,
+		StripeHashes:   append([]schema.StripeTree(nil), m.stripes[fileHash]...),
+	}, nil
+}
+
+func (m *Memory) GetFileMetadata(fileHash string) (*schema.FileMetadata, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	metadata, ok := m.metadata[fileHash]
+	if !ok {
+		return nil, classify(fmt.Errorf("file %s does not exist", fileHash))
+	}
+	copied := *metadata
+	return &copied, nil
+}
+
+func (m *Memory) ListExpiredFiles(limit int) ([]string, error) {
+	if limit <= 0 || limit > 1000 {
+		return nil, fmt.Errorf("limit must be between 1 and 1000")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now().Format(time.RFC3339)
+	var expired []*schema.FileTreeHeader
+	for _, header := range m.headers {
+		if header.ExpireAt != "" && header.ExpireAt <= now && m.referrer(header.FileHash) == "" {
+			expired = append(expired, header)
+		}
+	}
+	// Oldest expiry first, as the expiry index of the chaincode is ordered
+	sort.Slice(expired, func(i, j int) bool {
+		if expired[i].ExpireAt != expired[j].ExpireAt {
+			return expired[i].ExpireAt < expired[j].ExpireAt
+		}
+		return expired[i].FileHash < expired[j].FileHash
+	})
+	fileHashes := make([]string, 0, limit)
+	for _, header := range expired {
+		if len(fileHashes) == limit {
+			break
+		}
+		fileHashes = append(fileHashes, header.FileHash)
+	}
+	return fileHashes, nil
+}
+
+func (m *Memory) StoreFileTree(tree *schema.FileTree, metadata *schema.FileMetadataInput) (uint64, error) {
+	m.mu.Lock()
+	header, err := m.begin(tree.FileHash, tree.FileSize, len(tree.StripeHashes), tree.Codec, tree.SlotTableEpoch, metadata)
+	if err != nil {
+		m.mu.Unlock()
+		return 0, err
+	}
+	if header.Complete {
+		block, _ := m.commit("", nil)
+		m.mu.Unlock()
+		return block, nil
+	}
+	m.stripes[tree.FileHash] = append([]schema.StripeTree(nil), tree.StripeHashes...)
+	block, notify := m.complete(header)
+	m.mu.Unlock()
+	notify()
+	return block, nil
+}
+
+func (m *Memory) BeginFileTree(fileHash string, fileSize int64, stripes int, codec string, slotTableEpoch int, metadata *schema.FileMetadataInput) (*schema.FileTreeHeader, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	header, err := m.begin(fileHash, fileSize, stripes, codec, slotTableEpoch, metadata)
+	if err != nil {
+		return nil, err
+	}
+	m.commit("", nil)
+	copied := *header
+	return &copied, nil
+}
+
+// begin replaces the header of a file by an incomplete one, keeping the
+// retention of a file begun before. The header of a stored file is returned
+// with its retention set as SetRetention of the chaincode would; Memory has
+// no identities, so every client counts as its owner.
+func (m *Memory) begin(fileHash string, fileSize int64, stripes int, codec string, slotTableEpoch int, metadata *schema.FileMetadataInput) (*schema.FileTreeHeader, error) {
+	if fileHash == "" {
+		return nil, fmt.Errorf("file hash must not be empty")
+	}
+	if stripes < 0 || fileSize < 0 {
+		return nil, fmt.Errorf("invalid FileTree of %d bytes in %d stripes", fileSize, stripes)
+	}
+	if _, ok := m.slotTables[slotTableEpoch]; slotTableEpoch != 0 && !ok {
+		return nil, classify(fmt.Errorf("hash slot table of epoch %d does not exist", slotTableEpoch))
+	}
+	input := schema.FileMetadataInput{}
+	if metadata != nil {
+		input = *metadata
+	}
+	retainUntil, err := formatTimestamp("retention", input.RetainUntil)
+	if err != nil {
+		return nil, err
+	}
+	expireAt, err := formatTimestamp("expiry", input.ExpireAt)
+	if err != nil {
+		return nil, err
+	}
+	if existing, ok := m.headers[fileHash]; ok && existing.Complete {
+		if err := restoreRetention(existing, retainUntil, expireAt); err != nil {
+			return nil, err
+		}
+		return existing, nil
+	}
+	header := &schema.FileTreeHeader{
+		FileHash:       fileHash,
+		FileSize:       fileSize,
+		Codec:          codec,
+		SlotTableEpoch: slotTableEpoch,
+		Stripes:        stripes,
+		SegmentSize:    m.SegmentSize,
+		Segments:       (stripes + m.SegmentSize - 1) / m.SegmentSize,
+		Metadata:       &input,
+		RetainUntil:    retainUntil,
+		ExpireAt:       expireAt,
+	}
+	if existing, ok := m.headers[fileHash]; ok {
+		// Retention only ever grows
+		if existing.RetainUntil > header.RetainUntil {
+			header.RetainUntil = existing.RetainUntil
+		}
+		if existing.ExpireAt != "" && existing.ExpireAt > header.ExpireAt {
+			header.ExpireAt = existing.ExpireAt
+		}
+	}
+	m.headers[fileHash] = header
+	m.stripes[fileHash] = make([]schema.StripeTree, stripes)
+	return header, nil
+}
+
+// restoreRetention sets the retention given when a stored file is stored
+// again. Retention may only be extended and a file cannot expire before it
+// ends.
+func restoreRetention(header *schema.FileTreeHeader, retainUntil string, expireAt string) error {
+	retain, expire := header.RetainUntil, header.ExpireAt
+	if retainUntil != "" {
+		if retainUntil < retain {
+			return fmt.Errorf("retention of file %s cannot be shortened from %s", header.FileHash, retain)
+		}
+		retain = retainUntil
+	}
+	if expireAt != "" {
+		expire = expireAt
+	}
+	if expire != "" && expire < retain {
+		return fmt.Errorf("file %s cannot expire at %s before its retention ends at %s", header.FileHash, expire, retain)
+	}
+	header.RetainUntil, header.ExpireAt = retain, expire
+	return nil
+}
+
+func (m *Memory) StoreFileTreeSegment(fileHash string, segment *schema.FileTreeSegment) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	header, ok := m.headers[fileHash]
+	if !ok || header.Complete {
+		return 0, fmt.Errorf("FileTree %s was not begun", fileHash)
+	}
+	start := segment.Index * header.SegmentSize
+	if segment.Index < 0 || segment.Index >= header.Segments || start+len(segment.StripeHashes) > header.Stripes {
+		return 0, fmt.Errorf("invalid FileTree segment %d", segment.Index)
+	}
+	copy(m.stripes[fileHash][start:], segment.StripeHashes)
+	block, _ := m.commit("", nil)
+	return block, nil
+}
+
+func (m *Memory) CommitFileTree(fileHash string) (uint64, error) {
+	m.mu.Lock()
+	header, ok := m.headers[fileHash]
+	if !ok || header.Complete {
+		m.mu.Unlock()
+		return 0, fmt.Errorf("FileTree %s was not begun", fileHash)
+	}
+	for index, stripe := range m.stripes[fileHash] {
+		if stripe.StripeHash == "" {
+			m.mu.Unlock()
+			return 0, fmt.Errorf("FileTree %s is missing segment %d", fileHash, index/header.SegmentSize)
+		}
+	}
+	block, notify := m.complete(header)
+	m.mu.Unlock()
+	notify()
+	return block, nil
+}
+
+// complete makes a begun tree visible and records its metadata.
+func (m *Memory) complete(header *schema.FileTreeHeader) (uint64, func()) {
+	metadata := &schema.FileMetadata{
+		DocType:     "file",
+		FileHash:    header.FileHash,
+		Size:        header.FileSize,
+		CreatedAt:   m.now().Format(time.RFC3339),
+		Tags:        header.Metadata.Tags,
+		ContentType: header.Metadata.ContentType,
+	}
+	if metadata.Tags == nil {
+		metadata.Tags = []string{}
+	}
+	header.Complete = true
+	header.Metadata = nil
+	m.metadata[header.FileHash] = metadata
+	return m.commit(schema.StoreFileTreeEvent, schema.FileEvent{FileHash: header.FileHash})
+}
+
+func (m *Memory) DeleteFileTree(fileHash string) (*schema.DeletedFile, error) {
+	m.mu.Lock()
+	header, ok := m.headers[fileHash]
+	if !ok {
+		m.mu.Unlock()
+		return nil, classify(fmt.Errorf("FileTree does not exist"))
+	}
+	if err := m.checkDeletable(header, m.now().Format(time.RFC3339)); err != nil {
+		m.mu.Unlock()
+		return nil, err
+	}
+	deleted, notify := m.delete(fileHash)
+	m.mu.Unlock()
+	notify()
+	return deleted, nil
+}
+
+func (m *Memory) ExpireFile(fileHash string) (*schema.DeletedFile, error) {
+	m.mu.Lock()
+	header, ok := m.headers[fileHash]
+	if !ok {
+		m.mu.Unlock()
+		return nil, classify(fmt.Errorf("FileTree does not exist"))
+	}
+	now := m.now().Format(time.RFC3339)
+	if header.ExpireAt == "" || header.ExpireAt > now {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("file %s has not expired", fileHash)
+	}
+	if err := m.checkDeletable(header, now); err != nil {
+		m.mu.Unlock()
+		return nil, err
+	}
+	deleted, notify := m.delete(fileHash)
+	m.mu.Unlock()
+	notify()
+	return deleted, nil
+}
+
+// checkDeletable fails while a file is retained or an object points to it,
+// as in the chaincode.
+func (m *Memory) checkDeletable(header *schema.FileTreeHeader, now string) error {
+	if header.RetainUntil > now {
+		return classify(fmt.Errorf("file %s is retained until %s", header.FileHash, header.RetainUntil))
+	}
+	if referrer := m.referrer(header.FileHash); referrer != "" {
+		return classify(fmt.Errorf("file %s is referenced by %s", header.FileHash, referrer))
+	}
+	return nil
+}
+
+// referrer returns the first object pointing to a file, or nothing when no
+// object does.
+func (m *Memory) referrer(fileHash string) string {
+	var referrers []string
+	for bucket, objects := range m.objects {
+		for key, object := range objects {
+			if object.FileHash == fileHash {
+				referrers = append(referrers, "object "+bucket+"/"+key)
+			}
+		}
+	}
+	if len(referrers) == 0 {
+		return ""
+	}
+	sort.Strings(referrers)
+	return referrers[0]
+}
+
+// delete removes a file and returns its stripes and chunks that no other
+// file holds, as the chaincode does.
+func (m *Memory) delete(fileHash string) (*schema.DeletedFile, func()) {
+	deleted := &schema.DeletedFile{FileHash: fileHash, Stripes: []schema.StripeTree{}, SharedChunks: []string{}}
+	stripes := m.stripes[fileHash]
+	delete(m.headers, fileHash)
+	delete(m.stripes, fileHash)
+	delete(m.metadata, fileHash)
+
+	referenced := make(map[string]bool)
+	for _, other := range m.stripes {
+		for _, stripe := range other {
+			referenced[stripe.StripeHash] = true
+			for _, chunk := range stripe.ChunkHashes {
+				referenced[chunk.ChunkHash] = true
+			}
+		}
+	}
+	seen := make(map[string]bool)
+	for _, stripe := range stripes {
+		if stripe.StripeHash == "" || seen[stripe.StripeHash] || referenced[stripe.StripeHash] {
+			continue
+		}
+		seen[stripe.StripeHash] = true
+		deleted.Stripes = append(deleted.Stripes, stripe)
+		for _, chunk := range stripe.ChunkHashes {
+			if referenced[chunk.ChunkHash] && !seen[chunk.ChunkHash] {
+				deleted.SharedChunks = append(deleted.SharedChunks, chunk.ChunkHash)
+			}
+			seen[chunk.ChunkHash] = true
+		}
+	}
+	_, notify := m.commit(schema.DeleteFileTreeEvent, schema.FileEvent{FileHash: fileHash})
+	return deleted, notify
+}
+
+func (m *Memory) CreateBucket(name string) (uint64, error) {
+	if err := validateBucketName(name); err != nil {
+		return 0, classify(err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.buckets[name]; ok {
+		return 0, fmt.Errorf("bucket %s already exists", name)
+	}
+	m.buckets[name] = &schema.Bucket{Name: name, Owner: m.MSPID, CreatedAt: m.now().Format(time.RFC3339)}
+	m.objects[name] = make(map[string]*schema.Object)
+	block, _ := m.commit("", nil)
+	return block, nil
+}
+
+func (m *Memory) DeleteBucket(name string) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkOwner(name); err != nil {
+		return 0, err
+	}
+	if len(m.objects[name]) > 0 {
+		return 0, fmt.Errorf("bucket %s is not empty", name)
+	}
+	delete(m.buckets, name)
+	delete(m.objects, name)
+	block, _ := m.commit("", nil)
+	return block, nil
+}
+
+func (m *Memory) GetBucket(name string) (*schema.Bucket, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	bucket, ok := m.buckets[name]
+	if !ok {
+		return nil, nil
+	}
+	copied := *bucket
+	return &copied, nil
+}
+
+func (m *Memory) ListBuckets() ([]*schema.Bucket, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	buckets := make([]*schema.Bucket, 0, len(m.buckets))
+	for _, bucket := range m.buckets {
+		copied := *bucket
+		buckets = append(buckets, &copied)
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Name < buckets[j].Name })
+	return buckets, nil
+}
+
+func (m *Memory) PutObject(bucket string, key string, object *schema.ObjectInput) (uint64, error) {
+	m.mu.Lock()
+	if err := m.checkOwner(bucket); err != nil {
+		m.mu.Unlock()
+		return 0, err
+	}
+	if key == "" {
+		m.mu.Unlock()
+		return 0, fmt.Errorf("object key must not be empty")
+	}
+	header, ok := m.headers[object.FileHash]
+	if !ok || !header.Complete {
+		m.mu.Unlock()
+		return 0, classify(fmt.Errorf("file %s does not exist", object.FileHash))
+	}
+	if header.FileSize != object.Size {
+		m.mu.Unlock()
+		return 0, fmt.Errorf("object of %d bytes stored as file %s of %d bytes", object.Size, object.FileHash, header.FileSize)
+	}
+	m.objects[bucket][key] = &schema.Object{
+		Bucket:       bucket,
+		Key:          key,
+		FileHash:     object.FileHash,
+		Size:         object.Size,
+		ETag:         object.ETag,
+		ContentType:  object.ContentType,
+		Metadata:     object.Metadata,
+		LastModified: m.now().Format(time.RFC3339),
+	}
+	block, notify := m.commit(schema.PutObjectEvent, schema.ObjectEvent{Bucket: bucket, Key: key, FileHash: object.FileHash})
+	m.mu.Unlock()
+	notify()
+	return block, nil
+}
+
+func (m *Memory) GetObject(bucket string, key string) (*schema.Object, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	object, ok := m.objects[bucket][key]
+	if !ok {
+		return nil, nil
+	}
+	copied := *object
+	return &copied, nil
+}
+
+// DeleteObject succeeds for a key mapping to no object, like in S3.
+func (m *Memory) DeleteObject(bucket string, key string) (uint64, error) {
+	m.mu.Lock()
+	if err := m.checkOwner(bucket); err != nil {
+		m.mu.Unlock()
+		return 0, err
+	}
+	object, ok := m.objects[bucket][key]
+	if !ok {
+		block, _ := m.commit("", nil)
+		m.mu.Unlock()
+		return block, nil
+	}
+	delete(m.objects[bucket], key)
+	block, notify := m.commit(schema.DeleteObjectEvent, schema.ObjectEvent{Bucket: bucket, Key: key, FileHash: object.FileHash})
+	m.mu.Unlock()
+	notify()
+	return block, nil
+}
+
+func (m *Memory) ListObjects(bucket string, prefix string, startAfter string, maxKeys int) (*schema.ObjectPage, error) {
+	if maxKeys <= 0 || maxKeys > 1000 {
+		return nil, fmt.Errorf("maxKeys must be between 1 and 1000")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	objects, ok := m.objects[bucket]
+	if !ok {
+		return nil, classify(fmt.Errorf("bucket %s does not exist", bucket))
+	}
+	keys := make([]string, 0, len(objects))
+	for key := range objects {
+		if key > startAfter && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	page := &schema.ObjectPage{Objects: make([]*schema.Object, 0)}
+	if len(keys) > maxKeys {
+		keys = keys[:maxKeys]
+		page.IsTruncated = true
+	}
+	for _, key := range keys {
+		copied := *objects[key]
+		page.Objects = append(page.Objects, &copied)
+	}
+	return page, nil
+}
+
+// checkOwner checks that the bucket exists and the client owns it, as the
+// chaincode does before changing a bucket.
+func (m *Memory) checkOwner(name string) error {
+	bucket, ok := m.buckets[name]
+	if !ok {
+		return classify(fmt.Errorf("bucket %s does not exist", name))
+	}
+	if bucket.Owner != m.MSPID {
+		return classify(fmt.Errorf("bucket %s is owned by %s", name, bucket.Owner))
+	}
+	return nil
+}
+
+// validateBucketName applies the naming rules of S3 like the chaincode.
+func validateBucketName(name string) error {
+	if len(name) < 3 || len(name) > 63 {
+		return fmt.Errorf("invalid bucket name %q: must be 3 to 63 characters long", name)
+	}
+	for i, c := range name {
+		alnum := (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9')
+		if !alnum && ((c != '.' && c != '-') || i == 0 || i == len(name)-1) {
+			return fmt.Errorf("invalid bucket name %q", name)
+		}
+	}
+	return nil
+}
+
+// formatTimestamp normalizes an RFC 3339 timestamp to UTC, so timestamps
+// compare like the times they name.
+func formatTimestamp(name string, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s %q: %v", name, value, err)
+	}
+	return t.UTC().Format(time.RFC3339), nil
+}
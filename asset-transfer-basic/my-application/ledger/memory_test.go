@@ -0,0 +1,260 @@
+package ledger
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/schema"
+)
+
+func testTree(fileHash string, stripes int) *schema.FileTree {
+	tree := &schema.FileTree{FileHash: fileHash, FileSize: int64(stripes) * 100, Codec: "rs-6-3"}
+	for i := 0; i < stripes; i++ {
+		tree.StripeHashes = append(tree.StripeHashes, schema.StripeTree{
+			StripeHash:  fileHash + "-stripe",
+			ChunkHashes: []schema.Chunk{{ChunkHash: fileHash + "-chunk"}},
+		})
+	}
+	return tree
+}
+
+func TestMemoryFileTrees(t *testing.T) {
+	m := NewMemory()
+	m.SegmentSize = 2
+	var events []string
+	m.OnEvent = func(name string, payload []byte) {
+		events = append(events, name+" "+string(payload))
+	}
+
+	tree := testTree("a", 3)
+	if _, err := m.StoreFileTree(tree, &schema.FileMetadataInput{Tags: []string{"x"}}); err != nil {
+		t.Fatalf("StoreFileTree failed: %v", err)
+	}
+	got, err := m.GetFileTree("a")
+	if err != nil || !reflect.DeepEqual(got, tree) {
+		t.Fatalf("GetFileTree returned %+v, %v, want %+v", got, err, tree)
+	}
+	metadata, err := m.GetFileMetadata("a")
+	if err != nil || metadata.Size != tree.FileSize || !reflect.DeepEqual(metadata.Tags, []string{"x"}) {
+		t.Fatalf("GetFileMetadata returned %+v, %v", metadata, err)
+	}
+
+	// A tree stored in segments is invisible until committed with all of them
+	tree = testTree("b", 3)
+	header, err := m.BeginFileTree("b", tree.FileSize, 3, tree.Codec, 0, nil)
+	if err != nil || header.Segments != 2 {
+		t.Fatalf("BeginFileTree returned %+v, %v, want 2 segments", header, err)
+	}
+	if _, err := m.StoreFileTreeSegment("b", &schema.FileTreeSegment{Index: 0, StripeHashes: tree.StripeHashes[:2]}); err != nil {
+		t.Fatalf("StoreFileTreeSegment failed: %v", err)
+	}
+	if _, err := m.CommitFileTree("b"); err == nil || !strings.Contains(err.Error(), "missing segment 1") {
+		t.Fatalf("CommitFileTree of a partial tree returned %v", err)
+	}
+	if _, err := m.GetFileTree("b"); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Fatalf("GetFileTree of an uncommitted tree returned %v", err)
+	}
+	if _, err := m.StoreFileTreeSegment("b", &schema.FileTreeSegment{Index: 1, StripeHashes: tree.StripeHashes[2:]}); err != nil {
+		t.Fatalf("StoreFileTreeSegment failed: %v", err)
+	}
+	if _, err := m.CommitFileTree("b"); err != nil {
+		t.Fatalf("CommitFileTree failed: %v", err)
+	}
+	if got, err := m.GetFileTree("b"); err != nil || !reflect.DeepEqual(got, tree) {
+		t.Fatalf("GetFileTree returned %+v, %v, want %+v", got, err, tree)
+	}
+
+	// Beginning a stored file returns it, leaving nothing to store
+	header, err = m.BeginFileTree("a", 300, 3, "rs-6-3", 0, &schema.FileMetadataInput{Tags: []string{"y"}})
+	if err != nil || !header.Complete {
+		t.Fatalf("BeginFileTree of a stored file returned %+v, %v", header, err)
+	}
+	if metadata, _ := m.GetFileMetadata("a"); !reflect.DeepEqual(metadata.Tags, []string{"x"}) {
+		t.Fatalf("metadata of a stored file changed to %+v", metadata)
+	}
+
+	want := []string{`StoreFileTree {"fileHash":"a"}`, `StoreFileTree {"fileHash":"b"}`}
+	if !reflect.DeepEqual(events, want) {
+		t.Fatalf("events %v, want %v", events, want)
+	}
+}
+
+func TestMemoryRetention(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := NewMemory()
+	m.Now = func() time.Time { return now }
+
+	retained := &schema.FileMetadataInput{RetainUntil: "2024-01-01T02:00:00+01:00", ExpireAt: "2024-01-01T03:00:00Z"}
+	if _, err := m.StoreFileTree(testTree("a", 1), retained); err != nil {
+		t.Fatalf("StoreFileTree failed: %v", err)
+	}
+	if _, err := m.StoreFileTree(testTree("b", 1), &schema.FileMetadataInput{ExpireAt: "2024-01-01T02:00:00Z"}); err != nil {
+		t.Fatalf("StoreFileTree failed: %v", err)
+	}
+	// Storing again keeps the retention, which can only be extended
+	if _, err := m.StoreFileTree(testTree("a", 1), nil); err != nil {
+		t.Fatalf("StoreFileTree failed: %v", err)
+	}
+	if _, err := m.StoreFileTree(testTree("a", 1), &schema.FileMetadataInput{RetainUntil: "2024-01-01T00:30:00Z"}); err == nil || !strings.Contains(err.Error(), "cannot be shortened") {
+		t.Fatalf("StoreFileTree shortening the retention returned %v", err)
+	}
+
+	if _, err := m.DeleteFileTree("a"); !errors.Is(err, ErrRetained) || !strings.Contains(err.Error(), "is retained until 2024-01-01T01:00:00Z") {
+		t.Fatalf("DeleteFileTree of a retained file returned %v", err)
+	}
+	if _, err := m.ExpireFile("b"); err == nil || !strings.Contains(err.Error(), "has not expired") {
+		t.Fatalf("ExpireFile of an unexpired file returned %v", err)
+	}
+
+	now = now.Add(4 * time.Hour)
+	expired, err := m.ListExpiredFiles(10)
+	if err != nil || !reflect.DeepEqual(expired, []string{"b", "a"}) {
+		t.Fatalf("ListExpiredFiles returned %v, %v, want oldest expiry first", expired, err)
+	}
+	for _, fileHash := range expired {
+		if _, err := m.ExpireFile(fileHash); err != nil {
+			t.Fatalf("ExpireFile failed: %v", err)
+		}
+	}
+	if expired, _ := m.ListExpiredFiles(10); len(expired) != 0 {
+		t.Fatalf("ListExpiredFiles returned %v after expiry", expired)
+	}
+	if _, err := m.GetFileMetadata("a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetFileMetadata of an expired file returned %v", err)
+	}
+}
+
+func TestMemoryDeleteSharedStripes(t *testing.T) {
+	m := NewMemory()
+	a, b := testTree("a", 2), testTree("b", 1)
+	a.StripeHashes[1] = b.StripeHashes[0]
+	for _, tree := range []*schema.FileTree{a, b} {
+		if _, err := m.StoreFileTree(tree, nil); err != nil {
+			t.Fatalf("StoreFileTree failed: %v", err)
+		}
+	}
+
+	deleted, err := m.DeleteFileTree("a")
+	if err != nil || !reflect.DeepEqual(deleted.Stripes, a.StripeHashes[:1]) {
+		t.Fatalf("DeleteFileTree returned %+v, %v, want the stripe only a holds", deleted, err)
+	}
+	deleted, err = m.DeleteFileTree("b")
+	if err != nil || !reflect.DeepEqual(deleted.Stripes, b.StripeHashes) {
+		t.Fatalf("DeleteFileTree returned %+v, %v, want the stripe of b", deleted, err)
+	}
+}
+
+func TestMemoryHashSlotTable(t *testing.T) {
+	m := NewMemory()
+	if _, err := m.GetHashSlotTable(); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetHashSlotTable of a new ledger returned %v", err)
+	}
+	if _, err := m.CreateHashSlotTable(); err == nil {
+		t.Fatal("CreateHashSlotTable without orgs succeeded")
+	}
+
+	for orgID, weight := range map[string]int{"node0": 100, "node1": 100, "node2": 10} {
+		if _, err := m.UpdateOrgWeight(orgID, weight); err != nil {
+			t.Fatalf("UpdateOrgWeight failed: %v", err)
+		}
+	}
+	if _, err := m.RemoveOrg("node2"); err != nil {
+		t.Fatalf("RemoveOrg failed: %v", err)
+	}
+	if _, err := m.RemoveOrg("node2"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("RemoveOrg of a removed org returned %v", err)
+	}
+	if _, err := m.CreateHashSlotTable(); err != nil {
+		t.Fatalf("CreateHashSlotTable failed: %v", err)
+	}
+
+	got, err := m.GetHashSlotTable()
+	if err != nil {
+		t.Fatalf("GetHashSlotTable failed: %v", err)
+	}
+	want, _ := schema.AllocateSlots(map[string]int{"node0": 100, "node1": 100})
+	want.Epoch = 1
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("GetHashSlotTable returned %+v, want %+v", got, want)
+	}
+
+	// A new table takes the next epoch, the one it replaces stays readable
+	if _, err := m.UpdateOrgWeight("node1", 300); err != nil {
+		t.Fatalf("UpdateOrgWeight failed: %v", err)
+	}
+	if _, err := m.CreateHashSlotTable(); err != nil {
+		t.Fatalf("CreateHashSlotTable failed: %v", err)
+	}
+	if got, err := m.GetHashSlotTable(); err != nil || got.Epoch != 2 {
+		t.Fatalf("GetHashSlotTable returned %+v, %v", got, err)
+	}
+	if got, err := m.GetHashSlotTableByEpoch(1); err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("GetHashSlotTableByEpoch returned %+v, %v, want %+v", got, err, want)
+	}
+	if _, err := m.GetHashSlotTableByEpoch(3); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetHashSlotTableByEpoch of a missing epoch returned %v", err)
+	}
+	if _, err := m.BeginFileTree("a", 300, 3, "rs-6-3", 3, nil); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("BeginFileTree with a missing epoch returned %v", err)
+	}
+}
+
+func TestMemoryObjects(t *testing.T) {
+	m := NewMemory()
+	if _, err := m.CreateBucket("No"); !errors.Is(err, ErrInvalidBucketName) {
+		t.Fatalf("CreateBucket of an invalid name returned %v", err)
+	}
+	if _, err := m.CreateBucket("photos"); err != nil {
+		t.Fatalf("CreateBucket failed: %v", err)
+	}
+	if bucket, err := m.GetBucket("photos"); err != nil || bucket.Owner != "Org1MSP" {
+		t.Fatalf("GetBucket returned %+v, %v", bucket, err)
+	}
+	if bucket, err := m.GetBucket("missing"); err != nil || bucket != nil {
+		t.Fatalf("GetBucket of a missing bucket returned %+v, %v", bucket, err)
+	}
+
+	tree := testTree("a", 1)
+	object := &schema.ObjectInput{FileHash: "a", Size: tree.FileSize}
+	if _, err := m.PutObject("photos", "x", object); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("PutObject of a missing file returned %v", err)
+	}
+	if _, err := m.StoreFileTree(tree, nil); err != nil {
+		t.Fatalf("StoreFileTree failed: %v", err)
+	}
+	for _, key := range []string{"x/2", "x/1", "y"} {
+		if _, err := m.PutObject("photos", key, object); err != nil {
+			t.Fatalf("PutObject failed: %v", err)
+		}
+	}
+	if _, err := m.DeleteFileTree("a"); !errors.Is(err, ErrReferenced) || !strings.Contains(err.Error(), "referenced by object photos/x/1") {
+		t.Fatalf("DeleteFileTree of a referenced file returned %v", err)
+	}
+	page, err := m.ListObjects("photos", "x/", "", 1)
+	if err != nil || len(page.Objects) != 1 || page.Objects[0].Key != "x/1" || !page.IsTruncated {
+		t.Fatalf("ListObjects returned %+v, %v, want x/1 of a truncated page", page, err)
+	}
+
+	m.MSPID = "Org2MSP"
+	if _, err := m.DeleteObject("photos", "y"); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("DeleteObject of another MSP returned %v", err)
+	}
+	m.MSPID = "Org1MSP"
+	if _, err := m.DeleteBucket("photos"); err == nil || !strings.Contains(err.Error(), "not empty") {
+		t.Fatalf("DeleteBucket of a bucket with objects returned %v", err)
+	}
+	for _, key := range []string{"x/1", "x/2", "y", "y"} {
+		if _, err := m.DeleteObject("photos", key); err != nil {
+			t.Fatalf("DeleteObject failed: %v", err)
+		}
+	}
+	if _, err := m.DeleteBucket("photos"); err != nil {
+		t.Fatalf("DeleteBucket failed: %v", err)
+	}
+	if _, err := m.DeleteFileTree("a"); err != nil {
+		t.Fatalf("DeleteFileTree of an unreferenced file failed: %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package ledger
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/schema"
+)
+
+// SaveFileTree records the tree of a stored file on the ledger and returns
+// the block it was committed in. The tree is stored in a single StoreFileTree
+// transaction if its JSON fits in maxTransaction bytes, and a segment per
+// transaction between BeginFileTree and CommitFileTree otherwise, unless
+// BeginFileTree finds the file stored already, which returns block 0.
+func SaveFileTree(c Client, tree *schema.FileTree, metadata *schema.FileMetadataInput, maxTransaction int) (uint64, error) {
+	treeJSON, err := json.Marshal(tree)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal file tree: %v", err)
+	}
+	if len(treeJSON) <= maxTransaction {
+		return c.StoreFileTree(tree, metadata)
+	}
+
+	header, err := c.BeginFileTree(tree.FileHash, tree.FileSize, len(tree.StripeHashes), tree.Codec, tree.SlotTableEpoch, metadata)
+	if err != nil {
+		return 0, err
+	}
+	if header.Complete {
+		return 0, nil
+	}
+
+	// Segments are independent keys, so they are all submitted at once
+	var segments []schema.FileTreeSegment
+	for start := 0; start < len(tree.StripeHashes); start += header.SegmentSize {
+		end := min(start+header.SegmentSize, len(tree.StripeHashes))
+		segments = append(segments, schema.FileTreeSegment{
+			Index:        len(segments),
+			StripeHashes: tree.StripeHashes[start:end],
+		})
+	}
+	errs := make([]error, len(segments))
+	var wg sync.WaitGroup
+	for i := range segments {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = c.StoreFileTreeSegment(tree.FileHash, &segments[i])
+		}(i)
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return 0, err
+	}
+
+	return c.CommitFileTree(tree.FileHash)
+}
@@ -0,0 +1,61 @@
+package ledger
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/schema"
+)
+
+// recordingLedger records the transactions storing file trees.
+type recordingLedger struct {
+	*Memory
+	calls []string
+}
+
+func (l *recordingLedger) StoreFileTree(tree *schema.FileTree, metadata *schema.FileMetadataInput) (uint64, error) {
+	l.calls = append(l.calls, "StoreFileTree")
+	return l.Memory.StoreFileTree(tree, metadata)
+}
+
+func (l *recordingLedger) BeginFileTree(fileHash string, fileSize int64, stripes int, codec string, slotTableEpoch int, metadata *schema.FileMetadataInput) (*schema.FileTreeHeader, error) {
+	l.calls = append(l.calls, "BeginFileTree")
+	return l.Memory.BeginFileTree(fileHash, fileSize, stripes, codec, slotTableEpoch, metadata)
+}
+
+func (l *recordingLedger) CommitFileTree(fileHash string) (uint64, error) {
+	l.calls = append(l.calls, "CommitFileTree")
+	return l.Memory.CommitFileTree(fileHash)
+}
+
+func TestSaveFileTree(t *testing.T) {
+	tree := testTree("a", 9)
+	for _, test := range []struct {
+		name           string
+		maxTransaction int
+		calls          []string
+	}{
+		{"single transaction", 1024 * 1024, []string{"StoreFileTree"}},
+		{"segments", 100, []string{"BeginFileTree", "CommitFileTree"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m := &recordingLedger{Memory: NewMemory()}
+			m.SegmentSize = 4
+
+			if _, err := SaveFileTree(m, tree, nil, test.maxTransaction); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(m.calls, test.calls) {
+				t.Errorf("calls %v, want %v", m.calls, test.calls)
+			}
+			if got, err := m.GetFileTree("a"); err != nil || !reflect.DeepEqual(got, tree) {
+				t.Errorf("GetFileTree returned %+v, %v, want %+v", got, err, tree)
+			}
+
+			// A stored file is left as it is
+			if block, err := SaveFileTree(m, tree, nil, 100); err != nil || block != 0 {
+				t.Errorf("saving a stored tree returned block %d, %v", block, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+// Package metrics holds the Prometheus collectors shared by the storage
+// services and serves them on /metrics.
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const namespace = "dss"
+
+var (
+	RPCRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rpc_requests_total",
+		Help:      "Number of gRPC requests handled, by method and status code.",
+	}, []string{"method", "code"})
+
+	RPCDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rpc_duration_seconds",
+		Help:      "Latency of gRPC requests, by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	BytesStored = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "stored_bytes_total",
+		Help:      "Number of bytes accepted for storage.",
+	})
+
+	BytesServed = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "served_bytes_total",
+		Help:      "Number of bytes returned to readers.",
+	})
+
+	EncodeDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "stripe_encode_duration_seconds",
+		Help:      "Time spent erasure coding one stripe.",
+		Buckets:   prometheus.ExponentialBuckets(0.00001, 4, 10),
+	})
+
+	DecodeDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "stripe_decode_duration_seconds",
+		Help:      "Time spent joining or reconstructing one stripe.",
+		Buckets:   prometheus.ExponentialBuckets(0.00001, 4, 10),
+	})
+
+	ChaincodeDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "chaincode_duration_seconds",
+		Help:      "Latency of chaincode evaluations and submissions, by function.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"function"})
+
+	ForwardingHops = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "forwarding_hops_total",
+		Help:      "Number of chunk reads forwarded to another node through a link.",
+	})
+
+	CacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "chunk_cache_lookups_total",
+		Help:      "Number of chunk cache lookups, by result (hit or miss).",
+	}, []string{"result"})
+
+	CacheEvictions = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "chunk_cache_evictions_total",
+		Help:      "Number of chunks evicted from the chunk cache.",
+	})
+
+	FaultsInjected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "faults_injected_total",
+		Help:      "Number of faults injected by chaos mode, by kind (latency, drop, corrupt, loss or lose_chunks).",
+	}, []string{"kind"})
+)
+
+// ObserveChaincode records the latency of a chaincode call started at start.
+func ObserveChaincode(function string, start time.Time) {
+	ChaincodeDuration.WithLabelValues(function).Observe(time.Since(start).Seconds())
+}
+
+// UnaryServerInterceptor counts and times every unary RPC and logs it with
+// the address of the calling peer.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		elapsed := time.Since(start)
+
+		code := status.Code(err)
+		RPCRequests.WithLabelValues(info.FullMethod, code.String()).Inc()
+		RPCDuration.WithLabelValues(info.FullMethod).Observe(elapsed.Seconds())
+
+		attrs := []any{"method", info.FullMethod, "code", code.String(), "duration", elapsed}
+		if p, ok := peer.FromContext(ctx); ok {
+			attrs = append(attrs, "peer", p.Addr.String())
+		}
+		if err != nil {
+			slog.Warn("rpc failed", append(attrs, "err", err)...)
+		} else {
+			slog.Debug("rpc handled", attrs...)
+		}
+		return resp, err
+	}
+}
+
+// Serve exposes the default Prometheus registry on addr under /metrics. It
+// does nothing when addr is empty.
+func Serve(addr string) {
+	if addr == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	go func() {
+		slog.Info("serving metrics", "addr", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			slog.Error("metrics server stopped", "addr", addr, "err", err)
+		}
+	}()
+}
@@ -25,6 +25,9 @@ type ChunkStorageClient interface {
 	StoreChunk(ctx context.Context, in *ChunkStorageRequest, opts ...grpc.CallOption) (*ChunkStorageResponse, error)
 	GetChunk(ctx context.Context, in *ChunkRequest, opts ...grpc.CallOption) (*ChunkResponse, error)
 	StoreLink(ctx context.Context, in *LinkStorageRequest, opts ...grpc.CallOption) (*LinkStorageResponse, error)
+	DeleteChunk(ctx context.Context, in *ChunkDeletionRequest, opts ...grpc.CallOption) (*ChunkDeletionResponse, error)
+	SetFaults(ctx context.Context, in *FaultConfig, opts ...grpc.CallOption) (*FaultConfig, error)
+	LoseChunks(ctx context.Context, in *LoseChunksRequest, opts ...grpc.CallOption) (*LoseChunksResponse, error)
 }
 
 type chunkStorageClient struct {
@@ -62,6 +65,33 @@ func (c *chunkStorageClient) StoreLink(ctx context.Context, in *LinkStorageReque
 	return out, nil
 }
 
+func (c *chunkStorageClient) DeleteChunk(ctx context.Context, in *ChunkDeletionRequest, opts ...grpc.CallOption) (*ChunkDeletionResponse, error) {
+	out := new(ChunkDeletionResponse)
+	err := c.cc.Invoke(ctx, "/messages.ChunkStorage/DeleteChunk", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chunkStorageClient) SetFaults(ctx context.Context, in *FaultConfig, opts ...grpc.CallOption) (*FaultConfig, error) {
+	out := new(FaultConfig)
+	err := c.cc.Invoke(ctx, "/messages.ChunkStorage/SetFaults", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chunkStorageClient) LoseChunks(ctx context.Context, in *LoseChunksRequest, opts ...grpc.CallOption) (*LoseChunksResponse, error) {
+	out := new(LoseChunksResponse)
+	err := c.cc.Invoke(ctx, "/messages.ChunkStorage/LoseChunks", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ChunkStorageServer is the server API for ChunkStorage service.
 // All implementations must embed UnimplementedChunkStorageServer
 // for forward compatibility
@@ -69,6 +99,9 @@ type ChunkStorageServer interface {
 	StoreChunk(context.Context, *ChunkStorageRequest) (*ChunkStorageResponse, error)
 	GetChunk(context.Context, *ChunkRequest) (*ChunkResponse, error)
 	StoreLink(context.Context, *LinkStorageRequest) (*LinkStorageResponse, error)
+	DeleteChunk(context.Context, *ChunkDeletionRequest) (*ChunkDeletionResponse, error)
+	SetFaults(context.Context, *FaultConfig) (*FaultConfig, error)
+	LoseChunks(context.Context, *LoseChunksRequest) (*LoseChunksResponse, error)
 	mustEmbedUnimplementedChunkStorageServer()
 }
 
@@ -85,6 +118,15 @@ func (UnimplementedChunkStorageServer) GetChunk(context.Context, *ChunkRequest)
 func (UnimplementedChunkStorageServer) StoreLink(context.Context, *LinkStorageRequest) (*LinkStorageResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method StoreLink not implemented")
 }
+func (UnimplementedChunkStorageServer) DeleteChunk(context.Context, *ChunkDeletionRequest) (*ChunkDeletionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteChunk not implemented")
+}
+func (UnimplementedChunkStorageServer) SetFaults(context.Context, *FaultConfig) (*FaultConfig, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetFaults not implemented")
+}
+func (UnimplementedChunkStorageServer) LoseChunks(context.Context, *LoseChunksRequest) (*LoseChunksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LoseChunks not implemented")
+}
 func (UnimplementedChunkStorageServer) mustEmbedUnimplementedChunkStorageServer() {}
 
 // UnsafeChunkStorageServer may be embedded to opt out of forward compatibility for this service.
@@ -152,6 +194,60 @@ func _ChunkStorage_StoreLink_Handler(srv interface{}, ctx context.Context, dec f
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ChunkStorage_DeleteChunk_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChunkDeletionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChunkStorageServer).DeleteChunk(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/messages.ChunkStorage/DeleteChunk",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChunkStorageServer).DeleteChunk(ctx, req.(*ChunkDeletionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChunkStorage_SetFaults_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FaultConfig)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChunkStorageServer).SetFaults(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/messages.ChunkStorage/SetFaults",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChunkStorageServer).SetFaults(ctx, req.(*FaultConfig))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChunkStorage_LoseChunks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LoseChunksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChunkStorageServer).LoseChunks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/messages.ChunkStorage/LoseChunks",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChunkStorageServer).LoseChunks(ctx, req.(*LoseChunksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // ChunkStorage_ServiceDesc is the grpc.ServiceDesc for ChunkStorage service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -171,6 +267,18 @@ var ChunkStorage_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "StoreLink",
 			Handler:    _ChunkStorage_StoreLink_Handler,
 		},
+		{
+			MethodName: "DeleteChunk",
+			Handler:    _ChunkStorage_DeleteChunk_Handler,
+		},
+		{
+			MethodName: "SetFaults",
+			Handler:    _ChunkStorage_SetFaults_Handler,
+		},
+		{
+			MethodName: "LoseChunks",
+			Handler:    _ChunkStorage_LoseChunks_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "chunk_storage.proto",
@@ -23,6 +23,8 @@ const _ = grpc.SupportPackageIsVersion7
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type FilePartitionClient interface {
 	PartitionFile(ctx context.Context, in *FilePartitionRequest, opts ...grpc.CallOption) (*FilePartitionResponse, error)
+	ReadFile(ctx context.Context, in *FileRequest, opts ...grpc.CallOption) (*FileResponse, error)
+	DeleteFile(ctx context.Context, in *FileDeletionRequest, opts ...grpc.CallOption) (*FileDeletionResponse, error)
 }
 
 type filePartitionClient struct {
@@ -42,11 +44,31 @@ func (c *filePartitionClient) PartitionFile(ctx context.Context, in *FilePartiti
 	return out, nil
 }
 
+func (c *filePartitionClient) ReadFile(ctx context.Context, in *FileRequest, opts ...grpc.CallOption) (*FileResponse, error) {
+	out := new(FileResponse)
+	err := c.cc.Invoke(ctx, "/messages.FilePartition/ReadFile", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *filePartitionClient) DeleteFile(ctx context.Context, in *FileDeletionRequest, opts ...grpc.CallOption) (*FileDeletionResponse, error) {
+	out := new(FileDeletionResponse)
+	err := c.cc.Invoke(ctx, "/messages.FilePartition/DeleteFile", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // FilePartitionServer is the server API for FilePartition service.
 // All implementations must embed UnimplementedFilePartitionServer
 // for forward compatibility
 type FilePartitionServer interface {
 	PartitionFile(context.Context, *FilePartitionRequest) (*FilePartitionResponse, error)
+	ReadFile(context.Context, *FileRequest) (*FileResponse, error)
+	DeleteFile(context.Context, *FileDeletionRequest) (*FileDeletionResponse, error)
 	mustEmbedUnimplementedFilePartitionServer()
 }
 
@@ -57,6 +79,12 @@ type UnimplementedFilePartitionServer struct {
 func (UnimplementedFilePartitionServer) PartitionFile(context.Context, *FilePartitionRequest) (*FilePartitionResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method PartitionFile not implemented")
 }
+func (UnimplementedFilePartitionServer) ReadFile(context.Context, *FileRequest) (*FileResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReadFile not implemented")
+}
+func (UnimplementedFilePartitionServer) DeleteFile(context.Context, *FileDeletionRequest) (*FileDeletionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteFile not implemented")
+}
 func (UnimplementedFilePartitionServer) mustEmbedUnimplementedFilePartitionServer() {}
 
 // UnsafeFilePartitionServer may be embedded to opt out of forward compatibility for this service.
@@ -88,6 +116,42 @@ func _FilePartition_PartitionFile_Handler(srv interface{}, ctx context.Context,
 	return interceptor(ctx, in, info, handler)
 }
 
+func _FilePartition_ReadFile_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FileRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FilePartitionServer).ReadFile(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/messages.FilePartition/ReadFile",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FilePartitionServer).ReadFile(ctx, req.(*FileRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FilePartition_DeleteFile_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FileDeletionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FilePartitionServer).DeleteFile(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/messages.FilePartition/DeleteFile",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FilePartitionServer).DeleteFile(ctx, req.(*FileDeletionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // FilePartition_ServiceDesc is the grpc.ServiceDesc for FilePartition service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -99,6 +163,14 @@ var FilePartition_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "PartitionFile",
 			Handler:    _FilePartition_PartitionFile_Handler,
 		},
+		{
+			MethodName: "ReadFile",
+			Handler:    _FilePartition_ReadFile_Handler,
+		},
+		{
+			MethodName: "DeleteFile",
+			Handler:    _FilePartition_DeleteFile_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "file_partition.proto",
@@ -0,0 +1,161 @@
+package s3gateway
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	signingAlgorithm = "AWS4-HMAC-SHA256"
+	amzDateFormat    = "20060102T150405Z"
+	// maxClockSkew is how far the date of a request may be from the clock
+	// of the gateway.
+	maxClockSkew = 15 * time.Minute
+)
+
+// authenticate checks the AWS Signature Version 4 of the Authorization
+// header of a request. Presigned URLs are not supported.
+func (g *Gateway) authenticate(r *http.Request) error {
+	if g.Credentials == nil {
+		return nil
+	}
+	authorization := r.Header.Get("Authorization")
+	if authorization == "" {
+		return errAccessDenied.withMessage("The request is not signed.")
+	}
+	algorithm, fields, _ := strings.Cut(authorization, " ")
+	if algorithm != signingAlgorithm {
+		return errMalformedAuth.withMessage("Unsupported signing algorithm %q.", algorithm)
+	}
+	params := make(map[string]string)
+	for _, field := range strings.Split(fields, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		params[name] = value
+	}
+
+	// Credential is <access key>/<date>/<region>/s3/aws4_request
+	scope := strings.Split(params["Credential"], "/")
+	if len(scope) != 5 || scope[3] != "s3" || scope[4] != "aws4_request" {
+		return errMalformedAuth.withMessage("Invalid credential %q.", params["Credential"])
+	}
+	secret, ok := g.Credentials[scope[0]]
+	if !ok {
+		return errInvalidAccessKeyID
+	}
+	if g.Region != "" && scope[2] != g.Region {
+		return errMalformedAuth.withMessage("The region %q is wrong; expecting %q.", scope[2], g.Region)
+	}
+	amzDate := r.Header.Get("X-Amz-Date")
+	date, err := time.Parse(amzDateFormat, amzDate)
+	if err != nil || amzDate[:8] != scope[1] {
+		return errAccessDenied.withMessage("Invalid X-Amz-Date %q.", amzDate)
+	}
+	if skew := time.Since(date); skew > maxClockSkew || skew < -maxClockSkew {
+		return errTimeTooSkewed
+	}
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		return errAccessDenied.withMessage("Missing x-amz-content-sha256 header.")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		uriEncode(r.URL.Path, false),
+		canonicalQuery(r.URL.Query()),
+		canonicalHeaders(r, strings.Split(params["SignedHeaders"], ";")),
+		params["SignedHeaders"],
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		signingAlgorithm,
+		amzDate,
+		strings.Join(scope[1:], "/"),
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := []byte("AWS4" + secret)
+	for _, part := range []string{scope[1], scope[2], scope[3], scope[4], stringToSign} {
+		key = hmacSHA256(key, part)
+	}
+	signature, err := hex.DecodeString(params["Signature"])
+	if err != nil || !hmac.Equal(signature, key) {
+		return errSignatureMismatch
+	}
+	return nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// uriEncode escapes every byte but the unreserved characters of RFC 3986,
+// and slashes unless encodeSlash is set.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' && !encodeSlash {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// canonicalQuery lists the parameters of the query sorted by name, then by
+// value.
+func canonicalQuery(query url.Values) string {
+	var params [][2]string
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, [2]string{uriEncode(name, true), uriEncode(value, true)})
+		}
+	}
+	sort.Slice(params, func(i, j int) bool {
+		if params[i][0] != params[j][0] {
+			return params[i][0] < params[j][0]
+		}
+		return params[i][1] < params[j][1]
+	})
+	encoded := make([]string, len(params))
+	for i, param := range params {
+		encoded[i] = param[0] + "=" + param[1]
+	}
+	return strings.Join(encoded, "&")
+}
+
+// canonicalHeaders lists the signed headers with their values trimmed and
+// inner spaces collapsed, each followed by a newline.
+func canonicalHeaders(r *http.Request, names []string) string {
+	var b strings.Builder
+	for _, name := range names {
+		var value string
+		switch name {
+		case "host":
+			value = r.Host
+		case "content-length":
+			value = strconv.FormatInt(r.ContentLength, 10)
+		default:
+			var values []string
+			for _, v := range r.Header.Values(name) {
+				values = append(values, strings.Join(strings.Fields(v), " "))
+			}
+			value = strings.Join(values, ",")
+		}
+		b.WriteString(name + ":" + value + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,258 @@
+// Package s3gateway serves the core of the S3 API on top of the storage
+// system. Object data is split and read back like by the file partition
+// service, and the bucket and key of every object are mapped to the hash of
+// its file by the storage chaincode.
+package s3gateway
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	ledger "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/ledger"
+	storage "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/storage"
+	utils "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/utils"
+	"google.golang.org/grpc"
+)
+
+// xmlns is the namespace of the S3 API documents.
+const xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+// Gateway is an http.Handler serving path-style S3 requests: buckets are the
+// first segment of the path and keys the rest.
+type Gateway struct {
+	// Ledger calls the storage chaincode.
+	Ledger ledger.Objects
+	// Nodes and DialOptions reach the storage nodes like in storage.Uploader.
+	Nodes       []string
+	DialOptions []grpc.DialOption
+	// Cache, if set, keeps the chunks written and read by the gateway.
+	Cache *storage.ChunkCache
+
+	// Codec codes the stripes of objects, utils.DefaultCodec if nil. Objects
+	// smaller than ReplicateBelow bytes are stored as
+	// utils.DefaultReplication copies instead.
+	Codec          utils.Codec
+	ReplicateBelow int64
+	// MaxObjectSize bounds the size of objects and parts, which are held in
+	// memory while they are stored.
+	MaxObjectSize int64
+	// MinPartSize is the smallest size of every part of a multipart upload
+	// but the last.
+	MinPartSize int64
+	// MaxFileTreeTransaction is the largest file tree stored in a single
+	// StoreFileTree transaction.
+	MaxFileTreeTransaction int
+	// PartsDir keeps the parts of multipart uploads until they complete.
+	PartsDir string
+
+	// Credentials maps access key IDs to secret keys. Requests must be
+	// signed with AWS Signature Version 4 by one of them, unless it is nil.
+	Credentials map[string]string
+	// Region is the region requests are signed for, any if empty.
+	Region string
+}
+
+func NewGateway(chain ledger.Objects, nodes []string, partsDir string) *Gateway {
+	return &Gateway{
+		Ledger:                 chain,
+		Nodes:                  nodes,
+		ReplicateBelow:         4096,
+		MaxObjectSize:          1024 * 1024 * 1024,
+		MinPartSize:            5 * 1024 * 1024,
+		MaxFileTreeTransaction: 1024 * 1024,
+		PartsDir:               partsDir,
+		Region:                 "us-east-1",
+	}
+}
+
+// apiError is an error reported to the client in an S3 error document.
+type apiError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *apiError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+var (
+	errNoSuchBucket       = &apiError{http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist."}
+	errNoSuchKey          = &apiError{http.StatusNotFound, "NoSuchKey", "The specified key does not exist."}
+	errNoSuchUpload       = &apiError{http.StatusNotFound, "NoSuchUpload", "The specified multipart upload does not exist."}
+	errBucketExists       = &apiError{http.StatusConflict, "BucketAlreadyExists", "The requested bucket name is not available."}
+	errBucketNotEmpty     = &apiError{http.StatusConflict, "BucketNotEmpty", "The bucket you tried to delete is not empty."}
+	errInvalidRange       = &apiError{http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range is not satisfiable."}
+	errEntityTooLarge     = &apiError{http.StatusBadRequest, "EntityTooLarge", "Your proposed upload exceeds the maximum allowed object size."}
+	errEntityTooSmall     = &apiError{http.StatusBadRequest, "EntityTooSmall", "Your proposed upload is smaller than the minimum allowed object size."}
+	errKeyTooLong         = &apiError{http.StatusBadRequest, "KeyTooLongError", "Your key is too long."}
+	errInvalidPart        = &apiError{http.StatusBadRequest, "InvalidPart", "One or more of the specified parts could not be found."}
+	errInvalidPartOrder   = &apiError{http.StatusBadRequest, "InvalidPartOrder", "The list of parts was not in ascending order."}
+	errMalformedXML       = &apiError{http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed."}
+	errBadDigest          = &apiError{http.StatusBadRequest, "BadDigest", "The Content-MD5 you specified did not match what we received."}
+	errContentSHA256      = &apiError{http.StatusBadRequest, "XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed."}
+	errAccessDenied       = &apiError{http.StatusForbidden, "AccessDenied", "Access Denied."}
+	errMethodNotAllowed   = &apiError{http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource."}
+	errNotImplemented     = &apiError{http.StatusNotImplemented, "NotImplemented", "A header or query you provided implies functionality that is not implemented."}
+	errInternalError      = &apiError{http.StatusInternalServerError, "InternalError", "We encountered an internal error. Please try again."}
+	errInvalidArgument    = &apiError{http.StatusBadRequest, "InvalidArgument", "Invalid Argument."}
+	errInvalidBucketName  = &apiError{http.StatusBadRequest, "InvalidBucketName", "The specified bucket is not valid."}
+	errSignatureMismatch  = &apiError{http.StatusForbidden, "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided."}
+	errInvalidAccessKeyID = &apiError{http.StatusForbidden, "InvalidAccessKeyId", "The AWS access key Id you provided does not exist in our records."}
+	errTimeTooSkewed      = &apiError{http.StatusForbidden, "RequestTimeTooSkewed", "The difference between the request time and the server's time is too large."}
+	errMalformedAuth      = &apiError{http.StatusBadRequest, "AuthorizationHeaderMalformed", "The authorization header is malformed."}
+)
+
+// withMessage returns e with another message.
+func (e *apiError) withMessage(format string, args ...any) *apiError {
+	return &apiError{e.Status, e.Code, fmt.Sprintf(format, args...)}
+}
+
+type errorResponse struct {
+	XMLName  xml.Name `xml:"Error"`
+	Code     string   `xml:"Code"`
+	Message  string   `xml:"Message"`
+	Resource string   `xml:"Resource"`
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := g.authenticate(r)
+	if err == nil {
+		err = g.route(w, r)
+	}
+	if err == nil {
+		return
+	}
+
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		slog.Error("request failed", "method", r.Method, "path", r.URL.Path, "err", err)
+		apiErr = errInternalError
+	}
+	writeXML(w, r, apiErr.Status, errorResponse{Code: apiErr.Code, Message: apiErr.Message, Resource: r.URL.Path})
+}
+
+// route dispatches a request on its method, its path and the sub-resources
+// named in its query.
+func (g *Gateway) route(w http.ResponseWriter, r *http.Request) error {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+
+	switch {
+	case bucket == "":
+		if r.Method == http.MethodGet {
+			return g.listBuckets(w, r)
+		}
+	case key == "":
+		for _, subresource := range []string{"acl", "cors", "lifecycle", "location", "policy", "tagging", "uploads", "versioning", "versions", "website"} {
+			if query.Has(subresource) {
+				return errNotImplemented
+			}
+		}
+		switch r.Method {
+		case http.MethodPut:
+			return g.createBucket(w, r, bucket)
+		case http.MethodHead:
+			return g.headBucket(w, r, bucket)
+		case http.MethodDelete:
+			return g.deleteBucket(w, r, bucket)
+		case http.MethodGet:
+			if query.Get("list-type") != "2" {
+				return errNotImplemented.withMessage("Only ListObjectsV2 is implemented.")
+			}
+			return g.listObjects(w, r, bucket)
+		}
+	default:
+		for _, subresource := range []string{"acl", "tagging", "torrent", "versionId", "retention", "legal-hold"} {
+			if query.Has(subresource) {
+				return errNotImplemented
+			}
+		}
+		if len(key) > 1024 {
+			return errKeyTooLong
+		}
+		uploadID := query.Get("uploadId")
+		switch r.Method {
+		case http.MethodPut:
+			if r.Header.Get("X-Amz-Copy-Source") != "" {
+				return errNotImplemented.withMessage("Copying objects is not implemented.")
+			}
+			if uploadID != "" {
+				return g.uploadPart(w, r, bucket, key, uploadID)
+			}
+			return g.putObject(w, r, bucket, key)
+		case http.MethodGet:
+			if uploadID != "" {
+				return errNotImplemented.withMessage("Listing parts is not implemented.")
+			}
+			return g.getObject(w, r, bucket, key, true)
+		case http.MethodHead:
+			return g.getObject(w, r, bucket, key, false)
+		case http.MethodDelete:
+			if uploadID != "" {
+				return g.abortMultipartUpload(w, r, bucket, key, uploadID)
+			}
+			return g.deleteObject(w, r, bucket, key)
+		case http.MethodPost:
+			if query.Has("uploads") {
+				return g.createMultipartUpload(w, r, bucket, key)
+			}
+			if uploadID != "" {
+				return g.completeMultipartUpload(w, r, bucket, key, uploadID)
+			}
+		}
+	}
+	return errMethodNotAllowed
+}
+
+// writeXML writes v as the body of the response, without it for HEAD.
+func writeXML(w http.ResponseWriter, r *http.Request, status int, v any) {
+	body, err := xml.Marshal(v)
+	if err != nil {
+		slog.Error("failed to marshal response", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		w.Write([]byte(xml.Header))
+		w.Write(body)
+	}
+}
+
+// submitted wraps the error of a chaincode transaction, reporting an owner
+// check of the chaincode as AccessDenied.
+func submitted(name string, err error) error {
+	if errors.Is(err, ledger.ErrNotOwner) {
+		return errAccessDenied.withMessage("%v", err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to submit %s: %v", name, err)
+	}
+	return nil
+}
+
+// checkBucket returns errNoSuchBucket if the bucket does not exist.
+func (g *Gateway) checkBucket(name string) error {
+	bucket, err := g.Ledger.GetBucket(name)
+	if err != nil {
+		return err
+	}
+	if bucket == nil {
+		return errNoSuchBucket
+	}
+	return nil
+}
+
+func (g *Gateway) hashSlotTable() (storage.HashSlotTable, error) {
+	hashSlotTable, err := g.Ledger.GetHashSlotTable()
+	if err != nil {
+		return storage.HashSlotTable{}, err
+	}
+	return *hashSlotTable, nil
+}
@@ -0,0 +1,409 @@
+package s3gateway
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/schema"
+	storagetest "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/internal/storagetest"
+	ledger "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/ledger"
+	utils "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/utils"
+	"google.golang.org/grpc"
+)
+
+// countingLedger counts the trees stored in a single transaction.
+type countingLedger struct {
+	*ledger.Memory
+	mu     sync.Mutex
+	stores int
+}
+
+func (l *countingLedger) StoreFileTree(tree *schema.FileTree, metadata *schema.FileMetadataInput) (uint64, error) {
+	l.mu.Lock()
+	l.stores++
+	l.mu.Unlock()
+	return l.Memory.StoreFileTree(tree, metadata)
+}
+
+// newTestGateway starts a gateway on an in-process cluster of storage nodes
+// and returns an S3 client of it.
+func newTestGateway(t *testing.T, numNodes int) (*Gateway, *countingLedger, *s3.Client) {
+	chain := &countingLedger{Memory: ledger.NewMemory()}
+	var nodes []string
+	for i := 0; i < numNodes; i++ {
+		nodes = append(nodes, fmt.Sprintf("node%d", i))
+		if _, err := chain.UpdateOrgWeight(nodes[i], 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := chain.CreateHashSlotTable(); err != nil {
+		t.Fatalf("failed to create hash slot table: %v", err)
+	}
+	cluster := storagetest.NewCluster(t, nodes...)
+
+	g := NewGateway(chain, nodes, t.TempDir())
+	g.DialOptions = []grpc.DialOption{cluster.Dialer()}
+	g.MinPartSize = 1024
+	g.Credentials = map[string]string{"AKIDEXAMPLE": "secret"}
+	server := httptest.NewServer(g)
+	t.Cleanup(server.Close)
+
+	client := s3.New(s3.Options{
+		BaseEndpoint: aws.String(server.URL),
+		Region:       "us-east-1",
+		UsePathStyle: true,
+		Credentials:  credentials.NewStaticCredentialsProvider("AKIDEXAMPLE", "secret", ""),
+		DisableLogOutputChecksumValidationSkipped: true,
+	})
+	return g, chain, client
+}
+
+func randomContent(t *testing.T, size int) []byte {
+	content := make([]byte, size)
+	if _, err := rand.Read(content); err != nil {
+		t.Fatalf("failed to generate content: %v", err)
+	}
+	return content
+}
+
+// errorCode returns the S3 error code of err.
+func errorCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return ""
+}
+
+func getObject(t *testing.T, client *s3.Client, bucket, key, byteRange string) []byte {
+	input := &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}
+	if byteRange != "" {
+		input.Range = aws.String(byteRange)
+	}
+	output, err := client.GetObject(context.Background(), input)
+	if err != nil {
+		t.Fatalf("GetObject %s %s: %v", key, byteRange, err)
+	}
+	defer output.Body.Close()
+	data, err := io.ReadAll(output.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestObjects(t *testing.T) {
+	_, chain, client := newTestGateway(t, 6)
+	ctx := context.Background()
+
+	if _, err := client.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: aws.String("photos")}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := client.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: aws.String("photos")})
+	if code := errorCode(err); code != "BucketAlreadyExists" {
+		t.Errorf("creating a bucket again: %v", err)
+	}
+	if _, err := client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String("photos")}); err != nil {
+		t.Error(err)
+	}
+	buckets, err := client.ListBuckets(ctx, &s3.ListBucketsInput{})
+	if err != nil || len(buckets.Buckets) != 1 || aws.ToString(buckets.Buckets[0].Name) != "photos" {
+		t.Fatalf("ListBuckets: %v", err)
+	}
+
+	// A tiny object is replicated, a larger one erasure coded
+	small := []byte("hello, world")
+	large := randomContent(t, 3*utils.StripeSize+1000)
+	for key, content := range map[string][]byte{"small.txt": small, "dir/large.bin": large} {
+		_, err := client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:      aws.String("photos"),
+			Key:         aws.String(key),
+			Body:        bytes.NewReader(content),
+			ContentType: aws.String("application/x-test"),
+			Metadata:    map[string]string{"origin": "test"},
+		})
+		if err != nil {
+			t.Fatalf("PutObject %s: %v", key, err)
+		}
+		if got := getObject(t, client, "photos", key, ""); !bytes.Equal(got, content) {
+			t.Errorf("%s: read %d bytes differing from the %d stored", key, len(got), len(content))
+		}
+	}
+	if tree, err := chain.GetFileTree(utils.GetHash(small)); err != nil || tree.Codec != utils.DefaultReplication.Name() {
+		t.Errorf("tiny object stored as %+v: %v", tree, err)
+	}
+
+	// Storing the same content again reuses its file
+	_, err = client.PutObject(ctx, &s3.PutObjectInput{Bucket: aws.String("photos"), Key: aws.String("copy.bin"), Body: bytes.NewReader(large)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := chain.stores; n != 2 {
+		t.Errorf("%d file trees stored, want 2", n)
+	}
+
+	// Overwriting or deleting the last object of a file deletes the file
+	draft := []byte("draft")
+	for _, content := range [][]byte{draft, small} {
+		if _, err := client.PutObject(ctx, &s3.PutObjectInput{Bucket: aws.String("photos"), Key: aws.String("tmp.txt"), Body: bytes.NewReader(content)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := chain.GetFileMetadata(utils.GetHash(draft)); !errors.Is(err, ledger.ErrNotFound) {
+		t.Errorf("overwritten file still stored: %v", err)
+	}
+	if _, err := client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String("photos"), Key: aws.String("tmp.txt")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chain.GetFileMetadata(utils.GetHash(small)); err != nil {
+		t.Errorf("file of another object deleted: %v", err)
+	}
+
+	for _, test := range []struct {
+		byteRange string
+		want      []byte
+	}{
+		{"bytes=100-199", large[100:200]},
+		{"bytes=12000-12500", large[12000:12501]},
+		{"bytes=-10", large[len(large)-10:]},
+		{"bytes=37000-", large[37000:]},
+		{"bytes=37000-999999", large[37000:]},
+	} {
+		if got := getObject(t, client, "photos", "dir/large.bin", test.byteRange); !bytes.Equal(got, test.want) {
+			t.Errorf("range %s: got %d bytes, want %d", test.byteRange, len(got), len(test.want))
+		}
+	}
+	_, err = client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String("photos"), Key: aws.String("small.txt"), Range: aws.String("bytes=100-")})
+	if code := errorCode(err); code != "InvalidRange" {
+		t.Errorf("unsatisfiable range: %v", err)
+	}
+
+	head, err := client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String("photos"), Key: aws.String("dir/large.bin")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.ToInt64(head.ContentLength) != int64(len(large)) || aws.ToString(head.ContentType) != "application/x-test" ||
+		head.Metadata["origin"] != "test" || aws.ToString(head.ETag) != partETag(large) {
+		t.Errorf("HeadObject: %d bytes of %s, metadata %v, ETag %s", aws.ToInt64(head.ContentLength), aws.ToString(head.ContentType), head.Metadata, aws.ToString(head.ETag))
+	}
+
+	_, err = client.DeleteBucket(ctx, &s3.DeleteBucketInput{Bucket: aws.String("photos")})
+	if code := errorCode(err); code != "BucketNotEmpty" {
+		t.Errorf("deleting a bucket with objects: %v", err)
+	}
+	for _, key := range []string{"small.txt", "dir/large.bin", "copy.bin"} {
+		if _, err := client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String("photos"), Key: aws.String(key)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String("photos"), Key: aws.String("small.txt")})
+	if code := errorCode(err); code != "NoSuchKey" {
+		t.Errorf("reading a deleted object: %v", err)
+	}
+	for _, content := range [][]byte{small, large} {
+		if _, err := chain.GetFileMetadata(utils.GetHash(content)); !errors.Is(err, ledger.ErrNotFound) {
+			t.Errorf("file without objects still stored: %v", err)
+		}
+	}
+	if _, err := client.DeleteBucket(ctx, &s3.DeleteBucketInput{Bucket: aws.String("photos")}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String("photos"), Key: aws.String("small.txt")})
+	if code := errorCode(err); code != "NoSuchBucket" {
+		t.Errorf("reading from a deleted bucket: %v", err)
+	}
+
+	// The chaincode only lets the owner MSP delete a bucket
+	chain.MSPID = "Org2MSP"
+	if _, err := chain.CreateBucket("org2-bucket"); err != nil {
+		t.Fatal(err)
+	}
+	chain.MSPID = "Org1MSP"
+	_, err = client.DeleteBucket(ctx, &s3.DeleteBucketInput{Bucket: aws.String("org2-bucket")})
+	if code := errorCode(err); code != "AccessDenied" {
+		t.Errorf("deleting a bucket of another MSP: %v", err)
+	}
+}
+
+func TestListObjectsV2(t *testing.T) {
+	_, _, client := newTestGateway(t, 3)
+	ctx := context.Background()
+	if _, err := client.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: aws.String("logs")}); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b/1", "b/2", "b/3", "c", "d/x/1", "d/y", "e"} {
+		_, err := client.PutObject(ctx, &s3.PutObjectInput{Bucket: aws.String("logs"), Key: aws.String(key), Body: strings.NewReader(key)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list := func(input s3.ListObjectsV2Input) (keys []string) {
+		input.Bucket = aws.String("logs")
+		paginator := s3.NewListObjectsV2Paginator(client, &input)
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, object := range page.Contents {
+				keys = append(keys, aws.ToString(object.Key))
+			}
+			for _, prefix := range page.CommonPrefixes {
+				keys = append(keys, aws.ToString(prefix.Prefix))
+			}
+		}
+		return keys
+	}
+
+	for _, test := range []struct {
+		name  string
+		input s3.ListObjectsV2Input
+		want  string
+	}{
+		{"all", s3.ListObjectsV2Input{}, "a b/1 b/2 b/3 c d/x/1 d/y e"},
+		{"pages", s3.ListObjectsV2Input{MaxKeys: aws.Int32(3)}, "a b/1 b/2 b/3 c d/x/1 d/y e"},
+		{"delimiter", s3.ListObjectsV2Input{Delimiter: aws.String("/")}, "a c e b/ d/"},
+		{"delimiter pages", s3.ListObjectsV2Input{Delimiter: aws.String("/"), MaxKeys: aws.Int32(1)}, "a b/ c d/ e"},
+		{"prefix", s3.ListObjectsV2Input{Prefix: aws.String("d/"), Delimiter: aws.String("/")}, "d/y d/x/"},
+		{"start after", s3.ListObjectsV2Input{StartAfter: aws.String("b/2")}, "b/3 c d/x/1 d/y e"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := strings.Join(list(test.input), " "); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMultipartUpload(t *testing.T) {
+	_, _, client := newTestGateway(t, 6)
+	ctx := context.Background()
+	if _, err := client.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: aws.String("videos")}); err != nil {
+		t.Fatal(err)
+	}
+
+	upload := func(parts ...[]byte) (string, []types.CompletedPart) {
+		created, err := client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{Bucket: aws.String("videos"), Key: aws.String("movie.mp4")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var completed []types.CompletedPart
+		for i, part := range parts {
+			output, err := client.UploadPart(ctx, &s3.UploadPartInput{
+				Bucket:     aws.String("videos"),
+				Key:        aws.String("movie.mp4"),
+				UploadId:   created.UploadId,
+				PartNumber: aws.Int32(int32(i + 1)),
+				Body:       bytes.NewReader(part),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			completed = append(completed, types.CompletedPart{ETag: output.ETag, PartNumber: aws.Int32(int32(i + 1))})
+		}
+		return aws.ToString(created.UploadId), completed
+	}
+	complete := func(uploadID string, parts []types.CompletedPart) (*s3.CompleteMultipartUploadOutput, error) {
+		return client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String("videos"),
+			Key:             aws.String("movie.mp4"),
+			UploadId:        aws.String(uploadID),
+			MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+		})
+	}
+
+	parts := [][]byte{randomContent(t, 20000), randomContent(t, 1024), randomContent(t, 10)}
+	uploadID, completed := upload(parts...)
+	output, err := complete(uploadID, completed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if etag := aws.ToString(output.ETag); !strings.HasSuffix(etag, `-3"`) {
+		t.Errorf("ETag %s of a multipart upload", etag)
+	}
+	if got := getObject(t, client, "videos", "movie.mp4", ""); !bytes.Equal(got, bytes.Join(parts, nil)) {
+		t.Error("object differs from its parts")
+	}
+	if _, err := complete(uploadID, completed); errorCode(err) != "NoSuchUpload" {
+		t.Errorf("completing an upload again: %v", err)
+	}
+
+	uploadID, completed = upload(randomContent(t, 100), randomContent(t, 100))
+	if _, err := complete(uploadID, completed); errorCode(err) != "EntityTooSmall" {
+		t.Errorf("completing with a small part: %v", err)
+	}
+	if _, err := complete(uploadID, []types.CompletedPart{completed[1], completed[0]}); errorCode(err) != "InvalidPartOrder" {
+		t.Errorf("completing with unordered parts: %v", err)
+	}
+	_, err = client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{Bucket: aws.String("videos"), Key: aws.String("movie.mp4"), UploadId: aws.String(uploadID)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := complete(uploadID, completed[1:]); errorCode(err) != "NoSuchUpload" {
+		t.Errorf("completing an aborted upload: %v", err)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	g, _, _ := newTestGateway(t, 3)
+	server := httptest.NewServer(g)
+	defer server.Close()
+
+	for _, test := range []struct {
+		accessKey, secret string
+		code              string
+	}{
+		{"AKIDEXAMPLE", "wrong", "SignatureDoesNotMatch"},
+		{"AKIDUNKNOWN", "secret", "InvalidAccessKeyId"},
+	} {
+		client := s3.New(s3.Options{
+			BaseEndpoint: aws.String(server.URL),
+			Region:       "us-east-1",
+			UsePathStyle: true,
+			Credentials:  credentials.NewStaticCredentialsProvider(test.accessKey, test.secret, ""),
+		})
+		_, err := client.ListBuckets(context.Background(), &s3.ListBucketsInput{})
+		if code := errorCode(err); code != test.code {
+			t.Errorf("%s: got %v, want %s", test.accessKey, err, test.code)
+		}
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	for _, test := range []struct {
+		header          string
+		offset, length  int64
+		partial, failed bool
+	}{
+		{"", 0, 100, false, false},
+		{"bytes=0-9", 0, 10, true, false},
+		{"bytes=90-", 90, 10, true, false},
+		{"bytes=90-200", 90, 10, true, false},
+		{"bytes=-20", 80, 20, true, false},
+		{"bytes=-200", 0, 100, true, false},
+		{"bytes=100-", 0, 0, false, true},
+		{"bytes=-0", 0, 0, false, true},
+		{"bytes=5-1", 0, 100, false, false},
+		{"bytes=0-1,5-6", 0, 100, false, false},
+		{"items=0-1", 0, 100, false, false},
+	} {
+		offset, length, partial, err := parseRange(test.header, 100)
+		if offset != test.offset || length != test.length || partial != test.partial || (err != nil) != test.failed {
+			t.Errorf("%q: got %d, %d, %v, %v", test.header, offset, length, partial, err)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package s3gateway
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	storage "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/storage"
+)
+
+// maxParts is the largest number of parts of a multipart upload, as in S3.
+const maxParts = 10000
+
+// multipartUpload is kept in upload.json in the directory of an upload, next
+// to one file per part.
+type multipartUpload struct {
+	Bucket      string            `json:"bucket"`
+	Key         string            `json:"key"`
+	ContentType string            `json:"contentType"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type completeMultipartUpload struct {
+	Parts []completedPart `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+func partPath(dir string, partNumber int) string {
+	return filepath.Join(dir, fmt.Sprintf("part-%05d", partNumber))
+}
+
+// uploadDir returns the directory of an upload of the key, or errNoSuchUpload
+// if there is none.
+func (g *Gateway) uploadDir(bucket, key, uploadID string) (string, *multipartUpload, error) {
+	if _, err := hex.DecodeString(uploadID); err != nil || len(uploadID) != 32 {
+		return "", nil, errNoSuchUpload
+	}
+	dir := filepath.Join(g.PartsDir, uploadID)
+	uploadJSON, err := os.ReadFile(filepath.Join(dir, "upload.json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil, errNoSuchUpload
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read upload %s: %v", uploadID, err)
+	}
+	var upload multipartUpload
+	if err := json.Unmarshal(uploadJSON, &upload); err != nil {
+		return "", nil, fmt.Errorf("failed to unmarshal upload %s: %v", uploadID, err)
+	}
+	if upload.Bucket != bucket || upload.Key != key {
+		return "", nil, errNoSuchUpload
+	}
+	return dir, &upload, nil
+}
+
+func (g *Gateway) createMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	if !validKey(key) {
+		return errInvalidArgument.withMessage("Invalid object key.")
+	}
+	if err := g.checkBucket(bucket); err != nil {
+		return err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Errorf("failed to generate upload ID: %v", err)
+	}
+	uploadID := hex.EncodeToString(id)
+	uploadJSON, err := json.Marshal(multipartUpload{
+		Bucket:      bucket,
+		Key:         key,
+		ContentType: r.Header.Get("Content-Type"),
+		Metadata:    userMetadata(r.Header),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal upload: %v", err)
+	}
+	dir := filepath.Join(g.PartsDir, uploadID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create upload directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "upload.json"), uploadJSON, 0644); err != nil {
+		return fmt.Errorf("failed to write upload: %v", err)
+	}
+
+	writeXML(w, r, http.StatusOK, initiateMultipartUploadResult{Xmlns: xmlns, Bucket: bucket, Key: key, UploadID: uploadID})
+	return nil
+}
+
+func (g *Gateway) uploadPart(w http.ResponseWriter, r *http.Request, bucket, key, uploadID string) error {
+	partNumber, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || partNumber < 1 || partNumber > maxParts {
+		return errInvalidArgument.withMessage("Part number must be an integer between 1 and %d, inclusive.", maxParts)
+	}
+	dir, _, err := g.uploadDir(bucket, key, uploadID)
+	if err != nil {
+		return err
+	}
+	content, err := g.readBody(r)
+	if err != nil {
+		return err
+	}
+
+	// A part uploaded again replaces the previous one at once
+	tmp, err := os.CreateTemp(dir, "tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create part: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write part: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), partPath(dir, partNumber)); err != nil {
+		return fmt.Errorf("failed to write part: %v", err)
+	}
+
+	w.Header().Set("ETag", partETag(content))
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// completeMultipartUpload joins the listed parts into one object. Every part
+// but the last must hold at least MinPartSize bytes.
+func (g *Gateway) completeMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key, uploadID string) error {
+	dir, upload, err := g.uploadDir(bucket, key, uploadID)
+	if err != nil {
+		return err
+	}
+	var request completeMultipartUpload
+	if err := xml.NewDecoder(io.LimitReader(r.Body, 1024*1024)).Decode(&request); err != nil {
+		return errMalformedXML
+	}
+	if len(request.Parts) == 0 {
+		return errMalformedXML.withMessage("You must specify at least one part.")
+	}
+
+	for i := 1; i < len(request.Parts); i++ {
+		if request.Parts[i].PartNumber <= request.Parts[i-1].PartNumber {
+			return errInvalidPartOrder
+		}
+	}
+
+	var content []byte
+	etags := make([]string, len(request.Parts))
+	for i, part := range request.Parts {
+		data, err := os.ReadFile(partPath(dir, part.PartNumber))
+		if errors.Is(err, fs.ErrNotExist) {
+			return errInvalidPart
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read part %d: %v", part.PartNumber, err)
+		}
+		etags[i] = partETag(data)
+		if strings.Trim(part.ETag, `"`) != strings.Trim(etags[i], `"`) {
+			return errInvalidPart
+		}
+		if i < len(request.Parts)-1 && int64(len(data)) < g.MinPartSize {
+			return errEntityTooSmall
+		}
+		if int64(len(content)+len(data)) > g.MaxObjectSize {
+			return errEntityTooLarge
+		}
+		content = append(content, data...)
+	}
+
+	object := storage.ObjectInput{
+		ETag:        multipartETag(etags),
+		ContentType: upload.ContentType,
+		Metadata:    upload.Metadata,
+	}
+	if err := g.storeObject(r.Context(), bucket, key, content, object); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to remove parts of upload %s: %v", uploadID, err)
+	}
+
+	writeXML(w, r, http.StatusOK, completeMultipartUploadResult{
+		Xmlns:    xmlns,
+		Location: "/" + bucket + "/" + key,
+		Bucket:   bucket,
+		Key:      key,
+		ETag:     object.ETag,
+	})
+	return nil
+}
+
+func (g *Gateway) abortMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key, uploadID string) error {
+	dir, _, err := g.uploadDir(bucket, key, uploadID)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to remove parts of upload %s: %v", uploadID, err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
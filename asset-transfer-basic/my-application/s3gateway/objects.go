@@ -0,0 +1,555 @@
+package s3gateway
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/schema"
+	ledger "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/ledger"
+	metrics "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/metrics"
+	storage "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/storage"
+	utils "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/utils"
+)
+
+// metaPrefix starts the headers holding user metadata.
+const metaPrefix = "X-Amz-Meta-"
+
+// maxRune sorts after every rune of a key, which the ledger keys cannot hold.
+const maxRune = "\U0010FFFF"
+
+type bucketEntry struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+type listAllMyBucketsResult struct {
+	XMLName xml.Name      `xml:"ListAllMyBucketsResult"`
+	Xmlns   string        `xml:"xmlns,attr"`
+	Owner   string        `xml:"Owner>ID"`
+	Buckets []bucketEntry `xml:"Buckets>Bucket"`
+}
+
+type objectEntry struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name       `xml:"ListBucketResult"`
+	Xmlns                 string         `xml:"xmlns,attr"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	Delimiter             string         `xml:"Delimiter,omitempty"`
+	MaxKeys               int            `xml:"MaxKeys"`
+	KeyCount              int            `xml:"KeyCount"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	StartAfter            string         `xml:"StartAfter,omitempty"`
+	Contents              []objectEntry  `xml:"Contents"`
+	CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+}
+
+// isoTime converts a ledger timestamp to the format of S3 listings.
+func isoTime(timestamp string) string {
+	t, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return timestamp
+	}
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+func (g *Gateway) listBuckets(w http.ResponseWriter, r *http.Request) error {
+	buckets, err := g.Ledger.ListBuckets()
+	if err != nil {
+		return err
+	}
+	result := listAllMyBucketsResult{Xmlns: xmlns, Buckets: []bucketEntry{}}
+	for _, bucket := range buckets {
+		result.Buckets = append(result.Buckets, bucketEntry{Name: bucket.Name, CreationDate: isoTime(bucket.CreatedAt)})
+	}
+	writeXML(w, r, http.StatusOK, result)
+	return nil
+}
+
+func (g *Gateway) createBucket(w http.ResponseWriter, r *http.Request, name string) error {
+	bucket, err := g.Ledger.GetBucket(name)
+	if err != nil {
+		return err
+	}
+	if bucket != nil {
+		return errBucketExists
+	}
+	_, err = g.Ledger.CreateBucket(name)
+	if errors.Is(err, ledger.ErrInvalidBucketName) {
+		return errInvalidBucketName
+	}
+	if err := submitted("CreateBucket", err); err != nil {
+		return err
+	}
+	w.Header().Set("Location", "/"+name)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (g *Gateway) headBucket(w http.ResponseWriter, r *http.Request, name string) error {
+	if err := g.checkBucket(name); err != nil {
+		return err
+	}
+	w.Header().Set("X-Amz-Bucket-Region", g.Region)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (g *Gateway) deleteBucket(w http.ResponseWriter, r *http.Request, name string) error {
+	if err := g.checkBucket(name); err != nil {
+		return err
+	}
+	page, err := g.objectPage(name, "", "", 1)
+	if err != nil {
+		return err
+	}
+	if len(page.Objects) > 0 {
+		return errBucketNotEmpty
+	}
+	if _, err := g.Ledger.DeleteBucket(name); err != nil {
+		return submitted("DeleteBucket", err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (g *Gateway) objectPage(bucket, prefix, startAfter string, maxKeys int) (*storage.ObjectPage, error) {
+	page, err := g.Ledger.ListObjects(bucket, prefix, startAfter, maxKeys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %v", err)
+	}
+	return page, nil
+}
+
+// listObjects lists a bucket like ListObjectsV2. Keys sharing a common
+// prefix are skipped by starting the next page of the chaincode after the
+// prefix followed by maxRune, the continuation token encodes where the next
+// page starts.
+func (g *Gateway) listObjects(w http.ResponseWriter, r *http.Request, bucket string) error {
+	query := r.URL.Query()
+	if err := g.checkBucket(bucket); err != nil {
+		return err
+	}
+
+	result := listBucketResult{
+		Xmlns:             xmlns,
+		Name:              bucket,
+		Prefix:            query.Get("prefix"),
+		Delimiter:         query.Get("delimiter"),
+		MaxKeys:           1000,
+		ContinuationToken: query.Get("continuation-token"),
+		StartAfter:        query.Get("start-after"),
+	}
+	if maxKeys := query.Get("max-keys"); maxKeys != "" {
+		n, err := strconv.Atoi(maxKeys)
+		if err != nil || n < 0 {
+			return errInvalidArgument.withMessage("Invalid max-keys %q.", maxKeys)
+		}
+		result.MaxKeys = min(n, 1000)
+	}
+	after := result.StartAfter
+	if result.ContinuationToken != "" {
+		token, err := base64.StdEncoding.DecodeString(result.ContinuationToken)
+		if err != nil {
+			return errInvalidArgument.withMessage("The continuation token provided is incorrect.")
+		}
+		after = string(token)
+	}
+
+	more := result.MaxKeys > 0
+	for more && result.KeyCount < result.MaxKeys {
+		page, err := g.objectPage(bucket, result.Prefix, after, result.MaxKeys-result.KeyCount)
+		if err != nil {
+			return err
+		}
+		more = page.IsTruncated
+		for _, object := range page.Objects {
+			// Keys of the last common prefix
+			if object.Key <= after {
+				continue
+			}
+			if i := strings.Index(object.Key[len(result.Prefix):], result.Delimiter); result.Delimiter != "" && i >= 0 {
+				prefix := object.Key[:len(result.Prefix)+i+len(result.Delimiter)]
+				result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{Prefix: prefix})
+				after = prefix + maxRune
+			} else {
+				result.Contents = append(result.Contents, objectEntry{
+					Key:          object.Key,
+					LastModified: isoTime(object.LastModified),
+					ETag:         object.ETag,
+					Size:         object.Size,
+					StorageClass: "STANDARD",
+				})
+				after = object.Key
+			}
+			result.KeyCount++
+		}
+	}
+	if more {
+		result.IsTruncated = true
+		result.NextContinuationToken = base64.StdEncoding.EncodeToString([]byte(after))
+	}
+	writeXML(w, r, http.StatusOK, result)
+	return nil
+}
+
+// readBody reads the body of an upload, checking its size and the digests
+// the client sent along.
+func (g *Gateway) readBody(r *http.Request) ([]byte, error) {
+	if r.ContentLength > g.MaxObjectSize {
+		return nil, errEntityTooLarge
+	}
+	contentSHA256 := r.Header.Get("X-Amz-Content-Sha256")
+	if strings.HasPrefix(contentSHA256, "STREAMING-") {
+		return nil, errNotImplemented.withMessage("Chunked payloads are not implemented.")
+	}
+	content, err := io.ReadAll(io.LimitReader(r.Body, g.MaxObjectSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %v", err)
+	}
+	if int64(len(content)) > g.MaxObjectSize {
+		return nil, errEntityTooLarge
+	}
+
+	if _, err := hex.DecodeString(contentSHA256); err == nil && len(contentSHA256) == 2*sha256.Size {
+		sum := sha256.Sum256(content)
+		if !strings.EqualFold(contentSHA256, hex.EncodeToString(sum[:])) {
+			return nil, errContentSHA256
+		}
+	}
+	if contentMD5 := r.Header.Get("Content-Md5"); contentMD5 != "" {
+		sum := md5.Sum(content)
+		if contentMD5 != base64.StdEncoding.EncodeToString(sum[:]) {
+			return nil, errBadDigest
+		}
+	}
+	return content, nil
+}
+
+// validKey tells whether the chaincode accepts key.
+func validKey(key string) bool {
+	return utf8.ValidString(key) && !strings.ContainsAny(key, "\x00"+maxRune)
+}
+
+// userMetadata returns the user metadata of a request, keyed by the lower
+// case header names without their prefix.
+func userMetadata(header http.Header) map[string]string {
+	var metadata map[string]string
+	for name, values := range header {
+		if strings.HasPrefix(name, metaPrefix) && len(name) > len(metaPrefix) {
+			if metadata == nil {
+				metadata = make(map[string]string)
+			}
+			metadata[strings.ToLower(name[len(metaPrefix):])] = strings.Join(values, ",")
+		}
+	}
+	return metadata
+}
+
+func (g *Gateway) putObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	if !validKey(key) {
+		return errInvalidArgument.withMessage("Invalid object key.")
+	}
+	if err := g.checkBucket(bucket); err != nil {
+		return err
+	}
+	content, err := g.readBody(r)
+	if err != nil {
+		return err
+	}
+
+	object := storage.ObjectInput{
+		ETag:        partETag(content),
+		ContentType: r.Header.Get("Content-Type"),
+		Metadata:    userMetadata(r.Header),
+	}
+	if err := g.storeObject(r.Context(), bucket, key, content, object); err != nil {
+		return err
+	}
+	w.Header().Set("ETag", object.ETag)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// storeObject stores content unless a file of the same hash is stored
+// already, then maps the key to it. The file the key mapped to before is
+// released.
+func (g *Gateway) storeObject(ctx context.Context, bucket, key string, content []byte, object storage.ObjectInput) error {
+	object.FileHash = utils.GetHash(content)
+	object.Size = int64(len(content))
+	if object.ContentType == "" {
+		object.ContentType = http.DetectContentType(content)
+	}
+	metrics.BytesStored.Add(float64(len(content)))
+
+	if _, err := g.Ledger.GetFileMetadata(object.FileHash); errors.Is(err, ledger.ErrNotFound) {
+		hashSlotTable, err := g.hashSlotTable()
+		if err != nil {
+			return err
+		}
+		uploader := storage.NewUploader(hashSlotTable, g.Nodes)
+		uploader.DialOptions = g.DialOptions
+		uploader.Codec = g.codec(len(content))
+		if g.Cache != nil {
+			uploader.OnChunk = g.Cache.Put
+		}
+		file, err := uploader.Upload(ctx, content)
+		if err != nil {
+			return err
+		}
+
+		metadata := &storage.FileMetadataInput{ContentType: object.ContentType}
+		if _, err := ledger.SaveFileTree(g.Ledger, (*schema.FileTree)(file), metadata, g.MaxFileTreeTransaction); err != nil {
+			return submitted("StoreFileTree", err)
+		}
+	} else if err != nil {
+		return err
+	}
+
+	previous, err := g.Ledger.GetObject(bucket, key)
+	if err != nil {
+		return err
+	}
+	if _, err := g.Ledger.PutObject(bucket, key, &object); err != nil {
+		return submitted("PutObject", err)
+	}
+	if previous != nil && previous.FileHash != object.FileHash {
+		g.release(ctx, previous.FileHash)
+	}
+	return nil
+}
+
+// release deletes a file and its chunks once no object or ref points to it.
+// Files still referenced, retained or held are kept. The object is gone
+// already, so other failures are only logged.
+func (g *Gateway) release(ctx context.Context, fileHash string) {
+	deleted, err := g.Ledger.DeleteFileTree(fileHash)
+	switch {
+	case errors.Is(err, ledger.ErrReferenced), errors.Is(err, ledger.ErrRetained), errors.Is(err, ledger.ErrHeld), errors.Is(err, ledger.ErrNotFound):
+		return
+	case err != nil:
+		slog.Warn("failed to release file", "file", fileHash, "err", err)
+		return
+	}
+
+	hashSlotTable, err := g.hashSlotTable()
+	if err == nil {
+		err = storage.DeleteChunks(ctx, deleted, hashSlotTable, g.Nodes, g.DialOptions...)
+	}
+	if err != nil {
+		slog.Warn("failed to delete chunks of released file", "file", fileHash, "err", err)
+	}
+}
+
+func (g *Gateway) codec(size int) utils.Codec {
+	// Erasure coding would pad tiny objects to a whole stripe
+	if int64(size) < g.ReplicateBelow {
+		return utils.DefaultReplication
+	}
+	if g.Codec == nil {
+		return utils.DefaultCodec
+	}
+	return g.Codec
+}
+
+// lookupObject returns the object of a key, or the S3 error of a missing
+// bucket or key.
+func (g *Gateway) lookupObject(bucket, key string) (*storage.Object, error) {
+	object, err := g.Ledger.GetObject(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	if object == nil {
+		if err := g.checkBucket(bucket); err != nil {
+			return nil, err
+		}
+		return nil, errNoSuchKey
+	}
+	return object, nil
+}
+
+// parseRange returns the offset and length of the single byte range of a
+// Range header. Headers of several ranges or of other units are ignored like
+// S3 does, and the whole object is served.
+func parseRange(header string, size int64) (offset int64, length int64, partial bool, err error) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, size, false, nil
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0, size, false, nil
+	}
+
+	if first == "" {
+		// The last bytes of the object
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil {
+			return 0, size, false, nil
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, false, errInvalidRange
+		}
+		n = min(n, size)
+		return size - n, n, true, nil
+	}
+
+	offset, err = strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return 0, size, false, nil
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < offset {
+			return 0, size, false, nil
+		}
+		end = min(end, size-1)
+	}
+	if offset >= size {
+		return 0, 0, false, errInvalidRange
+	}
+	return offset, end - offset + 1, true, nil
+}
+
+// responseBody sends the header of a response with its first byte, so a
+// read failing before any data was written is still reported as an error.
+type responseBody struct {
+	w       http.ResponseWriter
+	status  int
+	started bool
+}
+
+func (b *responseBody) Write(p []byte) (int, error) {
+	if !b.started {
+		b.started = true
+		b.w.WriteHeader(b.status)
+	}
+	return b.w.Write(p)
+}
+
+func (g *Gateway) getObject(w http.ResponseWriter, r *http.Request, bucket, key string, withBody bool) error {
+	object, err := g.lookupObject(bucket, key)
+	if err != nil {
+		return err
+	}
+	offset, length, partial, err := parseRange(r.Header.Get("Range"), object.Size)
+	if err != nil {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", object.Size))
+		return err
+	}
+
+	var file *storage.File
+	if withBody && length > 0 {
+		// The tree is loaded before the header is sent
+		tree, err := g.Ledger.GetFileTree(object.FileHash)
+		if err != nil {
+			return err
+		}
+		file = (*storage.File)(tree)
+	}
+
+	header := w.Header()
+	header.Set("Accept-Ranges", "bytes")
+	header.Set("Content-Length", strconv.FormatInt(length, 10))
+	header.Set("Content-Type", object.ContentType)
+	header.Set("ETag", object.ETag)
+	if t, err := time.Parse(time.RFC3339, object.LastModified); err == nil {
+		header.Set("Last-Modified", t.UTC().Format(http.TimeFormat))
+	}
+	for name, value := range object.Metadata {
+		header.Set(metaPrefix+name, value)
+	}
+	status := http.StatusOK
+	if partial {
+		status = http.StatusPartialContent
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, object.Size))
+	}
+	if file == nil {
+		w.WriteHeader(status)
+		return nil
+	}
+
+	hashSlotTable, err := g.hashSlotTable()
+	if err != nil {
+		return err
+	}
+	reader := storage.NewReader(hashSlotTable, g.Nodes)
+	reader.SlotTables = g.Ledger
+	reader.DialOptions = g.DialOptions
+	reader.Cache = g.Cache
+	body := &responseBody{w: w, status: status}
+	err = reader.ReadRange(r.Context(), file, offset, length, body)
+	if err != nil && body.started {
+		// The client sees the body cut short
+		panic(http.ErrAbortHandler)
+	}
+	if err != nil {
+		return err
+	}
+	metrics.BytesServed.Add(float64(length))
+	return nil
+}
+
+func (g *Gateway) deleteObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	if err := g.checkBucket(bucket); err != nil {
+		return err
+	}
+	object, err := g.Ledger.GetObject(bucket, key)
+	if err != nil {
+		return err
+	}
+	if _, err := g.Ledger.DeleteObject(bucket, key); err != nil {
+		return submitted("DeleteObject", err)
+	}
+	if object != nil {
+		g.release(r.Context(), object.FileHash)
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// partETag returns the ETag of a part or of a whole object stored at once.
+func partETag(content []byte) string {
+	sum := md5.Sum(content)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// multipartETag returns the ETag of an object stored in parts, the MD5 of the
+// MD5 of its parts followed by their number.
+func multipartETag(partETags []string) string {
+	var sums bytes.Buffer
+	for _, etag := range partETags {
+		sum, _ := hex.DecodeString(strings.Trim(etag, `"`))
+		sums.Write(sum)
+	}
+	sum := md5.Sum(sums.Bytes())
+	return fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(sum[:]), len(partETags))
+}
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/schema"
+	"google.golang.org/grpc"
+)
+
+// auditPageSize is the number of files listed per ListFiles call of an audit.
+const auditPageSize = 100
+
+// Auditor is the part of the chaincode CountShards calls, a ledger.Fabric.
+type Auditor interface {
+	SlotTables
+	ListFiles(pageSize int, bookmark string) (*FilePage, error)
+	GetFileTree(fileHash string) (*schema.FileTree, error)
+}
+
+// CountShards fetches every chunk of every stored file and returns the
+// number of intact shards each node holds, as ReportShards of the chaincode
+// takes them. Files that cannot be verified are left out of the counts and
+// reported in the error, so a partial count is not mistaken for a full one.
+func CountShards(ctx context.Context, chain Auditor, hashSlotTable HashSlotTable, nodes []string, dialOptions ...grpc.DialOption) (map[string]int, error) {
+	repairer := NewRepairer(hashSlotTable, nodes)
+	repairer.DialOptions = dialOptions
+	repairer.SlotTables = chain
+
+	shards := make(map[string]int)
+	var errs []error
+	bookmark := ""
+	for {
+		page, err := chain.ListFiles(auditPageSize, bookmark)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files: %v", err)
+		}
+
+		for _, metadata := range page.Records {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			tree, err := chain.GetFileTree(metadata.FileHash)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to get file tree %s: %w", metadata.FileHash, err))
+				continue
+			}
+			file := (*File)(tree)
+			reports, err := repairer.Verify(ctx, file)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to verify file %s: %v", file.FileHash, err))
+				continue
+			}
+			for _, report := range reports {
+				for i, state := range report.Shards {
+					if state == ShardOK || state == ShardMisplaced {
+						shards[report.Nodes[i]]++
+					}
+				}
+			}
+		}
+
+		bookmark = page.Bookmark
+		if bookmark == "" || len(page.Records) == 0 {
+			break
+		}
+	}
+	return shards, errors.Join(errs...)
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/schema"
+	utils "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/utils"
+)
+
+// listingLedger lists the files of expiryLedger one per page, failing to
+// get the trees of files it lists but does not hold.
+type listingLedger struct {
+	expiryLedger
+	listed []string
+}
+
+func (l *listingLedger) ListFiles(pageSize int, bookmark string) (*FilePage, error) {
+	index := 0
+	if bookmark != "" {
+		index, _ = strconv.Atoi(bookmark)
+	}
+	page := &FilePage{Records: []*FileMetadata{{FileHash: l.listed[index]}}}
+	if index+1 < len(l.listed) {
+		page.Bookmark = strconv.Itoa(index + 1)
+	}
+	return page, nil
+}
+
+func (l *listingLedger) GetFileTree(fileHash string) (*schema.FileTree, error) {
+	file, ok := l.files[fileHash]
+	if !ok {
+		return nil, fmt.Errorf("file %s does not exist", fileHash)
+	}
+	return (*schema.FileTree)(file), nil
+}
+
+func (l *listingLedger) GetHashSlotTableByEpoch(epoch int) (*HashSlotTable, error) {
+	return nil, fmt.Errorf("hash slot table of epoch %d does not exist", epoch)
+}
+
+func TestCountShards(t *testing.T) {
+	c := newTestCluster(t, 3)
+	ledger := &listingLedger{expiryLedger: expiryLedger{files: make(map[string]*File)}}
+	for i := 0; i < 2; i++ {
+		_, file := uploadRandomFile(t, c, 2*utils.StripeSize)
+		ledger.files[file.FileHash] = file
+		ledger.listed = append(ledger.listed, file.FileHash)
+	}
+
+	shards, err := CountShards(context.Background(), ledger, c.hashSlotTable, c.nodes, c.dialer)
+	if err != nil {
+		t.Fatalf("count failed: %v", err)
+	}
+	total := 0
+	for _, node := range c.nodes {
+		if shards[node] == 0 {
+			t.Fatalf("node %s holds no shards: %v", node, shards)
+		}
+		total += shards[node]
+	}
+	if want := 4 * utils.N; total != want {
+		t.Fatalf("counted %d shards, want %d", total, want)
+	}
+
+	// Lost chunks are not counted, and a file that cannot be loaded is
+	// reported
+	lost := ledger.files[ledger.listed[0]].StripeHashes[0].ChunkHashes[0].ChunkHash
+	for _, srv := range c.servers {
+		srv.Lose(lost)
+	}
+	ledger.listed = append(ledger.listed, strings.Repeat("0", 64))
+	shards, err = CountShards(context.Background(), ledger, c.hashSlotTable, c.nodes, c.dialer)
+	if err == nil {
+		t.Fatalf("expected the missing file to be reported")
+	}
+	total = 0
+	for _, count := range shards {
+		total += count
+	}
+	if want := 4*utils.N - 1; total != want {
+		t.Fatalf("counted %d shards, want %d", total, want)
+	}
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"container/list"
+	"sync"
+
+	metrics "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/metrics"
+)
+
+// ChunkCache keeps recently written and recently read chunks in memory. It is
+// bounded by the total size of the cached chunks and evicts the least
+// recently used ones first. A nil *ChunkCache is valid and caches nothing.
+type ChunkCache struct {
+	mu       sync.Mutex
+	capacity int64
+	size     int64
+	order    *list.List
+	entries  map[string]*list.Element
+	stats    CacheStats
+}
+
+type cacheEntry struct {
+	chunkHash string
+	data      []byte
+}
+
+// CacheStats are the counters of a ChunkCache since it was created.
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Entries   int
+	Bytes     int64
+}
+
+func NewChunkCache(capacity int64) *ChunkCache {
+	return &ChunkCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// Get returns a cached chunk and marks it as recently used. The returned
+// slice is shared with the cache and must not be modified.
+func (c *ChunkCache) Get(chunkHash string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[chunkHash]
+	if !ok {
+		c.stats.Misses++
+		metrics.CacheLookups.WithLabelValues("miss").Inc()
+		return nil, false
+	}
+	c.stats.Hits++
+	metrics.CacheLookups.WithLabelValues("hit").Inc()
+	c.order.MoveToFront(elem)
+	return elem.Value.(*cacheEntry).data, true
+}
+
+// Put adds a chunk, evicting least recently used chunks until the cache fits
+// its capacity. Chunks larger than the whole cache are not stored. The chunk
+// is copied, so data may be a slice of a larger buffer.
+func (c *ChunkCache) Put(chunkHash string, data []byte) {
+	if c == nil || int64(len(data)) > c.capacity {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[chunkHash]; ok {
+		c.order.MoveToFront(elem)
+		return
+	}
+	entry := &cacheEntry{chunkHash: chunkHash, data: append([]byte(nil), data...)}
+	c.entries[chunkHash] = c.order.PushFront(entry)
+	c.size += int64(len(data))
+
+	for c.size > c.capacity {
+		elem := c.order.Back()
+		entry := elem.Value.(*cacheEntry)
+		c.order.Remove(elem)
+		delete(c.entries, entry.chunkHash)
+		c.size -= int64(len(entry.data))
+		c.stats.Evictions++
+		metrics.CacheEvictions.Inc()
+	}
+}
+
+func (c *ChunkCache) Stats() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = len(c.entries)
+	stats.Bytes = c.size
+	return stats
+}
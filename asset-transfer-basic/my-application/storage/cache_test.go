@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	utils "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/utils"
+)
+
+func TestChunkCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewChunkCache(30)
+	c.Put("a", make([]byte, 10))
+	c.Put("b", make([]byte, 10))
+	c.Put("c", make([]byte, 10))
+
+	// Touch a so that b is the least recently used chunk.
+	if _, ok := c.Get("a"); !ok {
+		t.Fatalf("expected a to be cached")
+	}
+	c.Put("d", make([]byte, 10))
+
+	if _, ok := c.Get("b"); ok {
+		t.Fatalf("expected b to be evicted")
+	}
+	for _, hash := range []string{"a", "c", "d"} {
+		if _, ok := c.Get(hash); !ok {
+			t.Fatalf("expected %s to be cached", hash)
+		}
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 4 || stats.Misses != 1 || stats.Evictions != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if stats.Entries != 3 || stats.Bytes != 30 {
+		t.Fatalf("unexpected size %+v", stats)
+	}
+}
+
+func TestChunkCacheSkipsOversizedChunks(t *testing.T) {
+	c := NewChunkCache(10)
+	c.Put("a", make([]byte, 5))
+	c.Put("big", make([]byte, 11))
+
+	if _, ok := c.Get("big"); ok {
+		t.Fatalf("expected oversized chunk not to be cached")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Fatalf("expected a to survive an oversized put")
+	}
+}
+
+func TestNilChunkCache(t *testing.T) {
+	var c *ChunkCache
+	c.Put("a", []byte("data"))
+	if _, ok := c.Get("a"); ok {
+		t.Fatalf("nil cache returned a chunk")
+	}
+}
+
+func TestReadServedFromCache(t *testing.T) {
+	c := newTestCluster(t, 3)
+	cache := NewChunkCache(1 << 20)
+	u := c.uploader(2, 2)
+	u.OnChunk = cache.Put
+	content := randomContent(t, 4*utils.StripeSize)
+	file, err := u.Upload(context.Background(), content)
+	if err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+
+	r := c.reader()
+	r.Cache = cache
+	var out bytes.Buffer
+	if err := r.ReadFile(context.Background(), file, &out); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), content) {
+		t.Fatalf("read returned different content")
+	}
+	if gets := c.totalGets(); gets != 0 {
+		t.Fatalf("expected no remote requests, got %d", gets)
+	}
+
+	// A reader with an empty cache fills it so the second read stays local.
+	r.Cache = NewChunkCache(1 << 20)
+	for i := 0; i < 2; i++ {
+		out.Reset()
+		if err := r.ReadFile(context.Background(), file, &out); err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+	}
+	if gets := c.totalGets(); gets != 4*utils.K {
+		t.Fatalf("expected %d remote requests, got %d", 4*utils.K, gets)
+	}
+	if stats := r.Cache.Stats(); stats.Hits != uint64(4*utils.K) {
+		t.Fatalf("unexpected cache stats %+v", stats)
+	}
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"crypto/rand"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/schema"
+	storagetest "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/internal/storagetest"
+	"google.golang.org/grpc"
+)
+
+type testCluster struct {
+	nodes         []string
+	servers       map[string]*storagetest.ChunkStorage
+	hashSlotTable HashSlotTable
+	dialer        grpc.DialOption
+}
+
+// newTestCluster starts one in-process ChunkStorage server per node over
+// bufconn and splits the hash slots evenly between them.
+func newTestCluster(t testing.TB, numNodes int) *testCluster {
+	weights := make(map[string]int)
+	for i := 0; i < numNodes; i++ {
+		weights[fmt.Sprintf("node%d", i)] = 1
+	}
+	hashSlotTable, err := schema.AllocateSlots(weights)
+	if err != nil {
+		t.Fatalf("failed to allocate slots: %v", err)
+	}
+
+	c := &testCluster{hashSlotTable: *hashSlotTable}
+	for i := 0; i < numNodes; i++ {
+		c.nodes = append(c.nodes, fmt.Sprintf("node%d", i))
+	}
+	cluster := storagetest.NewCluster(t, c.nodes...)
+	c.servers = cluster.Stores()
+	c.dialer = cluster.Dialer()
+	return c
+}
+
+func (c *testCluster) reader() *Reader {
+	r := NewReader(c.hashSlotTable, c.nodes)
+	r.DialOptions = []grpc.DialOption{c.dialer}
+	return r
+}
+
+func (c *testCluster) repairer() *Repairer {
+	r := NewRepairer(c.hashSlotTable, c.nodes)
+	r.DialOptions = []grpc.DialOption{c.dialer}
+	return r
+}
+
+func (c *testCluster) uploader(workers, inFlight int) *Uploader {
+	u := NewUploader(c.hashSlotTable, c.nodes)
+	u.Workers = workers
+	u.InFlight = inFlight
+	u.DialOptions = []grpc.DialOption{c.dialer}
+	return u
+}
+
+func randomContent(t testing.TB, size int) []byte {
+	content := make([]byte, size)
+	if _, err := rand.Read(content); err != nil {
+		t.Fatalf("failed to generate content: %v", err)
+	}
+	return content
+}
+
+func (c *testCluster) totalGets() int {
+	total := 0
+	for _, srv := range c.servers {
+		total += srv.Gets()
+	}
+	return total
+}
@@ -0,0 +1,25 @@
+package storage
+
+import (
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/schema"
+)
+
+// The chaincode keeps the stripes of a tree in segments of SegmentSize
+// stripes under their own keys, so large trees are read a segment at a time.
+type (
+	FileTreeHeader  = schema.FileTreeHeader
+	FileTreeSegment = schema.FileTreeSegment
+)
+
+// Segments splits the stripes of f into segments of segmentSize stripes.
+func (f *File) Segments(segmentSize int) []FileTreeSegment {
+	var segments []FileTreeSegment
+	for start := 0; start < len(f.StripeHashes); start += segmentSize {
+		end := min(start+segmentSize, len(f.StripeHashes))
+		segments = append(segments, FileTreeSegment{
+			Index:        len(segments),
+			StripeHashes: f.StripeHashes[start:end],
+		})
+	}
+	return segments
+}
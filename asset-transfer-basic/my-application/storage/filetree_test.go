@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+)
+
+func testFile(stripes int) *File {
+	file := &File{FileHash: "file", FileSize: int64(stripes) * 100}
+	for i := 0; i < stripes; i++ {
+		file.AddStripe(Stripe{
+			StripeHash:  fmt.Sprintf("stripe%d", i),
+			ChunkHashes: []Chunk{{ChunkHash: fmt.Sprintf("chunk%d", i)}},
+		})
+	}
+	return file
+}
+
+func TestSegments(t *testing.T) {
+	file := testFile(7)
+	segments := file.Segments(3)
+
+	if len(segments) != 3 {
+		t.Fatalf("got %d segments, want 3", len(segments))
+	}
+	for i, want := range []int{3, 3, 1} {
+		if segments[i].Index != i || len(segments[i].StripeHashes) != want {
+			t.Errorf("segment %d: index %d, %d stripes, want %d", i, segments[i].Index, len(segments[i].StripeHashes), want)
+		}
+	}
+	if segments[2].StripeHashes[0].StripeHash != "stripe6" {
+		t.Errorf("last segment starts with %s", segments[2].StripeHashes[0].StripeHash)
+	}
+
+	if got := (&File{}).Segments(3); len(got) != 0 {
+		t.Errorf("empty file has %d segments", len(got))
+	}
+}
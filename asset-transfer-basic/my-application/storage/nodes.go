@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"fmt"
+
+	pb "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/protos"
+	"google.golang.org/grpc"
+)
+
+// dialNodes opens one connection to every storage node and every org of the
+// hash slot table. The returned function closes all of them.
+func dialNodes(hashSlotTable HashSlotTable, nodes []string, dialOptions []grpc.DialOption) (map[string]pb.ChunkStorageClient, func(), error) {
+	addrs := append([]string{}, nodes...)
+	for org := range hashSlotTable.HST {
+		addrs = append(addrs, org)
+	}
+
+	opts := append([]grpc.DialOption{grpc.WithInsecure()}, dialOptions...)
+	clients := make(map[string]pb.ChunkStorageClient)
+	conns := make([]*grpc.ClientConn, 0, len(addrs))
+	closeConns := func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}
+	for _, addr := range addrs {
+		if _, ok := clients[addr]; ok {
+			continue
+		}
+		conn, err := grpc.Dial(addr, opts...)
+		if err != nil {
+			closeConns()
+			return nil, nil, fmt.Errorf("failed to connect to %s: %v", addr, err)
+		}
+		conns = append(conns, conn)
+		clients[addr] = pb.NewChunkStorageClient(conn)
+	}
+	return clients, closeConns, nil
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/schema"
+	utils "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/utils"
+)
+
+// The ledger records are defined by the schema package of the chaincode.
+type (
+	Chunk             = schema.Chunk
+	Stripe            = schema.StripeTree
+	FileMetadata      = schema.FileMetadata
+	FileMetadataInput = schema.FileMetadataInput
+	DeletedFile       = schema.DeletedFile
+	FilePage          = schema.PaginatedFileResult
+	Usage             = schema.Usage
+	LegalHold         = schema.LegalHold
+	Retention         = schema.Retention
+	Bucket            = schema.Bucket
+	ObjectInput       = schema.ObjectInput
+	Object            = schema.Object
+	ObjectPage        = schema.ObjectPage
+	Ref               = schema.Ref
+	RefHistoryRecord  = schema.RefHistoryRecord
+	PaymentConfig     = schema.PaymentConfig
+	Escrow            = schema.Escrow
+	ShardReport       = schema.ShardReport
+	Settlement        = schema.Settlement
+)
+
+// File is the tree of a stored file. It converts to and from a
+// schema.FileTree.
+type File struct {
+	FileHash string `json:"fileHash"`
+	// FileSize is the length of the file without the padding of its last
+	// stripe. Trees stored before it was recorded leave it at zero.
+	FileSize int64 `json:"fileSize,omitempty"`
+	// Codec names the utils.Codec the stripes were coded with, empty for
+	// utils.DefaultCodec.
+	Codec string `json:"codec,omitempty"`
+	// SlotTableEpoch is the epoch of the hash slot table the chunks were
+	// placed by, zero when unknown.
+	SlotTableEpoch int      `json:"slotTableEpoch,omitempty"`
+	StripeHashes   []Stripe `json:"stripeHashes"`
+}
+
+func (f *File) SetHashValue(hashValue string) {
+	f.FileHash = hashValue
+}
+
+func (f *File) AddStripe(stripe Stripe) {
+	f.StripeHashes = append(f.StripeHashes, stripe)
+}
+
+// GetCodec returns the codec that decodes the stripes of the file.
+func (f *File) GetCodec() (utils.Codec, error) {
+	return utils.GetCodec(f.Codec)
+}
+
+// Size returns the number of bytes a reader produces for the file.
+func (f *File) Size() int64 {
+	if f.FileSize > 0 {
+		return f.FileSize
+	}
+	return int64(len(f.StripeHashes)) * int64(utils.StripeSize)
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/schema"
+)
+
+type (
+	Slot          = schema.Slot
+	HashSlotTable = schema.HashSlotTable
+)
+
+// SlotID maps a hex encoded hash onto the hash slot ring.
+func SlotID(hash string) int {
+	return schema.SlotID(hash)
+}
+
+// GetOrgID returns the org whose slot range contains the hash.
+func GetOrgID(hash string, hashSlotTable HashSlotTable) string {
+	orgID, _ := schema.NewSlotRing(hashSlotTable).Lookup(SlotID(hash))
+	return orgID
+}
+
+// PlaceStripe decides where the chunks of one stripe are written, by the
+// rules LocateStripe of the chaincode reports them with; see
+// schema.SlotRing.PlaceStripe. When home[i] and actual[i] differ the home
+// node keeps a link to the actual one.
+func PlaceStripe(chunkHashes []string, hashSlotTable HashSlotTable) (home []string, actual []string) {
+	return schema.NewSlotRing(hashSlotTable).PlaceStripe(chunkHashes)
+}
+
+// SlotTables returns the hash slot table of an epoch, a ledger.Client. The
+// chunks of a file stay where the table of its SlotTableEpoch placed them
+// until they are moved to the nodes of a newer table.
+type SlotTables interface {
+	GetHashSlotTableByEpoch(epoch int) (*HashSlotTable, error)
+}
+
+// uploadTable returns the table the chunks of file were placed by, or nil
+// when it is unknown or hashSlotTable itself.
+func uploadTable(file *File, hashSlotTable HashSlotTable, tables SlotTables) (*HashSlotTable, error) {
+	if file.SlotTableEpoch == 0 || file.SlotTableEpoch == hashSlotTable.Epoch || tables == nil {
+		return nil, nil
+	}
+	table, err := tables.GetHashSlotTableByEpoch(file.SlotTableEpoch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hash slot table of epoch %d of file %s: %v", file.SlotTableEpoch, file.FileHash, err)
+	}
+	return table, nil
+}
+
+// LocateStripe lists the nodes each chunk of a stripe is looked for on, in
+// the order of LocateStripe of the chaincode: the node it is written to by
+// hashSlotTable and its home node, then the same by uploadTable, the table
+// of the upload, for chunks not moved since. uploadTable may be nil.
+func LocateStripe(chunkHashes []string, hashSlotTable HashSlotTable, uploadTable *HashSlotTable) [][]string {
+	home, actual := PlaceStripe(chunkHashes, hashSlotTable)
+	var uploadHome, uploadActual []string
+	if uploadTable != nil {
+		uploadHome, uploadActual = PlaceStripe(chunkHashes, *uploadTable)
+	}
+	holders := make([][]string, len(chunkHashes))
+	for i := range chunkHashes {
+		holders[i] = appendHolder(holders[i], actual[i])
+		holders[i] = appendHolder(holders[i], home[i])
+		if uploadTable != nil {
+			holders[i] = appendHolder(holders[i], uploadActual[i])
+			holders[i] = appendHolder(holders[i], uploadHome[i])
+		}
+	}
+	return holders
+}
+
+func appendHolder(holders []string, addr string) []string {
+	for _, holder := range holders {
+		if holder == addr {
+			return holders
+		}
+	}
+	return append(holders, addr)
+}
+
+// tableNodes returns the orgs of table, none for a nil table.
+func tableNodes(table *HashSlotTable) []string {
+	if table == nil {
+		return nil
+	}
+	nodes := make([]string, 0, len(table.HST))
+	for org := range table.HST {
+		nodes = append(nodes, org)
+	}
+	return nodes
+}
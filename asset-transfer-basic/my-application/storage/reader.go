@@ -0,0 +1,294 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	metrics "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/metrics"
+	pb "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/protos"
+	utils "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/utils"
+	"google.golang.org/grpc"
+)
+
+// Reader fetches files from the storage nodes. Up to StripesInFlight stripes
+// are fetched concurrently and written out in order. Each stripe starts by
+// requesting its data shards only; the parity shards are requested when a
+// data shard fails or has not arrived after HedgeDelay. Shard requests still
+// outstanding once a stripe can be decoded are cancelled. Stripes whose data
+// shards all arrived are joined without decoding. Stripes are decoded with
+// the codec named in the file tree. Chunks missing where HashSlotTable places
+// them are looked for where the table of the upload of the file did.
+type Reader struct {
+	HashSlotTable HashSlotTable
+	Nodes         []string
+	// SlotTables, if set, gives the tables files were stored with.
+	SlotTables SlotTables
+
+	// StripesInFlight is the number of stripes fetched concurrently.
+	StripesInFlight int
+	// HedgeDelay is how long to wait for the data shards before asking for
+	// parity shards as well.
+	HedgeDelay time.Duration
+	// DialOptions are appended to the options used to connect to nodes.
+	DialOptions []grpc.DialOption
+	// Cache, if set, is consulted before asking the storage nodes and keeps
+	// the chunks fetched from them.
+	Cache *ChunkCache
+}
+
+func NewReader(hashSlotTable HashSlotTable, nodes []string) *Reader {
+	return &Reader{
+		HashSlotTable:   hashSlotTable,
+		Nodes:           nodes,
+		StripesInFlight: 4,
+		HedgeDelay:      200 * time.Millisecond,
+	}
+}
+
+// ReadFile writes the whole file to w.
+func (r *Reader) ReadFile(ctx context.Context, file *File, w io.Writer) error {
+	return r.ReadRange(ctx, file, 0, file.Size(), w)
+}
+
+// ReadRange writes length bytes of the file starting at offset to w. Only
+// the stripes covering [offset, offset+length) are fetched.
+func (r *Reader) ReadRange(ctx context.Context, file *File, offset int64, length int64, w io.Writer) error {
+	size := file.Size()
+	if offset < 0 || length < 0 || offset+length > size {
+		return fmt.Errorf("range [%d, %d) is outside of file %s of size %d", offset, offset+length, file.FileHash, size)
+	}
+	if length == 0 {
+		return nil
+	}
+
+	codec, err := file.GetCodec()
+	if err != nil {
+		return err
+	}
+
+	stripeSize := int64(utils.StripeSize)
+	first := int(offset / stripeSize)
+	last := int((offset + length - 1) / stripeSize)
+
+	return r.readStripes(ctx, file, codec, first, last, func(index int, shards [][]byte) error {
+		start := int64(index) * stripeSize
+		window := &windowWriter{
+			w:      w,
+			skip:   max(offset, start) - start,
+			remain: min(offset+length, start+stripeSize) - max(offset, start),
+		}
+		decodeStart := time.Now()
+		err := codec.DecodeTo(window, shards)
+		metrics.DecodeDuration.Observe(time.Since(decodeStart).Seconds())
+		return err
+	})
+}
+
+// windowWriter drops the first skip bytes written to it and passes on at most
+// remain bytes after that.
+type windowWriter struct {
+	w      io.Writer
+	skip   int64
+	remain int64
+}
+
+func (ww *windowWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if ww.skip >= int64(len(p)) {
+		ww.skip -= int64(len(p))
+		return n, nil
+	}
+	p = p[ww.skip:]
+	ww.skip = 0
+	if int64(len(p)) > ww.remain {
+		p = p[:ww.remain]
+	}
+	ww.remain -= int64(len(p))
+	if _, err := ww.w.Write(p); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+var errCorruptChunk = errors.New("chunk is corrupted")
+
+type stripeResult struct {
+	shards [][]byte
+	err    error
+}
+
+// readStripes fetches stripes first..last and hands their shards to emit in
+// order.
+func (r *Reader) readStripes(ctx context.Context, file *File, codec utils.Codec, first int, last int, emit func(index int, shards [][]byte) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	upload, err := uploadTable(file, r.HashSlotTable, r.SlotTables)
+	if err != nil {
+		return err
+	}
+	clients, closeConns, err := dialNodes(r.HashSlotTable, append(tableNodes(upload), r.Nodes...), r.DialOptions)
+	if err != nil {
+		return err
+	}
+	defer closeConns()
+
+	pending := make([]chan stripeResult, 0, max(r.StripesInFlight, 1))
+	next := first
+	startNext := func() {
+		ch := make(chan stripeResult, 1)
+		index := next
+		go func() {
+			shards, err := r.fetchStripe(ctx, clients, file, codec, upload, index)
+			ch <- stripeResult{shards: shards, err: err}
+		}()
+		pending = append(pending, ch)
+		next++
+	}
+
+	for next <= last && len(pending) < cap(pending) {
+		startNext()
+	}
+	for index := first; index <= last; index++ {
+		res := <-pending[0]
+		pending = pending[1:]
+		if res.err != nil {
+			return fmt.Errorf("failed to read stripe %d of file %s: %v", index, file.FileHash, res.err)
+		}
+		if next <= last {
+			startNext()
+		}
+		if err := emit(index, res.shards); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type shardResult struct {
+	index int
+	data  []byte
+	err   error
+}
+
+// fetchStripe collects shards of a stripe until the codec can decode them,
+// preferring the data shards. Shards that were not fetched are left nil.
+// upload is the table the file was stored with when it is not the current
+// one.
+func (r *Reader) fetchStripe(ctx context.Context, clients map[string]pb.ChunkStorageClient, file *File, codec utils.Codec, upload *HashSlotTable, index int) ([][]byte, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stripe := file.StripeHashes[index]
+	logger := slog.With("file", file.FileHash, "stripe", index)
+	n := len(stripe.ChunkHashes)
+	if n != codec.Shards() {
+		return nil, fmt.Errorf("stripe %s has %d chunks, %s codes %d", stripe.StripeHash, n, codec.Name(), codec.Shards())
+	}
+	k := codec.DataShards()
+	chunkHashes := stripeChunkHashes(stripe)
+	holders := LocateStripe(chunkHashes, r.HashSlotTable, upload)
+
+	// Buffered so that late replies never block after we stop listening.
+	results := make(chan shardResult, n)
+	request := func(i int) {
+		if data, ok := r.Cache.Get(chunkHashes[i]); ok {
+			results <- shardResult{index: i, data: data}
+			return
+		}
+		go func() {
+			data, _, err := fetchChunk(ctx, clients, holders[i], chunkHashes[i])
+			if err == nil {
+				r.Cache.Put(chunkHashes[i], data)
+			}
+			results <- shardResult{index: i, data: data, err: err}
+		}()
+	}
+
+	outstanding := 0
+	for i := 0; i < k; i++ {
+		request(i)
+		outstanding++
+	}
+	hedged := false
+	hedge := func(reason string) {
+		if hedged {
+			return
+		}
+		hedged = true
+		logger.Debug("requesting parity shards", "reason", reason)
+		for i := k; i < n; i++ {
+			request(i)
+			outstanding++
+		}
+	}
+
+	timer := time.NewTimer(r.HedgeDelay)
+	defer timer.Stop()
+
+	shards := make([][]byte, n)
+	received := 0
+	var lastErr error
+	for !codec.Recoverable(shards) {
+		if outstanding == 0 {
+			return nil, fmt.Errorf("only %d of %d shards available, too few to decode: %v", received, n, lastErr)
+		}
+		select {
+		case res := <-results:
+			outstanding--
+			if res.err != nil {
+				lastErr = res.err
+				logger.Warn("failed to fetch shard", "shard", res.index, "peer", holders[res.index][0], "err", res.err)
+				hedge("shard failed")
+				continue
+			}
+			shards[res.index] = res.data
+			received++
+		case <-timer.C:
+			hedge("data shards are slow")
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return shards, nil
+}
+
+// fetchChunk asks the holders of a chunk in turn, see LocateStripe: the node
+// it was written to, then the node owning its hash slot, which forwards the
+// request through its link, then the nodes of the table of the upload. It
+// returns the holder the chunk came from, or the error of the first one.
+func fetchChunk(ctx context.Context, clients map[string]pb.ChunkStorageClient, holders []string, chunkHash string) ([]byte, string, error) {
+	var firstErr error
+	for _, addr := range holders {
+		data, err := getChunk(ctx, clients, addr, chunkHash)
+		if err == nil {
+			return data, addr, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, "", firstErr
+}
+
+func getChunk(ctx context.Context, clients map[string]pb.ChunkStorageClient, addr string, chunkHash string) ([]byte, error) {
+	client, ok := clients[addr]
+	if !ok {
+		return nil, fmt.Errorf("unknown storage node %q", addr)
+	}
+	res, err := client.GetChunk(ctx, &pb.ChunkRequest{Hash: chunkHash})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chunk %s from %s: %v", chunkHash, addr, err)
+	}
+	if utils.GetHash(res.GetData()) != chunkHash {
+		return nil, fmt.Errorf("chunk %s from %s: %w", chunkHash, addr, errCorruptChunk)
+	}
+	return res.GetData(), nil
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	utils "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/utils"
+)
+
+func uploadRandomFile(t *testing.T, c *testCluster, size int) ([]byte, *File) {
+	content := randomContent(t, size)
+	file, err := c.uploader(2, 2).Upload(context.Background(), content)
+	if err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+	return content, file
+}
+
+func TestReadFile(t *testing.T) {
+	c := newTestCluster(t, 3)
+	content, file := uploadRandomFile(t, c, 9*utils.StripeSize+7)
+
+	var out bytes.Buffer
+	if err := c.reader().ReadFile(context.Background(), file, &out); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), content) {
+		t.Fatalf("read returned different content")
+	}
+}
+
+func TestReadRange(t *testing.T) {
+	c := newTestCluster(t, 3)
+	content, file := uploadRandomFile(t, c, 5*utils.StripeSize+100)
+
+	for _, tc := range []struct {
+		name           string
+		offset, length int64
+		stripes        int
+	}{
+		{"within one stripe", 10, 100, 1},
+		{"across stripes", int64(utils.StripeSize) - 5, 10, 2},
+		{"tail", int64(5 * utils.StripeSize), 100, 1},
+		{"whole file", 0, int64(len(content)), 6},
+		{"empty", 42, 0, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			before := c.totalGets()
+			var out bytes.Buffer
+			if err := c.reader().ReadRange(context.Background(), file, tc.offset, tc.length, &out); err != nil {
+				t.Fatalf("read failed: %v", err)
+			}
+			if !bytes.Equal(out.Bytes(), content[tc.offset:tc.offset+tc.length]) {
+				t.Fatalf("read returned different content")
+			}
+			if gets := c.totalGets() - before; gets != tc.stripes*utils.K {
+				t.Fatalf("expected %d chunk requests, got %d", tc.stripes*utils.K, gets)
+			}
+		})
+	}
+
+	var out bytes.Buffer
+	if err := c.reader().ReadRange(context.Background(), file, int64(len(content))-1, 2, &out); err == nil {
+		t.Fatalf("expected reading past the end of the file to fail")
+	}
+}
+
+func TestReadHedgesSlowDataShards(t *testing.T) {
+	c := newTestCluster(t, 3)
+	content, file := uploadRandomFile(t, c, 3*utils.StripeSize)
+
+	// With one slow node every stripe still has K shards on fast nodes, so
+	// a hedged read does not have to wait for it.
+	c.servers[c.nodes[0]].SetDelay(time.Second)
+
+	r := c.reader()
+	r.HedgeDelay = 10 * time.Millisecond
+	start := time.Now()
+	var out bytes.Buffer
+	if err := r.ReadFile(context.Background(), file, &out); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), content) {
+		t.Fatalf("read returned different content")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("hedged read took %v", elapsed)
+	}
+}
+
+func TestReadSurvivesLostShards(t *testing.T) {
+	c := newTestCluster(t, 3)
+	content, file := uploadRandomFile(t, c, 4*utils.StripeSize)
+
+	// Losing one node leaves at least K shards of every stripe.
+	c.servers[c.nodes[1]].Wipe()
+
+	var out bytes.Buffer
+	if err := c.reader().ReadFile(context.Background(), file, &out); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), content) {
+		t.Fatalf("read returned different content")
+	}
+}
+
+func TestReadCancelled(t *testing.T) {
+	c := newTestCluster(t, 3)
+	_, file := uploadRandomFile(t, c, 2*utils.StripeSize)
+	for _, srv := range c.servers {
+		srv.SetDelay(time.Minute)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var out bytes.Buffer
+	if err := c.reader().ReadFile(ctx, file, &out); err == nil {
+		t.Fatalf("expected cancelled read to fail")
+	}
+}
@@ -0,0 +1,381 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	pb "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/protos"
+	utils "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/utils"
+	"google.golang.org/grpc"
+)
+
+type ShardState int
+
+const (
+	ShardOK ShardState = iota
+	ShardMissing
+	ShardCorrupt
+	// ShardMisplaced is a shard intact only where the table of the upload
+	// of the file placed it, not yet moved to the nodes of the current one.
+	ShardMisplaced
+)
+
+func (s ShardState) String() string {
+	switch s {
+	case ShardOK:
+		return "ok"
+	case ShardMissing:
+		return "missing"
+	case ShardCorrupt:
+		return "corrupt"
+	case ShardMisplaced:
+		return "misplaced"
+	}
+	return fmt.Sprintf("ShardState(%d)", int(s))
+}
+
+// StripeReport is the state of every shard of one stripe and the node the
+// shard is expected on, or was found on if it is misplaced.
+type StripeReport struct {
+	Index  int
+	Shards []ShardState
+	Nodes  []string
+	// DataShards is the number of data shards of the codec of the file.
+	DataShards int
+}
+
+// Available returns the number of intact shards, misplaced ones included.
+func (r StripeReport) Available() int {
+	available := 0
+	for _, state := range r.Shards {
+		if state == ShardOK || state == ShardMisplaced {
+			available++
+		}
+	}
+	return available
+}
+
+// Healthy reports whether every shard is intact where the current table
+// places it.
+func (r StripeReport) Healthy() bool {
+	for _, state := range r.Shards {
+		if state != ShardOK {
+			return false
+		}
+	}
+	return true
+}
+
+// Recoverable reports whether enough shards are left to rebuild the others.
+// With an LRC codec some patterns of that many shards are still not enough.
+func (r StripeReport) Recoverable() bool {
+	return r.Available() >= r.DataShards
+}
+
+// Repairer checks that every chunk of a file is stored intact and rewrites
+// the chunks that are missing or corrupted. Chunks still stored where the
+// table of the upload of the file placed them are moved to the nodes of
+// HashSlotTable.
+type Repairer struct {
+	HashSlotTable HashSlotTable
+	Nodes         []string
+	// SlotTables, if set, gives the tables files were stored with.
+	SlotTables SlotTables
+	// DialOptions are appended to the options used to connect to nodes.
+	DialOptions []grpc.DialOption
+}
+
+func NewRepairer(hashSlotTable HashSlotTable, nodes []string) *Repairer {
+	return &Repairer{HashSlotTable: hashSlotTable, Nodes: nodes}
+}
+
+// Verify fetches every chunk of the file and reports the state of each
+// stripe.
+func (r *Repairer) Verify(ctx context.Context, file *File) ([]StripeReport, error) {
+	codec, err := file.GetCodec()
+	if err != nil {
+		return nil, err
+	}
+	upload, clients, closeConns, err := r.dial(file)
+	if err != nil {
+		return nil, err
+	}
+	defer closeConns()
+
+	reports := make([]StripeReport, len(file.StripeHashes))
+	for index := range file.StripeHashes {
+		report, _, err := r.verifyStripe(ctx, clients, file, codec, upload, index)
+		if err != nil {
+			return nil, err
+		}
+		reports[index] = report
+	}
+	return reports, nil
+}
+
+// Repair rebuilds the missing and corrupted chunks of the file from the
+// intact ones and stores them again, and moves the misplaced ones. It returns
+// the number of chunks rewritten and fails if a stripe has too few intact
+// shards left.
+func (r *Repairer) Repair(ctx context.Context, file *File) (int, error) {
+	codec, err := file.GetCodec()
+	if err != nil {
+		return 0, err
+	}
+	upload, clients, closeConns, err := r.dial(file)
+	if err != nil {
+		return 0, err
+	}
+	defer closeConns()
+
+	repaired := 0
+	for index, stripe := range file.StripeHashes {
+		report, shards, err := r.verifyStripe(ctx, clients, file, codec, upload, index)
+		if err != nil {
+			return repaired, err
+		}
+		if report.Healthy() {
+			continue
+		}
+		if !codec.Recoverable(shards) {
+			return repaired, fmt.Errorf("stripe %d of file %s has only %d intact shards", index, file.FileHash, report.Available())
+		}
+
+		err = codec.Reconstruct(shards)
+		if err != nil {
+			return repaired, fmt.Errorf("failed to reconstruct stripe %d of file %s: %v", index, file.FileHash, err)
+		}
+
+		chunkHashes := stripeChunkHashes(stripe)
+		home, actual := PlaceStripe(chunkHashes, r.HashSlotTable)
+		for i, state := range report.Shards {
+			if state == ShardOK {
+				continue
+			}
+			if utils.GetHash(shards[i]) != chunkHashes[i] {
+				return repaired, fmt.Errorf("reconstructed chunk %s of stripe %d does not match its hash", chunkHashes[i], index)
+			}
+			w := shardWrite{home: home[i], addr: actual[i], chunkHash: chunkHashes[i], chunk: shards[i]}
+			if err := writeShard(ctx, clients, w); err != nil {
+				return repaired, err
+			}
+			if state == ShardMisplaced {
+				slog.Info("moved chunk", "file", file.FileHash, "stripe", index, "shard", i, "from", report.Nodes[i], "peer", actual[i])
+			} else {
+				slog.Info("repaired chunk", "file", file.FileHash, "stripe", index, "shard", i, "peer", actual[i])
+			}
+			repaired++
+		}
+	}
+	return repaired, nil
+}
+
+// RepairShards rebuilds the lost shards of one stripe and stores them again,
+// reading only the repair set of the codec: the other members of their local
+// groups with an LRC codec, DataShards shards otherwise. Shards of the repair
+// set that cannot be read are rebuilt as well, from a new repair set.
+func (r *Repairer) RepairShards(ctx context.Context, file *File, index int, lost []int) error {
+	codec, err := file.GetCodec()
+	if err != nil {
+		return err
+	}
+	if index < 0 || index >= len(file.StripeHashes) {
+		return fmt.Errorf("file %s has no stripe %d", file.FileHash, index)
+	}
+	upload, clients, closeConns, err := r.dial(file)
+	if err != nil {
+		return err
+	}
+	defer closeConns()
+
+	_, err = r.repairShards(ctx, clients, file, codec, upload, index, lost)
+	return err
+}
+
+// RepairNode rebuilds every chunk of the file stored on addr, e.g. after the
+// disk of the node was replaced, and returns the number of chunks rewritten.
+// Each stripe is rebuilt from the repair set of the chunks it lost.
+func (r *Repairer) RepairNode(ctx context.Context, file *File, addr string) (int, error) {
+	codec, err := file.GetCodec()
+	if err != nil {
+		return 0, err
+	}
+	upload, clients, closeConns, err := r.dial(file)
+	if err != nil {
+		return 0, err
+	}
+	defer closeConns()
+
+	repaired := 0
+	for index, stripe := range file.StripeHashes {
+		_, actual := PlaceStripe(stripeChunkHashes(stripe), r.HashSlotTable)
+		var lost []int
+		for i, node := range actual {
+			if node == addr {
+				lost = append(lost, i)
+			}
+		}
+		if len(lost) == 0 {
+			continue
+		}
+		n, err := r.repairShards(ctx, clients, file, codec, upload, index, lost)
+		repaired += n
+		if err != nil {
+			return repaired, err
+		}
+	}
+	return repaired, nil
+}
+
+// dial connects to the nodes of the current table and of the table of the
+// upload of file, which it returns when it is not the current one.
+func (r *Repairer) dial(file *File) (*HashSlotTable, map[string]pb.ChunkStorageClient, func(), error) {
+	upload, err := uploadTable(file, r.HashSlotTable, r.SlotTables)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	clients, closeConns, err := dialNodes(r.HashSlotTable, append(tableNodes(upload), r.Nodes...), r.DialOptions)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return upload, clients, closeConns, nil
+}
+
+// repairShards returns the number of chunks rewritten.
+func (r *Repairer) repairShards(ctx context.Context, clients map[string]pb.ChunkStorageClient, file *File, codec utils.Codec, upload *HashSlotTable, index int, lost []int) (int, error) {
+	chunkHashes := stripeChunkHashes(file.StripeHashes[index])
+	if len(chunkHashes) != codec.Shards() {
+		return 0, fmt.Errorf("stripe %d of file %s has %d chunks, %s codes %d", index, file.FileHash, len(chunkHashes), codec.Name(), codec.Shards())
+	}
+	home, actual := PlaceStripe(chunkHashes, r.HashSlotTable)
+	holders := LocateStripe(chunkHashes, r.HashSlotTable, upload)
+	logger := slog.With("file", file.FileHash, "stripe", index)
+
+	shards := make([][]byte, len(chunkHashes))
+	missing := append([]int(nil), lost...)
+	for {
+		failed := false
+		for _, i := range codec.RepairSet(missing) {
+			if shards[i] != nil {
+				continue
+			}
+			data, _, err := fetchChunk(ctx, clients, holders[i], chunkHashes[i])
+			if err != nil {
+				if ctx.Err() != nil {
+					return 0, ctx.Err()
+				}
+				logger.Warn("failed to fetch shard of repair set", "shard", i, "peer", actual[i], "err", err)
+				missing = append(missing, i)
+				failed = true
+				continue
+			}
+			shards[i] = data
+		}
+		if !failed {
+			break
+		}
+	}
+
+	if err := codec.Repair(shards, missing); err != nil {
+		return 0, fmt.Errorf("failed to repair stripe %d of file %s: %v", index, file.FileHash, err)
+	}
+	repaired := 0
+	for _, i := range missing {
+		if utils.GetHash(shards[i]) != chunkHashes[i] {
+			return repaired, fmt.Errorf("repaired chunk %s of stripe %d does not match its hash", chunkHashes[i], index)
+		}
+		w := shardWrite{home: home[i], addr: actual[i], chunkHash: chunkHashes[i], chunk: shards[i]}
+		if err := writeShard(ctx, clients, w); err != nil {
+			return repaired, err
+		}
+		logger.Info("repaired chunk", "shard", i, "peer", actual[i])
+		repaired++
+	}
+	return repaired, nil
+}
+
+// verifyStripe fetches every shard of a stripe. Shards that are not intact
+// are left nil.
+func (r *Repairer) verifyStripe(ctx context.Context, clients map[string]pb.ChunkStorageClient, file *File, codec utils.Codec, upload *HashSlotTable, index int) (StripeReport, [][]byte, error) {
+	chunkHashes := stripeChunkHashes(file.StripeHashes[index])
+	if len(chunkHashes) != codec.Shards() {
+		return StripeReport{}, nil, fmt.Errorf("stripe %d of file %s has %d chunks, %s codes %d", index, file.FileHash, len(chunkHashes), codec.Name(), codec.Shards())
+	}
+	home, actual := PlaceStripe(chunkHashes, r.HashSlotTable)
+	holders := LocateStripe(chunkHashes, r.HashSlotTable, upload)
+
+	report := StripeReport{
+		Index:      index,
+		Shards:     make([]ShardState, len(chunkHashes)),
+		Nodes:      append([]string(nil), actual...),
+		DataShards: codec.DataShards(),
+	}
+	shards := make([][]byte, len(chunkHashes))
+	for i, chunkHash := range chunkHashes {
+		data, addr, err := fetchChunk(ctx, clients, holders[i], chunkHash)
+		switch {
+		case err == nil:
+			shards[i] = data
+			if addr != actual[i] && addr != home[i] {
+				report.Shards[i] = ShardMisplaced
+				report.Nodes[i] = addr
+			}
+		case ctx.Err() != nil:
+			return StripeReport{}, nil, ctx.Err()
+		case errors.Is(err, errCorruptChunk):
+			report.Shards[i] = ShardCorrupt
+		default:
+			report.Shards[i] = ShardMissing
+		}
+	}
+	return report, shards, nil
+}
+
+// DeleteChunks removes the chunks a deleted file leaves unreferenced from the
+// storage nodes, together with the links pointing to them. Chunks are
+// addressed by their content, so only the chunks of the stripes no other file
+// holds are removed, apart from the chunks other stripes share.
+func DeleteChunks(ctx context.Context, deleted *DeletedFile, hashSlotTable HashSlotTable, nodes []string, dialOptions ...grpc.DialOption) error {
+	clients, closeConns, err := dialNodes(hashSlotTable, nodes, dialOptions)
+	if err != nil {
+		return err
+	}
+	defer closeConns()
+
+	shared := make(map[string]bool)
+	for _, chunkHash := range deleted.SharedChunks {
+		shared[chunkHash] = true
+	}
+
+	var errs []error
+	for _, stripe := range deleted.Stripes {
+		chunkHashes := stripeChunkHashes(stripe)
+		home, actual := PlaceStripe(chunkHashes, hashSlotTable)
+		for i, chunkHash := range chunkHashes {
+			if shared[chunkHash] {
+				continue
+			}
+			addrs := []string{actual[i]}
+			if home[i] != actual[i] {
+				addrs = append(addrs, home[i])
+			}
+			for _, addr := range addrs {
+				_, err := clients[addr].DeleteChunk(ctx, &pb.ChunkDeletionRequest{Hash: chunkHash})
+				if err != nil {
+					errs = append(errs, fmt.Errorf("failed to delete chunk %s on %s: %v", chunkHash, addr, err))
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func stripeChunkHashes(stripe Stripe) []string {
+	chunkHashes := make([]string, len(stripe.ChunkHashes))
+	for i, chunk := range stripe.ChunkHashes {
+		chunkHashes[i] = chunk.ChunkHash
+	}
+	return chunkHashes
+}
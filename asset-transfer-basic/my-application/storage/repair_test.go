@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	utils "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/utils"
+)
+
+func TestVerifyAndRepair(t *testing.T) {
+	c := newTestCluster(t, 3)
+	_, file := uploadRandomFile(t, c, 3*utils.StripeSize)
+
+	reports, err := c.repairer().Verify(context.Background(), file)
+	if err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	for _, report := range reports {
+		if !report.Healthy() {
+			t.Fatalf("stripe %d is not healthy after upload: %v", report.Index, report.Shards)
+		}
+	}
+
+	// Lose one chunk and flip a bit in another one of the first stripe.
+	lost := file.StripeHashes[0].ChunkHashes[0].ChunkHash
+	corrupted := file.StripeHashes[0].ChunkHashes[4].ChunkHash
+	for _, srv := range c.servers {
+		srv.Lose(lost)
+		srv.Corrupt(corrupted)
+	}
+
+	reports, err = c.repairer().Verify(context.Background(), file)
+	if err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	if reports[0].Shards[0] != ShardMissing || reports[0].Shards[4] != ShardCorrupt {
+		t.Fatalf("unexpected shard states %v", reports[0].Shards)
+	}
+	if !reports[0].Recoverable() || !reports[1].Healthy() {
+		t.Fatalf("unexpected reports %+v", reports)
+	}
+
+	repaired, err := c.repairer().Repair(context.Background(), file)
+	if err != nil {
+		t.Fatalf("repair failed: %v", err)
+	}
+	if repaired != 2 {
+		t.Fatalf("expected 2 repaired chunks, got %d", repaired)
+	}
+
+	reports, err = c.repairer().Verify(context.Background(), file)
+	if err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	if !reports[0].Healthy() {
+		t.Fatalf("stripe 0 is not healthy after repair: %v", reports[0].Shards)
+	}
+}
+
+func TestRepairFailsWithTooFewShards(t *testing.T) {
+	c := newTestCluster(t, 3)
+	_, file := uploadRandomFile(t, c, utils.StripeSize)
+
+	for _, chunk := range file.StripeHashes[0].ChunkHashes[:utils.N-utils.K+1] {
+		for _, srv := range c.servers {
+			srv.Lose(chunk.ChunkHash)
+		}
+	}
+	if _, err := c.repairer().Repair(context.Background(), file); err == nil {
+		t.Fatalf("expected repair to fail")
+	}
+}
+
+func TestRepairShardsReadsLocalGroup(t *testing.T) {
+	c := newTestCluster(t, 3)
+	u := c.uploader(2, 2)
+	u.Codec = utils.DefaultLRC
+	content := randomContent(t, 2*utils.StripeSize)
+	file, err := u.Upload(context.Background(), content)
+	if err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+	if file.Codec != "lrc-4-2-2" || len(file.StripeHashes[0].ChunkHashes) != 8 {
+		t.Fatalf("file coded with %q into %d chunks", file.Codec, len(file.StripeHashes[0].ChunkHashes))
+	}
+
+	lost := file.StripeHashes[1].ChunkHashes[2].ChunkHash
+	for _, srv := range c.servers {
+		srv.Lose(lost)
+	}
+	var out bytes.Buffer
+	if err := c.reader().ReadFile(context.Background(), file, &out); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), content) {
+		t.Fatalf("read returned different content")
+	}
+
+	before := c.totalGets()
+	if err := c.repairer().RepairShards(context.Background(), file, 1, []int{2}); err != nil {
+		t.Fatalf("repair failed: %v", err)
+	}
+	// Shard 2 is rebuilt from shard 3 and the parity of their group
+	if gets := c.totalGets() - before; gets != 2 {
+		t.Fatalf("expected 2 chunk requests, got %d", gets)
+	}
+	reports, err := c.repairer().Verify(context.Background(), file)
+	if err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	if !reports[1].Healthy() {
+		t.Fatalf("stripe 1 is not healthy after repair: %v", reports[1].Shards)
+	}
+}
+
+func TestRepairNode(t *testing.T) {
+	for _, codec := range []utils.Codec{utils.DefaultCodec, utils.DefaultLRC} {
+		t.Run(codec.Name(), func(t *testing.T) {
+			c := newTestCluster(t, 3)
+			u := c.uploader(2, 2)
+			u.Codec = codec
+			file, err := u.Upload(context.Background(), randomContent(t, 3*utils.StripeSize))
+			if err != nil {
+				t.Fatalf("upload failed: %v", err)
+			}
+
+			srv := c.servers["node1"]
+			wiped := srv.Wipe()
+
+			repaired, err := c.repairer().RepairNode(context.Background(), file, "node1")
+			if err != nil {
+				t.Fatalf("repair failed: %v", err)
+			}
+			if repaired != wiped {
+				t.Fatalf("expected %d repaired chunks, got %d", wiped, repaired)
+			}
+			reports, err := c.repairer().Verify(context.Background(), file)
+			if err != nil {
+				t.Fatalf("verify failed: %v", err)
+			}
+			for _, report := range reports {
+				if !report.Healthy() {
+					t.Fatalf("stripe %d is not healthy after repair: %v", report.Index, report.Shards)
+				}
+			}
+		})
+	}
+}
+
+func TestDeleteChunks(t *testing.T) {
+	c := newTestCluster(t, 3)
+	_, file := uploadRandomFile(t, c, 2*utils.StripeSize)
+	shared := file.StripeHashes[0].ChunkHashes[0].ChunkHash
+
+	deleted := &DeletedFile{FileHash: file.FileHash, Stripes: file.StripeHashes, SharedChunks: []string{shared}}
+	err := DeleteChunks(context.Background(), deleted, c.hashSlotTable, c.nodes, c.dialer)
+	if err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	// Only the chunk another file holds is left
+	chunks := 0
+	for addr, srv := range c.servers {
+		for chunkHash := range srv.Chunks() {
+			if chunkHash != shared {
+				t.Fatalf("node %s still holds chunk %s", addr, chunkHash)
+			}
+			chunks++
+		}
+	}
+	if chunks != 1 {
+		t.Fatalf("%d copies of the shared chunk left, want 1", chunks)
+	}
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/schema"
+	"google.golang.org/grpc"
+)
+
+// Expirer is the part of the chaincode the sweeper calls, a ledger.Client.
+type Expirer interface {
+	ListExpiredFiles(limit int) ([]string, error)
+	ExpireFile(fileHash string) (*schema.DeletedFile, error)
+}
+
+// SweepExpired removes up to limit files whose expiry has passed. The
+// chaincode deletes each file tree first, so the file is gone for readers
+// even if some storage nodes cannot be reached, then the chunks no other file
+// holds are deleted.
+// It returns the hashes of the files removed from the ledger. A file that
+// cannot be removed, e.g. because a legal hold was set since it was listed,
+// is skipped and reported in the error.
+func SweepExpired(ctx context.Context, chain Expirer, hashSlotTable HashSlotTable, nodes []string, limit int, dialOptions ...grpc.DialOption) ([]string, error) {
+	expired, err := chain.ListExpiredFiles(limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expired files: %v", err)
+	}
+
+	var swept []string
+	var errs []error
+	for _, fileHash := range expired {
+		if ctx.Err() != nil {
+			errs = append(errs, ctx.Err())
+			break
+		}
+		deleted, err := chain.ExpireFile(fileHash)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to expire file %s: %v", fileHash, err))
+			continue
+		}
+		swept = append(swept, fileHash)
+		if err := DeleteChunks(ctx, deleted, hashSlotTable, nodes, dialOptions...); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return swept, errors.Join(errs...)
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/schema"
+	utils "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/utils"
+)
+
+// expiryLedger answers the chaincode functions of the sweeper for a set of
+// expired files, one of which is held when ExpireFile is called.
+type expiryLedger struct {
+	files   map[string]*File
+	expired []string
+	held    string
+	expires []string
+}
+
+func (l *expiryLedger) ListExpiredFiles(limit int) ([]string, error) {
+	return l.expired, nil
+}
+
+func (l *expiryLedger) ExpireFile(fileHash string) (*schema.DeletedFile, error) {
+	if fileHash == l.held {
+		return nil, fmt.Errorf("file %s is under legal hold case-1", fileHash)
+	}
+	l.expires = append(l.expires, fileHash)
+	return &schema.DeletedFile{FileHash: fileHash, Stripes: l.files[fileHash].StripeHashes}, nil
+}
+
+func TestSweepExpired(t *testing.T) {
+	c := newTestCluster(t, 3)
+	ledger := &expiryLedger{files: make(map[string]*File)}
+	for i := 0; i < 3; i++ {
+		_, file := uploadRandomFile(t, c, utils.StripeSize)
+		ledger.files[file.FileHash] = file
+		ledger.expired = append(ledger.expired, file.FileHash)
+	}
+	ledger.held = ledger.expired[1]
+
+	swept, err := SweepExpired(context.Background(), ledger, c.hashSlotTable, c.nodes, 10, c.dialer)
+	if err == nil || !strings.Contains(err.Error(), "under legal hold") {
+		t.Fatalf("got error %v, want the held file reported", err)
+	}
+	want := []string{ledger.expired[0], ledger.expired[2]}
+	if !reflect.DeepEqual(swept, want) || !reflect.DeepEqual(ledger.expires, want) {
+		t.Fatalf("swept %v and expired %v, want %v", swept, ledger.expires, want)
+	}
+
+	// Only the chunks of the held file are left
+	if err := c.reader().ReadFile(context.Background(), ledger.files[ledger.held], io.Discard); err != nil {
+		t.Fatalf("held file unreadable: %v", err)
+	}
+	chunks := 0
+	for _, srv := range c.servers {
+		chunks += len(srv.Chunks())
+	}
+	if want := len(ledger.files[ledger.held].StripeHashes) * utils.N; chunks != want {
+		t.Fatalf("%d chunks left, want %d", chunks, want)
+	}
+}
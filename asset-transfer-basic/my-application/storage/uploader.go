@@ -0,0 +1,216 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	metrics "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/metrics"
+	pb "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/protos"
+	utils "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/utils"
+	"google.golang.org/grpc"
+)
+
+// Uploader splits a file into stripes, encodes every stripe exactly once and
+// distributes the chunks to the storage nodes. Stripes are encoded by a pool
+// of workers while earlier stripes are still being written, and each node has
+// at most InFlight StoreChunk calls outstanding at a time.
+type Uploader struct {
+	HashSlotTable HashSlotTable
+	Nodes         []string
+	// Codec codes the stripes, utils.DefaultCodec if nil. Its name is
+	// recorded in the file tree.
+	Codec utils.Codec
+
+	// Workers is the number of goroutines running erasure encoding.
+	Workers int
+	// InFlight bounds the number of concurrent shard writes per node.
+	InFlight int
+	// DialOptions are appended to the options used to connect to nodes.
+	DialOptions []grpc.DialOption
+	// OnChunk, if set, is called with every chunk before it is sent out.
+	OnChunk func(chunkHash string, chunk []byte)
+}
+
+func NewUploader(hashSlotTable HashSlotTable, nodes []string) *Uploader {
+	return &Uploader{
+		HashSlotTable: hashSlotTable,
+		Nodes:         nodes,
+		Workers:       runtime.NumCPU(),
+		InFlight:      4,
+	}
+}
+
+type shardWrite struct {
+	home      string
+	addr      string
+	chunkHash string
+	chunk     []byte
+}
+
+// Upload stores content on the cluster and returns its file tree. The first
+// failing write cancels the remaining work and is returned.
+func (u *Uploader) Upload(ctx context.Context, content []byte) (*File, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	clients, closeConns, err := dialNodes(u.HashSlotTable, u.Nodes, u.DialOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer closeConns()
+
+	var (
+		errOnce  sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	inFlight := max(u.InFlight, 1)
+	queues := make(map[string]chan shardWrite, len(clients))
+	var writers sync.WaitGroup
+	for addr := range clients {
+		queue := make(chan shardWrite, inFlight)
+		queues[addr] = queue
+		for i := 0; i < inFlight; i++ {
+			writers.Add(1)
+			go func() {
+				defer writers.Done()
+				for w := range queue {
+					if ctx.Err() != nil {
+						continue
+					}
+					if err := writeShard(ctx, clients, w); err != nil {
+						fail(err)
+					}
+				}
+			}()
+		}
+	}
+
+	codec := u.codec()
+	numStripes := (len(content) + utils.StripeSize - 1) / utils.StripeSize
+	file := &File{
+		FileHash:       utils.GetHash(content),
+		FileSize:       int64(len(content)),
+		Codec:          codec.Name(),
+		SlotTableEpoch: u.HashSlotTable.Epoch,
+		StripeHashes:   make([]Stripe, numStripes),
+	}
+
+	stripes := make(chan int)
+	var encoders sync.WaitGroup
+	for i := 0; i < max(u.Workers, 1); i++ {
+		encoders.Add(1)
+		go func() {
+			defer encoders.Done()
+			for index := range stripes {
+				stripe, writes, err := u.encodeStripe(codec, content, index)
+				if err != nil {
+					fail(err)
+					continue
+				}
+				file.StripeHashes[index] = stripe
+				for _, w := range writes {
+					select {
+					case queues[w.addr] <- w:
+					case <-ctx.Done():
+					}
+				}
+			}
+		}()
+	}
+
+feed:
+	for index := 0; index < numStripes; index++ {
+		select {
+		case stripes <- index:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(stripes)
+	encoders.Wait()
+	for _, queue := range queues {
+		close(queue)
+	}
+	writers.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (u *Uploader) codec() utils.Codec {
+	if u.Codec == nil {
+		return utils.DefaultCodec
+	}
+	return u.Codec
+}
+
+func (u *Uploader) encodeStripe(codec utils.Codec, content []byte, index int) (Stripe, []shardWrite, error) {
+	offset := index * utils.StripeSize
+	end := min(offset+utils.StripeSize, len(content))
+	// Cap the slice so the encoder never writes into the next stripe.
+	data := content[offset:end:end]
+	// Erasure coded stripes are padded so the chunks of a file are all of
+	// the same size, copies are kept as they are.
+	if len(data) < utils.StripeSize && codec.DataShards() > 1 {
+		padded := make([]byte, utils.StripeSize)
+		copy(padded, data)
+		data = padded
+	}
+
+	start := time.Now()
+	encodedChunks, err := codec.Encode(data)
+	metrics.EncodeDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		return Stripe{}, nil, fmt.Errorf("failed to encode stripe %d: %v", index, err)
+	}
+
+	stripe := Stripe{StripeHash: utils.GetHash(data)}
+	chunkHashes := make([]string, len(encodedChunks))
+	for i, chunk := range encodedChunks {
+		chunkHashes[i] = utils.GetHash(chunk)
+		stripe.ChunkHashes = append(stripe.ChunkHashes, Chunk{ChunkHash: chunkHashes[i]})
+	}
+
+	home, actual := PlaceStripe(chunkHashes, u.HashSlotTable)
+	writes := make([]shardWrite, len(encodedChunks))
+	for i, chunk := range encodedChunks {
+		if home[i] == "" {
+			return Stripe{}, nil, fmt.Errorf("no node owns the slot of chunk %s", chunkHashes[i])
+		}
+		if u.OnChunk != nil {
+			u.OnChunk(chunkHashes[i], chunk)
+		}
+		writes[i] = shardWrite{home: home[i], addr: actual[i], chunkHash: chunkHashes[i], chunk: chunk}
+	}
+	return stripe, writes, nil
+}
+
+func writeShard(ctx context.Context, clients map[string]pb.ChunkStorageClient, w shardWrite) error {
+	_, err := clients[w.addr].StoreChunk(ctx, &pb.ChunkStorageRequest{Data: w.chunk})
+	if err != nil {
+		return fmt.Errorf("failed to store chunk %s on %s: %v", w.chunkHash, w.addr, err)
+	}
+
+	if w.addr != w.home {
+		_, err = clients[w.home].StoreLink(ctx, &pb.LinkStorageRequest{Hash: w.chunkHash, Id: w.addr})
+		if err != nil {
+			return fmt.Errorf("failed to store link for chunk %s on %s: %v", w.chunkHash, w.home, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	utils "github.com/xuyangm/fabric-samples/asset-transfer-basic/my-application/utils"
+)
+
+func TestUploadStoresEveryChunk(t *testing.T) {
+	c := newTestCluster(t, 3)
+	content := randomContent(t, 10*utils.StripeSize+123)
+	original := append([]byte{}, content...)
+
+	file, err := c.uploader(4, 2).Upload(context.Background(), content)
+	if err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+	if !bytes.Equal(content, original) {
+		t.Fatalf("upload modified the input buffer")
+	}
+	if file.FileHash != utils.GetHash(content) {
+		t.Fatalf("unexpected file hash %s", file.FileHash)
+	}
+	if len(file.StripeHashes) != 11 {
+		t.Fatalf("expected 11 stripes, got %d", len(file.StripeHashes))
+	}
+
+	for i, stripe := range file.StripeHashes {
+		start := i * utils.StripeSize
+		data := make([]byte, utils.StripeSize)
+		copy(data, content[start:min(start+utils.StripeSize, len(content))])
+		if stripe.StripeHash != utils.GetHash(data) {
+			t.Fatalf("stripe %d has the wrong hash", i)
+		}
+		if len(stripe.ChunkHashes) != utils.N {
+			t.Fatalf("stripe %d has %d chunks, expected %d", i, len(stripe.ChunkHashes), utils.N)
+		}
+
+		shards := make([][]byte, utils.N)
+		for j, chunk := range stripe.ChunkHashes {
+			for _, srv := range c.servers {
+				if data, ok := srv.Chunk(chunk.ChunkHash); ok {
+					shards[j] = data
+				}
+			}
+			if shards[j] == nil {
+				t.Fatalf("chunk %d of stripe %d was not stored", j, i)
+			}
+		}
+		decoded, err := utils.Decode(utils.N, utils.K, shards)
+		if err != nil {
+			t.Fatalf("failed to decode stripe %d: %v", i, err)
+		}
+		if !bytes.Equal(decoded, data) {
+			t.Fatalf("stripe %d does not decode to the original data", i)
+		}
+	}
+}
+
+func TestUploadLinksMovedChunks(t *testing.T) {
+	c := newTestCluster(t, 3)
+	content := randomContent(t, 20*utils.StripeSize)
+
+	file, err := c.uploader(2, 1).Upload(context.Background(), content)
+	if err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+
+	for _, stripe := range file.StripeHashes {
+		hashes := make([]string, len(stripe.ChunkHashes))
+		for i, chunk := range stripe.ChunkHashes {
+			hashes[i] = chunk.ChunkHash
+		}
+		home, actual := PlaceStripe(hashes, c.hashSlotTable)
+		for i, hash := range hashes {
+			if _, ok := c.servers[actual[i]].Chunk(hash); !ok {
+				t.Fatalf("chunk %s missing on %s", hash, actual[i])
+			}
+			if home[i] != actual[i] && c.servers[home[i]].Link(hash) != actual[i] {
+				t.Fatalf("node %s has no link for moved chunk %s", home[i], hash)
+			}
+		}
+	}
+}
+
+func TestUploadFailsWhenNodeIsDown(t *testing.T) {
+	c := newTestCluster(t, 3)
+	u := c.uploader(2, 2)
+	u.HashSlotTable = HashSlotTable{HST: map[string]Slot{
+		"unreachable": {StartSlot: 0, EndSlot: utils.NumOfSlots - 1},
+	}}
+
+	if _, err := u.Upload(context.Background(), randomContent(t, 4*utils.StripeSize)); err == nil {
+		t.Fatalf("expected upload to fail")
+	}
+}
+
+func BenchmarkUpload(b *testing.B) {
+	content := randomContent(b, 256*utils.StripeSize)
+	for _, bc := range []struct{ workers, inFlight int }{
+		{1, 1}, {2, 2}, {4, 4}, {8, 8},
+	} {
+		b.Run(fmt.Sprintf("workers=%d/inflight=%d", bc.workers, bc.inFlight), func(b *testing.B) {
+			c := newTestCluster(b, 3)
+			u := c.uploader(bc.workers, bc.inFlight)
+			b.SetBytes(int64(len(content)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := u.Upload(context.Background(), content); err != nil {
+					b.Fatalf("upload failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestUploadWithCodecs(t *testing.T) {
+	compressible := bytes.Repeat([]byte("0123456789abcdef"), 3*utils.StripeSize/16+5)
+	for _, test := range []struct {
+		codec   utils.Codec
+		content []byte
+		// stored bounds the bytes of chunks written to the nodes
+		stored int
+	}{
+		{utils.DefaultReplication, []byte("a tiny file"), 3 * 12},
+		{utils.Compress(utils.DefaultReplication), []byte("a tiny file"), 3 * 32},
+		{utils.Compress(utils.DefaultCodec), compressible, len(compressible) / 4},
+	} {
+		t.Run(test.codec.Name(), func(t *testing.T) {
+			c := newTestCluster(t, 3)
+			u := c.uploader(2, 2)
+			u.Codec = test.codec
+			file, err := u.Upload(context.Background(), test.content)
+			if err != nil {
+				t.Fatalf("upload failed: %v", err)
+			}
+			if file.Codec != test.codec.Name() {
+				t.Fatalf("file tree names codec %q", file.Codec)
+			}
+
+			stored := 0
+			for _, srv := range c.servers {
+				for _, chunk := range srv.Chunks() {
+					stored += len(chunk)
+				}
+			}
+			if stored > test.stored {
+				t.Fatalf("%d bytes stored for a file of %d bytes", stored, len(test.content))
+			}
+
+			// Readers pick the decoder from the tree
+			var out bytes.Buffer
+			offset := int64(len(test.content) / 3)
+			length := int64(len(test.content)) - offset - 1
+			if err := c.reader().ReadRange(context.Background(), file, offset, length, &out); err != nil {
+				t.Fatalf("read failed: %v", err)
+			}
+			if !bytes.Equal(out.Bytes(), test.content[offset:offset+length]) {
+				t.Fatalf("read returned different content")
+			}
+		})
+	}
+}
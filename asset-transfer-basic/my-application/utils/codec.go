@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Codec codes the data of a stripe into shards and back. Readers fetch the
+// first DataShards shards and fall back to the others when one of them fails.
+// The codec of a file is named in its tree.
+type Codec interface {
+	// Name identifies the codec in file trees.
+	Name() string
+	Shards() int
+	DataShards() int
+	// Encode splits data into DataShards shards and adds the parity shards.
+	Encode(data []byte) ([][]byte, error)
+	// DecodeTo writes the data of a stripe to w. Missing shards are nil.
+	DecodeTo(w io.Writer, shards [][]byte) error
+	// Reconstruct recreates every missing (nil) shard, parity included.
+	Reconstruct(shards [][]byte) error
+	// Recoverable reports whether the shards that are not nil are enough to
+	// reconstruct the others.
+	Recoverable(shards [][]byte) bool
+	// RepairSet returns the shards to read to rebuild the lost ones, in
+	// ascending order.
+	RepairSet(lost []int) []int
+	// Repair rebuilds the lost shards from the shards of their repair set,
+	// the other shards may be nil.
+	Repair(shards [][]byte, lost []int) error
+}
+
+// ReedSolomon is the systematic Reed-Solomon code of klauspost/reedsolomon:
+// any K of the N shards rebuild the others.
+type ReedSolomon struct {
+	N, K int
+}
+
+func (c ReedSolomon) Name() string {
+	return fmt.Sprintf("rs-%d-%d", c.N, c.K)
+}
+
+func (c ReedSolomon) Shards() int {
+	return c.N
+}
+
+func (c ReedSolomon) DataShards() int {
+	return c.K
+}
+
+func (c ReedSolomon) Encode(data []byte) ([][]byte, error) {
+	return Encode(c.N, c.K, data)
+}
+
+func (c ReedSolomon) DecodeTo(w io.Writer, shards [][]byte) error {
+	return DecodeTo(w, c.N, c.K, shards)
+}
+
+func (c ReedSolomon) Reconstruct(shards [][]byte) error {
+	return Reconstruct(c.N, c.K, shards)
+}
+
+// Recoverable reports whether at least K shards are present.
+func (c ReedSolomon) Recoverable(shards [][]byte) bool {
+	present := 0
+	for _, shard := range shards {
+		if len(shard) > 0 {
+			present++
+		}
+	}
+	return present >= c.K
+}
+
+// RepairSet returns the first K shards that are not lost.
+func (c ReedSolomon) RepairSet(lost []int) []int {
+	return firstShards(c.N, c.K, lost)
+}
+
+func (c ReedSolomon) Repair(shards [][]byte, lost []int) error {
+	return c.Reconstruct(shards)
+}
+
+// DefaultCodec codes the files whose tree names no codec, which were all
+// stored before codecs were recorded.
+var DefaultCodec Codec = ReedSolomon{N: N, K: K}
+
+var codecs = map[string]Codec{}
+
+// RegisterCodec makes a codec available to GetCodec by its name.
+func RegisterCodec(codec Codec) {
+	codecs[codec.Name()] = codec
+}
+
+func init() {
+	for _, codec := range []Codec{DefaultCodec, DefaultLRC, DefaultReplication} {
+		RegisterCodec(codec)
+		RegisterCodec(Compress(codec))
+	}
+}
+
+// GetCodec returns the codec named in a file tree, the default codec for an
+// empty name.
+func GetCodec(name string) (Codec, error) {
+	if name == "" {
+		return DefaultCodec, nil
+	}
+	codec, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown codec %q", name)
+	}
+	return codec, nil
+}
+
+// CodecNames returns the names of the registered codecs, sorted.
+func CodecNames() []string {
+	names := make([]string, 0, len(codecs))
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// firstShards returns the first count of n shards that are not lost, or
+// every shard that is not lost when there are fewer.
+func firstShards(n int, count int, lost []int) []int {
+	isLost := make([]bool, n)
+	for _, i := range lost {
+		isLost[i] = true
+	}
+	shards := make([]int, 0, count)
+	for i := 0; i < n && len(shards) < count; i++ {
+		if !isLost[i] {
+			shards = append(shards, i)
+		}
+	}
+	return shards
+}
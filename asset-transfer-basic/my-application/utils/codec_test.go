@@ -0,0 +1,219 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/rand"
+	"reflect"
+	"testing"
+)
+
+func encodeWith(t *testing.T, codec Codec) ([]byte, [][]byte) {
+	data := make([]byte, StripeSize)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("failed to generate data: %v", err)
+	}
+	shards, err := codec.Encode(data)
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	if len(shards) != codec.Shards() {
+		t.Fatalf("got %d shards, want %d", len(shards), codec.Shards())
+	}
+	return data, shards
+}
+
+// lossPatterns calls f with every set of count of n shards.
+func lossPatterns(n int, count int, f func(lost []int)) {
+	var walk func(start int, lost []int)
+	walk = func(start int, lost []int) {
+		if len(lost) == count {
+			f(lost)
+			return
+		}
+		for i := start; i < n; i++ {
+			walk(i+1, append(lost, i))
+		}
+	}
+	walk(0, nil)
+}
+
+func without(shards [][]byte, lost []int) [][]byte {
+	damaged := make([][]byte, len(shards))
+	copy(damaged, shards)
+	for _, i := range lost {
+		damaged[i] = nil
+	}
+	return damaged
+}
+
+func TestCodecsSurviveLosses(t *testing.T) {
+	for _, test := range []struct {
+		codec     Codec
+		tolerated int
+	}{
+		{DefaultCodec, N - K},
+		{DefaultLRC, 3},
+		{mustLRC(6, 3, 2), 3},
+		{DefaultReplication, 2},
+		{Compress(DefaultCodec), N - K},
+		{Compress(DefaultReplication), 2},
+	} {
+		t.Run(test.codec.Name(), func(t *testing.T) {
+			data, shards := encodeWith(t, test.codec)
+			for count := 1; count <= test.tolerated; count++ {
+				lossPatterns(len(shards), count, func(lost []int) {
+					damaged := without(shards, lost)
+					var out bytes.Buffer
+					if err := test.codec.DecodeTo(&out, damaged); err != nil {
+						t.Fatalf("decode without %v: %v", lost, err)
+					}
+					if !bytes.Equal(out.Bytes(), data) {
+						t.Fatalf("decoded data differs without %v", lost)
+					}
+
+					damaged = without(shards, lost)
+					if err := test.codec.Reconstruct(damaged); err != nil {
+						t.Fatalf("reconstruct without %v: %v", lost, err)
+					}
+					if !reflect.DeepEqual(damaged, shards) {
+						t.Fatalf("reconstructed shards differ without %v", lost)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestLRCRepairsFromLocalGroup(t *testing.T) {
+	codec := DefaultLRC
+	_, shards := encodeWith(t, codec)
+
+	for lost, want := range map[int][]int{
+		0: {1, 4},
+		1: {0, 4},
+		3: {2, 5},
+		4: {0, 1},
+		5: {2, 3},
+	} {
+		repairSet := codec.RepairSet([]int{lost})
+		if !reflect.DeepEqual(repairSet, want) {
+			t.Errorf("repair set of shard %d is %v, want %v", lost, repairSet, want)
+			continue
+		}
+
+		// Only the repair set is at hand
+		partial := make([][]byte, len(shards))
+		for _, i := range repairSet {
+			partial[i] = shards[i]
+		}
+		if err := codec.Repair(partial, []int{lost}); err != nil {
+			t.Errorf("repair of shard %d: %v", lost, err)
+		} else if !bytes.Equal(partial[lost], shards[lost]) {
+			t.Errorf("repaired shard %d differs", lost)
+		}
+	}
+
+	// One shard of each group is repaired from both groups
+	if got := codec.RepairSet([]int{0, 3}); !reflect.DeepEqual(got, []int{1, 2, 4, 5}) {
+		t.Errorf("repair set of shards 0 and 3 is %v", got)
+	}
+	// Two shards of a group need K shards
+	repairSet := codec.RepairSet([]int{0, 1})
+	if len(repairSet) != codec.DataShards() {
+		t.Errorf("repair set of shards 0 and 1 is %v", repairSet)
+	}
+	partial := make([][]byte, len(shards))
+	for _, i := range repairSet {
+		partial[i] = shards[i]
+	}
+	if err := codec.Repair(partial, []int{0, 1}); err != nil || !reflect.DeepEqual(partial, shards) {
+		t.Errorf("repair of shards 0 and 1 from %v: %v", repairSet, err)
+	}
+	if got := codec.RepairSet([]int{6}); !reflect.DeepEqual(got, []int{0, 1, 2, 3}) {
+		t.Errorf("repair set of global parity 6 is %v", got)
+	}
+}
+
+func TestLRCFailsBeyondRecovery(t *testing.T) {
+	codec := DefaultLRC
+	_, shards := encodeWith(t, codec)
+
+	// Four shards, but shard 4 is the sum of shards 0 and 1
+	if codec.Recoverable(without(shards, []int{2, 5, 6, 7})) {
+		t.Error("shards 0, 1, 3 and 4 reported recoverable")
+	}
+	if !codec.Recoverable(without(shards, []int{2, 4, 5, 7})) {
+		t.Error("shards 0, 1, 3 and 6 reported unrecoverable")
+	}
+
+	damaged := without(shards, []int{0, 1, 4, 6, 7})
+	if codec.Recoverable(damaged) {
+		t.Error("shards 2, 3 and 5 reported recoverable")
+	}
+	if err := codec.Reconstruct(damaged); err == nil {
+		t.Fatal("expected an error with a whole local group and every global parity lost")
+	}
+}
+
+func TestReedSolomonRepairSet(t *testing.T) {
+	if got := DefaultCodec.RepairSet([]int{1}); !reflect.DeepEqual(got, []int{0, 2, 3}) {
+		t.Errorf("repair set of shard 1 is %v", got)
+	}
+}
+
+func TestReplicationKeepsTinyStripes(t *testing.T) {
+	data := []byte("tiny")
+	shards, err := DefaultReplication.Encode(data)
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	if len(shards) != 3 || len(shards[0]) != len(data)+1 {
+		t.Fatalf("got %d shards of %d bytes", len(shards), len(shards[0]))
+	}
+	// Copies differ in their first byte so their hashes differ
+	if GetHash(shards[0]) == GetHash(shards[1]) {
+		t.Fatal("copies have the same hash")
+	}
+	if got := DefaultReplication.RepairSet([]int{0}); !reflect.DeepEqual(got, []int{1}) {
+		t.Errorf("repair set of copy 0 is %v", got)
+	}
+}
+
+func TestCompressionShrinksShards(t *testing.T) {
+	data := bytes.Repeat([]byte("compressible "), StripeSize/13+1)[:StripeSize]
+	codec := Compress(DefaultCodec)
+	shards, err := codec.Encode(data)
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	if len(shards[0])*K >= len(data)/4 {
+		t.Errorf("shards of %d bytes for a compressible stripe of %d bytes", len(shards[0]), len(data))
+	}
+
+	shards[1] = nil
+	var out bytes.Buffer
+	if err := codec.DecodeTo(&out, shards); err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Fatal("decoded data differs")
+	}
+}
+
+func TestGetCodec(t *testing.T) {
+	for name, want := range map[string]Codec{
+		"":               DefaultCodec,
+		"rs-6-3":         DefaultCodec,
+		"lrc-4-2-2":      DefaultLRC,
+		"rep-3":          DefaultReplication,
+		"zstd+lrc-4-2-2": Compress(DefaultLRC),
+	} {
+		codec, err := GetCodec(name)
+		if err != nil || codec != want {
+			t.Errorf("GetCodec(%q) = %v, %v", name, codec, err)
+		}
+	}
+	if _, err := GetCodec("rs-9-1"); err == nil {
+		t.Error("expected an error for an unknown codec")
+	}
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compressed compresses every stripe with zstd before coding it with the
+// embedded codec. Stripes stay StripeSize bytes of the file, so ranges are
+// still read stripe by stripe, but their chunks shrink with the data.
+type Compressed struct {
+	Codec
+}
+
+// Compress returns codec with zstd compression in front of it.
+func Compress(codec Codec) Codec {
+	return Compressed{Codec: codec}
+}
+
+// Without options neither constructor fails. EncodeAll and DecodeAll may be
+// called concurrently.
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+func (c Compressed) Name() string {
+	return "zstd+" + c.Codec.Name()
+}
+
+// Encode codes the compressed stripe, preceded by its length since the
+// codec may pad it.
+func (c Compressed) Encode(data []byte) ([][]byte, error) {
+	compressed := make([]byte, 4, 4+len(data)/2)
+	compressed = zstdEncoder.EncodeAll(data, compressed)
+	binary.BigEndian.PutUint32(compressed, uint32(len(compressed)-4))
+	return c.Codec.Encode(compressed)
+}
+
+func (c Compressed) DecodeTo(w io.Writer, shards [][]byte) error {
+	var buf bytes.Buffer
+	if err := c.Codec.DecodeTo(&buf, shards); err != nil {
+		return err
+	}
+	compressed := buf.Bytes()
+	if len(compressed) < 4 {
+		return fmt.Errorf("compressed stripe is too short")
+	}
+	size := binary.BigEndian.Uint32(compressed)
+	if int64(size) > int64(len(compressed)-4) {
+		return fmt.Errorf("compressed stripe is truncated")
+	}
+	data, err := zstdDecoder.DecodeAll(compressed[4:4+size], nil)
+	if err != nil {
+		return fmt.Errorf("failed to decompress stripe: %v", err)
+	}
+	_, err = w.Write(data)
+	return err
+}
@@ -4,7 +4,8 @@ const (
     // Reed-Solomon code with (n, k) parameters
     N int = 6
     K int = 3
-    L int = 3
+    // local groups of the locally repairable code lrc-4-L-2
+    L int = 2
     StripeSize int = 4096 * 3 //bytes redis
     NumOfSlots int = 16384
 )
@@ -30,22 +30,24 @@ func Encode(n int, k int, input []byte) ([][]byte, error) {
 }
 
 func Decode(n int, k int, shards [][]byte) ([]byte, error) {
-    enc, err := reedsolomon.New(k, n-k)
-    if err != nil {
-        return nil, err
-    }
-    err = enc.Reconstruct(shards)
-    if err != nil {
-        return nil, err
-    }
     var buf bytes.Buffer
-    err = enc.Join(&buf, shards, len(shards[0])*k)
+    err := DecodeTo(&buf, n, k, shards)
     if err != nil {
         return nil, err
     }
     return buf.Bytes(), nil
 }
 
+// Reconstruct recreates the missing (nil) shards of a stripe, parity
+// included.
+func Reconstruct(n int, k int, shards [][]byte) error {
+    enc, err := reedsolomon.New(k, n-k)
+    if err != nil {
+        return err
+    }
+    return enc.Reconstruct(shards)
+}
+
 
 
 
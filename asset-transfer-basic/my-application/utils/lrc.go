@@ -0,0 +1,464 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// LRC is a locally repairable code. Its K data shards are split into L local
+// groups, each protected by an XOR of its members, and G global parities
+// protect them all. A lost data or local parity shard is rebuilt from the
+// other members of its group, K/L shards instead of K, and any G+1 lost
+// shards can be rebuilt from the rest. Shards are ordered data, local
+// parities, global parities.
+type LRC struct {
+	k, l, g int
+	// matrix holds one row per shard: the coefficients, in GF(2^8), of the
+	// data shards it is the sum of.
+	matrix [][]byte
+}
+
+// DefaultLRC splits its four data shards into L local groups. With the two
+// groups of lrc-4-2-2 it stores two bytes per byte of data like the default
+// Reed-Solomon code, and repairs a single shard from two shards instead of
+// three. The groups are a parameter of the code alone; they are not tied to
+// the schema.NodesPerStripe nodes the chunks of a stripe are spread over.
+var DefaultLRC Codec = mustLRC(4, L, 2)
+
+func NewLRC(k int, l int, g int) (*LRC, error) {
+	if k <= 0 || l <= 0 || g < 0 || k%l != 0 || k+g >= 255 {
+		return nil, fmt.Errorf("invalid LRC parameters k=%d l=%d g=%d", k, l, g)
+	}
+
+	c := &LRC{k: k, l: l, g: g}
+	for i := 0; i < k; i++ {
+		row := make([]byte, k)
+		row[i] = 1
+		c.matrix = append(c.matrix, row)
+	}
+	for j := 0; j < l; j++ {
+		row := make([]byte, k)
+		for i := range row {
+			if c.group(i) == j {
+				row[i] = 1
+			}
+		}
+		c.matrix = append(c.matrix, row)
+	}
+	// Global parity r weighs data shard i by a_i^(r+1), a_i = 2^(i+1)
+	for r := 0; r < g; r++ {
+		row := make([]byte, k)
+		for i := range row {
+			row[i] = gfExp[((i+1)*(r+1))%255]
+		}
+		c.matrix = append(c.matrix, row)
+	}
+	return c, nil
+}
+
+func mustLRC(k int, l int, g int) *LRC {
+	c, err := NewLRC(k, l, g)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func (c *LRC) Name() string {
+	return fmt.Sprintf("lrc-%d-%d-%d", c.k, c.l, c.g)
+}
+
+func (c *LRC) Shards() int {
+	return c.k + c.l + c.g
+}
+
+func (c *LRC) DataShards() int {
+	return c.k
+}
+
+// group returns the local group of shard i, or -1 for a global parity.
+func (c *LRC) group(i int) int {
+	switch {
+	case i < c.k:
+		return i / (c.k / c.l)
+	case i < c.k+c.l:
+		return i - c.k
+	}
+	return -1
+}
+
+// members returns the data shards of local group j followed by its parity.
+func (c *LRC) members(j int) []int {
+	size := c.k / c.l
+	members := make([]int, 0, size+1)
+	for i := j * size; i < (j+1)*size; i++ {
+		members = append(members, i)
+	}
+	return append(members, c.k+j)
+}
+
+func (c *LRC) Encode(data []byte) ([][]byte, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("no data to encode")
+	}
+	shardSize := (len(data) + c.k - 1) / c.k
+	n := c.Shards()
+	buf := make([]byte, n*shardSize)
+	copy(buf, data)
+
+	shards := make([][]byte, n)
+	for i := range shards {
+		shards[i] = buf[i*shardSize : (i+1)*shardSize : (i+1)*shardSize]
+	}
+	for p := c.k; p < n; p++ {
+		c.encodeShard(shards, p)
+	}
+	return shards, nil
+}
+
+// encodeShard computes shard p from the data shards.
+func (c *LRC) encodeShard(shards [][]byte, p int) {
+	out := make([]byte, len(shards[0]))
+	for i, coef := range c.matrix[p] {
+		gfMulAdd(out, shards[i], coef)
+	}
+	shards[p] = out
+}
+
+func (c *LRC) DecodeTo(w io.Writer, shards [][]byte) error {
+	if !hasDataShards(c.k, shards) {
+		if err := c.reconstruct(shards, true); err != nil {
+			return err
+		}
+	}
+	for _, shard := range shards[:c.k] {
+		if _, err := w.Write(shard); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *LRC) Reconstruct(shards [][]byte) error {
+	return c.reconstruct(shards, false)
+}
+
+// reconstruct rebuilds what it can from the local groups first and solves
+// for the data shards still missing from any K independent shards after.
+// With dataOnly, missing parity shards are left nil.
+func (c *LRC) reconstruct(shards [][]byte, dataOnly bool) error {
+	n := c.Shards()
+	if len(shards) != n {
+		return fmt.Errorf("expected %d shards, got %d", n, len(shards))
+	}
+	shardSize := -1
+	for _, shard := range shards {
+		if len(shard) == 0 {
+			continue
+		}
+		if shardSize >= 0 && len(shard) != shardSize {
+			return fmt.Errorf("shards differ in size")
+		}
+		shardSize = len(shard)
+	}
+	if shardSize < 0 {
+		return fmt.Errorf("no shards to reconstruct from")
+	}
+
+	for j := 0; j < c.l; j++ {
+		missing := -1
+		count := 0
+		for _, i := range c.members(j) {
+			if len(shards[i]) == 0 {
+				missing = i
+				count++
+			}
+		}
+		if count != 1 {
+			continue
+		}
+		out := make([]byte, shardSize)
+		for _, i := range c.members(j) {
+			if i != missing {
+				gfMulAdd(out, shards[i], 1)
+			}
+		}
+		shards[missing] = out
+	}
+
+	if !hasDataShards(c.k, shards) {
+		available := make([]int, 0, n)
+		for i, shard := range shards {
+			if len(shard) > 0 {
+				available = append(available, i)
+			}
+		}
+		rows := c.independentRows(available)
+		if len(rows) < c.k {
+			return fmt.Errorf("too few shards to reconstruct, %d of %d available", len(available), n)
+		}
+
+		decode := make([][]byte, c.k)
+		for j, row := range rows {
+			decode[j] = c.matrix[row]
+		}
+		inverse, err := gfInvert(decode)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < c.k; i++ {
+			if len(shards[i]) > 0 {
+				continue
+			}
+			out := make([]byte, shardSize)
+			for j, row := range rows {
+				gfMulAdd(out, shards[row], inverse[i][j])
+			}
+			shards[i] = out
+		}
+	}
+
+	if !dataOnly {
+		for p := c.k; p < n; p++ {
+			if len(shards[p]) == 0 {
+				c.encodeShard(shards, p)
+			}
+		}
+	}
+	return nil
+}
+
+// Recoverable reports whether the rows of the present shards span the data
+// shards. Unlike Reed-Solomon, not every K shards do: a local parity and the
+// members of its group only count for K/L of them.
+func (c *LRC) Recoverable(shards [][]byte) bool {
+	if len(shards) != c.Shards() {
+		return false
+	}
+	available := make([]int, 0, len(shards))
+	for i, shard := range shards {
+		if len(shard) > 0 {
+			available = append(available, i)
+		}
+	}
+	return len(c.independentRows(available)) == c.k
+}
+
+// independentRows picks, in order, up to K of the candidate shards whose rows
+// of the matrix are linearly independent.
+func (c *LRC) independentRows(candidates []int) []int {
+	var rows []int
+	var basis [][]byte
+	for _, candidate := range candidates {
+		if len(rows) == c.k {
+			break
+		}
+		if reduced, ok := gfReduce(basis, c.matrix[candidate]); ok {
+			basis = append(basis, reduced)
+			rows = append(rows, candidate)
+		}
+	}
+	return rows
+}
+
+// RepairSet returns the other members of the local groups of the lost shards
+// when each group lost at most one of them. Otherwise, or when a global
+// parity is lost, it returns K shards that rebuild the whole stripe.
+func (c *LRC) RepairSet(lost []int) []int {
+	isLost := make([]bool, c.Shards())
+	for _, i := range lost {
+		isLost[i] = true
+	}
+
+	local := true
+	groupLost := make([]int, c.l)
+	for _, i := range lost {
+		j := c.group(i)
+		if j < 0 || groupLost[j] > 0 {
+			local = false
+			break
+		}
+		groupLost[j]++
+	}
+
+	if local {
+		var shards []int
+		for j := 0; j < c.l; j++ {
+			if groupLost[j] == 0 {
+				continue
+			}
+			for _, i := range c.members(j) {
+				if !isLost[i] {
+					shards = append(shards, i)
+				}
+			}
+		}
+		sort.Ints(shards)
+		return shards
+	}
+
+	available := make([]int, 0, c.Shards())
+	for i := range isLost {
+		if !isLost[i] {
+			available = append(available, i)
+		}
+	}
+	shards := c.independentRows(available)
+	sort.Ints(shards)
+	return shards
+}
+
+// Repair rebuilds each lost shard from its local group when the lost shards
+// are in different groups, and the whole stripe otherwise.
+func (c *LRC) Repair(shards [][]byte, lost []int) error {
+	if len(shards) != c.Shards() {
+		return fmt.Errorf("expected %d shards, got %d", c.Shards(), len(shards))
+	}
+	groups := make(map[int]bool)
+	for _, i := range lost {
+		j := c.group(i)
+		if j < 0 || groups[j] {
+			return c.Reconstruct(shards)
+		}
+		groups[j] = true
+	}
+
+	for _, i := range lost {
+		members := c.members(c.group(i))
+		var shardSize int
+		for _, m := range members {
+			if m != i {
+				if len(shards[m]) == 0 {
+					return fmt.Errorf("shard %d of the local group of shard %d is missing", m, i)
+				}
+				shardSize = len(shards[m])
+			}
+		}
+		out := make([]byte, shardSize)
+		for _, m := range members {
+			if m != i {
+				gfMulAdd(out, shards[m], 1)
+			}
+		}
+		shards[i] = out
+	}
+	return nil
+}
+
+// Arithmetic in GF(2^8) with the polynomial x^8+x^4+x^3+x^2+1, the field of
+// klauspost/reedsolomon. The tables are variables rather than built by init
+// so that DefaultLRC can use them.
+var (
+	gfExp, gfLog = gfTables()
+	gfMul        = gfMulTable()
+)
+
+func gfTables() (exp [510]byte, log [256]int) {
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = byte(x)
+		exp[i+255] = byte(x)
+		log[x] = i
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	return exp, log
+}
+
+func gfMulTable() *[256][256]byte {
+	var mul [256][256]byte
+	for a := 1; a < 256; a++ {
+		for b := 1; b < 256; b++ {
+			mul[a][b] = gfExp[gfLog[a]+gfLog[b]]
+		}
+	}
+	return &mul
+}
+
+func gfInverse(a byte) byte {
+	return gfExp[255-gfLog[a]]
+}
+
+// gfMulAdd adds coef*src to dst.
+func gfMulAdd(dst []byte, src []byte, coef byte) {
+	switch coef {
+	case 0:
+	case 1:
+		for i, b := range src {
+			dst[i] ^= b
+		}
+	default:
+		mul := &gfMul[coef]
+		for i, b := range src {
+			dst[i] ^= mul[b]
+		}
+	}
+}
+
+// gfReduce eliminates the leading columns of the rows of basis from row. It
+// reports whether anything is left, which is then the next row of the basis.
+func gfReduce(basis [][]byte, row []byte) ([]byte, bool) {
+	reduced := append([]byte(nil), row...)
+	for _, b := range basis {
+		pivot := leadingColumn(b)
+		if coef := reduced[pivot]; coef != 0 {
+			factor := gfMul[coef][gfInverse(b[pivot])]
+			gfMulAdd(reduced, b, factor)
+		}
+	}
+	return reduced, leadingColumn(reduced) >= 0
+}
+
+func leadingColumn(row []byte) int {
+	for i, b := range row {
+		if b != 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// gfInvert inverts a square matrix by Gauss-Jordan elimination.
+func gfInvert(matrix [][]byte) ([][]byte, error) {
+	size := len(matrix)
+	work := make([][]byte, size)
+	inverse := make([][]byte, size)
+	for i := range matrix {
+		work[i] = append([]byte(nil), matrix[i]...)
+		inverse[i] = make([]byte, size)
+		inverse[i][i] = 1
+	}
+
+	for col := 0; col < size; col++ {
+		pivot := -1
+		for row := col; row < size; row++ {
+			if work[row][col] != 0 {
+				pivot = row
+				break
+			}
+		}
+		if pivot < 0 {
+			return nil, fmt.Errorf("matrix is singular")
+		}
+		work[col], work[pivot] = work[pivot], work[col]
+		inverse[col], inverse[pivot] = inverse[pivot], inverse[col]
+
+		scale := gfInverse(work[col][col])
+		for i := range work[col] {
+			work[col][i] = gfMul[scale][work[col][i]]
+			inverse[col][i] = gfMul[scale][inverse[col][i]]
+		}
+		for row := 0; row < size; row++ {
+			if row == col || work[row][col] == 0 {
+				continue
+			}
+			factor := work[row][col]
+			gfMulAdd(work[row], work[col], factor)
+			gfMulAdd(inverse[row], inverse[col], factor)
+		}
+	}
+	return inverse, nil
+}
@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/schema"
+)
+
+// Replication stores Copies whole copies of a stripe. It costs less than
+// erasure coding for files far smaller than a stripe, which erasure coding
+// pads to StripeSize, and any single copy rebuilds the others. Each copy
+// starts with its index so that the copies have distinct hashes and are
+// placed like the chunks of any other codec.
+type Replication struct {
+	Copies int
+}
+
+// DefaultReplication keeps a copy of tiny files on each of the
+// schema.NodesPerStripe nodes of a stripe.
+var DefaultReplication Codec = Replication{Copies: schema.NodesPerStripe}
+
+func (c Replication) Name() string {
+	return fmt.Sprintf("rep-%d", c.Copies)
+}
+
+func (c Replication) Shards() int {
+	return c.Copies
+}
+
+func (c Replication) DataShards() int {
+	return 1
+}
+
+func (c Replication) Encode(data []byte) ([][]byte, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("no data to encode")
+	}
+	if c.Copies <= 0 || c.Copies > 256 {
+		return nil, fmt.Errorf("invalid number of copies %d", c.Copies)
+	}
+	shards := make([][]byte, c.Copies)
+	for i := range shards {
+		shards[i] = c.replica(i, data)
+	}
+	return shards, nil
+}
+
+func (c Replication) replica(i int, data []byte) []byte {
+	shard := make([]byte, 1+len(data))
+	shard[0] = byte(i)
+	copy(shard[1:], data)
+	return shard
+}
+
+// copyData returns the data of a present copy.
+func (c Replication) copyData(shards [][]byte) ([]byte, error) {
+	if len(shards) != c.Copies {
+		return nil, fmt.Errorf("expected %d shards, got %d", c.Copies, len(shards))
+	}
+	for _, shard := range shards {
+		if len(shard) > 0 {
+			return shard[1:], nil
+		}
+	}
+	return nil, fmt.Errorf("no copy left")
+}
+
+func (c Replication) DecodeTo(w io.Writer, shards [][]byte) error {
+	data, err := c.copyData(shards)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (c Replication) Reconstruct(shards [][]byte) error {
+	data, err := c.copyData(shards)
+	if err != nil {
+		return err
+	}
+	for i, shard := range shards {
+		if len(shard) == 0 {
+			shards[i] = c.replica(i, data)
+		}
+	}
+	return nil
+}
+
+func (c Replication) Recoverable(shards [][]byte) bool {
+	_, err := c.copyData(shards)
+	return err == nil
+}
+
+// RepairSet returns the first copy that is not lost.
+func (c Replication) RepairSet(lost []int) []int {
+	return firstShards(c.Copies, 1, lost)
+}
+
+func (c Replication) Repair(shards [][]byte, lost []int) error {
+	return c.Reconstruct(shards)
+}
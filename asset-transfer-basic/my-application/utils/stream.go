@@ -0,0 +1,175 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/reedsolomon"
+)
+
+// DecodeTo writes the data of one stripe to w. The code is systematic, so
+// when the k data shards are all present they are written out as they are
+// and reconstruction only runs if one of them is missing. Missing shards are
+// nil.
+func DecodeTo(w io.Writer, n int, k int, shards [][]byte) error {
+	if len(shards) != n {
+		return fmt.Errorf("expected %d shards, got %d", n, len(shards))
+	}
+	if !hasDataShards(k, shards) {
+		enc, err := reedsolomon.New(k, n-k)
+		if err != nil {
+			return err
+		}
+		err = enc.ReconstructData(shards)
+		if err != nil {
+			return err
+		}
+	}
+	for _, shard := range shards[:k] {
+		if _, err := w.Write(shard); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasDataShards(k int, shards [][]byte) bool {
+	for _, shard := range shards[:k] {
+		if len(shard) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Encoded stripes are streamed as their n shards in order, each preceded by
+// its length as a 4-byte big-endian integer. A length of 0 marks a missing
+// shard.
+const shardHeaderSize = 4
+
+var errTruncatedStripe = errors.New("stream ends inside a stripe")
+
+// AppendStripe appends the shards of one stripe to b in the stream format of
+// StripeWriter and StripeReader. Missing shards are nil.
+func AppendStripe(b []byte, shards [][]byte) []byte {
+	for _, shard := range shards {
+		b = binary.BigEndian.AppendUint32(b, uint32(len(shard)))
+		b = append(b, shard...)
+	}
+	return b
+}
+
+// StripeWriter is an io.Writer taking a stream of encoded stripes. Each
+// stripe is decoded with DecodeTo once its last shard has been written, and
+// its data goes to the underlying writer.
+type StripeWriter struct {
+	w      io.Writer
+	n, k   int
+	buf    []byte
+	shards [][]byte
+	err    error
+}
+
+func NewStripeWriter(w io.Writer, n int, k int) *StripeWriter {
+	return &StripeWriter{w: w, n: n, k: k}
+}
+
+func (s *StripeWriter) Write(p []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	s.buf = append(s.buf, p...)
+	start := 0
+	for len(s.buf)-start >= shardHeaderSize {
+		size := int(binary.BigEndian.Uint32(s.buf[start:]))
+		end := start + shardHeaderSize + size
+		if len(s.buf) < end {
+			break
+		}
+		var shard []byte
+		if size > 0 {
+			shard = append(shard, s.buf[start+shardHeaderSize:end]...)
+		}
+		s.shards = append(s.shards, shard)
+		start = end
+		if len(s.shards) == s.n {
+			s.err = DecodeTo(s.w, s.n, s.k, s.shards)
+			s.shards = nil
+			if s.err != nil {
+				return len(p), s.err
+			}
+		}
+	}
+	s.buf = s.buf[:copy(s.buf, s.buf[start:])]
+	return len(p), nil
+}
+
+// Close reports a stream that stopped inside a stripe. It does not close the
+// underlying writer.
+func (s *StripeWriter) Close() error {
+	if s.err != nil {
+		return s.err
+	}
+	if len(s.buf) > 0 || len(s.shards) > 0 {
+		return errTruncatedStripe
+	}
+	return nil
+}
+
+// StripeReader is an io.Reader over the decoded data of a stream of encoded
+// stripes read from r.
+type StripeReader struct {
+	r    io.Reader
+	n, k int
+	buf  bytes.Buffer
+	err  error
+}
+
+func NewStripeReader(r io.Reader, n int, k int) *StripeReader {
+	return &StripeReader{r: r, n: n, k: k}
+}
+
+func (s *StripeReader) Read(p []byte) (int, error) {
+	for s.buf.Len() == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		s.err = s.readStripe()
+	}
+	return s.buf.Read(p)
+}
+
+// readStripe decodes the next stripe of the stream into buf, or returns
+// io.EOF at the end of the stream.
+func (s *StripeReader) readStripe() error {
+	shards := make([][]byte, s.n)
+	var header [shardHeaderSize]byte
+	for i := range shards {
+		_, err := io.ReadFull(s.r, header[:])
+		if err == io.EOF && i == 0 {
+			return io.EOF
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return errTruncatedStripe
+		}
+		if err != nil {
+			return err
+		}
+		size := binary.BigEndian.Uint32(header[:])
+		if size == 0 {
+			continue
+		}
+		shards[i] = make([]byte, size)
+		_, err = io.ReadFull(s.r, shards[i])
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return errTruncatedStripe
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return DecodeTo(&s.buf, s.n, s.k, shards)
+}
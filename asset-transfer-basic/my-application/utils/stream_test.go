@@ -0,0 +1,150 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+)
+
+func encodeRandomStripe(t *testing.T) ([]byte, [][]byte) {
+	data := make([]byte, StripeSize)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("failed to generate data: %v", err)
+	}
+	shards, err := Encode(N, K, data)
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	return data, shards
+}
+
+func TestDecodeToSkipsReconstructionWithDataShards(t *testing.T) {
+	data, shards := encodeRandomStripe(t)
+	for i := K; i < N; i++ {
+		shards[i] = nil
+	}
+
+	var out bytes.Buffer
+	if err := DecodeTo(&out, N, K, shards); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Fatalf("decoded data differs")
+	}
+	for i := K; i < N; i++ {
+		if shards[i] != nil {
+			t.Fatalf("parity shard %d was reconstructed", i)
+		}
+	}
+}
+
+func TestDecodeToReconstructsMissingDataShard(t *testing.T) {
+	data, shards := encodeRandomStripe(t)
+	shards[0] = nil
+	shards[N-1] = nil
+
+	var out bytes.Buffer
+	if err := DecodeTo(&out, N, K, shards); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Fatalf("decoded data differs")
+	}
+}
+
+func TestDecodeToFailsWithTooFewShards(t *testing.T) {
+	_, shards := encodeRandomStripe(t)
+	for i := 0; i <= N-K; i++ {
+		shards[i] = nil
+	}
+	if err := DecodeTo(io.Discard, N, K, shards); err == nil {
+		t.Fatalf("expected decode to fail")
+	}
+}
+
+// encodeRandomStream encodes three stripes into the stream format, with the
+// shards chosen by drop missing, and returns their data.
+func encodeRandomStream(t *testing.T, drop func(stripe int, shards [][]byte)) ([]byte, []byte) {
+	var want, stream []byte
+	for i := 0; i < 3; i++ {
+		data, shards := encodeRandomStripe(t)
+		drop(i, shards)
+		want = append(want, data...)
+		stream = AppendStripe(stream, shards)
+	}
+	return want, stream
+}
+
+// writeStream writes stream to a StripeWriter in pieces that split shards and
+// their headers.
+func writeStream(t *testing.T, stream []byte) []byte {
+	var out bytes.Buffer
+	w := NewStripeWriter(&out, N, K)
+	for len(stream) > 0 {
+		size := min(len(stream), 1001)
+		if _, err := w.Write(stream[:size]); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		stream = stream[size:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	return out.Bytes()
+}
+
+func TestStripeStreamSkipsReconstructionWithDataShards(t *testing.T) {
+	// Parity shards of the wrong size would fail a reconstruction
+	want, stream := encodeRandomStream(t, func(stripe int, shards [][]byte) {
+		shards[K] = nil
+		for i := K + 1; i < N; i++ {
+			shards[i] = []byte{1}
+		}
+	})
+
+	got, err := io.ReadAll(NewStripeReader(bytes.NewReader(stream), N, K))
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("stripe reader returned different data")
+	}
+	if !bytes.Equal(writeStream(t, stream), want) {
+		t.Fatalf("stripe writer wrote different data")
+	}
+}
+
+func TestStripeStreamReconstructsMissingDataShards(t *testing.T) {
+	want, stream := encodeRandomStream(t, func(stripe int, shards [][]byte) {
+		shards[stripe] = nil
+		shards[N-1] = nil
+	})
+
+	got, err := io.ReadAll(NewStripeReader(bytes.NewReader(stream), N, K))
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("stripe reader returned different data")
+	}
+	if !bytes.Equal(writeStream(t, stream), want) {
+		t.Fatalf("stripe writer wrote different data")
+	}
+}
+
+func TestStripeStreamFailsOnTruncatedStripe(t *testing.T) {
+	_, stream := encodeRandomStream(t, func(int, [][]byte) {})
+	stream = stream[:len(stream)-1]
+
+	if _, err := io.ReadAll(NewStripeReader(bytes.NewReader(stream), N, K)); err != errTruncatedStripe {
+		t.Fatalf("expected a truncated stripe from the reader, got %v", err)
+	}
+	w := NewStripeWriter(io.Discard, N, K)
+	if _, err := w.Write(stream); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if err := w.Close(); err != errTruncatedStripe {
+		t.Fatalf("expected a truncated stripe from the writer, got %v", err)
+	}
+}
@@ -16,6 +16,10 @@ func main() {
 		TLSCertPath:  cryptoPath + "/peers/peer0.org1.example.com/tls/ca.crt",
 		PeerEndpoint: "localhost:7051",
 		GatewayPeer:  "peer0.org1.example.com",
+		// The storage system of my-application, served under /files
+		ChannelID:         "mychannel",
+		ChaincodeID:       "basic",
+		FilePartitionAddr: "localhost:50051",
 	}
 
 	orgSetup, err := web.Initialize(orgConfig)
@@ -0,0 +1,5 @@
+// Package messages is the gRPC client of the file partition service,
+// generated from the proto of my-application so the two cannot drift apart.
+package messages
+
+//go:generate protoc -I ../../my-application/protos --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative file_partition.proto
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"net/http"
 
+	pb "rest-api-go/protos"
+
 	"github.com/hyperledger/fabric-gateway/pkg/client"
 )
 
@@ -18,12 +20,38 @@ type OrgSetup struct {
 	PeerEndpoint string
 	GatewayPeer  string
 	Gateway      client.Gateway
+	// ChannelID and ChaincodeID name the storage chaincode the /files
+	// endpoints query, FilePartitionAddr the file partition service storing
+	// and reading the files.
+	ChannelID         string
+	ChaincodeID       string
+	FilePartitionAddr string
+	FilePartition     pb.FilePartitionClient
+	// storage replaces the storage chaincode in tests.
+	storage evaluator
+}
+
+// evaluator evaluates transactions of a chaincode, like client.Contract.
+type evaluator interface {
+	EvaluateTransaction(name string, args ...string) ([]byte, error)
+}
+
+// storageContract returns the storage chaincode of the /files endpoints.
+func (setup OrgSetup) storageContract() evaluator {
+	if setup.storage != nil {
+		return setup.storage
+	}
+	return setup.Gateway.GetNetwork(setup.ChannelID).GetContract(setup.ChaincodeID)
 }
 
 // Serve starts http web server.
 func Serve(setups OrgSetup) {
 	http.HandleFunc("/query", setups.Query)
 	http.HandleFunc("/invoke", setups.Invoke)
+	if setups.FilePartition != nil {
+		http.HandleFunc("/files", setups.Files)
+		http.HandleFunc("/files/", setups.File)
+	}
 	fmt.Println("Listening (http://localhost:3000/)...")
 	if err := http.ListenAndServe(":3000", nil); err != nil {
 		fmt.Println(err)
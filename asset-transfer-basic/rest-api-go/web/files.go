@@ -0,0 +1,302 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "rest-api-go/protos"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxFileSize is the largest file accepted, the largest message the file
+// partition service receives.
+const maxFileSize = 1024 * 1024 * 1024
+
+// readBlockSize is the largest number of bytes fetched by one ReadFile call.
+const readBlockSize = 4 * 1024 * 1024
+
+// fileMetadata is the metadata the storage chaincode keeps next to a file.
+type fileMetadata struct {
+	FileHash    string   `json:"fileHash"`
+	Owner       string   `json:"owner"`
+	Size        int64    `json:"size"`
+	CreatedAt   string   `json:"createdAt"`
+	Tags        []string `json:"tags"`
+	ContentType string   `json:"contentType"`
+}
+
+// writeJSON writes v as the JSON body of the response.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		status = http.StatusInternalServerError
+		body = []byte(`{"error":"failed to marshal response"}`)
+	}
+	writeJSONBody(w, status, body)
+}
+
+func writeJSONBody(w http.ResponseWriter, status int, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	log.Printf("Error: %s", err)
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// chaincodeStatus maps an error of the storage chaincode to an HTTP status.
+func chaincodeStatus(err error) int {
+	if strings.Contains(err.Error(), "does not exist") {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// Files handles /files: a multipart POST stores the file of its "file" field
+// and a GET lists the stored files a page at a time.
+func (setup OrgSetup) Files(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		setup.uploadFile(w, r)
+	case http.MethodGet:
+		setup.listFiles(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+// File handles /files/{hash}: GET and HEAD read the file, with Range
+// support, and DELETE removes it.
+func (setup OrgSetup) File(w http.ResponseWriter, r *http.Request) {
+	fileHash := strings.TrimPrefix(r.URL.Path, "/files/")
+	if fileHash == "" || strings.Contains(fileHash, "/") {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no file at %s", r.URL.Path))
+		return
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		setup.downloadFile(w, r, fileHash)
+	case http.MethodDelete:
+		setup.deleteFile(w, r, fileHash)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+// uploadFile hands the file to the file partition service. The service
+// stores its chunks and file tree in the background, so the file can be read
+// once its tree is committed.
+func (setup OrgSetup) uploadFile(w http.ResponseWriter, r *http.Request) {
+	log.Println("Received file upload request")
+	r.Body = http.MaxBytesReader(w, r.Body, maxFileSize+1024*1024)
+	if err := r.ParseMultipartForm(32 * 1024 * 1024); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("failed to parse multipart form: %w", err))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	part, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("missing file field: %w", err))
+		return
+	}
+	defer part.Close()
+	if header.Size > maxFileSize {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("file of %d bytes is larger than %d bytes", header.Size, maxFileSize))
+		return
+	}
+	data, err := io.ReadAll(part)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to read file: %w", err))
+		return
+	}
+
+	// The service detects the content type when none is given
+	contentType := r.FormValue("contentType")
+	if contentType == "" && header.Header.Get("Content-Type") != "application/octet-stream" {
+		contentType = header.Header.Get("Content-Type")
+	}
+	response, err := setup.FilePartition.PartitionFile(r.Context(), &pb.FilePartitionRequest{
+		Data:        data,
+		Tags:        r.MultipartForm.Value["tags"],
+		ContentType: contentType,
+		Codec:       r.FormValue("codec"),
+		RetainUntil: r.FormValue("retainUntil"),
+		ExpireAt:    r.FormValue("expireAt"),
+	})
+	if err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Errorf("failed to store file: %w", err))
+		return
+	}
+
+	fileHash := response.GetStatus()
+	w.Header().Set("ETag", `"`+fileHash+`"`)
+	w.Header().Set("Location", "/files/"+fileHash)
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{"fileHash": fileHash, "size": len(data)})
+}
+
+// listFiles returns a page of file metadata as the chaincode does, restricted
+// to the owner or tag given.
+func (setup OrgSetup) listFiles(w http.ResponseWriter, r *http.Request) {
+	log.Println("Received file list request")
+	query := r.URL.Query()
+	pageSize := query.Get("pageSize")
+	if pageSize == "" {
+		pageSize = "100"
+	}
+	if _, err := strconv.Atoi(pageSize); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid pageSize %q", pageSize))
+		return
+	}
+	bookmark := query.Get("bookmark")
+
+	var function string
+	var args []string
+	switch owner, tag := query.Get("owner"), query.Get("tag"); {
+	case owner != "" && tag != "":
+		writeError(w, http.StatusBadRequest, errors.New("owner and tag cannot be combined"))
+		return
+	case owner != "":
+		function, args = "QueryFilesByOwner", []string{owner, pageSize, bookmark}
+	case tag != "":
+		function, args = "QueryFilesByTag", []string{tag, pageSize, bookmark}
+	default:
+		function, args = "ListFiles", []string{pageSize, bookmark}
+	}
+	page, err := setup.storageContract().EvaluateTransaction(function, args...)
+	if err != nil {
+		writeError(w, chaincodeStatus(err), fmt.Errorf("failed to list files: %w", err))
+		return
+	}
+	writeJSONBody(w, http.StatusOK, page)
+}
+
+// downloadFile serves a file like http.ServeContent, which handles Range,
+// HEAD and conditional requests. The content is read through the file
+// partition service, a block at a time.
+func (setup OrgSetup) downloadFile(w http.ResponseWriter, r *http.Request, fileHash string) {
+	log.Printf("Received file download request: %s", fileHash)
+	metadataJSON, err := setup.storageContract().EvaluateTransaction("GetFileMetadata", fileHash)
+	if err != nil {
+		writeError(w, chaincodeStatus(err), fmt.Errorf("failed to get file metadata: %w", err))
+		return
+	}
+	var metadata fileMetadata
+	if err := json.Unmarshal(metadataJSON, &metadata); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to unmarshal file metadata: %w", err))
+		return
+	}
+
+	w.Header().Set("ETag", `"`+metadata.FileHash+`"`)
+	// ServeContent sniffs the type of files stored without one
+	if metadata.ContentType != "" {
+		w.Header().Set("Content-Type", metadata.ContentType)
+	}
+	modified, _ := time.Parse(time.RFC3339, metadata.CreatedAt)
+	content := &fileReader{ctx: r.Context(), client: setup.FilePartition, fileHash: metadata.FileHash, size: metadata.Size}
+	http.ServeContent(w, r, "", modified, content)
+	if content.err != nil {
+		log.Printf("Error reading file %s: %s", fileHash, content.err)
+	}
+}
+
+func (setup OrgSetup) deleteFile(w http.ResponseWriter, r *http.Request, fileHash string) {
+	log.Printf("Received file delete request: %s", fileHash)
+	_, err := setup.FilePartition.DeleteFile(r.Context(), &pb.FileDeletionRequest{Hash: fileHash})
+	if status.Code(err) == codes.NotFound {
+		writeError(w, http.StatusNotFound, fmt.Errorf("file %s does not exist", fileHash))
+		return
+	}
+	// Retained and held files stay until their retention ends or holds are released
+	if status.Code(err) == codes.FailedPrecondition {
+		writeError(w, http.StatusConflict, errors.New(status.Convert(err).Message()))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Errorf("failed to delete file: %w", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"fileHash": fileHash})
+}
+
+// fileReader is an io.ReadSeeker over a stored file. The blocks fetched by
+// ReadFile double after every read up to readBlockSize, so short ranges are
+// read in a single small call and long ones in few calls.
+type fileReader struct {
+	ctx      context.Context
+	client   pb.FilePartitionClient
+	fileHash string
+	size     int64
+	offset   int64
+	block    int64
+	buf      []byte
+	err      error
+}
+
+func (f *fileReader) Read(p []byte) (int, error) {
+	if f.offset >= f.size {
+		return 0, io.EOF
+	}
+	if len(f.buf) == 0 {
+		f.block *= 2
+		if f.block < int64(len(p)) {
+			f.block = int64(len(p))
+		}
+		if f.block > readBlockSize {
+			f.block = readBlockSize
+		}
+		length := f.size - f.offset
+		if length > f.block {
+			length = f.block
+		}
+		response, err := f.client.ReadFile(f.ctx, &pb.FileRequest{Hash: f.fileHash, Offset: f.offset, Length: length})
+		if err != nil {
+			f.err = err
+			return 0, err
+		}
+		if len(response.GetData()) == 0 {
+			f.err = io.ErrUnexpectedEOF
+			return 0, f.err
+		}
+		f.buf = response.GetData()
+	}
+	n := copy(p, f.buf)
+	f.buf = f.buf[n:]
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *fileReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	if offset != f.offset {
+		f.buf = nil
+		f.block = 0
+	}
+	f.offset = offset
+	return offset, nil
+}
@@ -0,0 +1,290 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"reflect"
+	"strings"
+	"testing"
+
+	pb "rest-api-go/protos"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakePartition stores files in memory like the file partition service,
+// under the SHA-256 of their content, and records the requests.
+type fakePartition struct {
+	pb.FilePartitionClient
+	files    map[string]*pb.FilePartitionRequest
+	retained map[string]bool
+	reads    []*pb.FileRequest
+	err      error
+}
+
+func newFakePartition() *fakePartition {
+	return &fakePartition{files: make(map[string]*pb.FilePartitionRequest), retained: make(map[string]bool)}
+}
+
+func (f *fakePartition) PartitionFile(ctx context.Context, in *pb.FilePartitionRequest, opts ...grpc.CallOption) (*pb.FilePartitionResponse, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	sum := sha256.Sum256(in.Data)
+	fileHash := hex.EncodeToString(sum[:])
+	f.files[fileHash] = in
+	return &pb.FilePartitionResponse{Status: fileHash}, nil
+}
+
+func (f *fakePartition) ReadFile(ctx context.Context, in *pb.FileRequest, opts ...grpc.CallOption) (*pb.FileResponse, error) {
+	f.reads = append(f.reads, in)
+	file, ok := f.files[in.Hash]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "file %s does not exist", in.Hash)
+	}
+	end := in.Offset + in.Length
+	if end > int64(len(file.Data)) {
+		end = int64(len(file.Data))
+	}
+	return &pb.FileResponse{Data: file.Data[in.Offset:end]}, nil
+}
+
+func (f *fakePartition) DeleteFile(ctx context.Context, in *pb.FileDeletionRequest, opts ...grpc.CallOption) (*pb.FileDeletionResponse, error) {
+	if _, ok := f.files[in.Hash]; !ok {
+		return nil, status.Errorf(codes.NotFound, "file %s does not exist", in.Hash)
+	}
+	if f.retained[in.Hash] {
+		return nil, status.Errorf(codes.FailedPrecondition, "file %s is retained until 2030-01-01T00:00:00Z", in.Hash)
+	}
+	delete(f.files, in.Hash)
+	return &pb.FileDeletionResponse{}, nil
+}
+
+// fakeStorage answers the queries of the storage chaincode from the files of
+// a fakePartition and records them.
+type fakeStorage struct {
+	partition *fakePartition
+	calls     [][]string
+}
+
+func (s *fakeStorage) EvaluateTransaction(name string, args ...string) ([]byte, error) {
+	s.calls = append(s.calls, append([]string{name}, args...))
+	switch name {
+	case "GetFileMetadata":
+		file, ok := s.partition.files[args[0]]
+		if !ok {
+			return nil, fmt.Errorf("the file %s does not exist", args[0])
+		}
+		return json.Marshal(fileMetadata{
+			FileHash:    args[0],
+			Owner:       "Org1MSP",
+			Size:        int64(len(file.Data)),
+			CreatedAt:   "2023-05-01T12:00:00Z",
+			Tags:        file.Tags,
+			ContentType: file.ContentType,
+		})
+	case "ListFiles", "QueryFilesByOwner", "QueryFilesByTag":
+		return []byte(`{"records":[],"fetchedRecordsCount":0,"bookmark":""}`), nil
+	}
+	return nil, fmt.Errorf("unexpected transaction %s", name)
+}
+
+func newTestSetup() (OrgSetup, *fakePartition, *fakeStorage) {
+	partition := newFakePartition()
+	storage := &fakeStorage{partition: partition}
+	return OrgSetup{FilePartition: partition, storage: storage}, partition, storage
+}
+
+// upload posts content as the file field of a multipart form, with the
+// fields given.
+func upload(setup OrgSetup, content string, fields map[string][]string) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, values := range fields {
+		for _, value := range values {
+			form.WriteField(name, value)
+		}
+	}
+	if content != "" {
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", `form-data; name="file"; filename="hello.txt"`)
+		header.Set("Content-Type", "text/plain")
+		part, _ := form.CreatePart(header)
+		part.Write([]byte(content))
+	}
+	form.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/files", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	setup.Files(w, r)
+	return w
+}
+
+func request(handler http.HandlerFunc, method string, target string, header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestUploadFile(t *testing.T) {
+	setup, partition, _ := newTestSetup()
+
+	w := upload(setup, "hello, world", map[string][]string{"tags": {"a", "b"}, "codec": {"rep-3"}, "expireAt": {"2030-01-01T00:00:00Z"}})
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("upload returned %d: %s", w.Code, w.Body)
+	}
+	var response struct {
+		FileHash string `json:"fileHash"`
+		Size     int    `json:"size"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Size != 12 || w.Header().Get("Location") != "/files/"+response.FileHash || w.Header().Get("ETag") != `"`+response.FileHash+`"` {
+		t.Errorf("unexpected response %+v with headers %v", response, w.Header())
+	}
+	stored := partition.files[response.FileHash]
+	if stored == nil {
+		t.Fatalf("file %s was not stored", response.FileHash)
+	}
+	if string(stored.Data) != "hello, world" || !reflect.DeepEqual(stored.Tags, []string{"a", "b"}) ||
+		stored.ContentType != "text/plain" || stored.Codec != "rep-3" || stored.ExpireAt != "2030-01-01T00:00:00Z" {
+		t.Errorf("unexpected request %+v", stored)
+	}
+
+	if w := upload(setup, "", map[string][]string{"tags": {"a"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("upload without a file returned %d", w.Code)
+	}
+	partition.err = status.Error(codes.Unavailable, "no storage nodes")
+	if w := upload(setup, "hello", nil); w.Code != http.StatusBadGateway {
+		t.Errorf("failed upload returned %d", w.Code)
+	}
+	if w := request(setup.Files, http.MethodPut, "/files", nil); w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "GET, POST" {
+		t.Errorf("PUT returned %d with headers %v", w.Code, w.Header())
+	}
+}
+
+func TestDownloadFile(t *testing.T) {
+	setup, partition, _ := newTestSetup()
+	content := "0123456789abcdef"
+	var response struct {
+		FileHash string `json:"fileHash"`
+	}
+	json.Unmarshal(upload(setup, content, nil).Body.Bytes(), &response)
+
+	w := request(setup.File, http.MethodGet, "/files/"+response.FileHash, nil)
+	if w.Code != http.StatusOK || w.Body.String() != content || w.Header().Get("Content-Type") != "text/plain" {
+		t.Errorf("GET returned %d %q with headers %v", w.Code, w.Body, w.Header())
+	}
+
+	// A range is read in one call of its own length
+	partition.reads = nil
+	w = request(setup.File, http.MethodGet, "/files/"+response.FileHash, http.Header{"Range": {"bytes=2-5"}})
+	if w.Code != http.StatusPartialContent || w.Body.String() != "2345" || w.Header().Get("Content-Range") != "bytes 2-5/16" {
+		t.Errorf("range GET returned %d %q with headers %v", w.Code, w.Body, w.Header())
+	}
+	if !reflect.DeepEqual(partition.reads, []*pb.FileRequest{{Hash: response.FileHash, Offset: 2, Length: 4}}) {
+		t.Errorf("unexpected reads %v", partition.reads)
+	}
+
+	w = request(setup.File, http.MethodGet, "/files/"+response.FileHash, http.Header{"If-None-Match": {`"` + response.FileHash + `"`}})
+	if w.Code != http.StatusNotModified {
+		t.Errorf("conditional GET returned %d", w.Code)
+	}
+	w = request(setup.File, http.MethodHead, "/files/"+response.FileHash, nil)
+	if w.Code != http.StatusOK || w.Body.Len() != 0 || w.Header().Get("Content-Length") != "16" {
+		t.Errorf("HEAD returned %d %q with headers %v", w.Code, w.Body, w.Header())
+	}
+	if w := request(setup.File, http.MethodGet, "/files/"+strings.Repeat("0", 64), nil); w.Code != http.StatusNotFound {
+		t.Errorf("GET of a missing file returned %d", w.Code)
+	}
+	if w := request(setup.File, http.MethodGet, "/files/a/b", nil); w.Code != http.StatusNotFound {
+		t.Errorf("GET of a nested path returned %d", w.Code)
+	}
+
+	// The type of a file stored without one is sniffed
+	partition.files["html"] = &pb.FilePartitionRequest{Data: []byte("<html><body>hello</body></html>")}
+	w = request(setup.File, http.MethodGet, "/files/html", nil)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Errorf("GET of a file without a type returned %d with headers %v", w.Code, w.Header())
+	}
+}
+
+func TestDeleteFile(t *testing.T) {
+	setup, partition, _ := newTestSetup()
+	var response struct {
+		FileHash string `json:"fileHash"`
+	}
+	json.Unmarshal(upload(setup, "hello", nil).Body.Bytes(), &response)
+
+	// Retained files stay
+	partition.retained[response.FileHash] = true
+	w := request(setup.File, http.MethodDelete, "/files/"+response.FileHash, nil)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "is retained until") {
+		t.Errorf("DELETE of a retained file returned %d %q", w.Code, w.Body)
+	}
+
+	partition.retained[response.FileHash] = false
+	if w := request(setup.File, http.MethodDelete, "/files/"+response.FileHash, nil); w.Code != http.StatusOK {
+		t.Errorf("DELETE returned %d %q", w.Code, w.Body)
+	}
+	if _, ok := partition.files[response.FileHash]; ok {
+		t.Errorf("file %s was not deleted", response.FileHash)
+	}
+	if w := request(setup.File, http.MethodDelete, "/files/"+response.FileHash, nil); w.Code != http.StatusNotFound {
+		t.Errorf("second DELETE returned %d", w.Code)
+	}
+
+	partition.files[response.FileHash] = &pb.FilePartitionRequest{}
+	setup.FilePartition = &failingDelete{partition}
+	if w := request(setup.File, http.MethodDelete, "/files/"+response.FileHash, nil); w.Code != http.StatusBadGateway {
+		t.Errorf("failed DELETE returned %d", w.Code)
+	}
+}
+
+// failingDelete fails every deletion as an unreachable service does.
+type failingDelete struct {
+	*fakePartition
+}
+
+func (f *failingDelete) DeleteFile(ctx context.Context, in *pb.FileDeletionRequest, opts ...grpc.CallOption) (*pb.FileDeletionResponse, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestListFiles(t *testing.T) {
+	setup, _, storage := newTestSetup()
+
+	w := request(setup.Files, http.MethodGet, "/files", nil)
+	if w.Code != http.StatusOK || w.Body.String() != `{"records":[],"fetchedRecordsCount":0,"bookmark":""}` {
+		t.Errorf("list returned %d %q", w.Code, w.Body)
+	}
+	request(setup.Files, http.MethodGet, "/files?owner=Org1MSP&pageSize=10&bookmark=b", nil)
+	request(setup.Files, http.MethodGet, "/files?tag=a", nil)
+	expected := [][]string{{"ListFiles", "100", ""}, {"QueryFilesByOwner", "Org1MSP", "10", "b"}, {"QueryFilesByTag", "a", "100", ""}}
+	if !reflect.DeepEqual(storage.calls, expected) {
+		t.Errorf("unexpected queries %v", storage.calls)
+	}
+
+	if w := request(setup.Files, http.MethodGet, "/files?owner=Org1MSP&tag=a", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("list by owner and tag returned %d", w.Code)
+	}
+	if w := request(setup.Files, http.MethodGet, "/files?pageSize=ten", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("list with an invalid page size returned %d", w.Code)
+	}
+}
@@ -8,10 +8,13 @@ import (
 	"path"
 	"time"
 
+	pb "rest-api-go/protos"
+
 	"github.com/hyperledger/fabric-gateway/pkg/client"
 	"github.com/hyperledger/fabric-gateway/pkg/identity"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
 // Initialize the setup for the organization.
@@ -34,6 +37,9 @@ func Initialize(setup OrgSetup) (*OrgSetup, error) {
 		panic(err)
 	}
 	setup.Gateway = *gateway
+	if setup.FilePartitionAddr != "" {
+		setup.FilePartition = setup.newFilePartitionClient()
+	}
 	log.Println("Initialization complete")
 	return &setup, nil
 }
@@ -57,6 +63,23 @@ func (setup OrgSetup) newGrpcConnection() *grpc.ClientConn {
 	return connection
 }
 
+// newFilePartitionClient connects to the file partition service, allowing
+// messages as large as the files it stores.
+func (setup OrgSetup) newFilePartitionClient() pb.FilePartitionClient {
+	connection, err := grpc.Dial(setup.FilePartitionAddr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(
+			grpc.MaxCallSendMsgSize(maxFileSize+1024*1024),
+			grpc.MaxCallRecvMsgSize(readBlockSize+1024*1024),
+		),
+	)
+	if err != nil {
+		panic(fmt.Errorf("failed to create gRPC connection to the file partition service: %w", err))
+	}
+
+	return pb.NewFilePartitionClient(connection)
+}
+
 // newIdentity creates a client identity for this Gateway connection using an X.509 certificate.
 func (setup OrgSetup) newIdentity() *identity.X509Identity {
 	certificate, err := loadCertificate(setup.CertPath)